@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNoAPITokenError = errors.New("API token does not exist")
+
+// apiTokenTouchInterval spares a write on every request, last used times
+// only need to be about right
+const apiTokenTouchInterval = time.Minute
+
+const apiTokenColumns = "id, user_id, name, token_prefix, scopes, folder_id, expires_at, last_used_at, created_at"
+
+func CreateAPIToken(ctx context.Context, pool *pgxpool.Pool, token *models.APIToken, tokenHash string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	var count int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM api_tokens WHERE user_id = $1 AND name = $2", token.UserID, token.Name).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check for duplicate API token name", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("API token name already exists")
+	}
+
+	now := time.Now()
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scopes, folder_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		token.UserID, token.Name, tokenHash, token.Prefix, strings.Join(token.Scopes, " "), token.FolderID, token.ExpiresAt, now,
+	).Scan(&token.ID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to insert API token", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	token.LastUsedAt = nil
+	token.CreatedAt = now
+
+	return nil
+}
+
+func GetAPIToken(ctx context.Context, pool *pgxpool.Pool, tokenID int64) (*models.APIToken, error) {
+	token, err := scanAPIToken(pool.QueryRow(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens WHERE id = $1", tokenID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("API token with ID %d does not exist: %w", tokenID, ErrNoAPITokenError)
+		}
+		return nil, fmt.Errorf("%w: failed to get API token", ErrDatabaseError)
+	}
+
+	return token, nil
+}
+
+func GetAPITokenByHash(ctx context.Context, pool *pgxpool.Pool, tokenHash string) (*models.APIToken, error) {
+	query := "SELECT " + apiTokenColumns + " FROM api_tokens WHERE token_hash = $1 AND expires_at > $2"
+
+	token, err := scanAPIToken(pool.QueryRow(ctx, query, tokenHash, time.Now()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoAPITokenError
+		}
+		return nil, fmt.Errorf("%w: failed to get API token", ErrDatabaseError)
+	}
+
+	return token, nil
+}
+
+func GetAPITokens(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.APIToken, error) {
+	rows, err := pool.Query(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens WHERE user_id = $1 ORDER BY created_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get API tokens", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan API token data", ErrDatabaseError)
+		}
+		tokens = append(tokens, *token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate API tokens", ErrDatabaseError)
+	}
+
+	return tokens, nil
+}
+
+func TouchAPIToken(ctx context.Context, pool *pgxpool.Pool, tokenID int64, usedAt time.Time) error {
+	_, err := pool.Exec(ctx, `
+		UPDATE api_tokens SET last_used_at = $1
+		WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)`,
+		usedAt, tokenID, usedAt.Add(-apiTokenTouchInterval),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update API token", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func DeleteAPIToken(ctx context.Context, pool *pgxpool.Pool, tokenID int64) error {
+	result, err := pool.Exec(ctx, "DELETE FROM api_tokens WHERE id = $1", tokenID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete API token", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("API token with ID %d does not exist: %w", tokenID, ErrNoAPITokenError)
+	}
+
+	return nil
+}
+
+func scanAPIToken(row pgx.Row) (*models.APIToken, error) {
+	var token models.APIToken
+	var scopes string
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&scopes,
+		&token.FolderID,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = strings.Fields(scopes)
+	return &token, nil
+}
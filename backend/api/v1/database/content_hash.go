@@ -0,0 +1,35 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// DuplicateContentError is returned by CreateUniqueSnippet and
+// UpdateUniqueSnippet when other live snippets of the user already hold the
+// same content
+type DuplicateContentError struct {
+	// IDs lists those snippets, oldest first
+	IDs []int64
+}
+
+func (e *DuplicateContentError) Error() string {
+	return fmt.Sprintf("content already saved in %d snippets", len(e.IDs))
+}
+
+// contentHash fingerprints snippet content for the duplicate check. Line
+// endings, trailing whitespace and blank lines at either end are ignored, so
+// the same code pasted from another editor still matches, but indentation and
+// everything else counts.
+func contentHash(content string) string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	normalized := strings.Trim(strings.Join(lines, "\n"), "\n")
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/GHutch55/fragments/backend/api/v1/models"
@@ -45,7 +48,7 @@ func CreateFolder(ctx context.Context, pool *pgxpool.Pool, folder *models.Folder
 
 	if folder.ParentID != nil {
 		var parentUserID int64
-		err = tx.QueryRow(ctx, "SELECT user_id FROM folders WHERE id = $1", *folder.ParentID).Scan(&parentUserID)
+		err = tx.QueryRow(ctx, "SELECT user_id FROM folders WHERE id = $1 AND deleted_at IS NULL", *folder.ParentID).Scan(&parentUserID)
 		if err != nil {
 			if errors.Is(err, pgx.ErrNoRows) {
 				return fmt.Errorf("parent folder does not exist")
@@ -57,7 +60,7 @@ func CreateFolder(ctx context.Context, pool *pgxpool.Pool, folder *models.Folder
 			return fmt.Errorf("parent folder does not belong to user")
 		}
 
-		if err := checkCircularReference(ctx, tx, folder.UserID, *folder.ParentID, 0); err != nil {
+		if err := checkCircularReference(ctx, tx, folder.UserID, *folder.ParentID); err != nil {
 			return fmt.Errorf("circular reference detected: %w", err)
 		}
 	}
@@ -67,10 +70,10 @@ func CreateFolder(ctx context.Context, pool *pgxpool.Pool, folder *models.Folder
 	var nameCheckArgs []interface{}
 
 	if folder.ParentID != nil {
-		nameCheckQuery = "SELECT COUNT(*) FROM folders WHERE user_id = $1 AND name = $2 AND parent_id = $3"
+		nameCheckQuery = "SELECT COUNT(*) FROM folders WHERE user_id = $1 AND name = $2 AND parent_id = $3 AND deleted_at IS NULL"
 		nameCheckArgs = []interface{}{folder.UserID, folder.Name, *folder.ParentID}
 	} else {
-		nameCheckQuery = "SELECT COUNT(*) FROM folders WHERE user_id = $1 AND name = $2 AND parent_id IS NULL"
+		nameCheckQuery = "SELECT COUNT(*) FROM folders WHERE user_id = $1 AND name = $2 AND parent_id IS NULL AND deleted_at IS NULL"
 		nameCheckArgs = []interface{}{folder.UserID, folder.Name}
 	}
 
@@ -99,6 +102,10 @@ func CreateFolder(ctx context.Context, pool *pgxpool.Pool, folder *models.Folder
 		return fmt.Errorf("failed to insert folder: %w", err)
 	}
 
+	if err = setFolderPath(ctx, tx, generatedID, folder.ParentID); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -111,10 +118,16 @@ func CreateFolder(ctx context.Context, pool *pgxpool.Pool, folder *models.Folder
 }
 
 func GetFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64) (*models.Folder, error) {
+	return getFolder(ctx, pool, folderID, "deleted_at IS NULL")
+}
+
+// getFolder loads a folder, trashCondition picks whether live or trashed rows
+// are visible
+func getFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64, trashCondition string) (*models.Folder, error) {
 	query := `
 		SELECT id, user_id, name, description, parent_id, created_at, updated_at
 		FROM folders 
-		WHERE id = $1`
+		WHERE id = $1 AND ` + trashCondition
 
 	var folder models.Folder
 	var description *string
@@ -145,7 +158,7 @@ func GetFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64) (*models
 func GetFolders(ctx context.Context, pool *pgxpool.Pool, page, limit int, userID int64, parentID *int64) ([]models.Folder, int, error) {
 	offset := (page - 1) * limit
 
-	whereClause := "WHERE user_id = $1"
+	whereClause := "WHERE user_id = $1 AND deleted_at IS NULL"
 	args := []interface{}{userID}
 
 	argPosition := 2
@@ -209,6 +222,126 @@ func GetFolders(ctx context.Context, pool *pgxpool.Pool, page, limit int, userID
 	return folders, total, nil
 }
 
+// GetFolderTree returns the user's live folders nested under their parents,
+// each with its direct and recursive snippet counts
+func GetFolderTree(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]*models.FolderNode, error) {
+	rows, err := pool.Query(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT id, 0 AS depth
+			FROM folders
+			WHERE user_id = $1 AND parent_id IS NULL AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.id, t.depth + 1
+			FROM folders f
+			JOIN tree t ON f.parent_id = t.id
+			WHERE f.deleted_at IS NULL AND t.depth < 50
+		),
+		subtree AS (
+			SELECT id AS ancestor_id, id AS folder_id FROM tree
+			UNION ALL
+			SELECT s.ancestor_id, f.id
+			FROM subtree s
+			JOIN folders f ON f.parent_id = s.folder_id
+			WHERE f.deleted_at IS NULL
+		),
+		counts AS (
+			SELECT folder_id, COUNT(*) AS snippet_count
+			FROM snippets
+			WHERE user_id = $1 AND folder_id IS NOT NULL AND deleted_at IS NULL
+			GROUP BY folder_id
+		)
+		SELECT f.id, f.user_id, f.name, f.description, f.parent_id, f.created_at, f.updated_at, t.depth,
+			COALESCE(c.snippet_count, 0),
+			(SELECT COALESCE(SUM(sc.snippet_count), 0)::bigint
+			 FROM subtree s
+			 JOIN counts sc ON sc.folder_id = s.folder_id
+			 WHERE s.ancestor_id = f.id)
+		FROM tree t
+		JOIN folders f ON f.id = t.id
+		LEFT JOIN counts c ON c.folder_id = f.id
+		ORDER BY t.depth, f.name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get folder tree", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var nodes []*models.FolderNode
+	for rows.Next() {
+		node := &models.FolderNode{}
+		err := rows.Scan(
+			&node.ID,
+			&node.UserID,
+			&node.Name,
+			&node.Description,
+			&node.ParentID,
+			&node.CreatedAt,
+			&node.UpdatedAt,
+			&node.Depth,
+			&node.SnippetCount,
+			&node.TotalSnippetCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan folder tree", ErrDatabaseError)
+		}
+		nodes = append(nodes, node)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate folder tree", ErrDatabaseError)
+	}
+
+	return buildFolderTree(nodes), nil
+}
+
+// GetFolderPath returns the folder and its ancestors, root first
+func GetFolderPath(ctx context.Context, pool *pgxpool.Pool, folderID int64) ([]models.Folder, error) {
+	rows, err := pool.Query(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, 0 AS depth FROM folders WHERE id = $1 AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.id, f.parent_id, c.depth + 1
+			FROM folders f
+			JOIN chain c ON f.id = c.parent_id
+			WHERE f.deleted_at IS NULL AND c.depth < 50
+		)
+		SELECT f.id, f.user_id, f.name, f.description, f.parent_id, f.created_at, f.updated_at
+		FROM chain c
+		JOIN folders f ON f.id = c.id
+		ORDER BY c.depth DESC`, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get folder path", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var path []models.Folder
+	for rows.Next() {
+		var folder models.Folder
+		err := rows.Scan(
+			&folder.ID,
+			&folder.UserID,
+			&folder.Name,
+			&folder.Description,
+			&folder.ParentID,
+			&folder.CreatedAt,
+			&folder.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan folder path", ErrDatabaseError)
+		}
+		path = append(path, folder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate folder path", ErrDatabaseError)
+	}
+
+	if len(path) == 0 {
+		return nil, ErrNoFolderError
+	}
+
+	return path, nil
+}
+
 func UpdateFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64, folder *models.Folder) error {
 	tx, err := pool.Begin(ctx)
 	if err != nil {
@@ -218,7 +351,7 @@ func UpdateFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64, folde
 
 	var currentUserID int64
 	var currentParentID *int64
-	err = tx.QueryRow(ctx, "SELECT user_id, parent_id FROM folders WHERE id = $1", folderID).Scan(&currentUserID, &currentParentID)
+	err = tx.QueryRow(ctx, "SELECT user_id, parent_id FROM folders WHERE id = $1 AND deleted_at IS NULL", folderID).Scan(&currentUserID, &currentParentID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return fmt.Errorf("folder with ID %d does not exist: %w", folderID, ErrNoFolderError)
@@ -228,7 +361,7 @@ func UpdateFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64, folde
 
 	if folder.ParentID != nil {
 		var parentUserID int64
-		err = tx.QueryRow(ctx, "SELECT user_id FROM folders WHERE id = $1", *folder.ParentID).Scan(&parentUserID)
+		err = tx.QueryRow(ctx, "SELECT user_id FROM folders WHERE id = $1 AND deleted_at IS NULL", *folder.ParentID).Scan(&parentUserID)
 		if err != nil {
 			if errors.Is(err, pgx.ErrNoRows) {
 				return fmt.Errorf("parent folder does not exist")
@@ -250,7 +383,7 @@ func UpdateFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64, folde
 		}
 
 		if needsCircularCheck {
-			if err := checkCircularReferenceForUpdate(ctx, tx, folder.UserID, folderID, *folder.ParentID, 0); err != nil {
+			if err := checkCircularReferenceForUpdate(ctx, tx, folder.UserID, folderID, *folder.ParentID); err != nil {
 				return fmt.Errorf("circular reference detected: %w", err)
 			}
 		}
@@ -261,10 +394,10 @@ func UpdateFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64, folde
 	var nameCheckArgs []interface{}
 
 	if folder.ParentID != nil {
-		nameCheckQuery = "SELECT COUNT(*) FROM folders WHERE user_id = $1 AND name = $2 AND parent_id = $3 AND id != $4"
+		nameCheckQuery = "SELECT COUNT(*) FROM folders WHERE user_id = $1 AND name = $2 AND parent_id = $3 AND id != $4 AND deleted_at IS NULL"
 		nameCheckArgs = []interface{}{folder.UserID, folder.Name, *folder.ParentID, folderID}
 	} else {
-		nameCheckQuery = "SELECT COUNT(*) FROM folders WHERE user_id = $1 AND name = $2 AND parent_id IS NULL AND id != $3"
+		nameCheckQuery = "SELECT COUNT(*) FROM folders WHERE user_id = $1 AND name = $2 AND parent_id IS NULL AND id != $3 AND deleted_at IS NULL"
 		nameCheckArgs = []interface{}{folder.UserID, folder.Name, folderID}
 	}
 
@@ -296,7 +429,7 @@ func UpdateFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64, folde
 	updateQuery := `
 		UPDATE folders 
 		SET name = $1, description = $2, parent_id = $3, updated_at = $4
-		WHERE id = $5`
+		WHERE id = $5 AND deleted_at IS NULL`
 
 	result, err := tx.Exec(ctx, updateQuery,
 		folder.Name,
@@ -314,6 +447,11 @@ func UpdateFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64, folde
 		return fmt.Errorf("folder with ID %d does not exist: %w", folderID, ErrNoFolderError)
 	}
 
+	// Moving a folder moves everything below it
+	if err = setFolderPath(ctx, tx, folderID, folder.ParentID); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return fmt.Errorf("%w: failed to commit update", ErrDatabaseError)
 	}
@@ -325,98 +463,318 @@ func UpdateFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64, folde
 	return nil
 }
 
-func DeleteFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64) error {
+// DeleteFolder moves a folder to the trash. Snippets still in it are moved to
+// the root first, snippets already in the trash keep pointing at it so they
+// can bring it back when restored.
+func DeleteFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64, mode string) (*models.FolderDeleteResult, error) {
 	tx, err := pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+		return nil, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
 	}
 	defer tx.Rollback(ctx)
 
-	var exists bool
-	err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM folders WHERE id = $1)", folderID).Scan(&exists)
+	var userID int64
+	var parentID *int64
+	err = tx.QueryRow(ctx, "SELECT user_id, parent_id FROM folders WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", folderID).Scan(&userID, &parentID)
 	if err != nil {
-		return fmt.Errorf("%w: failed to check folder existence", ErrDatabaseError)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("folder with ID %d does not exist: %w", folderID, ErrNoFolderError)
+		}
+		return nil, fmt.Errorf("%w: failed to check folder existence", ErrDatabaseError)
 	}
 
-	if !exists {
-		return fmt.Errorf("folder with ID %d does not exist: %w", folderID, ErrNoFolderError)
+	path, err := trashPath(ctx, tx, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to record folder path", ErrDatabaseError)
 	}
 
-	var childCount int
-	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM folders WHERE parent_id = $1", folderID).Scan(&childCount)
+	now := time.Now()
+	result := newFolderDeleteResult(mode)
+
+	// Trash the folder before dealing with its contents, so its name is free
+	// for a child that shares it
+	_, err = tx.Exec(ctx, "UPDATE folders SET deleted_at = $1, trash_path = $2 WHERE id = $3", now, path, folderID)
 	if err != nil {
-		return fmt.Errorf("%w: failed to check for child folders", ErrDatabaseError)
+		return nil, fmt.Errorf("%w: failed to delete folder", ErrDatabaseError)
+	}
+
+	switch mode {
+	case models.FolderDeleteRestrict:
+		var childCount int
+		err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM folders WHERE parent_id = $1 AND deleted_at IS NULL", folderID).Scan(&childCount)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to check for child folders", ErrDatabaseError)
+		}
+
+		if childCount > 0 {
+			return nil, fmt.Errorf("folder has %d child folders: %w", childCount, ErrFolderHasChildren)
+		}
+
+		// Move snippets to root
+		result.MovedSnippets, err = moveFolderSnippets(ctx, tx, userID, folderID, nil, now)
+		if err != nil {
+			return nil, err
+		}
+
+	case models.FolderDeleteCascade:
+		result.RemovedFolders, result.RemovedSnippets, err = trashFolderContents(ctx, tx, userID, folderID, path, now)
+		if err != nil {
+			return nil, err
+		}
+
+	case models.FolderDeleteReparent:
+		result.MovedFolders, err = moveChildFolders(ctx, tx, userID, folderID, parentID, now)
+		if err != nil {
+			return nil, err
+		}
+
+		result.MovedSnippets, err = moveFolderSnippets(ctx, tx, userID, folderID, parentID, now)
+		if err != nil {
+			return nil, err
+		}
+		result.MovedTo = parentID
+
+	default:
+		return nil, fmt.Errorf("unknown folder delete mode %q", mode)
 	}
 
-	if childCount > 0 {
-		return fmt.Errorf("folder has %d child folders: %w", childCount, ErrFolderHasChildren)
+	result.RemovedFolders = append([]int64{folderID}, result.RemovedFolders...)
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%w: failed to commit deletion", ErrDatabaseError)
 	}
 
-	var snippetCount int
-	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM snippets WHERE folder_id = $1", folderID).Scan(&snippetCount)
+	return result, nil
+}
+
+// moveFolderSnippets moves userID's live snippets in folderID to newFolderID
+// and returns their IDs
+func moveFolderSnippets(ctx context.Context, tx pgx.Tx, userID, folderID int64, newFolderID *int64, now time.Time) ([]int64, error) {
+	rows, err := tx.Query(ctx, `
+		UPDATE snippets SET folder_id = $1, updated_at = $2
+		WHERE folder_id = $3 AND user_id = $4 AND deleted_at IS NULL
+		RETURNING id`,
+		newFolderID, now, folderID, userID,
+	)
 	if err != nil {
-		return fmt.Errorf("%w: failed to check for snippets in folder", ErrDatabaseError)
+		return nil, fmt.Errorf("%w: failed to move snippets", ErrDatabaseError)
 	}
 
-	// Move snippets to root before deleting folder
-	if snippetCount > 0 {
-		_, err = tx.Exec(ctx, "UPDATE snippets SET folder_id = NULL, updated_at = CURRENT_TIMESTAMP WHERE folder_id = $1", folderID)
-		if err != nil {
-			return fmt.Errorf("%w: failed to move snippets to root", ErrDatabaseError)
-		}
+	moved, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to move snippets", ErrDatabaseError)
 	}
+	slices.Sort(moved)
 
-	result, err := tx.Exec(ctx, "DELETE FROM folders WHERE id = $1", folderID)
+	return moved, nil
+}
+
+// moveChildFolders moves the live subfolders of folderID to newParentID,
+// renaming any whose name is already taken there
+func moveChildFolders(ctx context.Context, tx pgx.Tx, userID, folderID int64, newParentID *int64, now time.Time) ([]models.MovedFolder, error) {
+	rows, err := tx.Query(ctx, "SELECT id, name FROM folders WHERE parent_id = $1 AND deleted_at IS NULL ORDER BY id", folderID)
 	if err != nil {
-		return fmt.Errorf("%w: failed to delete folder", ErrDatabaseError)
+		return nil, fmt.Errorf("%w: failed to get child folders", ErrDatabaseError)
 	}
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("folder with ID %d does not exist: %w", folderID, ErrNoFolderError)
+	var children []models.MovedFolder
+	for rows.Next() {
+		var child models.MovedFolder
+		if err := rows.Scan(&child.ID, &child.Name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%w: failed to scan child folder", ErrDatabaseError)
+		}
+		children = append(children, child)
 	}
+	rows.Close()
 
-	if err = tx.Commit(ctx); err != nil {
-		return fmt.Errorf("%w: failed to commit deletion", ErrDatabaseError)
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate child folders", ErrDatabaseError)
 	}
 
-	return nil
+	moved := []models.MovedFolder{}
+	for _, child := range children {
+		name := child.Name
+		for n := 2; ; n++ {
+			existingID, err := findLiveFolder(ctx, tx, userID, name, newParentID)
+			if err != nil {
+				return nil, err
+			}
+			if existingID == 0 {
+				break
+			}
+			name = folderCopyName(child.Name, n)
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE folders SET parent_id = $1, name = $2, updated_at = $3 WHERE id = $4", newParentID, name, now, child.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to move child folder", ErrDatabaseError)
+		}
+
+		if err = setFolderPath(ctx, tx, child.ID, newParentID); err != nil {
+			return nil, err
+		}
+
+		if name != child.Name {
+			renamedFrom := child.Name
+			child.RenamedFrom = &renamedFrom
+			child.Name = name
+		}
+		moved = append(moved, child)
+	}
+
+	return moved, nil
 }
 
-func checkCircularReference(ctx context.Context, tx pgx.Tx, userID int64, parentID int64, depth int) error {
-	// Prevent infinite recursion
-	if depth > 50 {
-		return fmt.Errorf("maximum folder depth exceeded")
+// trashFolderContents moves every live folder and snippet below folderID to the
+// trash, stamped with the same deleted_at as the folder so restoring the folder
+// brings them back with it. path is the folder's own trash path. Only userID's
+// snippets are touched, whatever else claims to be in their folders.
+func trashFolderContents(ctx context.Context, tx pgx.Tx, userID, folderID int64, path []string, now time.Time) ([]int64, []int64, error) {
+	rows, err := tx.Query(ctx, `
+		WITH RECURSIVE subtree AS (
+			SELECT id, parent_id, name, 0 AS depth FROM folders WHERE id = $1
+			UNION ALL
+			SELECT f.id, f.parent_id, f.name, s.depth + 1
+			FROM folders f
+			JOIN subtree s ON f.parent_id = s.id
+			WHERE f.deleted_at IS NULL AND s.depth < 50
+		)
+		SELECT id, parent_id, name FROM subtree ORDER BY depth, id`, folderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to get folder tree", ErrDatabaseError)
+	}
+
+	// Parents come before their children, so each folder's path can be built
+	// from its parent's
+	paths := map[int64][]string{}
+	var folderIDs []int64
+	var folderPaths [][]string
+	for rows.Next() {
+		var id int64
+		var parentID *int64
+		var name string
+		if err := rows.Scan(&id, &parentID, &name); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("%w: failed to scan folder tree", ErrDatabaseError)
+		}
+
+		if id == folderID {
+			paths[id] = append(slices.Clip(path), name)
+			continue
+		}
+
+		parentPath := paths[*parentID]
+		paths[id] = append(slices.Clip(parentPath), name)
+		folderIDs = append(folderIDs, id)
+		folderPaths = append(folderPaths, parentPath)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to iterate folder tree", ErrDatabaseError)
+	}
+
+	for i, id := range folderIDs {
+		_, err = tx.Exec(ctx, "UPDATE folders SET deleted_at = $1, trash_path = $2 WHERE id = $3", now, folderPaths[i], id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to delete folder", ErrDatabaseError)
+		}
 	}
 
-	var grandParentID *int64
-	err := tx.QueryRow(ctx, "SELECT parent_id FROM folders WHERE id = $1 AND user_id = $2", parentID, userID).Scan(&grandParentID)
+	rows, err = tx.Query(ctx, "SELECT id, folder_id FROM snippets WHERE folder_id = ANY($1) AND user_id = $2 AND deleted_at IS NULL ORDER BY id", append([]int64{folderID}, folderIDs...), userID)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil
+		return nil, nil, fmt.Errorf("%w: failed to get snippets in folder tree", ErrDatabaseError)
+	}
+
+	var snippetIDs []int64
+	var snippetFolders []int64
+	for rows.Next() {
+		var id, snippetFolderID int64
+		if err := rows.Scan(&id, &snippetFolderID); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("%w: failed to scan snippet", ErrDatabaseError)
 		}
-		return fmt.Errorf("failed to check parent folder: %w", err)
+		snippetIDs = append(snippetIDs, id)
+		snippetFolders = append(snippetFolders, snippetFolderID)
 	}
+	rows.Close()
 
-	if grandParentID == nil {
-		return nil
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to iterate snippets", ErrDatabaseError)
+	}
+
+	for i, id := range snippetIDs {
+		_, err = tx.Exec(ctx, "UPDATE snippets SET deleted_at = $1, trash_path = $2 WHERE id = $3", now, paths[snippetFolders[i]], id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to delete snippet", ErrDatabaseError)
+		}
+	}
+
+	if folderIDs == nil {
+		folderIDs = []int64{}
+	}
+	if snippetIDs == nil {
+		snippetIDs = []int64{}
 	}
 
-	return checkCircularReference(ctx, tx, userID, *grandParentID, depth+1)
+	return folderIDs, snippetIDs, nil
 }
 
-func checkCircularReferenceForUpdate(ctx context.Context, tx pgx.Tx, userID int64, folderID int64, newParentID int64, depth int) error {
-	// Prevent infinite recursion
-	if depth > 50 {
-		return fmt.Errorf("maximum folder depth exceeded")
+// buildFolderTree nests nodes under their parents. nodes must list parents
+// before their children, and children keep the order they appear in.
+func buildFolderTree(nodes []*models.FolderNode) []*models.FolderNode {
+	byID := make(map[int64]*models.FolderNode, len(nodes))
+	roots := []*models.FolderNode{}
+	for _, node := range nodes {
+		node.Children = []*models.FolderNode{}
+		byID[node.ID] = node
+
+		if node.ParentID == nil {
+			roots = append(roots, node)
+			continue
+		}
+		if parent, ok := byID[*node.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+	return roots
+}
+
+// newFolderDeleteResult returns an empty result for mode, with every list
+// non-nil so it encodes as []
+func newFolderDeleteResult(mode string) *models.FolderDeleteResult {
+	return &models.FolderDeleteResult{
+		Mode:            mode,
+		RemovedFolders:  []int64{},
+		RemovedSnippets: []int64{},
+		MovedFolders:    []models.MovedFolder{},
+		MovedSnippets:   []int64{},
 	}
+}
+
+// folderCopyName gives the nth name to try for a folder whose name is taken,
+// "name (2)", "name (3)" and so on
+func folderCopyName(name string, n int) string {
+	return fmt.Sprintf("%s (%d)", name, n)
+}
 
+// checkCircularReference checks a new folder can go under parentID without
+// nesting deeper than 50 levels
+func checkCircularReference(ctx context.Context, tx pgx.Tx, userID int64, parentID int64) error {
+	return checkCircularReferenceForUpdate(ctx, tx, userID, 0, parentID)
+}
+
+// checkCircularReferenceForUpdate checks folderID can move under newParentID.
+// The new parent's path lists all of its ancestors, so the folder being one of
+// them shows up without walking the tree.
+func checkCircularReferenceForUpdate(ctx context.Context, tx pgx.Tx, userID int64, folderID int64, newParentID int64) error {
 	if newParentID == folderID {
 		return fmt.Errorf("folder cannot be its own parent")
 	}
 
-	var grandParentID *int64
-	err := tx.QueryRow(ctx, "SELECT parent_id FROM folders WHERE id = $1 AND user_id = $2", newParentID, userID).Scan(&grandParentID)
+	var parentPath string
+	err := tx.QueryRow(ctx, "SELECT path FROM folders WHERE id = $1 AND user_id = $2", newParentID, userID).Scan(&parentPath)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil
@@ -424,13 +782,79 @@ func checkCircularReferenceForUpdate(ctx context.Context, tx pgx.Tx, userID int6
 		return fmt.Errorf("failed to check parent folder: %w", err)
 	}
 
-	if grandParentID == nil {
+	if folderID != 0 && folderPathContains(parentPath, folderID) {
+		return fmt.Errorf("circular reference detected")
+	}
+
+	if folderPathDepth(parentPath) >= 50 {
+		return fmt.Errorf("maximum folder depth exceeded")
+	}
+
+	return nil
+}
+
+// setFolderPath rebuilds folderID's path under parentID and carries the paths
+// of everything below it along. Call it in the same transaction whenever a
+// folder is created or its parent_id changes.
+func setFolderPath(ctx context.Context, tx pgx.Tx, folderID int64, parentID *int64) error {
+	parentPath := "/"
+	if parentID != nil {
+		err := tx.QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", *parentID).Scan(&parentPath)
+		if err != nil {
+			return fmt.Errorf("%w: failed to get parent folder path", ErrDatabaseError)
+		}
+	}
+
+	var oldPath string
+	err := tx.QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", folderID).Scan(&oldPath)
+	if err != nil {
+		return fmt.Errorf("%w: failed to get folder path", ErrDatabaseError)
+	}
+
+	newPath := parentPath + strconv.FormatInt(folderID, 10) + "/"
+	if newPath == oldPath {
 		return nil
 	}
 
-	if *grandParentID == folderID {
-		return fmt.Errorf("circular reference detected")
+	// A folder that was just inserted still has the column default and
+	// nothing below it
+	if oldPath == "/" {
+		_, err = tx.Exec(ctx, "UPDATE folders SET path = $1 WHERE id = $2", newPath, folderID)
+	} else {
+		_, err = tx.Exec(ctx, "UPDATE folders SET path = $1 || substr(path, $2) WHERE path LIKE $3", newPath, len(oldPath)+1, oldPath+"%")
+	}
+	if err != nil {
+		return fmt.Errorf("%w: failed to update folder paths", ErrDatabaseError)
 	}
 
-	return checkCircularReferenceForUpdate(ctx, tx, userID, folderID, *grandParentID, depth+1)
+	return nil
+}
+
+// detachFolderPaths turns the folders directly below folderID into roots
+// before it is purged, matching what ON DELETE SET NULL does to their parent_id
+func detachFolderPaths(ctx context.Context, tx pgx.Tx, folderID int64) error {
+	var path string
+	err := tx.QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", folderID).Scan(&path)
+	if err != nil {
+		return fmt.Errorf("%w: failed to get folder path", ErrDatabaseError)
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE folders SET path = '/' || substr(path, $1) WHERE path LIKE $2 AND id <> $3", len(path)+1, path+"%", folderID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update folder paths", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+// folderPathDepth returns how many levels deep a folder path is, 1 for a
+// folder at the root
+func folderPathDepth(path string) int {
+	return strings.Count(path, "/") - 1
+}
+
+// folderPathContains reports whether a folder path runs through folderID,
+// i.e. the folder is folderID or somewhere below it
+func folderPathContains(path string, folderID int64) bool {
+	return strings.Contains(path, "/"+strconv.FormatInt(folderID, 10)+"/")
 }
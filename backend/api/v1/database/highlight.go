@@ -0,0 +1,318 @@
+package database
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+const (
+	// maxHitLines caps the content line numbers reported for one snippet
+	maxHitLines = 100
+	// maxContentExcerpts is how many matching content lines get an excerpt,
+	// like ts_headline's MaxFragments
+	maxContentExcerpts = 3
+	// excerptLength is the longest excerpt in characters, longer lines are
+	// cut down to a window around the first match
+	excerptLength = 160
+	// excerptLead is how much text is kept before the first match when a
+	// line is cut down
+	excerptLead = 40
+	// maxStemSuffix is how far a word may run past a search word and still
+	// count as the same word, standing in for the stemmer
+	maxStemSuffix = 3
+)
+
+// searchHighlighter finds where the free text of a search matched. Every
+// store runs it on the page of results it returns, so hits look the same
+// whatever the backend.
+type searchHighlighter struct {
+	// literals are matched verbatim ignoring case, as substring search and
+	// phrases do
+	literals [][]rune
+	// words are matched against whole words and identifier parts, as the
+	// full-text index does
+	words []string
+	// prefixes are matched against the start of whole words and identifier
+	// parts, as a prefix term's :* does
+	prefixes []string
+	// stems, when set, are the lowercased words of the page that Postgres's
+	// stemmer matched to words. Without them stemMatches stands in.
+	stems map[string]bool
+}
+
+// highlightSearchHits sets SearchHit on each snippet for the text terms of
+// search. Searches with only operators leave the snippets alone.
+func highlightSearchHits(snippets []models.Snippet, search *SearchQuery, mode string) {
+	include, _ := search.textTerms()
+	if len(include) == 0 {
+		return
+	}
+
+	newSearchHighlighter(include, mode).highlight(snippets)
+}
+
+func (h *searchHighlighter) highlight(snippets []models.Snippet) {
+	for i := range snippets {
+		snippets[i].SearchHit = h.hit(&snippets[i])
+	}
+}
+
+func newSearchHighlighter(terms []SearchTerm, mode string) *searchHighlighter {
+	fullText := mode != SearchModeSubstring
+	substring := mode != SearchModeFullText
+
+	h := &searchHighlighter{}
+	seen := make(map[string]bool)
+	addLiteral := func(text string) {
+		text = strings.ToLower(strings.TrimSpace(text))
+		if text == "" || seen[text] {
+			return
+		}
+		seen[text] = true
+		h.literals = append(h.literals, []rune(text))
+	}
+
+	for _, term := range terms {
+		if substring || term.Phrase {
+			addLiteral(term.Value)
+		}
+		if fullText && !term.Phrase {
+			words := searchTerms(term.Value)
+			if term.Prefix && len(words) > 0 {
+				h.prefixes = append(h.prefixes, words[len(words)-1])
+				words = words[:len(words)-1]
+			}
+			h.words = append(h.words, words...)
+		}
+	}
+
+	return h
+}
+
+// hit reports the fields and content lines of snippet that matched
+func (h *searchHighlighter) hit(snippet *models.Snippet) *models.SearchHit {
+	hit := &models.SearchHit{
+		Fields:   []string{},
+		Lines:    []int{},
+		Excerpts: []models.SearchExcerpt{},
+	}
+
+	addField := func(field, text string, line int) bool {
+		ranges := h.ranges(text)
+		if len(ranges) == 0 {
+			return false
+		}
+		if !slices.Contains(hit.Fields, field) {
+			hit.Fields = append(hit.Fields, field)
+		}
+
+		excerpt, highlights := excerptAround(text, ranges)
+		hit.Excerpts = append(hit.Excerpts, models.SearchExcerpt{
+			Field:      field,
+			Line:       line,
+			Text:       excerpt,
+			Highlights: highlights,
+		})
+		return true
+	}
+
+	addField(models.SearchFieldTitle, snippet.Title, 0)
+	if snippet.Description != nil {
+		addField(models.SearchFieldDescription, *snippet.Description, 0)
+	}
+
+	contentExcerpts := 0
+	for i, line := range strings.Split(snippet.Content, "\n") {
+		if len(hit.Lines) >= maxHitLines {
+			break
+		}
+
+		line = strings.TrimSuffix(line, "\r")
+		if contentExcerpts >= maxContentExcerpts {
+			// Only the line number is needed from here on
+			if len(h.ranges(line)) > 0 {
+				hit.Lines = append(hit.Lines, i+1)
+			}
+			continue
+		}
+
+		if addField(models.SearchFieldContent, line, i+1) {
+			hit.Lines = append(hit.Lines, i+1)
+			contentExcerpts++
+		}
+	}
+
+	return hit
+}
+
+// ranges returns the merged spans of text matching any literal or word
+func (h *searchHighlighter) ranges(text string) []models.TextRange {
+	// Lowercase rune by rune so offsets still line up with text
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	var found []models.TextRange
+	for _, literal := range h.literals {
+		for i := 0; i+len(literal) <= len(lower); i++ {
+			if slices.Equal(lower[i:i+len(literal)], literal) {
+				found = append(found, models.TextRange{Start: i, End: i + len(literal)})
+			}
+		}
+	}
+
+	if len(h.words) > 0 || len(h.prefixes) > 0 {
+		for _, word := range wordSpans(runes) {
+			if h.matchesWord(string(lower[word.Start:word.End])) {
+				found = append(found, word)
+			}
+		}
+	}
+
+	return mergeRanges(found)
+}
+
+// matchesWord reports whether a lowercased word of the text matches one of
+// the search words or starts with one of the prefixes
+func (h *searchHighlighter) matchesWord(token string) bool {
+	for _, prefix := range h.prefixes {
+		if strings.HasPrefix(token, prefix) {
+			return true
+		}
+	}
+	if h.stems != nil {
+		return h.stems[token]
+	}
+	for _, needle := range h.words {
+		if stemMatches(token, needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// pageWords returns the distinct lowercased words of the snippets that
+// matchesWord may be asked about, identifier parts included
+func pageWords(snippets []models.Snippet) []string {
+	seen := make(map[string]bool)
+	var words []string
+	add := func(text string) {
+		runes := []rune(text)
+		for _, word := range wordSpans(runes) {
+			token := strings.Map(unicode.ToLower, string(runes[word.Start:word.End]))
+			if !seen[token] {
+				seen[token] = true
+				words = append(words, token)
+			}
+		}
+	}
+
+	for i := range snippets {
+		add(snippets[i].Title)
+		if snippets[i].Description != nil {
+			add(*snippets[i].Description)
+		}
+		add(snippets[i].Content)
+	}
+	return words
+}
+
+// wordSpans returns the letter and digit runs of text, and the camelCase parts
+// inside them, so NewDecoder yields NewDecoder, New and Decoder
+func wordSpans(runes []rune) []models.TextRange {
+	var spans []models.TextRange
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+			i++
+		}
+		spans = append(spans, models.TextRange{Start: start, End: i})
+
+		parts := splitCamelCase(string(runes[start:i]))
+		if len(parts) > 1 {
+			offset := start
+			for _, part := range parts {
+				length := len([]rune(part))
+				spans = append(spans, models.TextRange{Start: offset, End: offset + length})
+				offset += length
+			}
+		}
+	}
+	return spans
+}
+
+// stemMatches approximates the stemmer by letting one word run a few
+// characters past the other, so decoder matches decoders and contexts
+// matches context. Postgres asks its own stemmer instead, see
+// highlightPostgresSearchHits.
+func stemMatches(token, needle string) bool {
+	if token == needle {
+		return true
+	}
+
+	shorter, longer := token, needle
+	if len(shorter) > len(longer) {
+		shorter, longer = longer, shorter
+	}
+	return len([]rune(shorter)) >= 3 &&
+		len([]rune(longer))-len([]rune(shorter)) <= maxStemSuffix &&
+		strings.HasPrefix(longer, shorter)
+}
+
+// mergeRanges sorts ranges and joins the ones that overlap or touch
+func mergeRanges(ranges []models.TextRange) []models.TextRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Start < ranges[j].Start
+	})
+
+	merged := []models.TextRange{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End {
+			last.End = max(last.End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// excerptAround cuts text down to at most excerptLength characters around
+// the first range and moves the ranges to match
+func excerptAround(text string, ranges []models.TextRange) (string, []models.TextRange) {
+	runes := []rune(text)
+	if len(runes) <= excerptLength {
+		return text, ranges
+	}
+
+	start := max(0, ranges[0].Start-excerptLead)
+	end := min(len(runes), start+excerptLength)
+
+	var highlights []models.TextRange
+	for _, r := range ranges {
+		if r.Start >= end {
+			break
+		}
+		highlights = append(highlights, models.TextRange{
+			Start: max(r.Start, start) - start,
+			End:   min(r.End, end) - start,
+		})
+	}
+
+	return string(runes[start:end]), highlights
+}
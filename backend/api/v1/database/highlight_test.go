@@ -0,0 +1,121 @@
+package database
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func TestStemMatches(t *testing.T) {
+	tests := []struct {
+		token, needle string
+		want          bool
+	}{
+		{"decoder", "decoder", true},
+		{"decoders", "decoder", true},
+		{"context", "contexts", true},
+		{"decoding", "decoder", false},
+		{"go", "gopher", false},
+		{"configuration", "config", false},
+	}
+
+	for _, tt := range tests {
+		if got := stemMatches(tt.token, tt.needle); got != tt.want {
+			t.Errorf("stemMatches(%q, %q) = %v, want %v", tt.token, tt.needle, got, tt.want)
+		}
+	}
+}
+
+func TestSearchHighlighterRanges(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		mode  string
+		stems map[string]bool
+		text  string
+		want  []models.TextRange
+	}{
+		{
+			name:  "whole word",
+			query: "decoder",
+			mode:  SearchModeFullText,
+			text:  "a decoder here",
+			want:  []models.TextRange{{Start: 2, End: 9}},
+		},
+		{
+			name:  "camelCase part",
+			query: "decoder",
+			mode:  SearchModeFullText,
+			text:  "json.NewDecoder(r)",
+			want:  []models.TextRange{{Start: 8, End: 15}},
+		},
+		{
+			name:  "substring inside a word",
+			query: "code",
+			mode:  SearchModeSubstring,
+			text:  "NewDecoder",
+			want:  []models.TextRange{{Start: 5, End: 9}},
+		},
+		{
+			name:  "phrase",
+			query: `"new decoder"`,
+			mode:  SearchModeFullText,
+			text:  "a new decoder",
+			want:  []models.TextRange{{Start: 2, End: 13}},
+		},
+		{
+			name:  "prefix",
+			query: "deco*",
+			mode:  SearchModeFullText,
+			stems: map[string]bool{},
+			text:  "NewDecoder decorates",
+			want:  []models.TextRange{{Start: 3, End: 10}, {Start: 11, End: 20}},
+		},
+		{
+			name:  "stems from the database replace the approximation",
+			query: "running",
+			mode:  SearchModeFullText,
+			stems: map[string]bool{"ran": true, "runs": true},
+			text:  "runs ran running",
+			want:  []models.TextRange{{Start: 0, End: 4}, {Start: 5, End: 8}},
+		},
+		{
+			name:  "no stems means no word matches",
+			query: "decoder",
+			mode:  SearchModeFullText,
+			stems: map[string]bool{},
+			text:  "a decoder",
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			search, err := ParseSearchQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			include, _ := search.textTerms()
+			h := newSearchHighlighter(include, tt.mode)
+			h.stems = tt.stems
+
+			if got := h.ranges(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("ranges(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageWords(t *testing.T) {
+	description := "Reads JSON"
+	snippets := []models.Snippet{
+		{Title: "NewDecoder", Description: &description, Content: "json.NewDecoder(r)"},
+		{Title: "other", Content: "new_decoder"},
+	}
+
+	want := []string{"newdecoder", "new", "decoder", "reads", "json", "r", "other"}
+	if got := pageWords(snippets); !slices.Equal(got, want) {
+		t.Errorf("pageWords = %v, want %v", got, want)
+	}
+}
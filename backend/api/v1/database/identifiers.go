@@ -0,0 +1,97 @@
+package database
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// identifierSeparators join the parts of a compound identifier, as in
+// snake_case, kebab-case and dotted.paths
+const identifierSeparators = "_-."
+
+// identifierTokens splits the identifiers in text into the words they are made
+// of, so that a search for decoder finds NewDecoder, new_decoder and
+// json.NewDecoder. Only compound identifiers contribute, plain words are
+// already indexed as they are. The tokens come back lowercased, deduplicated
+// and separated by spaces, ready for the search_tokens column.
+func identifierTokens(text string) string {
+	seen := make(map[string]bool)
+	var tokens []string
+
+	add := func(token string) {
+		token = strings.ToLower(token)
+		// Single letters and bare numbers such as the parts of 1.5 or a
+		// date are noise
+		if len([]rune(token)) < 2 || !strings.ContainsFunc(token, unicode.IsLetter) || seen[token] {
+			return
+		}
+		seen[token] = true
+		tokens = append(tokens, token)
+	}
+
+	for _, identifier := range strings.FieldsFunc(text, func(r rune) bool {
+		return !isIdentifierRune(r)
+	}) {
+		parts := strings.FieldsFunc(identifier, func(r rune) bool {
+			return strings.ContainsRune(identifierSeparators, r)
+		})
+
+		var words []string
+		for _, part := range parts {
+			partWords := splitCamelCase(part)
+			if len(partWords) > 1 {
+				// Keep NewDecoder whole too, the full-text parser may have
+				// swallowed it into json.NewDecoder
+				words = append(words, part)
+			}
+			words = append(words, partWords...)
+		}
+
+		if len(words) < 2 {
+			continue
+		}
+		for _, word := range words {
+			add(word)
+		}
+	}
+
+	return strings.Join(tokens, " ")
+}
+
+// isIdentifierRune reports whether r can appear in an identifier, counting
+// the separators that join compound ones
+func isIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(identifierSeparators, r)
+}
+
+// splitCamelCase breaks a camelCase or PascalCase word at each change of case.
+// A run of capitals is kept together as an acronym, so HTTPServer becomes
+// HTTP and Server. Digits stay with the letters before them, as in utf8.
+func splitCamelCase(word string) []string {
+	runes := []rune(word)
+	var words []string
+
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		boundary := (unicode.IsLower(prev) || unicode.IsDigit(prev)) && unicode.IsUpper(cur)
+		if !boundary && unicode.IsUpper(prev) && unicode.IsUpper(cur) {
+			// The last capital of an acronym starts the next word: HTTPServer
+			boundary = i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		}
+		if boundary {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+
+	return append(words, string(runes[start:]))
+}
+
+// snippetSearchTokens returns the identifier tokens stored with a snippet,
+// taken from its title and content
+func snippetSearchTokens(snippet *models.Snippet) string {
+	return identifierTokens(snippet.Title + "\n" + snippet.Content)
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIdentifierTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"camelCase", "parseURL", "parseurl parse url"},
+		{"PascalCase with acronym", "HTTPServer", "httpserver http server"},
+		{"digits stay with the word before", "utf8Decode", "utf8decode utf8 decode"},
+		{"digits after an acronym", "SHA256Hash", "sha256hash sha256 hash"},
+		{"single letter parts dropped", "getX", "getx get"},
+		{"snake_case", "new_decoder", "new decoder"},
+		{"SCREAMING_SNAKE", "MAX_RETRY_COUNT", "max retry count"},
+		{"kebab-case", "content-type", "content type"},
+		{"dotted", "os.path.join", "os path join"},
+		{"dotted camelCase", "json.NewDecoder(r)", "json newdecoder new decoder"},
+		{"separators at the ends", "__init__ -flag-", ""},
+		{"plain words", "hello world", ""},
+		{"version numbers", "version 1.5.2", ""},
+		{"single letters", "a_b x.y", ""},
+		{"deduplicated", "NewDecoder new_decoder Decoder.New", "newdecoder new decoder"},
+		{"unicode letters", "naïveCafé", "naïvecafé naïve café"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := identifierTokens(tt.text); got != tt.want {
+				t.Errorf("identifierTokens(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCamelCase(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"decoder", []string{"decoder"}},
+		{"NewDecoder", []string{"New", "Decoder"}},
+		{"newDecoder", []string{"new", "Decoder"}},
+		{"A", []string{"A"}},
+		{"ID", []string{"ID"}},
+		{"HTTPServer", []string{"HTTP", "Server"}},
+		{"ServeHTTP", []string{"Serve", "HTTP"}},
+		{"parseHTTPRequest", []string{"parse", "HTTP", "Request"}},
+		{"XMLHTTPRequest", []string{"XMLHTTP", "Request"}},
+		{"utf8", []string{"utf8"}},
+		{"base64Encode", []string{"base64", "Encode"}},
+		{"Int64Value", []string{"Int64", "Value"}},
+		{"HTTP2Server", []string{"HTTP2", "Server"}},
+		{"MD5Sum", []string{"MD5", "Sum"}},
+		{"Go2Go", []string{"Go2", "Go"}},
+		{"v2", []string{"v2"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitCamelCase(tt.word); !slices.Equal(got, tt.want) {
+			t.Errorf("splitCamelCase(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNoIdentityError     = errors.New("identity does not exist")
+	ErrIdentityExistsError = errors.New("identity is already linked")
+)
+
+const identityColumns = "id, user_id, issuer, subject, email, created_at"
+
+func GetIdentity(ctx context.Context, pool *pgxpool.Pool, identityID int64) (*models.UserIdentity, error) {
+	identity, err := scanIdentity(pool.QueryRow(ctx, "SELECT "+identityColumns+" FROM user_identities WHERE id = $1", identityID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("identity with ID %d does not exist: %w", identityID, ErrNoIdentityError)
+		}
+		return nil, fmt.Errorf("%w: failed to get identity", ErrDatabaseError)
+	}
+
+	return identity, nil
+}
+
+func GetIdentityBySubject(ctx context.Context, pool *pgxpool.Pool, issuer, subject string) (*models.UserIdentity, error) {
+	query := "SELECT " + identityColumns + " FROM user_identities WHERE issuer = $1 AND subject = $2"
+
+	identity, err := scanIdentity(pool.QueryRow(ctx, query, issuer, subject))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoIdentityError
+		}
+		return nil, fmt.Errorf("%w: failed to get identity", ErrDatabaseError)
+	}
+
+	return identity, nil
+}
+
+func GetIdentities(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.UserIdentity, error) {
+	rows, err := pool.Query(ctx, "SELECT "+identityColumns+" FROM user_identities WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get identities", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	identities := []models.UserIdentity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan identity data", ErrDatabaseError)
+		}
+		identities = append(identities, *identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate identities", ErrDatabaseError)
+	}
+
+	return identities, nil
+}
+
+func CreateIdentity(ctx context.Context, pool *pgxpool.Pool, identity *models.UserIdentity) error {
+	now := time.Now()
+
+	err := pool.QueryRow(ctx, `
+		INSERT INTO user_identities (user_id, issuer, subject, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (issuer, subject) DO NOTHING
+		RETURNING id`,
+		identity.UserID, identity.Issuer, identity.Subject, identity.Email, now,
+	).Scan(&identity.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrIdentityExistsError
+		}
+		return fmt.Errorf("%w: failed to insert identity", ErrDatabaseError)
+	}
+
+	identity.CreatedAt = now
+	return nil
+}
+
+func CreateUserWithIdentity(ctx context.Context, pool *pgxpool.Pool, user *models.User, identity *models.UserIdentity) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	var count int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM users WHERE username = $1", user.Username).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check username availability", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("%w: username '%s' is already taken", ErrUsernameExists, user.Username)
+	}
+
+	// password_hash stays NULL, the identity is how the user signs in
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (username) VALUES ($1)
+		RETURNING id, created_at, updated_at, token_generation`,
+		user.Username,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.TokenGeneration)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return fmt.Errorf("%w: username became unavailable", ErrUsernameExists)
+		}
+		return fmt.Errorf("%w: failed to create user", ErrDatabaseError)
+	}
+
+	identity.UserID = user.ID
+	err = tx.QueryRow(ctx, `
+		INSERT INTO user_identities (user_id, issuer, subject, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (issuer, subject) DO NOTHING
+		RETURNING id`,
+		identity.UserID, identity.Issuer, identity.Subject, identity.Email, user.CreatedAt,
+	).Scan(&identity.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrIdentityExistsError
+		}
+		return fmt.Errorf("%w: failed to insert identity", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	identity.CreatedAt = user.CreatedAt
+	return nil
+}
+
+func DeleteIdentity(ctx context.Context, pool *pgxpool.Pool, identityID int64) error {
+	result, err := pool.Exec(ctx, "DELETE FROM user_identities WHERE id = $1", identityID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete identity", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("identity with ID %d does not exist: %w", identityID, ErrNoIdentityError)
+	}
+
+	return nil
+}
+
+func scanIdentity(row pgx.Row) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Issuer,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
@@ -0,0 +1,1551 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// Default ts_rank weights for the A, B, C and D labels used by document_with_weights
+const (
+	titleWeight       = 1.0
+	descriptionWeight = 0.4
+	contentWeight     = 0.2
+	identifierWeight  = 0.1
+)
+
+// MemoryStore is an in-process implementation of Store. It mirrors the
+// behaviour of the Postgres queries (ordering, pagination, validation and
+// sentinel errors) so handlers can be exercised without a live database.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	users       map[int64]UserWithPassword
+	folders     map[int64]models.Folder
+	snippets    map[int64]models.Snippet
+	tags        map[int64]models.Tag
+	snippetTags map[int64]map[int64]struct{}       // snippet ID -> set of tag IDs
+	revisions   map[int64][]models.SnippetRevision // snippet ID -> revisions, oldest first
+
+	savedSearches  map[int64]models.SavedSearch
+	sessionTokens  map[string]sessionToken // refresh token hash -> token
+	apiTokens      map[int64]models.APIToken
+	apiTokenHashes map[string]int64 // token hash -> token ID
+	twoFactor      map[int64]models.TwoFactor
+	recoveryCodes  map[int64]map[string]bool // user ID -> code hash -> used
+	identities     map[int64]models.UserIdentity
+
+	// Soft-deleted rows stay in snippets and folders, these mark them trashed
+	snippetTrash map[int64]trashEntry
+	folderTrash  map[int64]trashEntry
+
+	lastUserID     int64
+	lastFolderID   int64
+	lastSnippetID  int64
+	lastTagID      int64
+	lastRevisionID int64
+
+	lastSavedSearchID int64
+	lastSessionID     int64
+	lastAPITokenID    int64
+	lastIdentityID    int64
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:       make(map[int64]UserWithPassword),
+		folders:     make(map[int64]models.Folder),
+		snippets:    make(map[int64]models.Snippet),
+		tags:        make(map[int64]models.Tag),
+		snippetTags: make(map[int64]map[int64]struct{}),
+		revisions:   make(map[int64][]models.SnippetRevision),
+
+		savedSearches:  make(map[int64]models.SavedSearch),
+		sessionTokens:  make(map[string]sessionToken),
+		apiTokens:      make(map[int64]models.APIToken),
+		apiTokenHashes: make(map[string]int64),
+		twoFactor:      make(map[int64]models.TwoFactor),
+		recoveryCodes:  make(map[int64]map[string]bool),
+		identities:     make(map[int64]models.UserIdentity),
+
+		snippetTrash: make(map[int64]trashEntry),
+		folderTrash:  make(map[int64]trashEntry),
+	}
+}
+
+// Close is a no-op, it exists to satisfy Store
+func (s *MemoryStore) Close() {}
+
+// Snippets
+
+func (s *MemoryStore) CreateSnippet(ctx context.Context, snippet *models.Snippet) error {
+	return s.createSnippet(snippet, false)
+}
+
+func (s *MemoryStore) CreateUniqueSnippet(ctx context.Context, snippet *models.Snippet) error {
+	return s.createSnippet(snippet, true)
+}
+
+func (s *MemoryStore) createSnippet(snippet *models.Snippet, unique bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if unique {
+		if ids := s.snippetIDsByContent(snippet.UserID, 0, snippet.Content); len(ids) > 0 {
+			return &DuplicateContentError{IDs: ids}
+		}
+	}
+
+	now := time.Now()
+
+	s.lastSnippetID++
+	stored := *snippet
+	stored.ID = s.lastSnippetID
+	stored.Description = cloneString(snippet.Description)
+	stored.FolderID = cloneInt64(snippet.FolderID)
+	stored.Tags = nil
+	stored.CreatedAt = now
+	stored.UpdatedAt = now
+	s.snippets[stored.ID] = stored
+
+	if snippet.Tags != nil && len(*snippet.Tags) > 0 {
+		s.insertSnippetTags(stored.ID, snippet.UserID, *snippet.Tags)
+	}
+
+	s.insertSnippetRevision(stored.ID, now)
+
+	snippet.ID = stored.ID
+	snippet.CreatedAt = now
+	snippet.UpdatedAt = now
+
+	return nil
+}
+
+func (s *MemoryStore) GetSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.snippets[snippetID]
+	if !ok || s.snippetTrashed(snippetID) {
+		return nil, ErrNoSnippetError
+	}
+
+	snippet := s.copySnippet(stored)
+	return &snippet, nil
+}
+
+func (s *MemoryStore) GetSnippets(ctx context.Context, page, limit int, userID int64, filter SnippetFilter) ([]models.Snippet, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches, search, err := s.matchSnippets(userID, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ascending := snippetSortAscending(filter)
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i].snippet, matches[j].snippet
+		if cmp := compareSnippets(a, b, filter.Sort); cmp != 0 {
+			return (cmp < 0) == ascending
+		}
+		if _, sorted := snippetSortColumns[filter.Sort]; sorted {
+			return (a.ID < b.ID) == ascending
+		}
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank > matches[j].rank
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+
+	total := len(matches)
+	start, end := pageBounds(page, limit, total)
+
+	var snippets []models.Snippet
+	for _, match := range matches[start:end] {
+		snippets = append(snippets, s.copySnippet(match.snippet))
+	}
+
+	if search != nil {
+		highlightSearchHits(snippets, search, filter.SearchMode)
+	}
+
+	return snippets, total, nil
+}
+
+func (s *MemoryStore) CountSnippets(ctx context.Context, userID int64, filters []SnippetFilter) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make([]int, len(filters))
+	for i, filter := range filters {
+		matches, _, err := s.matchSnippets(userID, filter)
+		if err != nil {
+			return nil, err
+		}
+		counts[i] = len(matches)
+	}
+
+	return counts, nil
+}
+
+func (s *MemoryStore) GetSnippetFacets(ctx context.Context, userID int64, filter SnippetFilter, facets []string) (models.SnippetFacets, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches, _, err := s.matchSnippets(userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newSnippetFacets(facets)
+	for _, facet := range facets {
+		counts := make(map[string]*models.FacetCount)
+		var order []*models.FacetCount
+		count := func(key string, value string, folderID *int64) {
+			if counts[key] == nil {
+				counts[key] = &models.FacetCount{Value: value, FolderID: folderID}
+				order = append(order, counts[key])
+			}
+			counts[key].Count++
+		}
+
+		for _, match := range matches {
+			snippet := match.snippet
+			switch facet {
+			case FacetLanguage:
+				count(snippet.Language, snippet.Language, nil)
+			case FacetTag:
+				for _, name := range s.snippetTagNames(snippet.ID) {
+					count(name, name, nil)
+				}
+			case FacetFolder:
+				if snippet.FolderID == nil {
+					count("", "", nil)
+				} else {
+					count(strconv.FormatInt(*snippet.FolderID, 10), s.folders[*snippet.FolderID].Name, cloneInt64(snippet.FolderID))
+				}
+			}
+		}
+
+		sort.Slice(order, func(i, j int) bool {
+			if order[i].Count != order[j].Count {
+				return order[i].Count > order[j].Count
+			}
+			return order[i].Value < order[j].Value
+		})
+		for _, c := range order[:min(len(order), maxFacetValues)] {
+			result[facet] = append(result[facet], *c)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *MemoryStore) UpdateSnippet(ctx context.Context, snippetID int64, snippet *models.Snippet) error {
+	return s.updateSnippet(snippetID, snippet, false)
+}
+
+func (s *MemoryStore) UpdateUniqueSnippet(ctx context.Context, snippetID int64, snippet *models.Snippet) error {
+	return s.updateSnippet(snippetID, snippet, true)
+}
+
+func (s *MemoryStore) updateSnippet(snippetID int64, snippet *models.Snippet, unique bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.snippets[snippetID]
+	if !ok || s.snippetTrashed(snippetID) {
+		return fmt.Errorf("snippet with ID %d does not exist: %w", snippetID, ErrNoSnippetError)
+	}
+
+	// Snippets already sharing content can still be edited in other ways
+	if unique && contentHash(stored.Content) != contentHash(snippet.Content) {
+		if ids := s.snippetIDsByContent(stored.UserID, snippetID, snippet.Content); len(ids) > 0 {
+			return &DuplicateContentError{IDs: ids}
+		}
+	}
+
+	now := time.Now()
+
+	stored.FolderID = cloneInt64(snippet.FolderID)
+	stored.Title = snippet.Title
+	stored.Description = cloneString(snippet.Description)
+	stored.Content = snippet.Content
+	stored.Language = snippet.Language
+	stored.IsFavorite = snippet.IsFavorite
+	stored.UpdatedAt = now
+	s.snippets[snippetID] = stored
+
+	if snippet.Tags != nil {
+		delete(s.snippetTags, snippetID)
+		if len(*snippet.Tags) > 0 {
+			s.insertSnippetTags(snippetID, stored.UserID, *snippet.Tags)
+		}
+	}
+
+	s.insertSnippetRevision(snippetID, now)
+
+	snippet.ID = snippetID
+	snippet.UserID = stored.UserID
+	snippet.UpdatedAt = now
+
+	if snippet.Tags != nil {
+		tags := s.snippetTagNames(snippetID)
+		if len(tags) > 0 {
+			snippet.Tags = &tags
+		} else {
+			emptyTags := []string{}
+			snippet.Tags = &emptyTags
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteSnippet(ctx context.Context, snippetID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.snippets[snippetID]
+	if !ok || s.snippetTrashed(snippetID) {
+		return fmt.Errorf("snippet with ID %d does not exist: %w", snippetID, ErrNoSnippetError)
+	}
+
+	s.snippetTrash[snippetID] = trashEntry{
+		deletedAt: time.Now(),
+		path:      s.folderPath(stored.FolderID),
+	}
+
+	return nil
+}
+
+// WalkSnippets copies the user's snippets up front, so fn runs without the lock held
+func (s *MemoryStore) WalkSnippets(ctx context.Context, userID int64, fn func(*models.Snippet) error) error {
+	s.mu.RLock()
+	var snippets []models.Snippet
+	for _, stored := range s.snippets {
+		if stored.UserID == userID && !s.snippetTrashed(stored.ID) {
+			snippet := stored
+			snippet.Description = cloneString(stored.Description)
+			snippet.FolderID = cloneInt64(stored.FolderID)
+			snippets = append(snippets, snippet)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(snippets, func(i, j int) bool {
+		return snippets[i].ID < snippets[j].ID
+	})
+
+	for i := range snippets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&snippets[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BackfillSearchTokens has nothing to do, identifier tokens are worked out
+// from the snippet whenever it is searched
+func (s *MemoryStore) BackfillSearchTokens(ctx context.Context, limit int) (int, error) {
+	return 0, nil
+}
+
+func (s *MemoryStore) GetSnippetIDsByContent(ctx context.Context, userID int64, content string) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.snippetIDsByContent(userID, 0, content), nil
+}
+
+// snippetIDsByContent lists the user's live snippets other than exceptID
+// holding content once normalized, oldest first
+func (s *MemoryStore) snippetIDsByContent(userID, exceptID int64, content string) []int64 {
+	hash := contentHash(content)
+
+	var ids []int64
+	for id, snippet := range s.snippets {
+		if id != exceptID && snippet.UserID == userID && !s.snippetTrashed(id) && contentHash(snippet.Content) == hash {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	return ids
+}
+
+// BackfillContentHashes has nothing to do, content is hashed whenever it is
+// compared
+func (s *MemoryStore) BackfillContentHashes(ctx context.Context, limit int) (int, error) {
+	return 0, nil
+}
+
+// Folders
+
+func (s *MemoryStore) CreateFolder(ctx context.Context, folder *models.Folder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if folder.ParentID != nil {
+		parent, ok := s.folders[*folder.ParentID]
+		if !ok || s.folderTrashed(parent.ID) {
+			return fmt.Errorf("parent folder does not exist")
+		}
+
+		if parent.UserID != folder.UserID {
+			return fmt.Errorf("parent folder does not belong to user")
+		}
+
+		if err := s.checkCircularReference(folder.UserID, 0, *folder.ParentID); err != nil {
+			return fmt.Errorf("circular reference detected: %w", err)
+		}
+	}
+
+	if s.folderNameTaken(folder.UserID, folder.Name, folder.ParentID, 0) {
+		return fmt.Errorf("folder name already exists in this location")
+	}
+
+	now := time.Now()
+
+	s.lastFolderID++
+	stored := *folder
+	stored.ID = s.lastFolderID
+	stored.Description = cloneString(folder.Description)
+	stored.ParentID = cloneInt64(folder.ParentID)
+	stored.CreatedAt = now
+	stored.UpdatedAt = now
+	s.folders[stored.ID] = stored
+
+	folder.ID = stored.ID
+	folder.CreatedAt = now
+	folder.UpdatedAt = now
+
+	return nil
+}
+
+func (s *MemoryStore) GetFolder(ctx context.Context, folderID int64) (*models.Folder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.folders[folderID]
+	if !ok || s.folderTrashed(folderID) {
+		return nil, ErrNoFolderError
+	}
+
+	folder := copyFolder(stored)
+	return &folder, nil
+}
+
+func (s *MemoryStore) GetFolders(ctx context.Context, page, limit int, userID int64, parentID *int64) ([]models.Folder, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []models.Folder
+	for _, stored := range s.folders {
+		if stored.UserID != userID || !sameParent(stored.ParentID, parentID) || s.folderTrashed(stored.ID) {
+			continue
+		}
+		matches = append(matches, stored)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Name != matches[j].Name {
+			return matches[i].Name < matches[j].Name
+		}
+		return matches[i].ID < matches[j].ID
+	})
+
+	total := len(matches)
+	start, end := pageBounds(page, limit, total)
+
+	var folders []models.Folder
+	for _, match := range matches[start:end] {
+		folders = append(folders, copyFolder(match))
+	}
+
+	return folders, total, nil
+}
+
+func (s *MemoryStore) GetFolderTree(ctx context.Context, userID int64) ([]*models.FolderNode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := map[int64]int{}
+	for id, snippet := range s.snippets {
+		if snippet.UserID == userID && snippet.FolderID != nil && !s.snippetTrashed(id) {
+			counts[*snippet.FolderID]++
+		}
+	}
+
+	children := map[int64][]models.Folder{}
+	var roots []models.Folder
+	for id, stored := range s.folders {
+		if stored.UserID != userID || s.folderTrashed(id) {
+			continue
+		}
+		if stored.ParentID == nil {
+			roots = append(roots, stored)
+		} else {
+			children[*stored.ParentID] = append(children[*stored.ParentID], stored)
+		}
+	}
+
+	byName := func(folders []models.Folder) {
+		sort.Slice(folders, func(i, j int) bool {
+			if folders[i].Name != folders[j].Name {
+				return folders[i].Name < folders[j].Name
+			}
+			return folders[i].ID < folders[j].ID
+		})
+	}
+
+	// Walk breadth first so parents come before their children, the order
+	// buildFolderTree expects
+	byName(roots)
+	level := roots
+	var nodes []*models.FolderNode
+	for depth := 0; len(level) > 0 && depth <= 50; depth++ {
+		var next []models.Folder
+		for _, folder := range level {
+			nodes = append(nodes, &models.FolderNode{
+				Folder:       copyFolder(folder),
+				Depth:        depth,
+				SnippetCount: counts[folder.ID],
+			})
+
+			byName(children[folder.ID])
+			next = append(next, children[folder.ID]...)
+		}
+		level = next
+	}
+
+	tree := buildFolderTree(nodes)
+
+	// Children come after their parents, so going backwards every subtree
+	// total is complete before it is added to its parent's
+	byID := make(map[int64]*models.FolderNode, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		node := nodes[i]
+		node.TotalSnippetCount += node.SnippetCount
+		if node.ParentID != nil {
+			byID[*node.ParentID].TotalSnippetCount += node.TotalSnippetCount
+		}
+	}
+
+	return tree, nil
+}
+
+func (s *MemoryStore) GetFolderPath(ctx context.Context, folderID int64) ([]models.Folder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.folders[folderID]; !ok || s.folderTrashed(folderID) {
+		return nil, ErrNoFolderError
+	}
+
+	var path []models.Folder
+	currentID := &folderID
+	for depth := 0; currentID != nil && depth <= 50; depth++ {
+		folder, ok := s.folders[*currentID]
+		if !ok || s.folderTrashed(*currentID) {
+			break
+		}
+		path = append([]models.Folder{copyFolder(folder)}, path...)
+		currentID = folder.ParentID
+	}
+
+	return path, nil
+}
+
+func (s *MemoryStore) UpdateFolder(ctx context.Context, folderID int64, folder *models.Folder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.folders[folderID]
+	if !ok || s.folderTrashed(folderID) {
+		return fmt.Errorf("folder with ID %d does not exist: %w", folderID, ErrNoFolderError)
+	}
+
+	if folder.ParentID != nil {
+		parent, ok := s.folders[*folder.ParentID]
+		if !ok || s.folderTrashed(parent.ID) {
+			return fmt.Errorf("parent folder does not exist")
+		}
+
+		if parent.UserID != folder.UserID {
+			return fmt.Errorf("parent folder does not belong to user")
+		}
+
+		if *folder.ParentID == folderID {
+			return fmt.Errorf("folder cannot be its own parent")
+		}
+
+		if !sameParent(stored.ParentID, folder.ParentID) {
+			if err := s.checkCircularReference(folder.UserID, folderID, *folder.ParentID); err != nil {
+				return fmt.Errorf("circular reference detected: %w", err)
+			}
+		}
+	}
+
+	if s.folderNameTaken(folder.UserID, folder.Name, folder.ParentID, folderID) {
+		return fmt.Errorf("folder name already exists in this location")
+	}
+
+	now := time.Now()
+
+	stored.Name = folder.Name
+	stored.Description = cloneString(folder.Description)
+	stored.ParentID = cloneInt64(folder.ParentID)
+	stored.UpdatedAt = now
+	s.folders[folderID] = stored
+
+	folder.ID = folderID
+	folder.UserID = stored.UserID
+	folder.UpdatedAt = now
+
+	return nil
+}
+
+// DeleteFolder moves a folder to the trash. Snippets still in it are moved to
+// the root first, snippets already in the trash keep pointing at it.
+func (s *MemoryStore) DeleteFolder(ctx context.Context, folderID int64, mode string) (*models.FolderDeleteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.folders[folderID]
+	if !ok || s.folderTrashed(folderID) {
+		return nil, fmt.Errorf("folder with ID %d does not exist: %w", folderID, ErrNoFolderError)
+	}
+
+	now := time.Now()
+	result := newFolderDeleteResult(mode)
+
+	switch mode {
+	case models.FolderDeleteRestrict:
+		childCount := len(s.childFolders(folderID))
+		if childCount > 0 {
+			return nil, fmt.Errorf("folder has %d child folders: %w", childCount, ErrFolderHasChildren)
+		}
+
+		// Move snippets to root
+		result.MovedSnippets = s.moveFolderSnippets(stored.UserID, folderID, nil, now)
+
+	case models.FolderDeleteCascade:
+		queue := s.childFolders(folderID)
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = append(queue[1:], s.childFolders(id)...)
+
+			s.folderTrash[id] = trashEntry{deletedAt: now, path: s.folderPath(s.folders[id].ParentID)}
+			result.RemovedFolders = append(result.RemovedFolders, id)
+		}
+
+		for _, id := range append([]int64{folderID}, result.RemovedFolders...) {
+			for snippetID, snippet := range s.snippets {
+				if snippet.UserID == stored.UserID && snippet.FolderID != nil && *snippet.FolderID == id && !s.snippetTrashed(snippetID) {
+					s.snippetTrash[snippetID] = trashEntry{deletedAt: now, path: s.folderPath(&id)}
+					result.RemovedSnippets = append(result.RemovedSnippets, snippetID)
+				}
+			}
+		}
+		slices.Sort(result.RemovedSnippets)
+
+	case models.FolderDeleteReparent:
+		for _, id := range s.childFolders(folderID) {
+			child := s.folders[id]
+			moved := models.MovedFolder{ID: id, Name: child.Name}
+
+			// The folder being deleted doesn't count, a child may take its name
+			name := child.Name
+			for n := 2; ; n++ {
+				existingID := s.findLiveFolder(child.UserID, name, stored.ParentID)
+				if existingID == 0 || existingID == folderID {
+					break
+				}
+				name = folderCopyName(child.Name, n)
+			}
+			if name != child.Name {
+				renamedFrom := child.Name
+				moved.RenamedFrom = &renamedFrom
+				moved.Name = name
+			}
+
+			child.Name = name
+			child.ParentID = cloneInt64(stored.ParentID)
+			child.UpdatedAt = now
+			s.folders[id] = child
+			result.MovedFolders = append(result.MovedFolders, moved)
+		}
+
+		result.MovedSnippets = s.moveFolderSnippets(stored.UserID, folderID, stored.ParentID, now)
+		result.MovedTo = cloneInt64(stored.ParentID)
+
+	default:
+		return nil, fmt.Errorf("unknown folder delete mode %q", mode)
+	}
+
+	s.folderTrash[folderID] = trashEntry{
+		deletedAt: now,
+		path:      s.folderPath(stored.ParentID),
+	}
+	result.RemovedFolders = append([]int64{folderID}, result.RemovedFolders...)
+
+	return result, nil
+}
+
+// Users
+
+func (s *MemoryStore) CreateUser(ctx context.Context, user *models.User) error {
+	created := &UserWithPassword{User: *user}
+	if err := s.CreateUserWithPassword(ctx, created); err != nil {
+		return err
+	}
+
+	*user = created.User
+	return nil
+}
+
+func (s *MemoryStore) GetUser(ctx context.Context, userID int64, user *models.User) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.users[userID]
+	if !ok {
+		return ErrNoUserError
+	}
+
+	*user = stored.User
+	return nil
+}
+
+func (s *MemoryStore) GetUsers(ctx context.Context, page, limit int, search string) ([]models.User, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search = strings.ToLower(search)
+
+	var matches []models.User
+	for _, stored := range s.users {
+		if search != "" && !strings.Contains(strings.ToLower(stored.Username), search) {
+			continue
+		}
+		matches = append(matches, stored.User)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+		return matches[i].ID > matches[j].ID
+	})
+
+	total := len(matches)
+	start, end := pageBounds(page, limit, total)
+
+	var users []models.User
+	users = append(users, matches[start:end]...)
+
+	return users, total, nil
+}
+
+func (s *MemoryStore) UpdateUser(ctx context.Context, userID int64, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("user with ID %d does not exist: %w", userID, ErrNoUserError)
+	}
+
+	if user.Username != stored.Username && s.usernameTaken(user.Username, userID) {
+		return fmt.Errorf("%w: username '%s' already exists", ErrUsernameExists, user.Username)
+	}
+
+	stored.Username = user.Username
+	stored.UpdatedAt = time.Now()
+	s.users[userID] = stored
+
+	user.ID = userID
+	user.CreatedAt = stored.CreatedAt
+	user.UpdatedAt = stored.UpdatedAt
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("user with ID %d does not exist: %w", userID, ErrNoUserError)
+	}
+
+	// Mirror ON DELETE CASCADE from the users table
+	for id, snippet := range s.snippets {
+		if snippet.UserID == userID {
+			delete(s.snippets, id)
+			delete(s.snippetTags, id)
+			delete(s.revisions, id)
+			delete(s.snippetTrash, id)
+		}
+	}
+	for id, folder := range s.folders {
+		if folder.UserID == userID {
+			delete(s.folders, id)
+			delete(s.folderTrash, id)
+		}
+	}
+	for id, tag := range s.tags {
+		if tag.UserID == userID {
+			delete(s.tags, id)
+		}
+	}
+	for id, search := range s.savedSearches {
+		if search.UserID == userID {
+			delete(s.savedSearches, id)
+		}
+	}
+	for hash, token := range s.sessionTokens {
+		if token.session.UserID == userID {
+			delete(s.sessionTokens, hash)
+		}
+	}
+	s.deleteAPITokens(func(token models.APIToken) bool { return token.UserID == userID })
+	delete(s.twoFactor, userID)
+	delete(s.recoveryCodes, userID)
+	for id, identity := range s.identities {
+		if identity.UserID == userID {
+			delete(s.identities, id)
+		}
+	}
+
+	delete(s.users, userID)
+
+	return nil
+}
+
+func (s *MemoryStore) CreateUserWithPassword(ctx context.Context, user *UserWithPassword) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usernameTaken(user.Username, 0) {
+		return fmt.Errorf("%w: username '%s' is already taken", ErrUsernameExists, user.Username)
+	}
+
+	now := time.Now()
+
+	s.lastUserID++
+	user.ID = s.lastUserID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	s.users[user.ID] = *user
+
+	return nil
+}
+
+func (s *MemoryStore) GetUserByUsername(ctx context.Context, username string) (*UserWithPassword, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, stored := range s.users {
+		if stored.Username == username {
+			user := stored
+			return &user, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user not found")
+}
+
+func (s *MemoryStore) UpdateUserPassword(ctx context.Context, userID int64, hashedPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("user with ID %d does not exist: %w", userID, ErrNoUserError)
+	}
+
+	stored.Password = hashedPassword
+	stored.UpdatedAt = time.Now()
+	stored.TokenGeneration++
+	s.users[userID] = stored
+	s.revokeUserSessions(userID, 0)
+
+	return nil
+}
+
+func (s *MemoryStore) RevokeUserTokens(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("user with ID %d does not exist: %w", userID, ErrNoUserError)
+	}
+
+	stored.TokenGeneration++
+	s.users[userID] = stored
+	s.revokeUserSessions(userID, 0)
+
+	return nil
+}
+
+// Tags
+
+func (s *MemoryStore) CreateTag(ctx context.Context, tag *models.Tag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findTag(tag.UserID, tag.Name) != 0 {
+		return fmt.Errorf("tag name already exists")
+	}
+
+	s.lastTagID++
+	tag.ID = s.lastTagID
+	tag.CreatedAt = time.Now()
+	tag.SnippetCount = 0
+
+	stored := *tag
+	stored.Color = cloneString(tag.Color)
+	s.tags[tag.ID] = stored
+
+	return nil
+}
+
+func (s *MemoryStore) GetTag(ctx context.Context, tagID int64) (*models.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tags[tagID]; !ok {
+		return nil, fmt.Errorf("tag with ID %d does not exist: %w", tagID, ErrNoTagError)
+	}
+
+	tag := s.copyTag(tagID)
+	return &tag, nil
+}
+
+func (s *MemoryStore) GetTags(ctx context.Context, userID int64) ([]models.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tags []models.Tag
+	for id, tag := range s.tags {
+		if tag.UserID == userID {
+			tags = append(tags, s.copyTag(id))
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags, nil
+}
+
+func (s *MemoryStore) UpdateTag(ctx context.Context, tagID int64, tag *models.Tag) (*models.Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tags[tagID]
+	if !ok {
+		return nil, fmt.Errorf("tag with ID %d does not exist: %w", tagID, ErrNoTagError)
+	}
+
+	resultID := tagID
+
+	if targetID := s.findTag(stored.UserID, tag.Name); targetID != 0 && targetID != tagID {
+		for _, tagIDs := range s.snippetTags {
+			if _, tagged := tagIDs[tagID]; tagged {
+				delete(tagIDs, tagID)
+				tagIDs[targetID] = struct{}{}
+			}
+		}
+		delete(s.tags, tagID)
+
+		target := s.tags[targetID]
+		if target.Color == nil {
+			target.Color = cloneString(tag.Color)
+			s.tags[targetID] = target
+		}
+		resultID = targetID
+	} else {
+		stored.Name = tag.Name
+		stored.Color = cloneString(tag.Color)
+		s.tags[tagID] = stored
+	}
+
+	result := s.copyTag(resultID)
+	return &result, nil
+}
+
+func (s *MemoryStore) DeleteTag(ctx context.Context, tagID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tags[tagID]; !ok {
+		return fmt.Errorf("tag with ID %d does not exist: %w", tagID, ErrNoTagError)
+	}
+
+	for _, tagIDs := range s.snippetTags {
+		delete(tagIDs, tagID)
+	}
+	delete(s.tags, tagID)
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteUnusedTags(ctx context.Context, userID int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used := make(map[int64]bool)
+	for _, tagIDs := range s.snippetTags {
+		for tagID := range tagIDs {
+			used[tagID] = true
+		}
+	}
+
+	deleted := 0
+	for id, tag := range s.tags {
+		if tag.UserID == userID && !used[id] {
+			delete(s.tags, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (s *MemoryStore) GetSnippetTags(ctx context.Context, snippetID int64) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.snippetTagNames(snippetID), nil
+}
+
+// Helpers below expect the caller to hold s.mu
+
+// rankedSnippet is a snippet matching a search along with its relevance
+type rankedSnippet struct {
+	snippet models.Snippet
+	rank    float64
+}
+
+// matchSnippets returns the user's live snippets matching filter, unsorted,
+// along with the parsed search
+func (s *MemoryStore) matchSnippets(userID int64, filter SnippetFilter) ([]rankedSnippet, *SearchQuery, error) {
+	var search *SearchQuery
+	var include, exclude []SearchTerm
+	if filter.Search != "" {
+		var err error
+		search, err = ParseSearchQuery(filter.Search)
+		if err != nil {
+			return nil, nil, err
+		}
+		include, exclude = search.textTerms()
+	}
+	tags := normalizeTagFilter(filter.Tags)
+
+	var matches []rankedSnippet
+	for _, stored := range s.snippets {
+		if stored.UserID != userID || s.snippetTrashed(stored.ID) {
+			continue
+		}
+
+		if filter.FolderID != nil && !s.inFolder(stored.FolderID, *filter.FolderID, filter.Recursive) {
+			continue
+		}
+
+		if !s.matchesFilter(stored, filter, tags) {
+			continue
+		}
+
+		if search != nil && !s.matchesSearchOperators(stored, search) {
+			continue
+		}
+
+		rank, matched := matchSearchText(stored, include, exclude, filter.SearchMode)
+		if !matched {
+			continue
+		}
+
+		matches = append(matches, rankedSnippet{snippet: stored, rank: rank})
+	}
+
+	return matches, search, nil
+}
+
+// insertSnippetTags links tags to a snippet, creating any tag the user does not have yet
+func (s *MemoryStore) insertSnippetTags(snippetID int64, userID int64, tagNames []string) {
+	for _, tagName := range tagNames {
+		tagName = strings.TrimSpace(tagName)
+		if tagName == "" {
+			continue
+		}
+
+		tagID := s.findTag(userID, tagName)
+		if tagID == 0 {
+			s.lastTagID++
+			tagID = s.lastTagID
+			s.tags[tagID] = models.Tag{
+				ID:        tagID,
+				UserID:    userID,
+				Name:      tagName,
+				CreatedAt: time.Now(),
+			}
+		}
+
+		if s.snippetTags[snippetID] == nil {
+			s.snippetTags[snippetID] = make(map[int64]struct{})
+		}
+		s.snippetTags[snippetID][tagID] = struct{}{}
+	}
+}
+
+func (s *MemoryStore) findTag(userID int64, name string) int64 {
+	for id, tag := range s.tags {
+		if tag.UserID == userID && tag.Name == name {
+			return id
+		}
+	}
+	return 0
+}
+
+// copyTag returns a detached copy of a stored tag with its live snippet count
+func (s *MemoryStore) copyTag(tagID int64) models.Tag {
+	tag := s.tags[tagID]
+	tag.Color = cloneString(tag.Color)
+	tag.SnippetCount = 0
+
+	for snippetID, tagIDs := range s.snippetTags {
+		if _, tagged := tagIDs[tagID]; tagged && !s.snippetTrashed(snippetID) {
+			tag.SnippetCount++
+		}
+	}
+
+	return tag
+}
+
+func (s *MemoryStore) snippetTagNames(snippetID int64) []string {
+	var names []string
+	for tagID := range s.snippetTags[snippetID] {
+		names = append(names, s.tags[tagID].Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// matchesFilter applies the structured filters, tags being the normalized
+// tag filter
+func (s *MemoryStore) matchesFilter(snippet models.Snippet, filter SnippetFilter, tags []string) bool {
+	if filter.Language != "" && snippet.Language != filter.Language {
+		return false
+	}
+
+	if filter.IsFavorite != nil && snippet.IsFavorite != *filter.IsFavorite {
+		return false
+	}
+
+	if filter.CreatedAfter != nil && snippet.CreatedAt.Before(*filter.CreatedAfter) {
+		return false
+	}
+	if filter.CreatedBefore != nil && !snippet.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+	if filter.UpdatedAfter != nil && snippet.UpdatedAt.Before(*filter.UpdatedAfter) {
+		return false
+	}
+	if filter.UpdatedBefore != nil && !snippet.UpdatedAt.Before(*filter.UpdatedBefore) {
+		return false
+	}
+
+	if len(tags) > 0 {
+		carried := make(map[string]bool)
+		for tagID := range s.snippetTags[snippet.ID] {
+			carried[strings.ToLower(s.tags[tagID].Name)] = true
+		}
+
+		matched := 0
+		for _, tag := range tags {
+			if carried[tag] {
+				matched++
+			}
+		}
+
+		if matched == 0 || (filter.MatchAllTags && matched < len(tags)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesSearchOperators applies the field operators of a search query
+func (s *MemoryStore) matchesSearchOperators(snippet models.Snippet, search *SearchQuery) bool {
+	for _, term := range search.Terms {
+		var matched bool
+		switch term.Field {
+		case SearchFieldLanguage:
+			matched = snippet.Language == strings.ToLower(term.Value)
+		case SearchFieldTag:
+			for tagID := range s.snippetTags[snippet.ID] {
+				if strings.EqualFold(s.tags[tagID].Name, term.Value) {
+					matched = true
+					break
+				}
+			}
+		case SearchFieldFolder:
+			matched = s.inNamedFolder(snippet.FolderID, term.Value)
+		case SearchFieldIs:
+			matched = snippet.IsFavorite
+		default:
+			continue
+		}
+
+		if matched == term.Negated {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inNamedFolder reports whether folderID or one of its ancestors is a live
+// folder with this name
+func (s *MemoryStore) inNamedFolder(folderID *int64, name string) bool {
+	for depth := 0; folderID != nil && depth <= 50; depth++ {
+		folder, ok := s.folders[*folderID]
+		if !ok || s.folderTrashed(folder.ID) {
+			return false
+		}
+		if strings.EqualFold(folder.Name, name) {
+			return true
+		}
+		folderID = folder.ParentID
+	}
+	return false
+}
+
+// compareSnippets orders two snippets by a SnippetSort field, returning 0 for
+// an empty field or a tie
+func compareSnippets(a, b models.Snippet, field string) int {
+	switch field {
+	case SnippetSortTitle:
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	case SnippetSortCreatedAt:
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case SnippetSortUpdatedAt:
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	return 0
+}
+
+// copySnippet returns a detached copy of a stored snippet with its tags attached
+func (s *MemoryStore) copySnippet(stored models.Snippet) models.Snippet {
+	snippet := stored
+	snippet.Description = cloneString(stored.Description)
+	snippet.FolderID = cloneInt64(stored.FolderID)
+	snippet.Tags = nil
+
+	if tags := s.snippetTagNames(stored.ID); len(tags) > 0 {
+		snippet.Tags = &tags
+	}
+
+	return snippet
+}
+
+// checkCircularReference walks up from parentID and fails if it reaches
+// folderID or exceeds the same depth limit the SQL implementation uses
+func (s *MemoryStore) checkCircularReference(userID int64, folderID int64, parentID int64) error {
+	currentID := parentID
+	for depth := 0; ; depth++ {
+		if depth > 50 {
+			return fmt.Errorf("maximum folder depth exceeded")
+		}
+
+		if folderID != 0 && currentID == folderID {
+			return fmt.Errorf("circular reference detected")
+		}
+
+		current, ok := s.folders[currentID]
+		if !ok || current.UserID != userID || current.ParentID == nil {
+			return nil
+		}
+
+		currentID = *current.ParentID
+	}
+}
+
+func (s *MemoryStore) folderNameTaken(userID int64, name string, parentID *int64, excludeID int64) bool {
+	for id, folder := range s.folders {
+		if id == excludeID || s.folderTrashed(id) {
+			continue
+		}
+		if folder.UserID == userID && folder.Name == name && sameParent(folder.ParentID, parentID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) usernameTaken(username string, excludeID int64) bool {
+	for id, user := range s.users {
+		if id != excludeID && user.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+// inFolder reports whether an item in folderID sits in targetID, or anywhere
+// below it when recursive is set
+func (s *MemoryStore) inFolder(folderID *int64, targetID int64, recursive bool) bool {
+	if !recursive {
+		return folderID != nil && *folderID == targetID
+	}
+
+	for depth := 0; folderID != nil && depth <= 50; depth++ {
+		if s.folderTrashed(*folderID) {
+			return false
+		}
+		if *folderID == targetID {
+			return true
+		}
+		folderID = s.folders[*folderID].ParentID
+	}
+	return false
+}
+
+// childFolders returns the IDs of the live subfolders of folderID in ID order
+func (s *MemoryStore) childFolders(folderID int64) []int64 {
+	var children []int64
+	for id, folder := range s.folders {
+		if folder.ParentID != nil && *folder.ParentID == folderID && !s.folderTrashed(id) {
+			children = append(children, id)
+		}
+	}
+	slices.Sort(children)
+	return children
+}
+
+// moveFolderSnippets moves userID's live snippets in folderID to newFolderID
+// and returns their IDs
+func (s *MemoryStore) moveFolderSnippets(userID, folderID int64, newFolderID *int64, now time.Time) []int64 {
+	moved := []int64{}
+	for id, snippet := range s.snippets {
+		if snippet.UserID == userID && snippet.FolderID != nil && *snippet.FolderID == folderID && !s.snippetTrashed(id) {
+			snippet.FolderID = cloneInt64(newFolderID)
+			snippet.UpdatedAt = now
+			s.snippets[id] = snippet
+			moved = append(moved, id)
+		}
+	}
+	slices.Sort(moved)
+	return moved
+}
+
+func copyFolder(stored models.Folder) models.Folder {
+	folder := stored
+	folder.Description = cloneString(stored.Description)
+	folder.ParentID = cloneInt64(stored.ParentID)
+	return folder
+}
+
+func sameParent(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func cloneString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := *s
+	return &v
+}
+
+func cloneInt64(i *int64) *int64 {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
+
+// pageBounds converts page/limit into slice bounds the same way LIMIT/OFFSET would
+func pageBounds(page, limit, total int) (int, int) {
+	start := (page - 1) * limit
+	if start < 0 {
+		start = 0
+	}
+	if start > total {
+		start = total
+	}
+
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	return start, end
+}
+
+// searchTerms splits a search string into lowercase words, similar to plainto_tsquery
+func searchTerms(search string) []string {
+	return strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchSearchText applies the free text of a search in the given mode and
+// returns the snippet's rank. Hybrid mode matches either way and adds the
+// full-text rank and substring score up, like the SQL stores.
+func matchSearchText(snippet models.Snippet, include, exclude []SearchTerm, mode string) (float64, bool) {
+	fullText := mode != SearchModeSubstring
+	substring := mode != SearchModeFullText
+
+	var rank float64
+	if len(include) > 0 {
+		matched := false
+		if fullText {
+			if textRank, ok := rankSnippet(snippet, searchNeedles(include)); ok {
+				rank += textRank
+				matched = true
+			}
+		}
+		if substring {
+			if score, ok := substringScore(snippet, include); ok {
+				rank += score
+				matched = true
+			}
+		}
+		if !matched {
+			return 0, false
+		}
+	}
+
+	for _, term := range exclude {
+		terms := []SearchTerm{term}
+		if fullText {
+			if _, ok := rankSnippet(snippet, searchNeedles(terms)); ok {
+				return 0, false
+			}
+		}
+		if substring {
+			if _, ok := substringScore(snippet, terms); ok {
+				return 0, false
+			}
+		}
+	}
+
+	return rank, true
+}
+
+// substringScore requires every term to appear verbatim, ignoring case, in the
+// title or content, and scores title matches above content matches
+func substringScore(snippet models.Snippet, terms []SearchTerm) (float64, bool) {
+	title := strings.ToLower(snippet.Title)
+	content := strings.ToLower(snippet.Content)
+
+	var score float64
+	for _, term := range terms {
+		text := strings.ToLower(term.Value)
+		inTitle := strings.Contains(title, text)
+		inContent := strings.Contains(content, text)
+		if !inTitle && !inContent {
+			return 0, false
+		}
+		if inTitle {
+			score += titleWeight
+		}
+		if inContent {
+			score += contentWeight
+		}
+	}
+
+	return score, true
+}
+
+// searchNeedles turns free text terms into the strings rankSnippet looks for:
+// every word on its own, and each phrase as its words joined by a space
+func searchNeedles(terms []SearchTerm) []string {
+	var needles []string
+	for _, term := range terms {
+		words := searchTerms(term.Value)
+		if len(words) == 0 {
+			continue
+		}
+		if term.Phrase {
+			needles = append(needles, strings.Join(words, " "))
+		} else {
+			needles = append(needles, words...)
+		}
+	}
+	return needles
+}
+
+// rankSnippet approximates ts_rank over document_with_weights. Every term must
+// appear somewhere in the snippet, and matches in the title outrank matches in
+// the description, which outrank matches in the content.
+func rankSnippet(snippet models.Snippet, terms []string) (float64, bool) {
+	if len(terms) == 0 {
+		return 0, false
+	}
+
+	// Normalize to words separated by single spaces so phrases match across
+	// punctuation and line breaks
+	title := strings.Join(searchTerms(snippet.Title), " ")
+	content := strings.Join(searchTerms(snippet.Content), " ")
+	description := ""
+	if snippet.Description != nil {
+		description = strings.Join(searchTerms(*snippet.Description), " ")
+	}
+	identifiers := snippetSearchTokens(&snippet)
+
+	var rank float64
+	for _, term := range terms {
+		var termRank float64
+		if strings.Contains(title, term) {
+			termRank += titleWeight
+		}
+		if strings.Contains(description, term) {
+			termRank += descriptionWeight
+		}
+		if strings.Contains(content, term) {
+			termRank += contentWeight
+		}
+		if strings.Contains(identifiers, term) {
+			termRank += identifierWeight
+		}
+		if termRank == 0 {
+			return 0, false
+		}
+		rank += termRank
+	}
+
+	return rank, true
+}
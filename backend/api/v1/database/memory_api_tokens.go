@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *MemoryStore) CreateAPIToken(ctx context.Context, token *models.APIToken, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.apiTokens {
+		if stored.UserID == token.UserID && stored.Name == token.Name {
+			return fmt.Errorf("API token name already exists")
+		}
+	}
+
+	s.lastAPITokenID++
+	token.ID = s.lastAPITokenID
+	token.LastUsedAt = nil
+	token.CreatedAt = time.Now()
+	s.apiTokens[token.ID] = copyAPIToken(*token)
+	s.apiTokenHashes[tokenHash] = token.ID
+
+	return nil
+}
+
+func (s *MemoryStore) GetAPIToken(ctx context.Context, tokenID int64) (*models.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.apiTokens[tokenID]
+	if !ok {
+		return nil, fmt.Errorf("API token with ID %d does not exist: %w", tokenID, ErrNoAPITokenError)
+	}
+
+	token := copyAPIToken(stored)
+	return &token, nil
+}
+
+func (s *MemoryStore) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.apiTokens[s.apiTokenHashes[tokenHash]]
+	if !ok || !stored.ExpiresAt.After(time.Now()) {
+		return nil, ErrNoAPITokenError
+	}
+
+	token := copyAPIToken(stored)
+	return &token, nil
+}
+
+func (s *MemoryStore) GetAPITokens(ctx context.Context, userID int64) ([]models.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := []models.APIToken{}
+	for _, stored := range s.apiTokens {
+		if stored.UserID == userID {
+			tokens = append(tokens, copyAPIToken(stored))
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+		}
+		return tokens[i].ID > tokens[j].ID
+	})
+
+	return tokens, nil
+}
+
+func (s *MemoryStore) TouchAPIToken(ctx context.Context, tokenID int64, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.apiTokens[tokenID]
+	if !ok {
+		return nil
+	}
+
+	if stored.LastUsedAt == nil || stored.LastUsedAt.Before(usedAt.Add(-apiTokenTouchInterval)) {
+		stored.LastUsedAt = &usedAt
+		s.apiTokens[tokenID] = stored
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteAPIToken(ctx context.Context, tokenID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apiTokens[tokenID]; !ok {
+		return fmt.Errorf("API token with ID %d does not exist: %w", tokenID, ErrNoAPITokenError)
+	}
+
+	s.deleteAPITokens(func(token models.APIToken) bool { return token.ID == tokenID })
+	return nil
+}
+
+// deleteAPITokens removes the tokens matching fn along with their hashes.
+// Assumes s.mu is held.
+func (s *MemoryStore) deleteAPITokens(fn func(models.APIToken) bool) {
+	for hash, tokenID := range s.apiTokenHashes {
+		if fn(s.apiTokens[tokenID]) {
+			delete(s.apiTokenHashes, hash)
+			delete(s.apiTokens, tokenID)
+		}
+	}
+}
+
+// copyAPIToken deep copies a token so callers can't modify stored state
+func copyAPIToken(token models.APIToken) models.APIToken {
+	token.Scopes = slices.Clone(token.Scopes)
+	token.FolderID = cloneInt64(token.FolderID)
+	if token.LastUsedAt != nil {
+		lastUsedAt := *token.LastUsedAt
+		token.LastUsedAt = &lastUsedAt
+	}
+	return token
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *MemoryStore) GetIdentity(ctx context.Context, identityID int64) (*models.UserIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identity, ok := s.identities[identityID]
+	if !ok {
+		return nil, fmt.Errorf("identity with ID %d does not exist: %w", identityID, ErrNoIdentityError)
+	}
+	return &identity, nil
+}
+
+func (s *MemoryStore) GetIdentityBySubject(ctx context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, identity := range s.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, ErrNoIdentityError
+}
+
+func (s *MemoryStore) GetIdentities(ctx context.Context, userID int64) ([]models.UserIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identities := []models.UserIdentity{}
+	for _, identity := range s.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].ID < identities[j].ID
+	})
+
+	return identities, nil
+}
+
+func (s *MemoryStore) CreateIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[identity.UserID]; !ok {
+		return fmt.Errorf("%w: failed to insert identity", ErrDatabaseError)
+	}
+
+	return s.insertIdentity(identity, time.Now())
+}
+
+func (s *MemoryStore) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usernameTaken(user.Username, 0) {
+		return fmt.Errorf("%w: username '%s' is already taken", ErrUsernameExists, user.Username)
+	}
+	if s.identityLinked(identity.Issuer, identity.Subject) {
+		return ErrIdentityExistsError
+	}
+
+	now := time.Now()
+
+	s.lastUserID++
+	user.ID = s.lastUserID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.TokenGeneration = 0
+	s.users[user.ID] = UserWithPassword{User: *user}
+
+	identity.UserID = user.ID
+	return s.insertIdentity(identity, now)
+}
+
+func (s *MemoryStore) DeleteIdentity(ctx context.Context, identityID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.identities[identityID]; !ok {
+		return fmt.Errorf("identity with ID %d does not exist: %w", identityID, ErrNoIdentityError)
+	}
+
+	delete(s.identities, identityID)
+	return nil
+}
+
+// insertIdentity mirrors the UNIQUE (issuer, subject) constraint. Assumes
+// s.mu is held.
+func (s *MemoryStore) insertIdentity(identity *models.UserIdentity, now time.Time) error {
+	if s.identityLinked(identity.Issuer, identity.Subject) {
+		return ErrIdentityExistsError
+	}
+
+	s.lastIdentityID++
+	identity.ID = s.lastIdentityID
+	identity.CreatedAt = now
+	s.identities[identity.ID] = *identity
+
+	return nil
+}
+
+// identityLinked assumes s.mu is held
+func (s *MemoryStore) identityLinked(issuer, subject string) bool {
+	for _, identity := range s.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// BackfillMinHashes has nothing to do, content is signed whenever it is
+// compared
+func (s *MemoryStore) BackfillMinHashes(ctx context.Context, limit int) (int, error) {
+	return 0, nil
+}
+
+// GetSimilarityCandidates signs each of the user's snippets to see which
+// share a band key, the memory store keeps no index of them
+func (s *MemoryStore) GetSimilarityCandidates(ctx context.Context, userID, exceptID int64, bandKeys []int64) ([]SnippetSignature, error) {
+	wanted := make(map[int64]bool, len(bandKeys))
+	for _, key := range bandKeys {
+		wanted[key] = true
+	}
+
+	var candidates []SnippetSignature
+	err := s.WalkSnippetSignatures(ctx, userID, func(candidate *SnippetSignature) error {
+		signature := candidate.signature()
+		if candidate.Snippet.ID == exceptID || signature == nil {
+			return nil
+		}
+		for _, key := range signature.bandKeys() {
+			if wanted[key] {
+				candidates = append(candidates, *candidate)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return candidates, nil
+}
+
+// WalkSnippetSignatures signs the user's snippets as it walks them
+func (s *MemoryStore) WalkSnippetSignatures(ctx context.Context, userID int64, fn func(*SnippetSignature) error) error {
+	return s.WalkSnippets(ctx, userID, func(snippet *models.Snippet) error {
+		return fn(&SnippetSignature{
+			Snippet: newSimilarSnippet(snippet, 0),
+			MinHash: encodeMinHash(newMinHashSignature(snippet.Content)),
+		})
+	})
+}
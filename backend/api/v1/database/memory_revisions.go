@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *MemoryStore) GetSnippetRevisions(ctx context.Context, snippetID int64, page, limit int) ([]models.SnippetRevision, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored := s.revisions[snippetID]
+
+	// Newest first, matching ORDER BY revision DESC
+	matches := make([]models.SnippetRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		matches = append(matches, stored[i])
+	}
+
+	total := len(matches)
+	start, end := pageBounds(page, limit, total)
+
+	var revisions []models.SnippetRevision
+	for _, match := range matches[start:end] {
+		revision := copyRevision(match)
+		revision.Content = ""
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, total, nil
+}
+
+func (s *MemoryStore) GetSnippetRevision(ctx context.Context, snippetID int64, revisionNumber int) (*models.SnippetRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, stored := range s.revisions[snippetID] {
+		if stored.Revision == revisionNumber {
+			revision := copyRevision(stored)
+			return &revision, nil
+		}
+	}
+
+	return nil, ErrNoRevisionError
+}
+
+// insertSnippetRevision snapshots the stored snippet and its tags, the caller
+// must hold s.mu
+func (s *MemoryStore) insertSnippetRevision(snippetID int64, createdAt time.Time) {
+	snippet := s.snippets[snippetID]
+
+	tags := s.snippetTagNames(snippetID)
+	if tags == nil {
+		tags = []string{}
+	}
+
+	s.lastRevisionID++
+	s.revisions[snippetID] = append(s.revisions[snippetID], models.SnippetRevision{
+		ID:          s.lastRevisionID,
+		SnippetID:   snippetID,
+		Revision:    len(s.revisions[snippetID]) + 1,
+		Title:       snippet.Title,
+		Description: cloneString(snippet.Description),
+		Content:     snippet.Content,
+		Language:    snippet.Language,
+		Tags:        tags,
+		CreatedAt:   createdAt,
+	})
+}
+
+func copyRevision(stored models.SnippetRevision) models.SnippetRevision {
+	revision := stored
+	revision.Description = cloneString(stored.Description)
+	revision.Tags = append([]string{}, stored.Tags...)
+	return revision
+}
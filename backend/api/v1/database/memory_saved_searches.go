@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *MemoryStore) CreateSavedSearch(ctx context.Context, search *models.SavedSearch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.savedSearchNameTaken(search.UserID, search.Name, 0) {
+		return fmt.Errorf("saved search name already exists")
+	}
+
+	now := time.Now()
+
+	s.lastSavedSearchID++
+	search.ID = s.lastSavedSearchID
+	search.CreatedAt = now
+	search.UpdatedAt = now
+	s.savedSearches[search.ID] = copySavedSearch(*search)
+
+	return nil
+}
+
+func (s *MemoryStore) GetSavedSearch(ctx context.Context, searchID int64) (*models.SavedSearch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.savedSearches[searchID]
+	if !ok {
+		return nil, fmt.Errorf("saved search with ID %d does not exist: %w", searchID, ErrNoSavedSearchError)
+	}
+
+	search := copySavedSearch(stored)
+	return &search, nil
+}
+
+func (s *MemoryStore) GetSavedSearches(ctx context.Context, userID int64) ([]models.SavedSearch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var searches []models.SavedSearch
+	for _, stored := range s.savedSearches {
+		if stored.UserID == userID {
+			searches = append(searches, copySavedSearch(stored))
+		}
+	}
+
+	sort.Slice(searches, func(i, j int) bool {
+		return searches[i].Name < searches[j].Name
+	})
+
+	return searches, nil
+}
+
+func (s *MemoryStore) UpdateSavedSearch(ctx context.Context, searchID int64, search *models.SavedSearch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.savedSearches[searchID]
+	if !ok {
+		return fmt.Errorf("saved search with ID %d does not exist: %w", searchID, ErrNoSavedSearchError)
+	}
+
+	if s.savedSearchNameTaken(stored.UserID, search.Name, searchID) {
+		return fmt.Errorf("saved search name already exists")
+	}
+
+	stored.Name = search.Name
+	stored.Query = search.Query
+	stored.Filters = search.Filters
+	stored.UpdatedAt = time.Now()
+	s.savedSearches[searchID] = copySavedSearch(stored)
+
+	search.ID = searchID
+	search.UserID = stored.UserID
+	search.UpdatedAt = stored.UpdatedAt
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteSavedSearch(ctx context.Context, searchID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.savedSearches[searchID]; !ok {
+		return fmt.Errorf("saved search with ID %d does not exist: %w", searchID, ErrNoSavedSearchError)
+	}
+
+	delete(s.savedSearches, searchID)
+	return nil
+}
+
+// savedSearchNameTaken reports whether the user has another saved search
+// called name. Assumes s.mu is held.
+func (s *MemoryStore) savedSearchNameTaken(userID int64, name string, excludeID int64) bool {
+	for id, search := range s.savedSearches {
+		if id != excludeID && search.UserID == userID && search.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// copySavedSearch deep copies a saved search so callers can't modify stored state
+func copySavedSearch(search models.SavedSearch) models.SavedSearch {
+	search.Filters.FolderID = cloneInt64(search.Filters.FolderID)
+	search.Filters.Tags = slices.Clone(search.Filters.Tags)
+	if search.Filters.IsFavorite != nil {
+		favorite := *search.Filters.IsFavorite
+		search.Filters.IsFavorite = &favorite
+	}
+	return search
+}
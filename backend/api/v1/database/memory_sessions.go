@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// sessionToken is one refresh token of a session, like a sessions row. The
+// session ID names the family.
+type sessionToken struct {
+	session    models.Session
+	replaced   bool
+	replacedAt time.Time
+	revoked    bool
+}
+
+// live reports whether the token is the current one of a session that can
+// still be used
+func (t sessionToken) live(now time.Time) bool {
+	return !t.replaced && !t.revoked && t.session.ExpiresAt.After(now)
+}
+
+func (s *MemoryStore) CreateSession(ctx context.Context, session *models.Session, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	s.lastSessionID++
+	session.ID = s.lastSessionID
+	session.SignedInAt = now
+	session.LastUsedAt = now
+	s.sessionTokens[tokenHash] = sessionToken{session: *session}
+
+	return nil
+}
+
+func (s *MemoryStore) GetSession(ctx context.Context, sessionID int64) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for _, token := range s.sessionTokens {
+		if token.session.ID == sessionID && token.live(now) {
+			session := token.session
+			return &session, nil
+		}
+	}
+
+	return nil, ErrNoSessionError
+}
+
+func (s *MemoryStore) GetSessionByToken(ctx context.Context, tokenHash string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.sessionTokens[tokenHash]
+	if !ok || !token.live(time.Now()) {
+		return nil, ErrNoSessionError
+	}
+
+	session := token.session
+	return &session, nil
+}
+
+func (s *MemoryStore) GetSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// A session refreshed twice within refreshReuseGrace has two live tokens,
+	// only the most recently used is listed
+	now := time.Now()
+	latest := make(map[int64]models.Session)
+	for _, token := range s.sessionTokens {
+		if token.session.UserID != userID || !token.live(now) {
+			continue
+		}
+		if seen, ok := latest[token.session.ID]; !ok || token.session.LastUsedAt.After(seen.LastUsedAt) {
+			latest[token.session.ID] = token.session
+		}
+	}
+
+	sessions := []models.Session{}
+	for _, session := range latest {
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+
+	return sessions, nil
+}
+
+func (s *MemoryStore) RotateSession(ctx context.Context, tokenHash, newTokenHash, ipAddress string, expiresAt time.Time) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	token, ok := s.sessionTokens[tokenHash]
+	if !ok || token.revoked || !token.session.ExpiresAt.After(now) {
+		return nil, ErrNoSessionError
+	}
+
+	if token.replaced && now.Sub(token.replacedAt) >= refreshReuseGrace {
+		s.revokeSession(token.session.ID)
+		return nil, fmt.Errorf("session %d revoked: %w", token.session.ID, ErrSessionReuseError)
+	}
+
+	// A token replaced moments ago keeps its time, so reusing it again
+	// doesn't stretch the grace
+	if !token.replaced {
+		token.replaced = true
+		token.replacedAt = now
+		s.sessionTokens[tokenHash] = token
+	}
+
+	session := token.session
+	session.IPAddress = ipAddress
+	session.LastUsedAt = now
+	session.ExpiresAt = expiresAt
+	s.sessionTokens[newTokenHash] = sessionToken{session: session}
+
+	return &session, nil
+}
+
+func (s *MemoryStore) RevokeSession(ctx context.Context, sessionID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.revokeSession(sessionID) == 0 {
+		return fmt.Errorf("session with ID %d does not exist: %w", sessionID, ErrNoSessionError)
+	}
+	return nil
+}
+
+func (s *MemoryStore) RevokeUserSessions(ctx context.Context, userID, exceptID int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.revokeUserSessions(userID, exceptID), nil
+}
+
+func (s *MemoryStore) PurgeSessions(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for hash, token := range s.sessionTokens {
+		if token.session.ExpiresAt.Before(before) {
+			delete(s.sessionTokens, hash)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// revokeSession revokes every token of the session and returns how many it
+// revoked. Assumes s.mu is held.
+func (s *MemoryStore) revokeSession(sessionID int64) int {
+	revoked := 0
+	for hash, token := range s.sessionTokens {
+		if token.session.ID == sessionID && !token.revoked {
+			token.revoked = true
+			s.sessionTokens[hash] = token
+			revoked++
+		}
+	}
+	return revoked
+}
+
+// revokeUserSessions revokes every session of the user but exceptID and
+// returns how many were live. Assumes s.mu is held.
+func (s *MemoryStore) revokeUserSessions(userID, exceptID int64) int {
+	now := time.Now()
+	revoked := make(map[int64]bool)
+	for hash, token := range s.sessionTokens {
+		if token.session.UserID != userID || token.session.ID == exceptID || token.revoked {
+			continue
+		}
+		if token.live(now) {
+			revoked[token.session.ID] = true
+		}
+		token.revoked = true
+		s.sessionTokens[hash] = token
+	}
+	return len(revoked)
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// suggestionUsage is a tag, folder or language completion being ranked
+type suggestionUsage struct {
+	suggestion models.Suggestion
+	lastUsed   time.Time
+}
+
+func (s *MemoryStore) Suggest(ctx context.Context, userID int64, prefix string, limit int) (*models.Suggestions, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefix = strings.ToLower(prefix)
+	matches := func(value string) bool {
+		return strings.HasPrefix(strings.ToLower(value), prefix)
+	}
+
+	var snippets []models.Snippet
+	tags := make(map[int64]*suggestionUsage)
+	folders := make(map[int64]*suggestionUsage)
+	languages := make(map[string]*suggestionUsage)
+
+	for id, tag := range s.tags {
+		if tag.UserID == userID && matches(tag.Name) {
+			tags[id] = &suggestionUsage{
+				suggestion: models.Suggestion{ID: cloneInt64(&tag.ID), Value: tag.Name},
+				lastUsed:   tag.CreatedAt,
+			}
+		}
+	}
+	for id, folder := range s.folders {
+		if folder.UserID == userID && !s.folderTrashed(id) && matches(folder.Name) {
+			folders[id] = &suggestionUsage{
+				suggestion: models.Suggestion{ID: cloneInt64(&folder.ID), Value: folder.Name},
+				lastUsed:   folder.UpdatedAt,
+			}
+		}
+	}
+
+	// Only the first suggestCandidates names are ranked, like the SQL stores
+	capSuggestCandidates(tags)
+	capSuggestCandidates(folders)
+
+	for _, snippet := range s.snippets {
+		if snippet.UserID != userID || s.snippetTrashed(snippet.ID) {
+			continue
+		}
+
+		if matches(snippet.Title) {
+			snippets = append(snippets, snippet)
+		}
+
+		// The first use replaces the creation time, later ones only move it on
+		use := func(usage *suggestionUsage) {
+			if usage.suggestion.Count == 0 || snippet.UpdatedAt.After(usage.lastUsed) {
+				usage.lastUsed = snippet.UpdatedAt
+			}
+			usage.suggestion.Count++
+		}
+
+		for tagID := range s.snippetTags[snippet.ID] {
+			if usage, ok := tags[tagID]; ok {
+				use(usage)
+			}
+		}
+		if snippet.FolderID != nil {
+			if usage, ok := folders[*snippet.FolderID]; ok {
+				use(usage)
+			}
+		}
+		if matches(snippet.Language) {
+			if languages[snippet.Language] == nil {
+				languages[snippet.Language] = &suggestionUsage{suggestion: models.Suggestion{Value: snippet.Language}}
+			}
+			use(languages[snippet.Language])
+		}
+	}
+
+	sort.Slice(snippets, func(i, j int) bool {
+		a, b := snippets[i], snippets[j]
+		if a.IsFavorite != b.IsFavorite {
+			return a.IsFavorite
+		}
+		if !a.UpdatedAt.Equal(b.UpdatedAt) {
+			return a.UpdatedAt.After(b.UpdatedAt)
+		}
+		return a.ID > b.ID
+	})
+
+	suggestions := &models.Suggestions{Snippets: []models.Suggestion{}}
+	for _, snippet := range snippets[:min(len(snippets), limit)] {
+		suggestions.Snippets = append(suggestions.Snippets, models.Suggestion{ID: cloneInt64(&snippet.ID), Value: snippet.Title})
+	}
+	suggestions.Tags = rankSuggestions(slices.Collect(maps.Values(tags)), limit)
+	suggestions.Folders = rankSuggestions(slices.Collect(maps.Values(folders)), limit)
+	suggestions.Languages = rankSuggestions(slices.Collect(maps.Values(languages)), limit)
+
+	return suggestions, nil
+}
+
+// rankSuggestions orders completions by usage, then recency, then name, and
+// keeps the first limit
+func rankSuggestions(ranked []*suggestionUsage, limit int) []models.Suggestion {
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.suggestion.Count != b.suggestion.Count {
+			return a.suggestion.Count > b.suggestion.Count
+		}
+		if !a.lastUsed.Equal(b.lastUsed) {
+			return a.lastUsed.After(b.lastUsed)
+		}
+		return a.suggestion.Value < b.suggestion.Value
+	})
+
+	suggestions := []models.Suggestion{}
+	for _, usage := range ranked[:min(len(ranked), limit)] {
+		suggestions = append(suggestions, usage.suggestion)
+	}
+	return suggestions
+}
+
+// capSuggestCandidates keeps the first suggestCandidates tags or folders in
+// order of name, ignoring case
+func capSuggestCandidates(candidates map[int64]*suggestionUsage) {
+	if len(candidates) <= suggestCandidates {
+		return
+	}
+
+	ids := slices.Collect(maps.Keys(candidates))
+	sort.Slice(ids, func(i, j int) bool {
+		a := strings.ToLower(candidates[ids[i]].suggestion.Value)
+		b := strings.ToLower(candidates[ids[j]].suggestion.Value)
+		if a != b {
+			return a < b
+		}
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids[suggestCandidates:] {
+		delete(candidates, id)
+	}
+}
@@ -0,0 +1,437 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// trashEntry marks a soft-deleted snippet or folder, mirroring the deleted_at
+// and trash_path columns
+type trashEntry struct {
+	deletedAt time.Time
+	path      []string
+}
+
+func (s *MemoryStore) GetTrash(ctx context.Context, page, limit int, userID int64, itemType string) ([]models.TrashItem, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []models.TrashItem
+	if itemType == "" || itemType == models.TrashTypeSnippet {
+		for id, entry := range s.snippetTrash {
+			snippet := s.snippets[id]
+			if snippet.UserID != userID {
+				continue
+			}
+			matches = append(matches, models.TrashItem{
+				Type:      models.TrashTypeSnippet,
+				ID:        id,
+				Name:      snippet.Title,
+				ParentID:  cloneInt64(snippet.FolderID),
+				Path:      append([]string{}, entry.path...),
+				DeletedAt: entry.deletedAt,
+			})
+		}
+	}
+	if itemType == "" || itemType == models.TrashTypeFolder {
+		for id, entry := range s.folderTrash {
+			folder := s.folders[id]
+			if folder.UserID != userID {
+				continue
+			}
+			matches = append(matches, models.TrashItem{
+				Type:      models.TrashTypeFolder,
+				ID:        id,
+				Name:      folder.Name,
+				ParentID:  cloneInt64(folder.ParentID),
+				Path:      append([]string{}, entry.path...),
+				DeletedAt: entry.deletedAt,
+			})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].DeletedAt.Equal(matches[j].DeletedAt) {
+			return matches[i].DeletedAt.After(matches[j].DeletedAt)
+		}
+		return matches[i].ID > matches[j].ID
+	})
+
+	total := len(matches)
+	start, end := pageBounds(page, limit, total)
+
+	var items []models.TrashItem
+	items = append(items, matches[start:end]...)
+
+	return items, total, nil
+}
+
+func (s *MemoryStore) GetTrashedSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.snippetTrashed(snippetID) {
+		return nil, ErrNoSnippetError
+	}
+
+	snippet := s.copySnippet(s.snippets[snippetID])
+	return &snippet, nil
+}
+
+func (s *MemoryStore) GetTrashedFolder(ctx context.Context, folderID int64) (*models.Folder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.folderTrashed(folderID) {
+		return nil, ErrNoFolderError
+	}
+
+	folder := copyFolder(s.folders[folderID])
+	return &folder, nil
+}
+
+func (s *MemoryStore) RestoreSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.snippetTrash[snippetID]
+	if !ok {
+		return nil, fmt.Errorf("snippet with ID %d is not in the trash: %w", snippetID, ErrNoSnippetError)
+	}
+
+	stored := s.snippets[snippetID]
+	now := time.Now()
+
+	folderID, err := s.restoreFolderChain(stored.UserID, stored.FolderID, entry.path, now, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	stored.FolderID = folderID
+	stored.UpdatedAt = now
+	s.snippets[snippetID] = stored
+	delete(s.snippetTrash, snippetID)
+
+	snippet := s.copySnippet(stored)
+	return &snippet, nil
+}
+
+func (s *MemoryStore) RestoreFolder(ctx context.Context, folderID int64) (*models.Folder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.folderTrash[folderID]
+	if !ok {
+		return nil, fmt.Errorf("folder with ID %d is not in the trash: %w", folderID, ErrNoFolderError)
+	}
+
+	stored := s.folders[folderID]
+	now := time.Now()
+
+	// Check the name before touching anything, so a failed restore leaves the
+	// trash as it was, like the rolled back SQL transaction
+	parentID, err := s.resolveFolderChain(stored.UserID, stored.ParentID, entry.path, 0)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil || len(entry.path) == 0 {
+		if s.findLiveFolder(stored.UserID, stored.Name, parentID) != 0 {
+			return nil, fmt.Errorf("folder name already exists in this location")
+		}
+	}
+
+	parentID, err = s.restoreFolderChain(stored.UserID, stored.ParentID, entry.path, now, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	s.restoreFolderContents(stored.UserID, folderID, entry.deletedAt, now)
+
+	stored.ParentID = parentID
+	stored.UpdatedAt = now
+	s.folders[folderID] = stored
+	delete(s.folderTrash, folderID)
+
+	folder := copyFolder(stored)
+	return &folder, nil
+}
+
+func (s *MemoryStore) PurgeSnippet(ctx context.Context, snippetID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.snippetTrashed(snippetID) {
+		return fmt.Errorf("snippet with ID %d is not in the trash: %w", snippetID, ErrNoSnippetError)
+	}
+
+	s.purgeSnippet(snippetID)
+
+	return nil
+}
+
+func (s *MemoryStore) PurgeFolder(ctx context.Context, folderID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.folderTrashed(folderID) {
+		return fmt.Errorf("folder with ID %d is not in the trash: %w", folderID, ErrNoFolderError)
+	}
+
+	s.purgeFolder(folderID)
+
+	return nil
+}
+
+func (s *MemoryStore) EmptyTrash(ctx context.Context, userID int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id := range s.snippetTrash {
+		if s.snippets[id].UserID == userID {
+			s.purgeSnippet(id)
+			purged++
+		}
+	}
+	for id := range s.folderTrash {
+		if s.folders[id].UserID == userID {
+			s.purgeFolder(id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (s *MemoryStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, entry := range s.snippetTrash {
+		if entry.deletedAt.Before(before) {
+			s.purgeSnippet(id)
+			purged++
+		}
+	}
+	for id, entry := range s.folderTrash {
+		if entry.deletedAt.Before(before) {
+			s.purgeFolder(id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// Helpers below expect the caller to hold s.mu
+
+func (s *MemoryStore) snippetTrashed(snippetID int64) bool {
+	_, ok := s.snippetTrash[snippetID]
+	return ok
+}
+
+func (s *MemoryStore) folderTrashed(folderID int64) bool {
+	_, ok := s.folderTrash[folderID]
+	return ok
+}
+
+func (s *MemoryStore) purgeSnippet(snippetID int64) {
+	delete(s.snippets, snippetID)
+	delete(s.snippetTags, snippetID)
+	delete(s.revisions, snippetID)
+	delete(s.snippetTrash, snippetID)
+}
+
+// purgeFolder removes a folder, mirroring ON DELETE SET NULL for anything in it
+// and ON DELETE CASCADE for the API tokens limited to it
+func (s *MemoryStore) purgeFolder(folderID int64) {
+	for id, snippet := range s.snippets {
+		if snippet.FolderID != nil && *snippet.FolderID == folderID {
+			snippet.FolderID = nil
+			s.snippets[id] = snippet
+		}
+	}
+	for id, folder := range s.folders {
+		if folder.ParentID != nil && *folder.ParentID == folderID {
+			folder.ParentID = nil
+			s.folders[id] = folder
+		}
+	}
+
+	s.deleteAPITokens(func(token models.APIToken) bool {
+		return token.FolderID != nil && *token.FolderID == folderID
+	})
+
+	delete(s.folders, folderID)
+	delete(s.folderTrash, folderID)
+}
+
+// restoreFolderContents restores the folders and snippets below folderID that
+// were trashed at deletedAt, i.e. along with it by a cascading delete. Only
+// userID's snippets are restored. A subfolder whose name a live folder has
+// taken comes back as "name (2)" and so on, like a reparented one.
+func (s *MemoryStore) restoreFolderContents(userID, folderID int64, deletedAt, now time.Time) {
+	queue := []int64{folderID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		for snippetID, snippet := range s.snippets {
+			entry, trashed := s.snippetTrash[snippetID]
+			if trashed && snippet.UserID == userID && entry.deletedAt.Equal(deletedAt) && snippet.FolderID != nil && *snippet.FolderID == id {
+				snippet.UpdatedAt = now
+				s.snippets[snippetID] = snippet
+				delete(s.snippetTrash, snippetID)
+			}
+		}
+
+		var children []int64
+		for childID, child := range s.folders {
+			entry, trashed := s.folderTrash[childID]
+			if trashed && entry.deletedAt.Equal(deletedAt) && child.ParentID != nil && *child.ParentID == id {
+				children = append(children, childID)
+			}
+		}
+		sort.Slice(children, func(i, j int) bool { return children[i] < children[j] })
+
+		for _, childID := range children {
+			child := s.folders[childID]
+
+			name := child.Name
+			for n := 2; s.findLiveFolder(userID, name, child.ParentID) != 0; n++ {
+				name = folderCopyName(child.Name, n)
+			}
+
+			child.Name = name
+			child.UpdatedAt = now
+			s.folders[childID] = child
+			delete(s.folderTrash, childID)
+			queue = append(queue, childID)
+		}
+	}
+}
+
+// folderPath returns the names of folderID and its ancestors, root first
+func (s *MemoryStore) folderPath(folderID *int64) []string {
+	path := []string{}
+	for depth := 0; folderID != nil && depth <= 50; depth++ {
+		folder, ok := s.folders[*folderID]
+		if !ok {
+			break
+		}
+		path = append([]string{folder.Name}, path...)
+		folderID = folder.ParentID
+	}
+	return path
+}
+
+// restoreFolderChain makes sure the folder a restored item goes back into is
+// live and returns its ID. A trashed parent is restored along with its own
+// parents, unless a live folder has taken its name, in which case the item
+// joins that folder instead. A purged parent is re-created from path.
+func (s *MemoryStore) restoreFolderChain(userID int64, folderID *int64, path []string, now time.Time, depth int) (*int64, error) {
+	// Prevent infinite recursion
+	if depth > 50 {
+		return nil, fmt.Errorf("maximum folder depth exceeded")
+	}
+
+	if folderID != nil {
+		entry, trashed := s.folderTrash[*folderID]
+		if !trashed {
+			return cloneInt64(folderID), nil
+		}
+
+		folder := s.folders[*folderID]
+		parentID, err := s.restoreFolderChain(userID, folder.ParentID, entry.path, now, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		if existingID := s.findLiveFolder(userID, folder.Name, parentID); existingID != 0 {
+			return &existingID, nil
+		}
+
+		folder.ParentID = parentID
+		folder.UpdatedAt = now
+		s.folders[folder.ID] = folder
+		delete(s.folderTrash, folder.ID)
+
+		return cloneInt64(folderID), nil
+	}
+
+	var parentID *int64
+	for _, name := range path {
+		id := s.findLiveFolder(userID, name, parentID)
+		if id == 0 {
+			s.lastFolderID++
+			id = s.lastFolderID
+			s.folders[id] = models.Folder{
+				ID:        id,
+				UserID:    userID,
+				Name:      name,
+				ParentID:  cloneInt64(parentID),
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+		}
+		parentID = &id
+	}
+
+	return parentID, nil
+}
+
+// resolveFolderChain works out where restoreFolderChain would put an item
+// without changing anything. It returns nil for a chain that does not exist
+// yet and would be created.
+func (s *MemoryStore) resolveFolderChain(userID int64, folderID *int64, path []string, depth int) (*int64, error) {
+	// Prevent infinite recursion
+	if depth > 50 {
+		return nil, fmt.Errorf("maximum folder depth exceeded")
+	}
+
+	if folderID != nil {
+		entry, trashed := s.folderTrash[*folderID]
+		if !trashed {
+			return cloneInt64(folderID), nil
+		}
+
+		folder := s.folders[*folderID]
+		parentID, err := s.resolveFolderChain(userID, folder.ParentID, entry.path, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		if existingID := s.findLiveFolder(userID, folder.Name, parentID); existingID != 0 {
+			return &existingID, nil
+		}
+
+		return cloneInt64(folderID), nil
+	}
+
+	var parentID *int64
+	for _, name := range path {
+		id := s.findLiveFolder(userID, name, parentID)
+		if id == 0 {
+			return nil, nil
+		}
+		parentID = &id
+	}
+
+	return parentID, nil
+}
+
+// findLiveFolder returns the ID of the user's live folder with this name and
+// parent, or 0 if there is none
+func (s *MemoryStore) findLiveFolder(userID int64, name string, parentID *int64) int64 {
+	for id, folder := range s.folders {
+		if folder.UserID == userID && folder.Name == name && sameParent(folder.ParentID, parentID) && !s.folderTrashed(id) {
+			return id
+		}
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *MemoryStore) GetTwoFactor(ctx context.Context, userID int64) (*models.TwoFactor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.twoFactor[userID]
+	if !ok {
+		return nil, ErrNoTwoFactorError
+	}
+
+	if stored.EnabledAt != nil {
+		enabledAt := *stored.EnabledAt
+		stored.EnabledAt = &enabledAt
+	}
+	if stored.LockedAt != nil {
+		lockedAt := *stored.LockedAt
+		stored.LockedAt = &lockedAt
+	}
+	return &stored, nil
+}
+
+func (s *MemoryStore) SetTwoFactorSecret(ctx context.Context, userID int64, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.twoFactor[userID]; ok && stored.Enabled() {
+		return ErrTwoFactorEnabledError
+	}
+
+	s.twoFactor[userID] = models.TwoFactor{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (s *MemoryStore) EnableTwoFactor(ctx context.Context, userID, step int64, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.twoFactor[userID]
+	if !ok || stored.Enabled() {
+		return ErrNoTwoFactorError
+	}
+
+	now := time.Now()
+	stored.EnabledAt = &now
+	stored.LastStep = step
+	s.twoFactor[userID] = stored
+
+	codes := make(map[string]bool, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		codes[codeHash] = false
+	}
+	s.recoveryCodes[userID] = codes
+
+	return nil
+}
+
+func (s *MemoryStore) UseTwoFactorStep(ctx context.Context, userID, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.twoFactor[userID]
+	if !ok || !stored.Enabled() || stored.LastStep >= step {
+		return ErrTwoFactorCodeUsedError
+	}
+
+	stored.LastStep = step
+	s.twoFactor[userID] = stored
+	return nil
+}
+
+func (s *MemoryStore) RecordTwoFactorFailure(ctx context.Context, userID int64, maxAttempts int) (*time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.twoFactor[userID]
+	if !ok {
+		return nil, ErrNoTwoFactorError
+	}
+
+	var lockedAt *time.Time
+	stored.FailedAttempts++
+	if stored.FailedAttempts >= maxAttempts {
+		now := time.Now()
+		stored.FailedAttempts = 0
+		stored.LockedAt = &now
+		lockedAt = new(time.Time)
+		*lockedAt = now
+	}
+	s.twoFactor[userID] = stored
+
+	return lockedAt, nil
+}
+
+func (s *MemoryStore) ResetTwoFactorFailures(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.twoFactor[userID]; ok {
+		stored.FailedAttempts = 0
+		s.twoFactor[userID] = stored
+	}
+	return nil
+}
+
+func (s *MemoryStore) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used, ok := s.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return ErrNoRecoveryCodeError
+	}
+
+	s.recoveryCodes[userID][codeHash] = true
+	return nil
+}
+
+func (s *MemoryStore) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, used := range s.recoveryCodes[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) DisableTwoFactor(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.twoFactor[userID]; !ok {
+		return ErrNoTwoFactorError
+	}
+
+	delete(s.twoFactor, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
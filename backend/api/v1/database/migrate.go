@@ -0,0 +1,530 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+var (
+	ErrSchemaAhead      = errors.New("database schema is newer than this binary")
+	ErrNoDownMigration  = errors.New("migration has no down script")
+	ErrInvalidMigration = errors.New("invalid migration file")
+)
+
+// migrationLockKey is an arbitrary constant used for pg_advisory_lock so
+// concurrent instances starting with auto-migrate don't race each other
+const migrationLockKey = 7243019580121
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change embedded in the binary
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Unknown   bool       `json:"unknown,omitempty"` // applied but not embedded in this binary
+}
+
+var (
+	_ MigratingStore = (*PostgresStore)(nil)
+	_ MigratingStore = (*SQLiteStore)(nil)
+)
+
+// Migrator applies and rolls back the embedded schema migrations
+type Migrator interface {
+	MigrateUp(ctx context.Context) ([]Migration, error)
+	MigrateDown(ctx context.Context, steps int) ([]Migration, error)
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+}
+
+// MigratingStore is a Store whose schema is managed by versioned migrations
+type MigratingStore interface {
+	Store
+	Migrator
+}
+
+// appliedMigration is a row from schema_migrations
+type appliedMigration struct {
+	Version   int64
+	Name      string
+	AppliedAt time.Time
+}
+
+// migrationRunner is the backend specific part of running migrations. Every
+// call to apply or revert must run the script and update schema_migrations
+// in a single transaction.
+type migrationRunner interface {
+	applied(ctx context.Context) ([]appliedMigration, error)
+	apply(ctx context.Context, migration Migration) error
+	revert(ctx context.Context, migration Migration) error
+}
+
+// LoadMigrations returns the embedded migrations for a driver, ordered by version
+func LoadMigrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s migrations: %w", driver, err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+
+		contents, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		} else if migration.Name != matches[2] {
+			return nil, fmt.Errorf("%w: version %d has two names", ErrInvalidMigration, version)
+		}
+
+		if matches[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("%w: version %d has no up script", ErrInvalidMigration, migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// CheckSchemaVersion fails with ErrSchemaAhead when the database has
+// migrations applied that this binary does not know about, and returns the
+// number of embedded migrations that are still pending.
+func CheckSchemaVersion(ctx context.Context, m Migrator) (int, error) {
+	statuses, err := m.MigrationStatus(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if status.Unknown {
+			return 0, fmt.Errorf("%w: migration %d (%s) is applied", ErrSchemaAhead, status.Version, status.Name)
+		}
+		if !status.Applied {
+			pending++
+		}
+	}
+
+	return pending, nil
+}
+
+func migrateUp(ctx context.Context, runner migrationRunner, migrations []Migration) ([]Migration, error) {
+	applied, err := runner.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkUnknownMigrations(applied, migrations); err != nil {
+		return nil, err
+	}
+
+	appliedVersions := make(map[int64]bool)
+	for _, migration := range applied {
+		appliedVersions[migration.Version] = true
+	}
+
+	var done []Migration
+	for _, migration := range migrations {
+		if appliedVersions[migration.Version] {
+			continue
+		}
+
+		if err := runner.apply(ctx, migration); err != nil {
+			return done, fmt.Errorf("failed to apply migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+func migrateDown(ctx context.Context, runner migrationRunner, migrations []Migration, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("number of migrations to roll back must be positive")
+	}
+
+	applied, err := runner.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkUnknownMigrations(applied, migrations); err != nil {
+		return nil, err
+	}
+
+	known := make(map[int64]Migration)
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	// Roll back newest first
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].Version > applied[j].Version
+	})
+
+	var done []Migration
+	for i := 0; i < steps && i < len(applied); i++ {
+		migration := known[applied[i].Version]
+		if migration.Down == "" {
+			return done, fmt.Errorf("%w: %d (%s)", ErrNoDownMigration, migration.Version, migration.Name)
+		}
+
+		if err := runner.revert(ctx, migration); err != nil {
+			return done, fmt.Errorf("failed to roll back migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+func migrationStatus(ctx context.Context, runner migrationRunner, migrations []Migration) ([]MigrationStatus, error) {
+	applied, err := runner.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedByVersion := make(map[int64]appliedMigration)
+	for _, migration := range applied {
+		appliedByVersion[migration.Version] = migration
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := appliedByVersion[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			delete(appliedByVersion, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	// Whatever is left was applied by a newer binary
+	for _, row := range appliedByVersion {
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, MigrationStatus{
+			Version:   row.Version,
+			Name:      row.Name,
+			Applied:   true,
+			AppliedAt: &appliedAt,
+			Unknown:   true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+func checkUnknownMigrations(applied []appliedMigration, migrations []Migration) error {
+	known := make(map[int64]bool)
+	for _, migration := range migrations {
+		known[migration.Version] = true
+	}
+
+	for _, migration := range applied {
+		if !known[migration.Version] {
+			return fmt.Errorf("%w: migration %d (%s) is applied", ErrSchemaAhead, migration.Version, migration.Name)
+		}
+	}
+
+	return nil
+}
+
+// Postgres
+
+type postgresMigrationRunner struct {
+	conn *pgx.Conn
+}
+
+func (s *PostgresStore) MigrateUp(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := s.withMigrationLock(ctx, func(runner migrationRunner, migrations []Migration) error {
+		var err error
+		done, err = migrateUp(ctx, runner, migrations)
+		return err
+	})
+	return done, err
+}
+
+func (s *PostgresStore) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := s.withMigrationLock(ctx, func(runner migrationRunner, migrations []Migration) error {
+		var err error
+		done, err = migrateDown(ctx, runner, migrations, steps)
+		return err
+	})
+	return done, err
+}
+
+func (s *PostgresStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := s.withMigrationLock(ctx, func(runner migrationRunner, migrations []Migration) error {
+		var err error
+		statuses, err = migrationStatus(ctx, runner, migrations)
+		return err
+	})
+	return statuses, err
+}
+
+// withMigrationLock holds a session level advisory lock on a dedicated
+// connection for the duration of fn
+func (s *PostgresStore) withMigrationLock(ctx context.Context, fn func(migrationRunner, []Migration) error) error {
+	migrations, err := LoadMigrations("postgres")
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to acquire connection", ErrDatabaseError)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("%w: failed to acquire migration lock", ErrDatabaseError)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return fmt.Errorf("%w: failed to create schema_migrations table", ErrDatabaseError)
+	}
+
+	return fn(&postgresMigrationRunner{conn: conn.Conn()}, migrations)
+}
+
+func (r *postgresMigrationRunner) applied(ctx context.Context) ([]appliedMigration, error) {
+	rows, err := r.conn.Query(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read schema_migrations", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var applied []appliedMigration
+	for rows.Next() {
+		var migration appliedMigration
+		if err := rows.Scan(&migration.Version, &migration.Name, &migration.AppliedAt); err != nil {
+			return nil, fmt.Errorf("%w: failed to scan schema_migrations", ErrDatabaseError)
+		}
+		applied = append(applied, migration)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate schema_migrations", ErrDatabaseError)
+	}
+
+	return applied, nil
+}
+
+func (r *postgresMigrationRunner) apply(ctx context.Context, migration Migration) error {
+	return r.inTx(ctx, migration.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+}
+
+func (r *postgresMigrationRunner) revert(ctx context.Context, migration Migration) error {
+	return r.inTx(ctx, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+}
+
+func (r *postgresMigrationRunner) inTx(ctx context.Context, script string, bookkeeping string, args ...interface{}) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Exec without arguments uses the simple protocol, which allows multiple statements
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SQLite
+
+type sqliteMigrationRunner struct {
+	db *sql.DB
+}
+
+func (s *SQLiteStore) MigrateUp(ctx context.Context) ([]Migration, error) {
+	runner, migrations, err := s.migrationRunner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrateUp(ctx, runner, migrations)
+}
+
+func (s *SQLiteStore) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	runner, migrations, err := s.migrationRunner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrateDown(ctx, runner, migrations, steps)
+}
+
+func (s *SQLiteStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	runner, migrations, err := s.migrationRunner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStatus(ctx, runner, migrations)
+}
+
+func (s *SQLiteStore) migrationRunner(ctx context.Context) (migrationRunner, []Migration, error) {
+	migrations, err := LoadMigrations("sqlite")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = s.DB.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to create schema_migrations table", ErrDatabaseError)
+	}
+
+	return &sqliteMigrationRunner{db: s.DB}, migrations, nil
+}
+
+func (r *sqliteMigrationRunner) applied(ctx context.Context) ([]appliedMigration, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read schema_migrations", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var applied []appliedMigration
+	for rows.Next() {
+		var migration appliedMigration
+		if err := rows.Scan(&migration.Version, &migration.Name, &migration.AppliedAt); err != nil {
+			return nil, fmt.Errorf("%w: failed to scan schema_migrations", ErrDatabaseError)
+		}
+		applied = append(applied, migration)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate schema_migrations", ErrDatabaseError)
+	}
+
+	return applied, nil
+}
+
+func (r *sqliteMigrationRunner) apply(ctx context.Context, migration Migration) error {
+	return r.inTx(ctx, migration.Up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", migration.Version, migration.Name, sqliteNow())
+}
+
+func (r *sqliteMigrationRunner) revert(ctx context.Context, migration Migration) error {
+	return r.inTx(ctx, migration.Down, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+}
+
+// inTx runs a migration script the way SQLite recommends for schema changes
+// that rebuild tables: foreign keys are switched off on a dedicated connection
+// so dropping the old table does not fire ON DELETE actions, and the result is
+// checked with foreign_key_check before committing.
+func (r *sqliteMigrationRunner) inTx(ctx context.Context, script string, bookkeeping string, args ...interface{}) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// foreign_keys cannot change inside a transaction, so toggle it around it
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	violations := rows.Next()
+	rows.Close()
+	if violations {
+		return fmt.Errorf("%w: migration leaves foreign key violations", ErrInvalidMigration)
+	}
+
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
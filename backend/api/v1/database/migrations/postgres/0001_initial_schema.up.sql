@@ -1,13 +1,16 @@
+-- Baseline schema. Uses IF NOT EXISTS so databases that had the old
+-- schema.sql applied by hand can adopt migrations without changes.
+
 -- Users table (simple session-based accounts)
-CREATE TABLE users (
+CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     username TEXT NOT NULL UNIQUE,
-    password_hash TEXT, -- Changed from password to password_hash
+    password_hash TEXT,
     created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE TABLE folders (
+CREATE TABLE IF NOT EXISTS folders (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     name TEXT NOT NULL,
@@ -19,7 +22,7 @@ CREATE TABLE folders (
 );
 
 -- Main snippets table
-CREATE TABLE snippets (
+CREATE TABLE IF NOT EXISTS snippets (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     folder_id INTEGER REFERENCES folders(id) ON DELETE SET NULL,
@@ -32,7 +35,7 @@ CREATE TABLE snippets (
     updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE TABLE tags (
+CREATE TABLE IF NOT EXISTS tags (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     name TEXT NOT NULL,
@@ -42,27 +45,26 @@ CREATE TABLE tags (
 );
 
 -- Many-to-many relationship between snippets and tags
-CREATE TABLE snippet_tags (
+CREATE TABLE IF NOT EXISTS snippet_tags (
     snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
     tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
     PRIMARY KEY (snippet_id, tag_id)
 );
 
 -- Indexes for performance
-CREATE INDEX idx_snippets_user_id ON snippets(user_id);
-CREATE INDEX idx_snippets_folder_id ON snippets(folder_id);
-CREATE INDEX idx_snippets_language ON snippets(language);
-CREATE INDEX idx_snippets_created_at ON snippets(created_at DESC);
-CREATE INDEX idx_folders_user_id ON folders(user_id);
-CREATE INDEX idx_tags_user_id ON tags(user_id);
+CREATE INDEX IF NOT EXISTS idx_snippets_user_id ON snippets(user_id);
+CREATE INDEX IF NOT EXISTS idx_snippets_folder_id ON snippets(folder_id);
+CREATE INDEX IF NOT EXISTS idx_snippets_language ON snippets(language);
+CREATE INDEX IF NOT EXISTS idx_snippets_created_at ON snippets(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_folders_user_id ON folders(user_id);
+CREATE INDEX IF NOT EXISTS idx_tags_user_id ON tags(user_id);
 
 -- Add a tsvector column for full-text search
-ALTER TABLE snippets ADD COLUMN document_with_weights tsvector GENERATED ALWAYS AS (
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS document_with_weights tsvector GENERATED ALWAYS AS (
     setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
     setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
     setweight(to_tsvector('english', coalesce(content, '')), 'C')
 ) STORED;
 
 -- Create GIN index on the tsvector column for fast search
-CREATE INDEX idx_snippets_fts ON snippets USING GIN (document_with_weights);
-
+CREATE INDEX IF NOT EXISTS idx_snippets_fts ON snippets USING GIN (document_with_weights);
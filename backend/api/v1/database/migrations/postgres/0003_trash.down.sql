@@ -0,0 +1,15 @@
+-- Rolling back empties the trash, the old unique constraint cannot hold
+-- trashed duplicates
+DELETE FROM snippets WHERE deleted_at IS NOT NULL;
+DELETE FROM folders WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_folders_deleted_at;
+DROP INDEX IF EXISTS idx_snippets_deleted_at;
+DROP INDEX IF EXISTS idx_folders_live_name;
+
+ALTER TABLE folders ADD CONSTRAINT folders_user_id_name_parent_id_key UNIQUE (user_id, name, parent_id);
+
+ALTER TABLE folders DROP COLUMN trash_path;
+ALTER TABLE folders DROP COLUMN deleted_at;
+ALTER TABLE snippets DROP COLUMN trash_path;
+ALTER TABLE snippets DROP COLUMN deleted_at;
@@ -0,0 +1,14 @@
+-- Soft deletes. Trashed rows keep deleted_at set until they are restored or
+-- purged, and trash_path records the folder names leading to the item so the
+-- chain can be re-created if a parent is purged first.
+ALTER TABLE snippets ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE snippets ADD COLUMN trash_path TEXT[];
+ALTER TABLE folders ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE folders ADD COLUMN trash_path TEXT[];
+
+-- A trashed folder must not block re-using its name
+ALTER TABLE folders DROP CONSTRAINT IF EXISTS folders_user_id_name_parent_id_key;
+CREATE UNIQUE INDEX idx_folders_live_name ON folders(user_id, name, parent_id) WHERE deleted_at IS NULL;
+
+CREATE INDEX idx_snippets_deleted_at ON snippets(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_folders_deleted_at ON folders(deleted_at) WHERE deleted_at IS NOT NULL;
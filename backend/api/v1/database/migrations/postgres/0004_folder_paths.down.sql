@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_folders_path;
+
+ALTER TABLE folders DROP COLUMN IF EXISTS path;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_snippets_content_trgm;
+DROP INDEX IF EXISTS idx_snippets_title_trgm;
+
+-- The pg_trgm extension is left installed, other database objects may use it
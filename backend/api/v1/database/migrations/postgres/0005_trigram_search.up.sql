@@ -0,0 +1,7 @@
+-- Trigram indexes for substring search. The English stemmer behind
+-- document_with_weights splits and mangles code such as ctx.Done() or
+-- --no-cache, pg_trgm lets ILIKE '%...%' find it exactly without a full scan.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_title_trgm ON snippets USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_snippets_content_trgm ON snippets USING GIN (content gin_trgm_ops);
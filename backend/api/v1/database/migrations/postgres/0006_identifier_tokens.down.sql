@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_snippets_fts;
+ALTER TABLE snippets DROP COLUMN IF EXISTS document_with_weights;
+
+ALTER TABLE snippets ADD COLUMN document_with_weights tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(content, '')), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_fts ON snippets USING GIN (document_with_weights);
+
+ALTER TABLE snippets DROP COLUMN IF EXISTS search_tokens;
@@ -0,0 +1,17 @@
+-- Sub-words of the compound identifiers in a snippet, e.g. "new decoder" for
+-- NewDecoder, written by the application on save. NULL marks snippets saved
+-- before this migration, which the server backfills on start.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS search_tokens TEXT;
+
+-- Rebuild document_with_weights with the identifier tokens at the lowest weight
+DROP INDEX IF EXISTS idx_snippets_fts;
+ALTER TABLE snippets DROP COLUMN IF EXISTS document_with_weights;
+
+ALTER TABLE snippets ADD COLUMN document_with_weights tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(content, '')), 'C') ||
+    setweight(to_tsvector('english', coalesce(search_tokens, '')), 'D')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_fts ON snippets USING GIN (document_with_weights);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_snippet_tags_tag_id;
+DROP INDEX IF EXISTS idx_tags_name_prefix;
+DROP INDEX IF EXISTS idx_folders_name_prefix;
+DROP INDEX IF EXISTS idx_snippets_user_language;
+DROP INDEX IF EXISTS idx_snippets_title_prefix;
@@ -0,0 +1,9 @@
+-- Prefix indexes for the typeahead, which matches LOWER(name) LIKE 'prefix%'
+-- on every keystroke
+CREATE INDEX IF NOT EXISTS idx_snippets_title_prefix ON snippets(user_id, LOWER(title) text_pattern_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_snippets_user_language ON snippets(user_id, language) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_folders_name_prefix ON folders(user_id, LOWER(name) text_pattern_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_tags_name_prefix ON tags(user_id, LOWER(name) text_pattern_ops);
+
+-- Counting a tag's snippets looks the tag up from the other side of the key
+CREATE INDEX IF NOT EXISTS idx_snippet_tags_tag_id ON snippet_tags(tag_id);
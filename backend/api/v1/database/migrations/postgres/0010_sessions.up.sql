@@ -0,0 +1,22 @@
+-- One row per refresh token, only its SHA-256 hash is kept. Rotating a token
+-- adds a row to the same family and marks the old one replaced, so a replaced
+-- token coming back means a copy leaked and the whole family is revoked.
+-- family_id is the id of the family's first row and names the session.
+CREATE TABLE IF NOT EXISTS sessions (
+    id SERIAL PRIMARY KEY,
+    family_id INTEGER NOT NULL DEFAULT 0,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    device TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    signed_in_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    replaced_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions (family_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id)
+    WHERE replaced_at IS NULL AND revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
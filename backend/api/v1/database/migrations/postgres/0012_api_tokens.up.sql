@@ -0,0 +1,17 @@
+-- Personal access tokens for scripts and CI. Only a SHA-256 hash of each token
+-- is kept, with its first characters so the owner can tell them apart. Scopes
+-- are space separated. A token limited to a folder goes when the folder is
+-- purged rather than being widened to the whole library.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_prefix TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    folder_id INTEGER REFERENCES folders(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, name)
+);
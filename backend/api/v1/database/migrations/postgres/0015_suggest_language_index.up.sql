@@ -0,0 +1,3 @@
+-- The typeahead matches LOWER(language) LIKE 'prefix%', which the plain
+-- (user_id, language) index from 0008_suggest_indexes can't answer
+CREATE INDEX IF NOT EXISTS idx_snippets_language_prefix ON snippets(user_id, LOWER(language) text_pattern_ops) WHERE deleted_at IS NULL;
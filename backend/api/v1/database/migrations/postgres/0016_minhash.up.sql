@@ -0,0 +1,18 @@
+-- MinHash signature of the content and its locality-sensitive hashing band
+-- keys, so similar snippets are found by index rather than by signing every
+-- snippet on each request. Existing rows are signed in the background after
+-- startup, until then they are compared from their content.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS minhash BYTEA;
+
+CREATE TABLE IF NOT EXISTS snippet_minhash_bands (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    band_key BIGINT NOT NULL,
+    PRIMARY KEY (snippet_id, band_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_snippet_minhash_bands_key ON snippet_minhash_bands(user_id, band_key);
+
+-- Snippets still to be signed are always candidates, this keeps finding them
+-- cheap once the backfill is done
+CREATE INDEX IF NOT EXISTS idx_snippets_unsigned ON snippets(user_id) WHERE minhash IS NULL;
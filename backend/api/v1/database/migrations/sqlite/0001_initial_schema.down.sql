@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS snippets_fts_update;
+DROP TRIGGER IF EXISTS snippets_fts_delete;
+DROP TRIGGER IF EXISTS snippets_fts_insert;
+DROP TABLE IF EXISTS snippets_fts;
+DROP TABLE IF EXISTS snippet_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS snippets;
+DROP TABLE IF EXISTS folders;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,84 @@
+-- SQLite equivalent of the Postgres baseline schema
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS folders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT,
+    parent_id INTEGER REFERENCES folders(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, name, parent_id) -- prevent duplicate folder names in same location
+);
+
+CREATE TABLE IF NOT EXISTS snippets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    folder_id INTEGER REFERENCES folders(id) ON DELETE SET NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    content TEXT NOT NULL,
+    language TEXT NOT NULL DEFAULT 'text',
+    is_favorite BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    color TEXT, -- hex color for UI (optional)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, name) -- users can't have duplicate tag names
+);
+
+CREATE TABLE IF NOT EXISTS snippet_tags (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (snippet_id, tag_id)
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_snippets_user_id ON snippets(user_id);
+CREATE INDEX IF NOT EXISTS idx_snippets_folder_id ON snippets(folder_id);
+CREATE INDEX IF NOT EXISTS idx_snippets_language ON snippets(language);
+CREATE INDEX IF NOT EXISTS idx_snippets_created_at ON snippets(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_folders_user_id ON folders(user_id);
+CREATE INDEX IF NOT EXISTS idx_tags_user_id ON tags(user_id);
+
+-- Full-text index standing in for document_with_weights. The columns keep
+-- title, description and content separate so bm25() can weight them the
+-- same way setweight() does with the A, B and C labels.
+CREATE VIRTUAL TABLE IF NOT EXISTS snippets_fts USING fts5(
+    title,
+    description,
+    content,
+    content = 'snippets',
+    content_rowid = 'id',
+    tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_insert AFTER INSERT ON snippets BEGIN
+    INSERT INTO snippets_fts(rowid, title, description, content)
+    VALUES (new.id, new.title, coalesce(new.description, ''), new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_delete AFTER DELETE ON snippets BEGIN
+    INSERT INTO snippets_fts(snippets_fts, rowid, title, description, content)
+    VALUES ('delete', old.id, old.title, coalesce(old.description, ''), old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_update AFTER UPDATE OF title, description, content ON snippets BEGIN
+    INSERT INTO snippets_fts(snippets_fts, rowid, title, description, content)
+    VALUES ('delete', old.id, old.title, coalesce(old.description, ''), old.content);
+    INSERT INTO snippets_fts(rowid, title, description, content)
+    VALUES (new.id, new.title, coalesce(new.description, ''), new.content);
+END;
@@ -0,0 +1,28 @@
+-- Immutable snapshots of a snippet, one per create/update. Tags are stored
+-- as a JSON array of names.
+CREATE TABLE snippet_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    content TEXT NOT NULL,
+    language TEXT NOT NULL,
+    tags TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(snippet_id, revision)
+);
+
+-- Existing snippets start their history at revision 1
+INSERT INTO snippet_revisions (snippet_id, revision, title, description, content, language, tags, created_at)
+SELECT s.id, 1, s.title, s.description, s.content, s.language,
+       (
+           SELECT json_group_array(name) FROM (
+               SELECT t.name FROM snippet_tags st
+               JOIN tags t ON st.tag_id = t.id
+               WHERE st.snippet_id = s.id
+               ORDER BY t.name
+           )
+       ),
+       s.updated_at
+FROM snippets s;
@@ -0,0 +1,28 @@
+-- Rolling back empties the trash, the old unique constraint cannot hold
+-- trashed duplicates
+DELETE FROM snippets WHERE deleted_at IS NOT NULL;
+DELETE FROM folders WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_snippets_deleted_at;
+
+CREATE TABLE folders_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT,
+    parent_id INTEGER REFERENCES folders(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, name, parent_id) -- prevent duplicate folder names in same location
+);
+
+INSERT INTO folders_old (id, user_id, name, description, parent_id, created_at, updated_at)
+SELECT id, user_id, name, description, parent_id, created_at, updated_at FROM folders;
+
+DROP TABLE folders;
+ALTER TABLE folders_old RENAME TO folders;
+
+CREATE INDEX idx_folders_user_id ON folders(user_id);
+
+ALTER TABLE snippets DROP COLUMN trash_path;
+ALTER TABLE snippets DROP COLUMN deleted_at;
@@ -0,0 +1,32 @@
+-- Soft deletes. Trashed rows keep deleted_at set until they are restored or
+-- purged, and trash_path records the folder names leading to the item (as a
+-- JSON array) so the chain can be re-created if a parent is purged first.
+ALTER TABLE snippets ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE snippets ADD COLUMN trash_path TEXT;
+
+-- SQLite cannot drop the inline UNIQUE constraint on folders, so the table is
+-- rebuilt with a partial index in its place. A trashed folder must not block
+-- re-using its name.
+CREATE TABLE folders_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT,
+    parent_id INTEGER REFERENCES folders(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP,
+    trash_path TEXT
+);
+
+INSERT INTO folders_new (id, user_id, name, description, parent_id, created_at, updated_at)
+SELECT id, user_id, name, description, parent_id, created_at, updated_at FROM folders;
+
+DROP TABLE folders;
+ALTER TABLE folders_new RENAME TO folders;
+
+CREATE INDEX idx_folders_user_id ON folders(user_id);
+CREATE UNIQUE INDEX idx_folders_live_name ON folders(user_id, name, parent_id) WHERE deleted_at IS NULL;
+
+CREATE INDEX idx_snippets_deleted_at ON snippets(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_folders_deleted_at ON folders(deleted_at) WHERE deleted_at IS NOT NULL;
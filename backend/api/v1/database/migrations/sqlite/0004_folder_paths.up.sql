@@ -0,0 +1,21 @@
+-- Materialized ancestry path for folders: the IDs from the root down to the
+-- folder itself, e.g. /3/17/42/. Everything under a folder shares its path as
+-- a prefix, so subtree queries and cycle checks are a single GLOB.
+ALTER TABLE folders ADD COLUMN path TEXT NOT NULL DEFAULT '/';
+
+-- Every folder contains at least itself, even one the walk below can't reach
+UPDATE folders SET path = '/' || id || '/';
+
+WITH RECURSIVE tree(id, path) AS (
+    SELECT id, '/' || id || '/'
+    FROM folders
+    WHERE parent_id IS NULL
+    UNION ALL
+    SELECT f.id, t.path || f.id || '/'
+    FROM folders f
+    JOIN tree t ON f.parent_id = t.id
+)
+UPDATE folders SET path = (SELECT tree.path FROM tree WHERE tree.id = folders.id)
+WHERE id IN (SELECT id FROM tree);
+
+CREATE INDEX IF NOT EXISTS idx_folders_path ON folders(path);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS snippets_trigram_update;
+DROP TRIGGER IF EXISTS snippets_trigram_delete;
+DROP TRIGGER IF EXISTS snippets_trigram_insert;
+DROP TABLE IF EXISTS snippets_trigram;
@@ -0,0 +1,29 @@
+-- Trigram index standing in for the pg_trgm indexes on title and content.
+-- FTS5 answers LIKE '%...%' on its columns from the index as long as the
+-- pattern has no ESCAPE clause.
+CREATE VIRTUAL TABLE IF NOT EXISTS snippets_trigram USING fts5(
+    title,
+    content,
+    content = 'snippets',
+    content_rowid = 'id',
+    tokenize = 'trigram'
+);
+
+INSERT INTO snippets_trigram(snippets_trigram) VALUES ('rebuild');
+
+CREATE TRIGGER IF NOT EXISTS snippets_trigram_insert AFTER INSERT ON snippets BEGIN
+    INSERT INTO snippets_trigram(rowid, title, content)
+    VALUES (new.id, new.title, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS snippets_trigram_delete AFTER DELETE ON snippets BEGIN
+    INSERT INTO snippets_trigram(snippets_trigram, rowid, title, content)
+    VALUES ('delete', old.id, old.title, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS snippets_trigram_update AFTER UPDATE OF title, content ON snippets BEGIN
+    INSERT INTO snippets_trigram(snippets_trigram, rowid, title, content)
+    VALUES ('delete', old.id, old.title, old.content);
+    INSERT INTO snippets_trigram(rowid, title, content)
+    VALUES (new.id, new.title, new.content);
+END;
@@ -0,0 +1,34 @@
+DROP TRIGGER IF EXISTS snippets_fts_update;
+DROP TRIGGER IF EXISTS snippets_fts_delete;
+DROP TRIGGER IF EXISTS snippets_fts_insert;
+DROP TABLE IF EXISTS snippets_fts;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS snippets_fts USING fts5(
+    title,
+    description,
+    content,
+    content = 'snippets',
+    content_rowid = 'id',
+    tokenize = 'porter unicode61'
+);
+
+INSERT INTO snippets_fts(snippets_fts) VALUES ('rebuild');
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_insert AFTER INSERT ON snippets BEGIN
+    INSERT INTO snippets_fts(rowid, title, description, content)
+    VALUES (new.id, new.title, coalesce(new.description, ''), new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_delete AFTER DELETE ON snippets BEGIN
+    INSERT INTO snippets_fts(snippets_fts, rowid, title, description, content)
+    VALUES ('delete', old.id, old.title, coalesce(old.description, ''), old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_update AFTER UPDATE OF title, description, content ON snippets BEGIN
+    INSERT INTO snippets_fts(snippets_fts, rowid, title, description, content)
+    VALUES ('delete', old.id, old.title, coalesce(old.description, ''), old.content);
+    INSERT INTO snippets_fts(rowid, title, description, content)
+    VALUES (new.id, new.title, coalesce(new.description, ''), new.content);
+END;
+
+ALTER TABLE snippets DROP COLUMN search_tokens;
@@ -0,0 +1,40 @@
+-- Sub-words of the compound identifiers in a snippet, e.g. "new decoder" for
+-- NewDecoder, written by the application on save. NULL marks snippets saved
+-- before this migration, which the server backfills on start.
+ALTER TABLE snippets ADD COLUMN search_tokens TEXT;
+
+-- FTS5 tables can't gain columns, so snippets_fts is rebuilt with the
+-- identifier tokens as a fourth, lowest weighted column
+DROP TRIGGER IF EXISTS snippets_fts_update;
+DROP TRIGGER IF EXISTS snippets_fts_delete;
+DROP TRIGGER IF EXISTS snippets_fts_insert;
+DROP TABLE IF EXISTS snippets_fts;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS snippets_fts USING fts5(
+    title,
+    description,
+    content,
+    search_tokens,
+    content = 'snippets',
+    content_rowid = 'id',
+    tokenize = 'porter unicode61'
+);
+
+INSERT INTO snippets_fts(snippets_fts) VALUES ('rebuild');
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_insert AFTER INSERT ON snippets BEGIN
+    INSERT INTO snippets_fts(rowid, title, description, content, search_tokens)
+    VALUES (new.id, new.title, coalesce(new.description, ''), new.content, coalesce(new.search_tokens, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_delete AFTER DELETE ON snippets BEGIN
+    INSERT INTO snippets_fts(snippets_fts, rowid, title, description, content, search_tokens)
+    VALUES ('delete', old.id, old.title, coalesce(old.description, ''), old.content, coalesce(old.search_tokens, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_update AFTER UPDATE OF title, description, content, search_tokens ON snippets BEGIN
+    INSERT INTO snippets_fts(snippets_fts, rowid, title, description, content, search_tokens)
+    VALUES ('delete', old.id, old.title, coalesce(old.description, ''), old.content, coalesce(old.search_tokens, ''));
+    INSERT INTO snippets_fts(rowid, title, description, content, search_tokens)
+    VALUES (new.id, new.title, coalesce(new.description, ''), new.content, coalesce(new.search_tokens, ''));
+END;
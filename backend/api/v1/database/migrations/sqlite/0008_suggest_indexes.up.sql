@@ -0,0 +1,9 @@
+-- Prefix indexes for the typeahead. LIKE ignores case, so it can only use an
+-- index whose column is compared with NOCASE.
+CREATE INDEX IF NOT EXISTS idx_snippets_title_prefix ON snippets(user_id, title COLLATE NOCASE) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_snippets_user_language ON snippets(user_id, language COLLATE NOCASE) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_folders_name_prefix ON folders(user_id, name COLLATE NOCASE) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_tags_name_prefix ON tags(user_id, name COLLATE NOCASE);
+
+-- Counting a tag's snippets looks the tag up from the other side of the key
+CREATE INDEX IF NOT EXISTS idx_snippet_tags_tag_id ON snippet_tags(tag_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_snippets_content_hash;
+
+ALTER TABLE snippets DROP COLUMN content_hash;
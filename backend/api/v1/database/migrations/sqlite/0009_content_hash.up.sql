@@ -0,0 +1,5 @@
+-- Fingerprint of the normalized content, so saving the same code twice can be
+-- caught. Existing rows are hashed in the background after startup.
+ALTER TABLE snippets ADD COLUMN content_hash TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_content_hash ON snippets(user_id, content_hash) WHERE deleted_at IS NULL;
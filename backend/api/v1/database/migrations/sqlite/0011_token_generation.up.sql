@@ -0,0 +1,3 @@
+-- Copied into every access token and bumped to revoke them all at once, on a
+-- password change or a forced logout
+ALTER TABLE users ADD COLUMN token_generation INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,25 @@
+-- TOTP two-factor authentication. The secret is kept from setup on but only
+-- asked for once enabled_at is set, when the user has confirmed a code.
+-- last_step is the time step of the last code accepted, so a code can't be
+-- used twice. Wrong codes are counted in failed_attempts, and enough of them
+-- in a row lock code entry for a while from locked_at. Challenges issued
+-- before locked_at stop working, so the password has to be given again.
+CREATE TABLE IF NOT EXISTS two_factor (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    enabled_at TIMESTAMP,
+    last_step INTEGER NOT NULL DEFAULT 0,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One-time codes for signing in without the authenticator, only a SHA-256
+-- hash of each is kept
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    UNIQUE(user_id, code_hash)
+);
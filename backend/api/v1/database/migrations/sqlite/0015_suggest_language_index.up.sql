@@ -0,0 +1,3 @@
+-- Postgres gains a LOWER(language) prefix index here. SQLite's LIKE already
+-- ignores case and uses the NOCASE idx_snippets_user_language from
+-- 0008_suggest_indexes, so this version only keeps the two schemas in step.
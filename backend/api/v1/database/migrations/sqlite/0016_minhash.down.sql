@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_snippets_unsigned;
+
+DROP TABLE IF EXISTS snippet_minhash_bands;
+
+ALTER TABLE snippets DROP COLUMN minhash;
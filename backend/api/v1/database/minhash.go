@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// signatureColumns are the columns scanned into a SnippetSignature. Content
+// is only read for rows the backfill hasn't signed yet.
+const signatureColumns = `s.id, s.title, s.folder_id, s.language, s.minhash,
+	CASE WHEN s.minhash IS NULL THEN s.content END`
+
+// saveMinHashBands replaces the band keys of a snippet with those of its
+// signature, which has already been written to the minhash column
+func saveMinHashBands(ctx context.Context, tx pgx.Tx, snippetID, userID int64, signature *minHashSignature) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM snippet_minhash_bands WHERE snippet_id = $1", snippetID); err != nil {
+		return fmt.Errorf("failed to clear minhash bands: %w", err)
+	}
+	if signature == nil {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO snippet_minhash_bands(snippet_id, user_id, band_key)
+		SELECT $1, $2, UNNEST($3::BIGINT[])
+		ON CONFLICT DO NOTHING`,
+		snippetID, userID, signature.bandKeys())
+	if err != nil {
+		return fmt.Errorf("failed to save minhash bands: %w", err)
+	}
+	return nil
+}
+
+// BackfillMinHashes signs up to limit snippets, trashed ones included, that
+// were saved before the minhash column existed
+func BackfillMinHashes(ctx context.Context, pool *pgxpool.Pool, limit int) (int, error) {
+	rows, err := pool.Query(ctx, "SELECT id, user_id, content FROM snippets WHERE minhash IS NULL ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to get snippets to sign", ErrDatabaseError)
+	}
+
+	type pendingSnippet struct {
+		id, userID int64
+		content    string
+	}
+	var pending []pendingSnippet
+	for rows.Next() {
+		var snippet pendingSnippet
+		if err := rows.Scan(&snippet.id, &snippet.userID, &snippet.content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%w: failed to scan snippet", ErrDatabaseError)
+		}
+		pending = append(pending, snippet)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("%w: failed to iterate snippets", ErrDatabaseError)
+	}
+
+	for i, snippet := range pending {
+		if err := backfillMinHash(ctx, pool, snippet.id, snippet.userID, snippet.content); err != nil {
+			return i, err
+		}
+	}
+
+	return len(pending), nil
+}
+
+// backfillMinHash signs one snippet, unless an edit signed it first
+func backfillMinHash(ctx context.Context, pool *pgxpool.Pool, snippetID, userID int64, content string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to begin transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	signature := newMinHashSignature(content)
+	result, err := tx.Exec(ctx, "UPDATE snippets SET minhash = $1 WHERE id = $2 AND minhash IS NULL", encodeMinHash(signature), snippetID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update minhash", ErrDatabaseError)
+	}
+	if result.RowsAffected() == 0 {
+		return nil
+	}
+
+	if err = saveMinHashBands(ctx, tx, snippetID, userID, signature); err != nil {
+		return fmt.Errorf("%w: failed to save minhash bands", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit minhash", ErrDatabaseError)
+	}
+	return nil
+}
+
+// GetSimilarityCandidates finds the snippets sharing a band key through
+// idx_snippet_minhash_bands_key, and those not yet signed through
+// idx_snippets_unsigned
+func GetSimilarityCandidates(ctx context.Context, pool *pgxpool.Pool, userID, exceptID int64, bandKeys []int64) ([]SnippetSignature, error) {
+	query := `
+		SELECT ` + signatureColumns + `
+		FROM snippets s
+		WHERE s.id IN (
+			SELECT snippet_id FROM snippet_minhash_bands WHERE user_id = $1 AND band_key = ANY($3)
+			UNION
+			SELECT id FROM snippets WHERE user_id = $1 AND minhash IS NULL
+		) AND s.id <> $2 AND s.deleted_at IS NULL
+		ORDER BY s.id`
+
+	rows, err := pool.Query(ctx, query, userID, exceptID, bandKeys)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get similarity candidates", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var candidates []SnippetSignature
+	for rows.Next() {
+		candidate, err := scanSnippetSignature(rows)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate similarity candidates", ErrDatabaseError)
+	}
+
+	return candidates, nil
+}
+
+func WalkSnippetSignatures(ctx context.Context, pool *pgxpool.Pool, userID int64, fn func(*SnippetSignature) error) error {
+	query := `
+		SELECT ` + signatureColumns + `
+		FROM snippets s
+		WHERE s.user_id = $1 AND s.id > $2 AND s.deleted_at IS NULL
+		ORDER BY s.id
+		LIMIT $3`
+
+	var lastID int64
+	for {
+		rows, err := pool.Query(ctx, query, userID, lastID, walkBatchSize)
+		if err != nil {
+			return fmt.Errorf("%w: failed to get snippet signatures", ErrDatabaseError)
+		}
+
+		// The batch is read in full first so no connection is held while fn runs
+		var batch []SnippetSignature
+		for rows.Next() {
+			signature, err := scanSnippetSignature(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, signature)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("%w: failed to iterate snippet signatures", ErrDatabaseError)
+		}
+
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < walkBatchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].Snippet.ID
+	}
+}
+
+func scanSnippetSignature(rows pgx.Rows) (SnippetSignature, error) {
+	var signature SnippetSignature
+	err := rows.Scan(
+		&signature.Snippet.ID,
+		&signature.Snippet.Title,
+		&signature.Snippet.FolderID,
+		&signature.Snippet.Language,
+		&signature.MinHash,
+		&signature.Content,
+	)
+	if err != nil {
+		return SnippetSignature{}, fmt.Errorf("%w: failed to scan snippet signature", ErrDatabaseError)
+	}
+	return signature, nil
+}
@@ -0,0 +1,398 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore implements Store on top of a pgx connection pool
+type PostgresStore struct {
+	Pool *pgxpool.Pool
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{Pool: pool}
+}
+
+// ConnectPostgres connects to connString and wraps the pool in a PostgresStore
+func ConnectPostgres(connString string) (*PostgresStore, error) {
+	pool, err := Connect(connString)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPostgresStore(pool), nil
+}
+
+func (s *PostgresStore) Close() {
+	s.Pool.Close()
+}
+
+// Snippets
+
+func (s *PostgresStore) CreateSnippet(ctx context.Context, snippet *models.Snippet) error {
+	return CreateSnippet(ctx, s.Pool, snippet)
+}
+
+func (s *PostgresStore) CreateUniqueSnippet(ctx context.Context, snippet *models.Snippet) error {
+	return CreateUniqueSnippet(ctx, s.Pool, snippet)
+}
+
+func (s *PostgresStore) GetSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error) {
+	return GetSnippet(ctx, s.Pool, snippetID)
+}
+
+func (s *PostgresStore) GetSnippets(ctx context.Context, page, limit int, userID int64, filter SnippetFilter) ([]models.Snippet, int, error) {
+	return GetSnippets(ctx, s.Pool, page, limit, userID, filter)
+}
+
+func (s *PostgresStore) GetSnippetFacets(ctx context.Context, userID int64, filter SnippetFilter, facets []string) (models.SnippetFacets, error) {
+	return GetSnippetFacets(ctx, s.Pool, userID, filter, facets)
+}
+
+func (s *PostgresStore) CountSnippets(ctx context.Context, userID int64, filters []SnippetFilter) ([]int, error) {
+	return CountSnippets(ctx, s.Pool, userID, filters)
+}
+
+func (s *PostgresStore) UpdateSnippet(ctx context.Context, snippetID int64, snippet *models.Snippet) error {
+	return UpdateSnippet(ctx, s.Pool, snippetID, snippet)
+}
+
+func (s *PostgresStore) UpdateUniqueSnippet(ctx context.Context, snippetID int64, snippet *models.Snippet) error {
+	return UpdateUniqueSnippet(ctx, s.Pool, snippetID, snippet)
+}
+
+func (s *PostgresStore) DeleteSnippet(ctx context.Context, snippetID int64) error {
+	return DeleteSnippet(ctx, s.Pool, snippetID)
+}
+
+func (s *PostgresStore) BackfillSearchTokens(ctx context.Context, limit int) (int, error) {
+	return BackfillSearchTokens(ctx, s.Pool, limit)
+}
+
+func (s *PostgresStore) GetSnippetIDsByContent(ctx context.Context, userID int64, content string) ([]int64, error) {
+	return GetSnippetIDsByContent(ctx, s.Pool, userID, content)
+}
+
+func (s *PostgresStore) BackfillContentHashes(ctx context.Context, limit int) (int, error) {
+	return BackfillContentHashes(ctx, s.Pool, limit)
+}
+
+func (s *PostgresStore) WalkSnippets(ctx context.Context, userID int64, fn func(*models.Snippet) error) error {
+	return WalkSnippets(ctx, s.Pool, userID, fn)
+}
+
+func (s *PostgresStore) BackfillMinHashes(ctx context.Context, limit int) (int, error) {
+	return BackfillMinHashes(ctx, s.Pool, limit)
+}
+
+func (s *PostgresStore) GetSimilarityCandidates(ctx context.Context, userID, exceptID int64, bandKeys []int64) ([]SnippetSignature, error) {
+	return GetSimilarityCandidates(ctx, s.Pool, userID, exceptID, bandKeys)
+}
+
+func (s *PostgresStore) WalkSnippetSignatures(ctx context.Context, userID int64, fn func(*SnippetSignature) error) error {
+	return WalkSnippetSignatures(ctx, s.Pool, userID, fn)
+}
+
+// Folders
+
+func (s *PostgresStore) CreateFolder(ctx context.Context, folder *models.Folder) error {
+	return CreateFolder(ctx, s.Pool, folder)
+}
+
+func (s *PostgresStore) GetFolder(ctx context.Context, folderID int64) (*models.Folder, error) {
+	return GetFolder(ctx, s.Pool, folderID)
+}
+
+func (s *PostgresStore) GetFolders(ctx context.Context, page, limit int, userID int64, parentID *int64) ([]models.Folder, int, error) {
+	return GetFolders(ctx, s.Pool, page, limit, userID, parentID)
+}
+
+func (s *PostgresStore) GetFolderTree(ctx context.Context, userID int64) ([]*models.FolderNode, error) {
+	return GetFolderTree(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) GetFolderPath(ctx context.Context, folderID int64) ([]models.Folder, error) {
+	return GetFolderPath(ctx, s.Pool, folderID)
+}
+
+func (s *PostgresStore) UpdateFolder(ctx context.Context, folderID int64, folder *models.Folder) error {
+	return UpdateFolder(ctx, s.Pool, folderID, folder)
+}
+
+func (s *PostgresStore) DeleteFolder(ctx context.Context, folderID int64, mode string) (*models.FolderDeleteResult, error) {
+	return DeleteFolder(ctx, s.Pool, folderID, mode)
+}
+
+// Users
+
+func (s *PostgresStore) CreateUser(ctx context.Context, user *models.User) error {
+	return CreateUser(ctx, s.Pool, user)
+}
+
+func (s *PostgresStore) GetUser(ctx context.Context, userID int64, user *models.User) error {
+	return GetUser(ctx, s.Pool, userID, user)
+}
+
+func (s *PostgresStore) GetUsers(ctx context.Context, page, limit int, search string) ([]models.User, int, error) {
+	return GetUsers(ctx, s.Pool, page, limit, search)
+}
+
+func (s *PostgresStore) UpdateUser(ctx context.Context, userID int64, user *models.User) error {
+	return UpdateUser(ctx, s.Pool, userID, user)
+}
+
+func (s *PostgresStore) DeleteUser(ctx context.Context, userID int64) error {
+	return DeleteUser(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) CreateUserWithPassword(ctx context.Context, user *UserWithPassword) error {
+	return CreateUserWithPassword(ctx, s.Pool, user)
+}
+
+func (s *PostgresStore) GetUserByUsername(ctx context.Context, username string) (*UserWithPassword, error) {
+	return GetUserByUsername(ctx, s.Pool, username)
+}
+
+func (s *PostgresStore) UpdateUserPassword(ctx context.Context, userID int64, hashedPassword string) error {
+	return UpdateUserPassword(ctx, s.Pool, userID, hashedPassword)
+}
+
+func (s *PostgresStore) RevokeUserTokens(ctx context.Context, userID int64) error {
+	return RevokeUserTokens(ctx, s.Pool, userID)
+}
+
+// Tags
+
+func (s *PostgresStore) CreateTag(ctx context.Context, tag *models.Tag) error {
+	return CreateTag(ctx, s.Pool, tag)
+}
+
+func (s *PostgresStore) GetTag(ctx context.Context, tagID int64) (*models.Tag, error) {
+	return GetTag(ctx, s.Pool, tagID)
+}
+
+func (s *PostgresStore) GetTags(ctx context.Context, userID int64) ([]models.Tag, error) {
+	return GetTags(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) UpdateTag(ctx context.Context, tagID int64, tag *models.Tag) (*models.Tag, error) {
+	return UpdateTag(ctx, s.Pool, tagID, tag)
+}
+
+func (s *PostgresStore) DeleteTag(ctx context.Context, tagID int64) error {
+	return DeleteTag(ctx, s.Pool, tagID)
+}
+
+func (s *PostgresStore) DeleteUnusedTags(ctx context.Context, userID int64) (int, error) {
+	return DeleteUnusedTags(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) GetSnippetTags(ctx context.Context, snippetID int64) ([]string, error) {
+	return getSnippetTags(ctx, s.Pool, snippetID)
+}
+
+// Revisions
+
+func (s *PostgresStore) GetSnippetRevisions(ctx context.Context, snippetID int64, page, limit int) ([]models.SnippetRevision, int, error) {
+	return GetSnippetRevisions(ctx, s.Pool, snippetID, page, limit)
+}
+
+func (s *PostgresStore) GetSnippetRevision(ctx context.Context, snippetID int64, revision int) (*models.SnippetRevision, error) {
+	return GetSnippetRevision(ctx, s.Pool, snippetID, revision)
+}
+
+// Trash
+
+func (s *PostgresStore) GetTrash(ctx context.Context, page, limit int, userID int64, itemType string) ([]models.TrashItem, int, error) {
+	return GetTrash(ctx, s.Pool, page, limit, userID, itemType)
+}
+
+func (s *PostgresStore) GetTrashedSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error) {
+	return GetTrashedSnippet(ctx, s.Pool, snippetID)
+}
+
+func (s *PostgresStore) GetTrashedFolder(ctx context.Context, folderID int64) (*models.Folder, error) {
+	return GetTrashedFolder(ctx, s.Pool, folderID)
+}
+
+func (s *PostgresStore) RestoreSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error) {
+	return RestoreSnippet(ctx, s.Pool, snippetID)
+}
+
+func (s *PostgresStore) RestoreFolder(ctx context.Context, folderID int64) (*models.Folder, error) {
+	return RestoreFolder(ctx, s.Pool, folderID)
+}
+
+func (s *PostgresStore) PurgeSnippet(ctx context.Context, snippetID int64) error {
+	return PurgeSnippet(ctx, s.Pool, snippetID)
+}
+
+func (s *PostgresStore) PurgeFolder(ctx context.Context, folderID int64) error {
+	return PurgeFolder(ctx, s.Pool, folderID)
+}
+
+func (s *PostgresStore) EmptyTrash(ctx context.Context, userID int64) (int, error) {
+	return EmptyTrash(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	return PurgeTrash(ctx, s.Pool, before)
+}
+
+// Saved searches
+
+func (s *PostgresStore) CreateSavedSearch(ctx context.Context, search *models.SavedSearch) error {
+	return CreateSavedSearch(ctx, s.Pool, search)
+}
+
+func (s *PostgresStore) GetSavedSearch(ctx context.Context, searchID int64) (*models.SavedSearch, error) {
+	return GetSavedSearch(ctx, s.Pool, searchID)
+}
+
+func (s *PostgresStore) GetSavedSearches(ctx context.Context, userID int64) ([]models.SavedSearch, error) {
+	return GetSavedSearches(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) UpdateSavedSearch(ctx context.Context, searchID int64, search *models.SavedSearch) error {
+	return UpdateSavedSearch(ctx, s.Pool, searchID, search)
+}
+
+func (s *PostgresStore) DeleteSavedSearch(ctx context.Context, searchID int64) error {
+	return DeleteSavedSearch(ctx, s.Pool, searchID)
+}
+
+// Suggestions
+
+func (s *PostgresStore) Suggest(ctx context.Context, userID int64, prefix string, limit int) (*models.Suggestions, error) {
+	return Suggest(ctx, s.Pool, userID, prefix, limit)
+}
+
+// Sessions
+
+func (s *PostgresStore) CreateSession(ctx context.Context, session *models.Session, tokenHash string) error {
+	return CreateSession(ctx, s.Pool, session, tokenHash)
+}
+
+func (s *PostgresStore) GetSession(ctx context.Context, sessionID int64) (*models.Session, error) {
+	return GetSession(ctx, s.Pool, sessionID)
+}
+
+func (s *PostgresStore) GetSessionByToken(ctx context.Context, tokenHash string) (*models.Session, error) {
+	return GetSessionByToken(ctx, s.Pool, tokenHash)
+}
+
+func (s *PostgresStore) GetSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	return GetSessions(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) RotateSession(ctx context.Context, tokenHash, newTokenHash, ipAddress string, expiresAt time.Time) (*models.Session, error) {
+	return RotateSession(ctx, s.Pool, tokenHash, newTokenHash, ipAddress, expiresAt)
+}
+
+func (s *PostgresStore) RevokeSession(ctx context.Context, sessionID int64) error {
+	return RevokeSession(ctx, s.Pool, sessionID)
+}
+
+func (s *PostgresStore) RevokeUserSessions(ctx context.Context, userID, exceptID int64) (int, error) {
+	return RevokeUserSessions(ctx, s.Pool, userID, exceptID)
+}
+
+func (s *PostgresStore) PurgeSessions(ctx context.Context, before time.Time) (int, error) {
+	return PurgeSessions(ctx, s.Pool, before)
+}
+
+// API tokens
+
+func (s *PostgresStore) CreateAPIToken(ctx context.Context, token *models.APIToken, tokenHash string) error {
+	return CreateAPIToken(ctx, s.Pool, token, tokenHash)
+}
+
+func (s *PostgresStore) GetAPIToken(ctx context.Context, tokenID int64) (*models.APIToken, error) {
+	return GetAPIToken(ctx, s.Pool, tokenID)
+}
+
+func (s *PostgresStore) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	return GetAPITokenByHash(ctx, s.Pool, tokenHash)
+}
+
+func (s *PostgresStore) GetAPITokens(ctx context.Context, userID int64) ([]models.APIToken, error) {
+	return GetAPITokens(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) TouchAPIToken(ctx context.Context, tokenID int64, usedAt time.Time) error {
+	return TouchAPIToken(ctx, s.Pool, tokenID, usedAt)
+}
+
+func (s *PostgresStore) DeleteAPIToken(ctx context.Context, tokenID int64) error {
+	return DeleteAPIToken(ctx, s.Pool, tokenID)
+}
+
+// Two-factor authentication
+
+func (s *PostgresStore) GetTwoFactor(ctx context.Context, userID int64) (*models.TwoFactor, error) {
+	return GetTwoFactor(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) SetTwoFactorSecret(ctx context.Context, userID int64, secret string) error {
+	return SetTwoFactorSecret(ctx, s.Pool, userID, secret)
+}
+
+func (s *PostgresStore) EnableTwoFactor(ctx context.Context, userID, step int64, codeHashes []string) error {
+	return EnableTwoFactor(ctx, s.Pool, userID, step, codeHashes)
+}
+
+func (s *PostgresStore) UseTwoFactorStep(ctx context.Context, userID, step int64) error {
+	return UseTwoFactorStep(ctx, s.Pool, userID, step)
+}
+
+func (s *PostgresStore) RecordTwoFactorFailure(ctx context.Context, userID int64, maxAttempts int) (*time.Time, error) {
+	return RecordTwoFactorFailure(ctx, s.Pool, userID, maxAttempts)
+}
+
+func (s *PostgresStore) ResetTwoFactorFailures(ctx context.Context, userID int64) error {
+	return ResetTwoFactorFailures(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	return UseRecoveryCode(ctx, s.Pool, userID, codeHash)
+}
+
+func (s *PostgresStore) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	return CountRecoveryCodes(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) DisableTwoFactor(ctx context.Context, userID int64) error {
+	return DisableTwoFactor(ctx, s.Pool, userID)
+}
+
+// Identities
+
+func (s *PostgresStore) GetIdentity(ctx context.Context, identityID int64) (*models.UserIdentity, error) {
+	return GetIdentity(ctx, s.Pool, identityID)
+}
+
+func (s *PostgresStore) GetIdentityBySubject(ctx context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	return GetIdentityBySubject(ctx, s.Pool, issuer, subject)
+}
+
+func (s *PostgresStore) GetIdentities(ctx context.Context, userID int64) ([]models.UserIdentity, error) {
+	return GetIdentities(ctx, s.Pool, userID)
+}
+
+func (s *PostgresStore) CreateIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	return CreateIdentity(ctx, s.Pool, identity)
+}
+
+func (s *PostgresStore) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) error {
+	return CreateUserWithIdentity(ctx, s.Pool, user, identity)
+}
+
+func (s *PostgresStore) DeleteIdentity(ctx context.Context, identityID int64) error {
+	return DeleteIdentity(ctx, s.Pool, identityID)
+}
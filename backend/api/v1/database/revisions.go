@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNoRevisionError = errors.New("revision does not exist")
+
+func GetSnippetRevisions(ctx context.Context, pool *pgxpool.Pool, snippetID int64, page, limit int) ([]models.SnippetRevision, int, error) {
+	offset := (page - 1) * limit
+
+	var total int
+	err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM snippet_revisions WHERE snippet_id = $1", snippetID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to get revision count", ErrDatabaseError)
+	}
+
+	// Content is left out of listings, fetch a single revision to get it
+	query := `
+		SELECT id, snippet_id, revision, title, description, language, tags, created_at
+		FROM snippet_revisions
+		WHERE snippet_id = $1
+		ORDER BY revision DESC
+		LIMIT $2 OFFSET $3`
+
+	rows, err := pool.Query(ctx, query, snippetID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to get revisions", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var revisions []models.SnippetRevision
+	for rows.Next() {
+		var revision models.SnippetRevision
+		var description *string
+
+		err := rows.Scan(
+			&revision.ID,
+			&revision.SnippetID,
+			&revision.Revision,
+			&revision.Title,
+			&description,
+			&revision.Language,
+			&revision.Tags,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: failed to scan revision data", ErrDatabaseError)
+		}
+
+		revision.Description = description
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to iterate revisions", ErrDatabaseError)
+	}
+
+	return revisions, total, nil
+}
+
+func GetSnippetRevision(ctx context.Context, pool *pgxpool.Pool, snippetID int64, revisionNumber int) (*models.SnippetRevision, error) {
+	query := `
+		SELECT id, snippet_id, revision, title, description, content, language, tags, created_at
+		FROM snippet_revisions
+		WHERE snippet_id = $1 AND revision = $2`
+
+	var revision models.SnippetRevision
+	var description *string
+
+	err := pool.QueryRow(ctx, query, snippetID, revisionNumber).Scan(
+		&revision.ID,
+		&revision.SnippetID,
+		&revision.Revision,
+		&revision.Title,
+		&description,
+		&revision.Content,
+		&revision.Language,
+		&revision.Tags,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRevisionError
+		}
+		return nil, fmt.Errorf("%w: failed to get revision", ErrDatabaseError)
+	}
+
+	revision.Description = description
+
+	return &revision, nil
+}
+
+// insertSnippetRevision snapshots the snippet row and its tags as they stand
+// inside tx, numbering the revision after the latest one
+func insertSnippetRevision(ctx context.Context, tx pgx.Tx, snippetID int64, createdAt time.Time) error {
+	query := `
+		INSERT INTO snippet_revisions (snippet_id, revision, title, description, content, language, tags, created_at)
+		SELECT s.id,
+		       COALESCE((SELECT MAX(revision) FROM snippet_revisions WHERE snippet_id = s.id), 0) + 1,
+		       s.title, s.description, s.content, s.language,
+		       ARRAY(
+		           SELECT t.name FROM snippet_tags st
+		           JOIN tags t ON st.tag_id = t.id
+		           WHERE st.snippet_id = s.id
+		           ORDER BY t.name
+		       ),
+		       $2
+		FROM snippets s
+		WHERE s.id = $1`
+
+	_, err := tx.Exec(ctx, query, snippetID, createdAt)
+	if err != nil {
+		return fmt.Errorf("failed to record snippet revision: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNoSavedSearchError = errors.New("saved search does not exist")
+
+func CreateSavedSearch(ctx context.Context, pool *pgxpool.Pool, search *models.SavedSearch) error {
+	filters, err := json.Marshal(search.Filters)
+	if err != nil {
+		return fmt.Errorf("failed to encode saved search filters: %w", err)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	var count int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM saved_searches WHERE user_id = $1 AND name = $2", search.UserID, search.Name).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check for duplicate saved search name", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("saved search name already exists")
+	}
+
+	now := time.Now()
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO saved_searches (user_id, name, query, filters, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		search.UserID, search.Name, search.Query, string(filters), now, now,
+	).Scan(&search.ID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to insert saved search", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	search.CreatedAt = now
+	search.UpdatedAt = now
+
+	return nil
+}
+
+func GetSavedSearch(ctx context.Context, pool *pgxpool.Pool, searchID int64) (*models.SavedSearch, error) {
+	query := `
+		SELECT id, user_id, name, query, filters, created_at, updated_at
+		FROM saved_searches
+		WHERE id = $1`
+
+	var search models.SavedSearch
+	var filters []byte
+	err := pool.QueryRow(ctx, query, searchID).Scan(
+		&search.ID,
+		&search.UserID,
+		&search.Name,
+		&search.Query,
+		&filters,
+		&search.CreatedAt,
+		&search.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("saved search with ID %d does not exist: %w", searchID, ErrNoSavedSearchError)
+		}
+		return nil, fmt.Errorf("%w: failed to get saved search", ErrDatabaseError)
+	}
+
+	if err = json.Unmarshal(filters, &search.Filters); err != nil {
+		return nil, fmt.Errorf("failed to decode saved search filters: %w", err)
+	}
+
+	return &search, nil
+}
+
+func GetSavedSearches(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.SavedSearch, error) {
+	query := `
+		SELECT id, user_id, name, query, filters, created_at, updated_at
+		FROM saved_searches
+		WHERE user_id = $1
+		ORDER BY name ASC`
+
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get saved searches", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var searches []models.SavedSearch
+	for rows.Next() {
+		var search models.SavedSearch
+		var filters []byte
+
+		err := rows.Scan(&search.ID, &search.UserID, &search.Name, &search.Query, &filters, &search.CreatedAt, &search.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan saved search data", ErrDatabaseError)
+		}
+
+		if err = json.Unmarshal(filters, &search.Filters); err != nil {
+			return nil, fmt.Errorf("failed to decode saved search filters: %w", err)
+		}
+
+		searches = append(searches, search)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate saved searches", ErrDatabaseError)
+	}
+
+	return searches, nil
+}
+
+// UpdateSavedSearch replaces the name, query and filters of a saved search
+func UpdateSavedSearch(ctx context.Context, pool *pgxpool.Pool, searchID int64, search *models.SavedSearch) error {
+	filters, err := json.Marshal(search.Filters)
+	if err != nil {
+		return fmt.Errorf("failed to encode saved search filters: %w", err)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "SELECT user_id FROM saved_searches WHERE id = $1 FOR UPDATE", searchID).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("saved search with ID %d does not exist: %w", searchID, ErrNoSavedSearchError)
+		}
+		return fmt.Errorf("%w: failed to check saved search existence", ErrDatabaseError)
+	}
+
+	var count int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM saved_searches WHERE user_id = $1 AND name = $2 AND id <> $3", userID, search.Name, searchID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check for duplicate saved search name", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("saved search name already exists")
+	}
+
+	now := time.Now()
+
+	_, err = tx.Exec(ctx, `
+		UPDATE saved_searches
+		SET name = $1, query = $2, filters = $3, updated_at = $4
+		WHERE id = $5`,
+		search.Name, search.Query, string(filters), now, searchID,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update saved search", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	search.ID = searchID
+	search.UserID = userID
+	search.UpdatedAt = now
+
+	return nil
+}
+
+func DeleteSavedSearch(ctx context.Context, pool *pgxpool.Pool, searchID int64) error {
+	result, err := pool.Exec(ctx, "DELETE FROM saved_searches WHERE id = $1", searchID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete saved search", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("saved search with ID %d does not exist: %w", searchID, ErrNoSavedSearchError)
+	}
+
+	return nil
+}
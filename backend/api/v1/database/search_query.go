@@ -0,0 +1,229 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Search query operators, written as field:value in the search box
+const (
+	SearchFieldLanguage = "lang"
+	SearchFieldTag      = "tag"
+	SearchFieldFolder   = "folder"
+	SearchFieldIs       = "is"
+)
+
+// searchFieldAliases maps every spelling of an operator onto its field
+var searchFieldAliases = map[string]string{
+	"lang":     SearchFieldLanguage,
+	"language": SearchFieldLanguage,
+	"tag":      SearchFieldTag,
+	"folder":   SearchFieldFolder,
+	"is":       SearchFieldIs,
+}
+
+// searchIsValues are the values is: understands
+var searchIsValues = map[string]bool{
+	"fav":       true,
+	"favorite":  true,
+	"favorited": true,
+}
+
+// SearchTerm is one part of a parsed search query
+type SearchTerm struct {
+	// Field is one of the SearchField operators, empty for free text
+	Field string
+	Value string
+	// Phrase marks quoted free text, whose words must appear together
+	Phrase bool
+	// Prefix marks a free text word written with a trailing *, whose last
+	// word matches any word starting with it
+	Prefix  bool
+	Negated bool
+	// Position is where the term starts in the query, counted in characters
+	Position int
+}
+
+// SearchQuery is a search box query broken into terms, for example
+// lang:go tag:http folder:utils is:fav "exact phrase" deco* -deprecated
+type SearchQuery struct {
+	Terms []SearchTerm
+}
+
+// SearchQueryError reports a malformed query and where it went wrong
+type SearchQueryError struct {
+	// Position is the offset of the problem in the query, counted in characters
+	Position int
+	Message  string
+}
+
+func (e *SearchQueryError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+// ParseSearchQuery parses a search box query. Words are matched as free text,
+// quotes make a phrase, a trailing * makes a word match as a prefix and a
+// leading - excludes a word, phrase or operator.
+// Only known operator names are treated as operators, so text such as
+// http://example.com stays a plain word.
+func ParseSearchQuery(query string) (*SearchQuery, error) {
+	input := []rune(query)
+	parsed := &SearchQuery{}
+
+	pos := 0
+	for {
+		for pos < len(input) && unicode.IsSpace(input[pos]) {
+			pos++
+		}
+		if pos >= len(input) {
+			break
+		}
+
+		term := SearchTerm{Position: pos}
+
+		// A leading -- is part of the word, as in --no-cache
+		if input[pos] == '-' && (pos+1 >= len(input) || input[pos+1] != '-') {
+			if pos+1 >= len(input) || unicode.IsSpace(input[pos+1]) {
+				return nil, &SearchQueryError{Position: pos, Message: "expected a term after -"}
+			}
+			term.Negated = true
+			pos++
+		}
+
+		if input[pos] == '"' {
+			phrase, next, err := readQuoted(input, pos)
+			if err != nil {
+				return nil, err
+			}
+			if strings.TrimSpace(phrase) == "" {
+				return nil, &SearchQueryError{Position: pos, Message: "empty phrase"}
+			}
+			term.Value = phrase
+			term.Phrase = true
+			parsed.Terms = append(parsed.Terms, term)
+			pos = next
+			continue
+		}
+
+		start := pos
+		for pos < len(input) && !unicode.IsSpace(input[pos]) {
+			pos++
+		}
+		word := string(input[start:pos])
+
+		name, value, isOperator := strings.Cut(word, ":")
+		field, known := searchFieldAliases[strings.ToLower(name)]
+		if !isOperator || !known {
+			if value, ok := strings.CutSuffix(word, "*"); ok && strings.TrimRight(value, "*") != "" {
+				word = value
+				term.Prefix = true
+			}
+			term.Value = word
+			parsed.Terms = append(parsed.Terms, term)
+			continue
+		}
+
+		term.Field = field
+
+		// A quoted value lets folder and tag names contain spaces
+		valuePos := start + len([]rune(name)) + 1
+		if strings.HasPrefix(value, `"`) {
+			quoted, next, err := readQuoted(input, valuePos)
+			if err != nil {
+				return nil, err
+			}
+			value = quoted
+			pos = next
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, &SearchQueryError{Position: start, Message: fmt.Sprintf("missing value for %s:", name)}
+		}
+
+		if field == SearchFieldIs && !searchIsValues[strings.ToLower(value)] {
+			return nil, &SearchQueryError{Position: valuePos, Message: fmt.Sprintf("unknown value %q for is:, expected fav", value)}
+		}
+
+		term.Value = value
+		parsed.Terms = append(parsed.Terms, term)
+	}
+
+	return parsed, nil
+}
+
+// readQuoted reads the quoted string opening at input[pos] and returns its
+// contents and the position just past the closing quote
+func readQuoted(input []rune, pos int) (string, int, error) {
+	for end := pos + 1; end < len(input); end++ {
+		if input[end] == '"' {
+			return string(input[pos+1 : end]), end + 1, nil
+		}
+	}
+	return "", 0, &SearchQueryError{Position: pos, Message: "unterminated quote"}
+}
+
+// HasText reports whether the query has free text to match, as opposed to
+// only operators
+func (q *SearchQuery) HasText() bool {
+	for _, term := range q.Terms {
+		if term.Field == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// textTerms splits the free text into the terms a snippet must match and the
+// terms it must not
+func (q *SearchQuery) textTerms() (include, exclude []SearchTerm) {
+	for _, term := range q.Terms {
+		if term.Field != "" {
+			continue
+		}
+		if term.Negated {
+			exclude = append(exclude, term)
+		} else {
+			include = append(include, term)
+		}
+	}
+	return include, exclude
+}
+
+// tsQueryText compiles free text terms into to_tsquery input requiring every
+// term. A term's words are split the way plainto_tsquery splits them, a
+// phrase's words are chained with <-> and a prefix term's last word gets :*.
+// Every word is quoted, so nothing in it is read as tsquery syntax.
+func tsQueryText(terms []SearchTerm) string {
+	var parts []string
+	for _, term := range terms {
+		words := searchTerms(term.Value)
+		if len(words) == 0 {
+			continue
+		}
+
+		lexemes := make([]string, len(words))
+		for i, word := range words {
+			lexemes[i] = tsQueryLexeme(word)
+		}
+		if term.Prefix {
+			lexemes[len(lexemes)-1] += ":*"
+		}
+
+		if term.Phrase {
+			parts = append(parts, "("+strings.Join(lexemes, " <-> ")+")")
+		} else {
+			parts = append(parts, strings.Join(lexemes, " & "))
+		}
+	}
+
+	return strings.Join(parts, " & ")
+}
+
+// tsQueryLexeme quotes word as a tsquery lexeme, doubling quotes and escaping
+// backslashes inside it
+func tsQueryLexeme(word string) string {
+	word = strings.ReplaceAll(word, `\`, `\\`)
+	return "'" + strings.ReplaceAll(word, "'", "''") + "'"
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []SearchTerm
+	}{
+		{
+			name:  "empty",
+			query: "   ",
+			want:  nil,
+		},
+		{
+			name:  "words",
+			query: "http  client",
+			want: []SearchTerm{
+				{Value: "http", Position: 0},
+				{Value: "client", Position: 6},
+			},
+		},
+		{
+			name:  "field operators",
+			query: "lang:go tag:http folder:utils is:fav",
+			want: []SearchTerm{
+				{Field: SearchFieldLanguage, Value: "go", Position: 0},
+				{Field: SearchFieldTag, Value: "http", Position: 8},
+				{Field: SearchFieldFolder, Value: "utils", Position: 17},
+				{Field: SearchFieldIs, Value: "fav", Position: 30},
+			},
+		},
+		{
+			name:  "operator aliases and case",
+			query: "Language:Go IS:Favorite",
+			want: []SearchTerm{
+				{Field: SearchFieldLanguage, Value: "Go", Position: 0},
+				{Field: SearchFieldIs, Value: "Favorite", Position: 12},
+			},
+		},
+		{
+			name:  "quoted operator value",
+			query: `folder:"my utils" retry`,
+			want: []SearchTerm{
+				{Field: SearchFieldFolder, Value: "my utils", Position: 0},
+				{Value: "retry", Position: 18},
+			},
+		},
+		{
+			name:  "unknown operator is a word",
+			query: "http://example.com key:value",
+			want: []SearchTerm{
+				{Value: "http://example.com", Position: 0},
+				{Value: "key:value", Position: 19},
+			},
+		},
+		{
+			name:  "phrase",
+			query: `"exact phrase" after`,
+			want: []SearchTerm{
+				{Value: "exact phrase", Phrase: true, Position: 0},
+				{Value: "after", Position: 15},
+			},
+		},
+		{
+			name:  "negated word, phrase and operator",
+			query: `-deprecated -"old api" -tag:legacy`,
+			want: []SearchTerm{
+				{Value: "deprecated", Negated: true, Position: 0},
+				{Value: "old api", Phrase: true, Negated: true, Position: 12},
+				{Field: SearchFieldTag, Value: "legacy", Negated: true, Position: 23},
+			},
+		},
+		{
+			name:  "prefix",
+			query: "deco* -json* a*b",
+			want: []SearchTerm{
+				{Value: "deco", Prefix: true, Position: 0},
+				{Value: "json", Prefix: true, Negated: true, Position: 6},
+				{Value: "a*b", Position: 13},
+			},
+		},
+		{
+			name:  "lone star is a word",
+			query: "*",
+			want:  []SearchTerm{{Value: "*", Position: 0}},
+		},
+		{
+			name:  "double dash is part of the word",
+			query: "--no-cache",
+			want:  []SearchTerm{{Value: "--no-cache", Position: 0}},
+		},
+		{
+			name:  "dash inside a word",
+			query: "read-only",
+			want:  []SearchTerm{{Value: "read-only", Position: 0}},
+		},
+		{
+			name:  "positions count characters",
+			query: "héllo wörld",
+			want: []SearchTerm{
+				{Value: "héllo", Position: 0},
+				{Value: "wörld", Position: 6},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseSearchQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseSearchQuery(%q) error = %v", tt.query, err)
+			}
+			if !slices.Equal(parsed.Terms, tt.want) {
+				t.Errorf("ParseSearchQuery(%q) = %+v, want %+v", tt.query, parsed.Terms, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	tests := []struct {
+		query        string
+		wantPosition int
+	}{
+		{"retry -", 6},
+		{"- retry", 0},
+		{`"unterminated`, 0},
+		{`say "`, 4},
+		{`""`, 0},
+		{`-"  "`, 1},
+		{"lang:", 0},
+		{"go tag:", 3},
+		{`folder:"my utils`, 7},
+		{"is:archived", 3},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseSearchQuery(tt.query)
+
+		var queryErr *SearchQueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("ParseSearchQuery(%q) error = %v, want a SearchQueryError", tt.query, err)
+			continue
+		}
+		if queryErr.Position != tt.wantPosition {
+			t.Errorf("ParseSearchQuery(%q) error at %d, want %d (%v)", tt.query, queryErr.Position, tt.wantPosition, err)
+		}
+	}
+}
+
+func TestSearchQueryTextTerms(t *testing.T) {
+	parsed, err := ParseSearchQuery(`lang:go retry -"old api" backoff`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !parsed.HasText() {
+		t.Error("HasText() = false, want true")
+	}
+
+	include, exclude := parsed.textTerms()
+	var includeValues, excludeValues []string
+	for _, term := range include {
+		includeValues = append(includeValues, term.Value)
+	}
+	for _, term := range exclude {
+		excludeValues = append(excludeValues, term.Value)
+	}
+	if !slices.Equal(includeValues, []string{"retry", "backoff"}) || !slices.Equal(excludeValues, []string{"old api"}) {
+		t.Errorf("textTerms() = %q, %q", includeValues, excludeValues)
+	}
+
+	operatorsOnly, err := ParseSearchQuery("lang:go is:fav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if operatorsOnly.HasText() {
+		t.Error("HasText() = true for operators only")
+	}
+}
+
+func TestTSQueryText(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"words", "retry backoff", "'retry' & 'backoff'"},
+		{"punctuation splits words", "json.NewDecoder", "'json' & 'newdecoder'"},
+		{"phrase", `"read json" now`, "('read' <-> 'json') & 'now'"},
+		{"prefix", "deco*", "'deco':*"},
+		{"prefix applies to the last word", "json.deco*", "'json' & 'deco':*"},
+		{"tsquery syntax is quoted", `a&b|!c <-> d:*`, "'a' & 'b' & 'c' & 'd':*"},
+		{"nothing to match", "!!! ***", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseSearchQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			include, _ := parsed.textTerms()
+			if got := tsQueryText(include); got != tt.want {
+				t.Errorf("tsQueryText(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTSQueryLexeme(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"retry", "'retry'"},
+		{"don't", "'don''t'"},
+		{`back\slash`, `'back\\slash'`},
+	}
+
+	for _, tt := range tests {
+		if got := tsQueryLexeme(tt.word); got != tt.want {
+			t.Errorf("tsQueryLexeme(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
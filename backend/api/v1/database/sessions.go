@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNoSessionError = errors.New("session does not exist")
+	// ErrSessionReuseError means a refresh token came back after it had been
+	// rotated, so someone else holds a copy
+	ErrSessionReuseError = errors.New("refresh token has already been used")
+)
+
+// refreshReuseGrace is how long a replaced refresh token still works. Two tabs
+// refreshing with the same token at once would otherwise look like a stolen
+// copy and sign the session out, so the later one gets a token of its own in
+// the same session instead. It is a variable so tests can close it.
+var refreshReuseGrace = 30 * time.Second
+
+// sessionColumns selects a sessions row as a models.Session, named by its family
+const sessionColumns = "family_id, user_id, device, ip_address, signed_in_at, last_used_at, expires_at"
+
+// liveSession matches the current refresh token of a session that has not
+// been revoked or run out, with the time as the next parameter
+const liveSession = "replaced_at IS NULL AND revoked_at IS NULL AND expires_at > "
+
+func CreateSession(ctx context.Context, pool *pgxpool.Pool, session *models.Session, tokenHash string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+
+	var sessionID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, token_hash, device, ip_address, signed_in_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		session.UserID, tokenHash, session.Device, session.IPAddress, now, now, session.ExpiresAt,
+	).Scan(&sessionID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to insert session", ErrDatabaseError)
+	}
+
+	// The first token names the family
+	_, err = tx.Exec(ctx, "UPDATE sessions SET family_id = id WHERE id = $1", sessionID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update session", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	session.ID = sessionID
+	session.SignedInAt = now
+	session.LastUsedAt = now
+
+	return nil
+}
+
+func GetSession(ctx context.Context, pool *pgxpool.Pool, sessionID int64) (*models.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE family_id = $1 AND " + liveSession + "$2"
+	return getSession(ctx, pool, query, sessionID, time.Now())
+}
+
+func GetSessionByToken(ctx context.Context, pool *pgxpool.Pool, tokenHash string) (*models.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE token_hash = $1 AND " + liveSession + "$2"
+	return getSession(ctx, pool, query, tokenHash, time.Now())
+}
+
+func getSession(ctx context.Context, pool *pgxpool.Pool, query string, args ...interface{}) (*models.Session, error) {
+	var session models.Session
+	err := pool.QueryRow(ctx, query, args...).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.IPAddress,
+		&session.SignedInAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoSessionError
+		}
+		return nil, fmt.Errorf("%w: failed to get session", ErrDatabaseError)
+	}
+
+	return &session, nil
+}
+
+func GetSessions(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE user_id = $1 AND " + liveSession + "$2 ORDER BY last_used_at DESC, family_id DESC"
+
+	rows, err := pool.Query(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get sessions", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	// A session refreshed twice within refreshReuseGrace has two live tokens,
+	// only the most recently used is listed
+	sessions := []models.Session{}
+	seen := make(map[int64]bool)
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.Device, &session.IPAddress, &session.SignedInAt, &session.LastUsedAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan session data", ErrDatabaseError)
+		}
+		if !seen[session.ID] {
+			seen[session.ID] = true
+			sessions = append(sessions, session)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate sessions", ErrDatabaseError)
+	}
+
+	return sessions, nil
+}
+
+func RotateSession(ctx context.Context, pool *pgxpool.Pool, tokenHash, newTokenHash, ipAddress string, expiresAt time.Time) (*models.Session, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the row makes a second refresh with the same token wait and
+	// then see it replaced
+	var tokenID int64
+	var session models.Session
+	var replacedAt, revokedAt *time.Time
+	err = tx.QueryRow(ctx, "SELECT id, "+sessionColumns+", replaced_at, revoked_at FROM sessions WHERE token_hash = $1 FOR UPDATE", tokenHash).Scan(
+		&tokenID,
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.IPAddress,
+		&session.SignedInAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&replacedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoSessionError
+		}
+		return nil, fmt.Errorf("%w: failed to get session", ErrDatabaseError)
+	}
+
+	now := time.Now()
+	if revokedAt != nil || !session.ExpiresAt.After(now) {
+		return nil, ErrNoSessionError
+	}
+
+	if replacedAt != nil && now.Sub(*replacedAt) >= refreshReuseGrace {
+		_, err = tx.Exec(ctx, "UPDATE sessions SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL", now, session.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to revoke session", ErrDatabaseError)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+		}
+		return nil, fmt.Errorf("session %d revoked: %w", session.ID, ErrSessionReuseError)
+	}
+
+	// A token replaced moments ago keeps its replaced_at, so reusing it again
+	// doesn't stretch the grace
+	if replacedAt == nil {
+		_, err = tx.Exec(ctx, "UPDATE sessions SET replaced_at = $1 WHERE id = $2", now, tokenID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to update session", ErrDatabaseError)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO sessions (family_id, user_id, token_hash, device, ip_address, signed_in_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		session.ID, session.UserID, newTokenHash, session.Device, ipAddress, session.SignedInAt, now, expiresAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to insert session", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	session.IPAddress = ipAddress
+	session.LastUsedAt = now
+	session.ExpiresAt = expiresAt
+
+	return &session, nil
+}
+
+func RevokeSession(ctx context.Context, pool *pgxpool.Pool, sessionID int64) error {
+	result, err := pool.Exec(ctx, "UPDATE sessions SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL", time.Now(), sessionID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to revoke session", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("session with ID %d does not exist: %w", sessionID, ErrNoSessionError)
+	}
+
+	return nil
+}
+
+func RevokeUserSessions(ctx context.Context, pool *pgxpool.Pool, userID, exceptID int64) (int, error) {
+	now := time.Now()
+
+	// Old tokens of each session are revoked along with the current one, but
+	// only the sessions still live are counted
+	var revoked int
+	err := pool.QueryRow(ctx, `
+		WITH revoked AS (
+			UPDATE sessions SET revoked_at = $1
+			WHERE user_id = $2 AND family_id <> $3 AND revoked_at IS NULL
+			RETURNING family_id, replaced_at, expires_at
+		)
+		SELECT COUNT(DISTINCT family_id) FROM revoked WHERE replaced_at IS NULL AND expires_at > $1`,
+		now, userID, exceptID,
+	).Scan(&revoked)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to revoke sessions", ErrDatabaseError)
+	}
+
+	return revoked, nil
+}
+
+// PurgeSessions deletes expired refresh tokens, across all users. Replaced
+// tokens are kept until then so that reusing one is still caught.
+func PurgeSessions(ctx context.Context, pool *pgxpool.Pool, before time.Time) (int, error) {
+	result, err := pool.Exec(ctx, "DELETE FROM sessions WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to purge sessions", ErrDatabaseError)
+	}
+
+	return int(result.RowsAffected()), nil
+}
@@ -0,0 +1,371 @@
+package database
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+const (
+	// minHashSize is the number of hash functions in a signature. The
+	// estimated similarity is within about 0.1 of the true Jaccard index.
+	minHashSize = 128
+	// shingleSize is how many consecutive tokens make up one shingle
+	shingleSize = 3
+	// minHashBands splits signatures for locality-sensitive hashing. Two
+	// snippets become candidates when any band of their signatures is
+	// identical, which catches most pairs above about 0.2 similarity and
+	// nearly every pair above 0.3.
+	minHashBands = 64
+	minHashRows  = minHashSize / minHashBands
+	// minCandidateSimilarity is the least similarity the bands are trusted to
+	// find. Below it every stored signature is compared instead.
+	minCandidateSimilarity = 0.2
+)
+
+// minHashSeeds are the odd multipliers and offsets of the hash functions,
+// h(x) = a*x + b keeping the top 32 bits, which is enough to approximate
+// independent permutations of the shingle hashes
+var minHashSeeds = func() [minHashSize][2]uint64 {
+	var seeds [minHashSize][2]uint64
+	state := uint64(0x9e3779b97f4a7c15)
+	for i := range seeds {
+		state += 0x9e3779b97f4a7c15
+		seeds[i][0] = mix64(state) | 1
+		state += 0x9e3779b97f4a7c15
+		seeds[i][1] = mix64(state)
+	}
+	return seeds
+}()
+
+// minHashSignature summarises a snippet's content so that the fraction of
+// positions two signatures share estimates how many shingles the snippets
+// have in common
+type minHashSignature [minHashSize]uint32
+
+// SnippetSignature is a snippet's stored MinHash signature along with the
+// fields a similarity result shows. Content is only loaded for snippets saved
+// before signatures were stored, so theirs can be worked out instead.
+type SnippetSignature struct {
+	Snippet models.SimilarSnippet
+	MinHash []byte
+	Content *string
+}
+
+// signature decodes the stored signature, or signs the content of a snippet
+// the backfill hasn't reached. It is nil for content without words.
+func (s *SnippetSignature) signature() *minHashSignature {
+	if s.Content != nil {
+		return newMinHashSignature(*s.Content)
+	}
+	return decodeMinHash(s.MinHash)
+}
+
+// similarityCandidate is a walked snippet along with its signature
+type similarityCandidate struct {
+	snippet   models.SimilarSnippet
+	signature *minHashSignature
+}
+
+// FindSimilarSnippets ranks the owner's other snippets by how much of their
+// content they share with snippet, most similar first. Snippets below
+// minSimilarity are left out.
+func FindSimilarSnippets(ctx context.Context, store SnippetStore, snippet *models.Snippet, limit int, minSimilarity float64) ([]models.SimilarSnippet, error) {
+	similar := []models.SimilarSnippet{}
+
+	target := newMinHashSignature(snippet.Content)
+	if target == nil {
+		return similar, nil
+	}
+
+	compare := func(other *SnippetSignature) error {
+		if other.Snippet.ID == snippet.ID {
+			return nil
+		}
+
+		signature := other.signature()
+		if signature == nil {
+			return nil
+		}
+
+		if similarity := target.similarity(signature); similarity >= minSimilarity {
+			match := other.Snippet
+			match.Similarity = roundSimilarity(similarity)
+			similar = append(similar, match)
+		}
+		return nil
+	}
+
+	// Only snippets sharing a band with this one are compared, unless the
+	// threshold is too low for the bands to find them all
+	if minSimilarity >= minCandidateSimilarity {
+		candidates, err := store.GetSimilarityCandidates(ctx, snippet.UserID, snippet.ID, target.bandKeys())
+		if err != nil {
+			return nil, err
+		}
+		for i := range candidates {
+			compare(&candidates[i])
+		}
+	} else if err := store.WalkSnippetSignatures(ctx, snippet.UserID, compare); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].Similarity != similar[j].Similarity {
+			return similar[i].Similarity > similar[j].Similarity
+		}
+		return similar[i].ID < similar[j].ID
+	})
+
+	return similar[:min(len(similar), limit)], nil
+}
+
+// FindDuplicateSnippets groups the user's snippets into clusters of near
+// duplicates, linking every pair at least minSimilarity alike. Each cluster
+// starts with its oldest snippet, and the similarity of the others is to that
+// one. The biggest clusters come first.
+func FindDuplicateSnippets(ctx context.Context, store SnippetStore, userID int64, minSimilarity float64) ([]models.DuplicateCluster, error) {
+	var candidates []similarityCandidate
+	err := store.WalkSnippetSignatures(ctx, userID, func(stored *SnippetSignature) error {
+		if signature := stored.signature(); signature != nil {
+			candidates = append(candidates, similarityCandidate{
+				snippet:   stored.Snippet,
+				signature: signature,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only snippets sharing a band key are compared, so the work grows with
+	// the number of likely duplicates rather than with every pair
+	parent := make([]int, len(candidates))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	buckets := make(map[int64][]int)
+	for i, candidate := range candidates {
+		for _, key := range candidate.signature.bandKeys() {
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	for _, bucket := range buckets {
+		// Each snippet is compared with one member of every cluster already
+		// in the bucket rather than with every member, so a bucket of many
+		// copies stays cheap
+		var representatives []int
+		for _, i := range bucket {
+			joined := false
+			for _, rep := range representatives {
+				a, b := find(i), find(rep)
+				if a == b {
+					joined = true
+					continue
+				}
+				if candidates[i].signature.similarity(candidates[rep].signature) >= minSimilarity {
+					parent[max(a, b)] = min(a, b)
+					joined = true
+				}
+			}
+			if !joined {
+				representatives = append(representatives, i)
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Candidates were walked in ID order, so each root is its cluster's oldest
+	// snippet
+	members := make(map[int][]int)
+	for i := range candidates {
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+
+	clusters := []models.DuplicateCluster{}
+	for root, indexes := range members {
+		if len(indexes) < 2 {
+			continue
+		}
+
+		first := candidates[root]
+		first.snippet.Similarity = 1
+		cluster := models.DuplicateCluster{Snippets: []models.SimilarSnippet{first.snippet}}
+		for _, i := range indexes {
+			if i == root {
+				continue
+			}
+			snippet := candidates[i].snippet
+			snippet.Similarity = roundSimilarity(first.signature.similarity(candidates[i].signature))
+			cluster.Snippets = append(cluster.Snippets, snippet)
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Snippets) != len(clusters[j].Snippets) {
+			return len(clusters[i].Snippets) > len(clusters[j].Snippets)
+		}
+		return clusters[i].Snippets[0].ID < clusters[j].Snippets[0].ID
+	})
+
+	return clusters, nil
+}
+
+// newMinHashSignature signs the shingles of content, or returns nil when it
+// has no words to compare
+func newMinHashSignature(content string) *minHashSignature {
+	shingles := contentShingles(content)
+	if len(shingles) == 0 {
+		return nil
+	}
+
+	signature := &minHashSignature{}
+	for i := range signature {
+		signature[i] = ^uint32(0)
+	}
+
+	for _, shingle := range shingles {
+		for i, seed := range minHashSeeds {
+			if h := uint32((seed[0]*shingle + seed[1]) >> 32); h < signature[i] {
+				signature[i] = h
+			}
+		}
+	}
+
+	return signature
+}
+
+// similarity estimates the Jaccard index of the two snippets' shingles
+func (s *minHashSignature) similarity(other *minHashSignature) float64 {
+	same := 0
+	for i := range s {
+		if s[i] == other[i] {
+			same++
+		}
+	}
+	return float64(same) / minHashSize
+}
+
+// bandKeys hashes each band of the signature together with its position,
+// giving the keys kept in snippet_minhash_bands. Signatures sharing a key
+// almost certainly share that band.
+func (s *minHashSignature) bandKeys() []int64 {
+	keys := make([]int64, minHashBands)
+	for band := range keys {
+		h := mix64(uint64(band) + 1)
+		for _, value := range s[band*minHashRows : (band+1)*minHashRows] {
+			h = mix64(h ^ uint64(value))
+		}
+		keys[band] = int64(h)
+	}
+	return keys
+}
+
+// encodeMinHash packs a signature for the minhash column. Content without
+// words stores an empty value, so it isn't mistaken for content not yet
+// signed.
+func encodeMinHash(signature *minHashSignature) []byte {
+	data := []byte{}
+	if signature != nil {
+		for _, value := range signature {
+			data = binary.LittleEndian.AppendUint32(data, value)
+		}
+	}
+	return data
+}
+
+// decodeMinHash unpacks a stored signature, nil for content without words
+func decodeMinHash(data []byte) *minHashSignature {
+	if len(data) != 4*minHashSize {
+		return nil
+	}
+
+	signature := &minHashSignature{}
+	for i := range signature {
+		signature[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+	return signature
+}
+
+// contentShingles hashes every run of shingleSize consecutive tokens in
+// content. Tokens are lowercased words and identifiers, so formatting and
+// punctuation changes don't count as differences. Content shorter than a
+// shingle becomes a single shingle.
+func contentShingles(content string) []uint64 {
+	tokens := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	hashes := make([]uint64, len(tokens))
+	for i, token := range tokens {
+		h := fnv.New64a()
+		h.Write([]byte(token))
+		hashes[i] = h.Sum64()
+	}
+
+	size := min(shingleSize, len(hashes))
+	seen := make(map[uint64]bool)
+	var shingles []uint64
+	for i := 0; i+size <= len(hashes); i++ {
+		// Mixing between tokens keeps the order, so a b c and c b a differ
+		var shingle uint64
+		for _, h := range hashes[i : i+size] {
+			shingle = mix64(shingle ^ h)
+		}
+		if !seen[shingle] {
+			seen[shingle] = true
+			shingles = append(shingles, shingle)
+		}
+	}
+	return shingles
+}
+
+// mix64 is the splitmix64 finalizer, which scrambles every input bit across
+// the output
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func newSimilarSnippet(snippet *models.Snippet, similarity float64) models.SimilarSnippet {
+	return models.SimilarSnippet{
+		ID:         snippet.ID,
+		Title:      snippet.Title,
+		FolderID:   cloneInt64(snippet.FolderID),
+		Language:   snippet.Language,
+		Similarity: roundSimilarity(similarity),
+	}
+}
+
+// roundSimilarity keeps two decimals, more would suggest a precision the
+// estimate doesn't have
+func roundSimilarity(similarity float64) float64 {
+	return float64(int(similarity*100+0.5)) / 100
+}
@@ -0,0 +1,330 @@
+package database
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+const retryContent = `func retry(ctx context.Context, attempts int, fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(i) * time.Second):
+		}
+	}
+	return err
+}`
+
+// shingleJaccard is the exact similarity the signatures estimate
+func shingleJaccard(a, b string) float64 {
+	set := make(map[uint64]int)
+	for _, shingle := range contentShingles(a) {
+		set[shingle] |= 1
+	}
+	for _, shingle := range contentShingles(b) {
+		set[shingle] |= 2
+	}
+
+	shared := 0
+	for _, in := range set {
+		if in == 3 {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(set))
+}
+
+func TestMinHashSimilarity(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		min, max float64
+	}{
+		{
+			name: "identical",
+			a:    retryContent,
+			b:    retryContent,
+			min:  1, max: 1,
+		},
+		{
+			name: "formatting, case and punctuation ignored",
+			a:    "fmt.Println(\"Hello, World\")",
+			b:    "fmt . println ( 'hello world' ) ;",
+			min:  1, max: 1,
+		},
+		{
+			name: "one line changed",
+			a:    retryContent,
+			b:    strings.Replace(retryContent, "time.Duration(i) * time.Second", "backoff(i)", 1),
+			min:  0.6, max: 0.95,
+		},
+		{
+			name: "same words in reverse order",
+			a:    "open the file read every line close the file",
+			b:    "file the close line every read file the open",
+			min:  0, max: 0.15,
+		},
+		{
+			name: "shorter than a shingle",
+			a:    "retry(ctx)",
+			b:    "Retry( ctx );",
+			min:  1, max: 1,
+		},
+		{
+			name: "shorter than a shingle, reordered",
+			a:    "retry ctx",
+			b:    "ctx retry",
+			min:  0, max: 0.1,
+		},
+		{
+			name: "one token against a longer snippet using it",
+			a:    "retry",
+			b:    "retry with backoff",
+			min:  0, max: 0.1,
+		},
+		{
+			name: "unrelated",
+			a:    retryContent,
+			b:    "SELECT id, title FROM snippets WHERE user_id = $1 ORDER BY created_at DESC",
+			min:  0, max: 0.1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newMinHashSignature(tt.a).similarity(newMinHashSignature(tt.b))
+			if got < tt.min || got > tt.max {
+				t.Errorf("similarity = %.2f, want between %.2f and %.2f", got, tt.min, tt.max)
+			}
+
+			// The estimate stays close to the Jaccard index it stands for
+			if exact := shingleJaccard(tt.a, tt.b); math.Abs(got-exact) > 0.15 {
+				t.Errorf("similarity = %.2f, exact Jaccard index is %.2f", got, exact)
+			}
+		})
+	}
+}
+
+func TestContentShingles(t *testing.T) {
+	tests := []struct {
+		content string
+		want    int
+	}{
+		{"", 0},
+		{"{ } ( ) ;", 0},
+		{"token", 1},
+		{"two tokens", 1},
+		{"a b c d", 2},
+		{"x y z x y z", 3}, // the repeat of x y z counts once
+		{"snake_case words", 1},
+	}
+
+	for _, tt := range tests {
+		if got := len(contentShingles(tt.content)); got != tt.want {
+			t.Errorf("contentShingles(%q) has %d shingles, want %d", tt.content, got, tt.want)
+		}
+	}
+
+	if newMinHashSignature("{ } ;") != nil {
+		t.Error("content without words has a signature")
+	}
+	if shingleJaccard("a b c", "c b a") != 0 {
+		t.Error("shingles ignore token order")
+	}
+}
+
+func TestFindSimilarAndDuplicateSnippets(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+		other := createTestUser(t, store, "bob")
+
+		original := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "retry", Content: retryContent})
+		copied := createTestSnippet(t, store, &models.Snippet{
+			UserID: user.ID, Title: "retry copy", Content: strings.ToUpper(retryContent),
+		})
+		edited := createTestSnippet(t, store, &models.Snippet{
+			UserID: user.ID, Title: "retry edited",
+			Content: strings.Replace(retryContent, "time.Duration(i) * time.Second", "backoff(i)", 1),
+		})
+		createTestSnippet(t, store, &models.Snippet{
+			UserID: user.ID, Title: "query", Content: "SELECT id, title FROM snippets WHERE user_id = $1",
+		})
+		createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "blank", Content: "{ }"})
+		createTestSnippet(t, store, &models.Snippet{UserID: other.ID, Title: "bob's retry", Content: retryContent})
+
+		similar, err := FindSimilarSnippets(ctx, store, original, 10, 0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(similar) != 2 || similar[0].ID != copied.ID || similar[0].Similarity != 1 || similar[1].ID != edited.ID {
+			t.Errorf("FindSimilarSnippets() = %+v, want the copy then the edit", similar)
+		}
+
+		limited, err := FindSimilarSnippets(ctx, store, original, 1, 0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(limited) != 1 || limited[0].ID != copied.ID {
+			t.Errorf("FindSimilarSnippets() with limit 1 = %+v", limited)
+		}
+
+		clusters, err := FindDuplicateSnippets(ctx, store, user.ID, 0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(clusters) != 1 {
+			t.Fatalf("FindDuplicateSnippets() found %d clusters, want 1: %+v", len(clusters), clusters)
+		}
+		if ids := similarIDs(clusters[0].Snippets); len(ids) != 3 || ids[0] != original.ID {
+			t.Errorf("cluster = %v, want the original first, then the copy and the edit", ids)
+		}
+
+		strict, err := FindDuplicateSnippets(ctx, store, user.ID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(strict) != 1 || len(strict[0].Snippets) != 2 {
+			t.Errorf("FindDuplicateSnippets() at 1.0 = %+v, want only the exact copy", strict)
+		}
+	})
+}
+
+func similarIDs(snippets []models.SimilarSnippet) []int64 {
+	ids := make([]int64, len(snippets))
+	for i, snippet := range snippets {
+		ids[i] = snippet.ID
+	}
+	return ids
+}
+
+func TestStoreSimilarityCandidates(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+		other := createTestUser(t, store, "bob")
+
+		original := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "retry", Content: retryContent})
+		copied := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "retry copy", Content: retryContent})
+		unrelated := createTestSnippet(t, store, &models.Snippet{
+			UserID: user.ID, Title: "query", Content: "SELECT id, title FROM snippets WHERE user_id = $1",
+		})
+		createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "blank", Content: "{ }"})
+		createTestSnippet(t, store, &models.Snippet{UserID: other.ID, Title: "bob's retry", Content: retryContent})
+
+		// Everything saved here was signed as it was saved
+		if signed, err := store.BackfillMinHashes(ctx, 10); err != nil || signed != 0 {
+			t.Errorf("BackfillMinHashes() = %d, %v, want nothing left to sign", signed, err)
+		}
+
+		keys := newMinHashSignature(retryContent).bandKeys()
+		candidates, err := store.GetSimilarityCandidates(ctx, user.ID, original.ID, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) != 1 || candidates[0].Snippet.ID != copied.ID || candidates[0].Snippet.Title != "retry copy" {
+			t.Fatalf("GetSimilarityCandidates() = %+v, want only the copy", candidates)
+		}
+		if signature := candidates[0].signature(); signature == nil || signature.similarity(newMinHashSignature(retryContent)) != 1 {
+			t.Errorf("candidate signature = %v, want the stored signature of the copy", signature)
+		}
+
+		// Editing the content replaces the band keys
+		copied.Content = unrelated.Content
+		if err := store.UpdateSnippet(ctx, copied.ID, copied); err != nil {
+			t.Fatal(err)
+		}
+		candidates, err = store.GetSimilarityCandidates(ctx, user.ID, original.ID, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) != 0 {
+			t.Errorf("GetSimilarityCandidates() after the edit = %+v, want none", candidates)
+		}
+
+		var walked []int64
+		err = store.WalkSnippetSignatures(ctx, user.ID, func(signature *SnippetSignature) error {
+			walked = append(walked, signature.Snippet.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(walked) != 4 || walked[0] != original.ID {
+			t.Errorf("WalkSnippetSignatures() walked %v, want the user's 4 snippets in ID order", walked)
+		}
+	})
+}
+
+func TestSQLiteMinHashBackfill(t *testing.T) {
+	ctx := context.Background()
+	store, err := ConnectSQLite(filepath.Join(t.TempDir(), "fragments.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+	if _, err := store.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	user := createTestUser(t, store, "alice")
+	original := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "retry", Content: retryContent})
+	copied := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "retry copy", Content: retryContent})
+	createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "blank", Content: "{ }"})
+
+	// As if saved before the minhash column existed
+	if _, err := store.DB.ExecContext(ctx, "UPDATE snippets SET minhash = NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.DB.ExecContext(ctx, "DELETE FROM snippet_minhash_bands"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unsigned snippets are still candidates, compared from their content
+	similar, err := FindSimilarSnippets(ctx, store, original, 10, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(similar) != 1 || similar[0].ID != copied.ID {
+		t.Errorf("FindSimilarSnippets() before the backfill = %+v, want the copy", similar)
+	}
+
+	signed, err := store.BackfillMinHashes(ctx, 2)
+	if err != nil || signed != 2 {
+		t.Fatalf("BackfillMinHashes() = %d, %v, want 2", signed, err)
+	}
+	signed, err = store.BackfillMinHashes(ctx, 2)
+	if err != nil || signed != 1 {
+		t.Fatalf("second BackfillMinHashes() = %d, %v, want the last 1", signed, err)
+	}
+
+	candidates, err := store.GetSimilarityCandidates(ctx, user.ID, original.ID, newMinHashSignature(retryContent).bandKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 || candidates[0].Snippet.ID != copied.ID || candidates[0].Content != nil {
+		t.Errorf("GetSimilarityCandidates() after the backfill = %+v, want the signed copy", candidates)
+	}
+}
+
+func TestMinHashEncoding(t *testing.T) {
+	signature := newMinHashSignature(retryContent)
+	if decoded := decodeMinHash(encodeMinHash(signature)); decoded == nil || *decoded != *signature {
+		t.Error("signature changed through encoding")
+	}
+
+	// Content without words is stored as signed, just with nothing to compare
+	if encoded := encodeMinHash(nil); encoded == nil || len(encoded) != 0 || decodeMinHash(encoded) != nil {
+		t.Errorf("encodeMinHash(nil) = %v, want an empty value", encoded)
+	}
+}
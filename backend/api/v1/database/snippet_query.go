@@ -0,0 +1,269 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// snippetSortColumns maps each sort field onto the expression it orders by,
+// so nothing from the request is ever spliced into ORDER BY
+var snippetSortColumns = map[string]string{
+	SnippetSortTitle:     "LOWER(s.title)",
+	SnippetSortCreatedAt: "s.created_at",
+	SnippetSortUpdatedAt: "s.updated_at",
+}
+
+// maxFacetValues caps how many values each facet reports
+const maxFacetValues = 100
+
+// snippetQuery collects the conditions GetSnippets filters on. Values only
+// ever reach the SQL as placeholders, and the count, data and facet queries
+// share the same FROM and WHERE clauses and arguments so their results always
+// agree.
+type snippetQuery struct {
+	placeholder func(n int) string
+	// from is the FROM clause, snippets s plus any join the search needs
+	from       string
+	conditions []string
+	args       []interface{}
+	// rank orders search results by relevance, empty when not searching
+	rank string
+}
+
+func postgresPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// sqlitePlaceholder numbers its parameters too, so arguments bound in the FROM
+// clause don't have to come first
+func sqlitePlaceholder(n int) string {
+	return "?" + strconv.Itoa(n)
+}
+
+// newSnippetQuery starts a query over the user's live snippets, aliased s.
+// Its placeholders are numbered after args, so queries built one after another
+// can be bound together in one statement.
+func newSnippetQuery(placeholder func(n int) string, userID int64, args ...interface{}) *snippetQuery {
+	q := &snippetQuery{placeholder: placeholder, from: "snippets s", args: args}
+	q.where("s.user_id = " + q.arg(userID))
+	q.where("s.deleted_at IS NULL")
+	return q
+}
+
+// arg binds a value and returns the placeholder standing in for it
+func (q *snippetQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return q.placeholder(len(q.args))
+}
+
+func (q *snippetQuery) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+func (q *snippetQuery) whereClause() string {
+	return "WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// addFilters adds the structured filters both SQL stores support the same
+// way, search and folders are left to the store
+func (q *snippetQuery) addFilters(filter SnippetFilter) {
+	if filter.Language != "" {
+		q.where("s.language = " + q.arg(filter.Language))
+	}
+
+	if tags := normalizeTagFilter(filter.Tags); len(tags) > 0 {
+		placeholders := make([]string, len(tags))
+		for i, tag := range tags {
+			placeholders[i] = q.arg(tag)
+		}
+
+		tagQuery := fmt.Sprintf(`
+			SELECT st.snippet_id
+			FROM snippet_tags st
+			JOIN tags t ON t.id = st.tag_id
+			WHERE LOWER(t.name) IN (%s)`, strings.Join(placeholders, ", "))
+		if filter.MatchAllTags {
+			tagQuery += fmt.Sprintf(`
+			GROUP BY st.snippet_id
+			HAVING COUNT(DISTINCT LOWER(t.name)) = %s`, q.arg(len(tags)))
+		}
+
+		q.where("s.id IN (" + tagQuery + ")")
+	}
+
+	if filter.IsFavorite != nil {
+		q.where("s.is_favorite = " + q.arg(*filter.IsFavorite))
+	}
+
+	if filter.CreatedAfter != nil {
+		q.where("s.created_at >= " + q.arg(filter.CreatedAfter.UTC()))
+	}
+	if filter.CreatedBefore != nil {
+		q.where("s.created_at < " + q.arg(filter.CreatedBefore.UTC()))
+	}
+	if filter.UpdatedAfter != nil {
+		q.where("s.updated_at >= " + q.arg(filter.UpdatedAfter.UTC()))
+	}
+	if filter.UpdatedBefore != nil {
+		q.where("s.updated_at < " + q.arg(filter.UpdatedBefore.UTC()))
+	}
+}
+
+// addSearchOperators compiles the query's operators into conditions, free
+// text is left to the store's full-text index
+func (q *snippetQuery) addSearchOperators(query *SearchQuery, userID int64) {
+	for _, term := range query.Terms {
+		var condition string
+		switch term.Field {
+		case SearchFieldLanguage:
+			condition = "s.language = " + q.arg(strings.ToLower(term.Value))
+		case SearchFieldTag:
+			condition = `s.id IN (
+				SELECT st.snippet_id
+				FROM snippet_tags st
+				JOIN tags t ON t.id = st.tag_id
+				WHERE LOWER(t.name) = ` + q.arg(strings.ToLower(term.Value)) + `)`
+		case SearchFieldFolder:
+			// The named folder or anywhere below it, every descendant's
+			// path starts with the folder's own
+			condition = `s.folder_id IN (
+				SELECT f.id
+				FROM folders f
+				JOIN folders named ON substr(f.path, 1, length(named.path)) = named.path
+				WHERE named.user_id = ` + q.arg(userID) + `
+				  AND LOWER(named.name) = ` + q.arg(strings.ToLower(term.Value)) + `
+				  AND named.deleted_at IS NULL
+				  AND f.deleted_at IS NULL)`
+			if term.Negated {
+				// Snippets outside any folder are not in the named one either
+				q.where("(s.folder_id IS NULL OR NOT " + condition + ")")
+				continue
+			}
+		case SearchFieldIs:
+			// is:fav is the only value the parser lets through
+			q.where("s.is_favorite = " + q.arg(!term.Negated))
+			continue
+		default:
+			continue
+		}
+
+		if term.Negated {
+			condition = "NOT " + condition
+		}
+		q.where(condition)
+	}
+}
+
+// orderClause sorts by the requested field, or by rank when searching without
+// one. rank is the store's relevance ordering, empty when not searching. The
+// ID breaks ties so pages never overlap.
+func (q *snippetQuery) orderClause(filter SnippetFilter, rank string) string {
+	column, ok := snippetSortColumns[filter.Sort]
+	if !ok {
+		if rank != "" {
+			return "ORDER BY " + rank + ", s.created_at DESC, s.id DESC"
+		}
+		return "ORDER BY s.created_at DESC, s.id DESC"
+	}
+
+	direction := "DESC"
+	if snippetSortAscending(filter) {
+		direction = "ASC"
+	}
+
+	return fmt.Sprintf("ORDER BY %s %s, s.id %s", column, direction, direction)
+}
+
+// facetQuery counts the matching snippets by one facet. Language and tag
+// queries return the value and count, folder queries the folder ID, name and
+// count.
+func (q *snippetQuery) facetQuery(facet string) string {
+	switch facet {
+	case FacetTag:
+		return fmt.Sprintf(`
+			SELECT facet_tag.name, COUNT(*)
+			FROM %s
+			JOIN snippet_tags facet_link ON facet_link.snippet_id = s.id
+			JOIN tags facet_tag ON facet_tag.id = facet_link.tag_id
+			%s
+			GROUP BY facet_tag.name
+			ORDER BY COUNT(*) DESC, facet_tag.name
+			LIMIT %d`, q.from, q.whereClause(), maxFacetValues)
+	case FacetFolder:
+		return fmt.Sprintf(`
+			SELECT s.folder_id, COALESCE(facet_folder.name, ''), COUNT(*)
+			FROM %s
+			LEFT JOIN folders facet_folder ON facet_folder.id = s.folder_id
+			%s
+			GROUP BY s.folder_id, facet_folder.name
+			ORDER BY COUNT(*) DESC, COALESCE(facet_folder.name, '')
+			LIMIT %d`, q.from, q.whereClause(), maxFacetValues)
+	default:
+		return fmt.Sprintf(`
+			SELECT s.language, COUNT(*)
+			FROM %s
+			%s
+			GROUP BY s.language
+			ORDER BY COUNT(*) DESC, s.language
+			LIMIT %d`, q.from, q.whereClause(), maxFacetValues)
+	}
+}
+
+// newSnippetFacets starts every requested facet off empty, so a facet with no
+// matches still comes back as an empty list
+func newSnippetFacets(facets []string) models.SnippetFacets {
+	result := make(models.SnippetFacets, len(facets))
+	for _, facet := range facets {
+		result[facet] = []models.FacetCount{}
+	}
+	return result
+}
+
+// snippetSortAscending resolves the sort direction, title defaults to A-Z and
+// the dates to newest first
+func snippetSortAscending(filter SnippetFilter) bool {
+	switch filter.Order {
+	case SortAsc:
+		return true
+	case SortDesc:
+		return false
+	default:
+		return filter.Sort == SnippetSortTitle
+	}
+}
+
+// likeSubstringPattern builds a LIKE pattern matching text anywhere, with the
+// wildcards in it escaped by a backslash. escaped reports whether the query
+// needs an ESCAPE clause.
+func likeSubstringPattern(text string) (pattern string, escaped bool) {
+	escaped = strings.ContainsAny(text, `%_\`)
+	if escaped {
+		text = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+	}
+	return "%" + text + "%", escaped
+}
+
+// likePrefixPattern builds a LIKE pattern matching text at the start, escaped
+// the same way as likeSubstringPattern
+func likePrefixPattern(text string) (pattern string, escaped bool) {
+	pattern, escaped = likeSubstringPattern(text)
+	return strings.TrimPrefix(pattern, "%"), escaped
+}
+
+// normalizeTagFilter lowercases and de-duplicates the tags being filtered on
+func normalizeTagFilter(tags []string) []string {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
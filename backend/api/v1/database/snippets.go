@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"strings"
 	"time"
 
@@ -14,16 +15,33 @@ import (
 
 var ErrNoSnippetError = errors.New("snippet does not exist")
 
+// walkBatchSize is how many snippets WalkSnippets loads per query
+const walkBatchSize = 100
+
 func CreateSnippet(ctx context.Context, pool *pgxpool.Pool, snippet *models.Snippet) error {
+	return createSnippet(ctx, pool, snippet, false)
+}
+
+func CreateUniqueSnippet(ctx context.Context, pool *pgxpool.Pool, snippet *models.Snippet) error {
+	return createSnippet(ctx, pool, snippet, true)
+}
+
+func createSnippet(ctx context.Context, pool *pgxpool.Pool, snippet *models.Snippet, unique bool) error {
 	tx, err := pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
+	if unique {
+		if err = checkUniqueContent(ctx, tx, snippet.UserID, 0, contentHash(snippet.Content)); err != nil {
+			return err
+		}
+	}
+
 	query := `
-	INSERT INTO snippets(user_id, folder_id, title, description, content, language, is_favorite, created_at, updated_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	INSERT INTO snippets(user_id, folder_id, title, description, content, language, is_favorite, search_tokens, content_hash, minhash, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	RETURNING id`
 
 	var description interface{}
@@ -41,6 +59,7 @@ func CreateSnippet(ctx context.Context, pool *pgxpool.Pool, snippet *models.Snip
 	}
 
 	now := time.Now()
+	signature := newMinHashSignature(snippet.Content)
 
 	var generatedID int64
 	err = tx.QueryRow(ctx,
@@ -52,6 +71,9 @@ func CreateSnippet(ctx context.Context, pool *pgxpool.Pool, snippet *models.Snip
 		snippet.Content,
 		snippet.Language,
 		snippet.IsFavorite,
+		snippetSearchTokens(snippet),
+		contentHash(snippet.Content),
+		encodeMinHash(signature),
 		now,
 		now,
 	).Scan(&generatedID)
@@ -59,6 +81,10 @@ func CreateSnippet(ctx context.Context, pool *pgxpool.Pool, snippet *models.Snip
 		return fmt.Errorf("failed to insert snippet: %w", err)
 	}
 
+	if err = saveMinHashBands(ctx, tx, generatedID, snippet.UserID, signature); err != nil {
+		return err
+	}
+
 	// Handle tags if provided
 	if snippet.Tags != nil && len(*snippet.Tags) > 0 {
 		err = insertSnippetTags(ctx, tx, generatedID, snippet.UserID, *snippet.Tags)
@@ -67,6 +93,10 @@ func CreateSnippet(ctx context.Context, pool *pgxpool.Pool, snippet *models.Snip
 		}
 	}
 
+	if err = insertSnippetRevision(ctx, tx, generatedID, now); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -79,11 +109,17 @@ func CreateSnippet(ctx context.Context, pool *pgxpool.Pool, snippet *models.Snip
 }
 
 func GetSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64) (*models.Snippet, error) {
+	return getSnippet(ctx, pool, snippetID, "deleted_at IS NULL")
+}
+
+// getSnippet loads a snippet and its tags, trashCondition picks whether live
+// or trashed rows are visible
+func getSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, trashCondition string) (*models.Snippet, error) {
 	query := `
 		SELECT id, user_id, folder_id, title, description, content, language, 
 		       is_favorite, created_at, updated_at
 		FROM snippets 
-		WHERE id = $1`
+		WHERE id = $1 AND ` + trashCondition
 
 	var snippet models.Snippet
 	var description *string
@@ -123,55 +159,33 @@ func GetSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64) (*mode
 	return &snippet, nil
 }
 
-func GetSnippets(ctx context.Context, pool *pgxpool.Pool, page, limit int, userID int64, search string) ([]models.Snippet, int, error) {
+func GetSnippets(ctx context.Context, pool *pgxpool.Pool, page, limit int, userID int64, filter SnippetFilter) ([]models.Snippet, int, error) {
 	offset := (page - 1) * limit
 
-	var whereClause string
-	var args []interface{}
-
-	if search != "" {
-		whereClause = `
-		WHERE s.user_id = $1
-		AND s.document_with_weights @@ plainto_tsquery('english', $2)`
-		args = []interface{}{userID, search}
-	} else {
-		whereClause = `WHERE user_id = $1`
-		args = []interface{}{userID}
+	q, search, err := buildSnippetQuery(ctx, pool, userID, filter)
+	if err != nil || q == nil {
+		return nil, 0, err
 	}
 
-	var countQuery string
-	if search != "" {
-		countQuery = fmt.Sprintf("SELECT COUNT(*) FROM snippets s %s", whereClause)
-	} else {
-		countQuery = fmt.Sprintf("SELECT COUNT(*) FROM snippets %s", whereClause)
-	}
+	whereClause := q.whereClause()
+	orderClause := q.orderClause(filter, q.rank)
+
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s %s", q.from, whereClause)
 
 	var total int
-	err := pool.QueryRow(ctx, countQuery, args...).Scan(&total)
+	err = pool.QueryRow(ctx, countQuery, q.args...).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get snippet count: %w", err)
 	}
 
-	var dataQuery string
-	argPosition := len(args) + 1
-	if search != "" {
-		dataQuery = fmt.Sprintf(`
-			SELECT s.id, s.user_id, s.folder_id, s.title, s.description, s.content, s.language, s.is_favorite, s.created_at, s.updated_at
-			FROM snippets s 
-			%s 
-			ORDER BY ts_rank(s.document_with_weights, plainto_tsquery('english', $2)) DESC, s.created_at DESC
-			LIMIT $%d OFFSET $%d`, whereClause, argPosition, argPosition+1)
-	} else {
-		dataQuery = fmt.Sprintf(`
-			SELECT id, user_id, folder_id, title, description, content, language, is_favorite, created_at, updated_at
-			FROM snippets 
-			%s 
-			ORDER BY created_at DESC
-			LIMIT $%d OFFSET $%d`, whereClause, argPosition, argPosition+1)
-	}
-	args = append(args, limit, offset)
+	dataQuery := fmt.Sprintf(`
+		SELECT s.id, s.user_id, s.folder_id, s.title, s.description, s.content, s.language, s.is_favorite, s.created_at, s.updated_at
+		FROM %s
+		%s
+		%s
+		LIMIT %s OFFSET %s`, q.from, whereClause, orderClause, q.arg(limit), q.arg(offset))
 
-	rows, err := pool.Query(ctx, dataQuery, args...)
+	rows, err := pool.Query(ctx, dataQuery, q.args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get snippets: %w", err)
 	}
@@ -219,10 +233,245 @@ func GetSnippets(ctx context.Context, pool *pgxpool.Pool, page, limit int, userI
 		}
 	}
 
+	if search != nil {
+		if err = highlightPostgresSearchHits(ctx, pool, snippets, search, filter.SearchMode); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	return snippets, total, nil
 }
 
+func GetSnippetFacets(ctx context.Context, pool *pgxpool.Pool, userID int64, filter SnippetFilter, facets []string) (models.SnippetFacets, error) {
+	q, _, err := buildSnippetQuery(ctx, pool, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newSnippetFacets(facets)
+	if q == nil {
+		return result, nil
+	}
+
+	for _, facet := range facets {
+		rows, err := pool.Query(ctx, q.facetQuery(facet), q.args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s facet: %w", facet, err)
+		}
+
+		for rows.Next() {
+			var count models.FacetCount
+			if facet == FacetFolder {
+				err = rows.Scan(&count.FolderID, &count.Value, &count.Count)
+			} else {
+				err = rows.Scan(&count.Value, &count.Count)
+			}
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan %s facet: %w", facet, err)
+			}
+			result[facet] = append(result[facet], count)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to iterate %s facet: %w", facet, err)
+		}
+	}
+
+	return result, nil
+}
+
+// CountSnippets counts the snippets matching each filter with one statement,
+// a COUNT subquery per filter over the same conditions GetSnippets uses
+func CountSnippets(ctx context.Context, pool *pgxpool.Pool, userID int64, filters []SnippetFilter) ([]int, error) {
+	counts := make([]int, len(filters))
+
+	var args []interface{}
+	var subqueries []string
+	var counted []interface{}
+	for i, filter := range filters {
+		q, _, err := buildSnippetQuery(ctx, pool, userID, filter, args...)
+		if err != nil {
+			return nil, err
+		}
+		if q == nil {
+			continue
+		}
+
+		args = q.args
+		subqueries = append(subqueries, fmt.Sprintf("(SELECT COUNT(*) FROM %s %s)", q.from, q.whereClause()))
+		counted = append(counted, &counts[i])
+	}
+
+	if len(subqueries) == 0 {
+		return counts, nil
+	}
+
+	err := pool.QueryRow(ctx, "SELECT "+strings.Join(subqueries, ", "), args...).Scan(counted...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count snippets: %w", err)
+	}
+
+	return counts, nil
+}
+
+// buildSnippetQuery compiles a filter into the query GetSnippets and
+// GetSnippetFacets share. A nil query means nothing can match. The query's
+// placeholders are numbered after args.
+func buildSnippetQuery(ctx context.Context, pool *pgxpool.Pool, userID int64, filter SnippetFilter, args ...interface{}) (*snippetQuery, *SearchQuery, error) {
+	q := newSnippetQuery(postgresPlaceholder, userID, args...)
+
+	var search *SearchQuery
+	if filter.Search != "" {
+		var err error
+		search, err = ParseSearchQuery(filter.Search)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		q.addSearchOperators(search, userID)
+
+		fullText := filter.SearchMode != SearchModeSubstring
+		substring := filter.SearchMode != SearchModeFullText
+
+		// Hybrid search matches either way and adds the two scores up
+		include, exclude := search.textTerms()
+		if len(include) > 0 {
+			var matches, scores []string
+			if fullText {
+				tsQuery := tsQueryExpression(q, include)
+				matches = append(matches, "s.document_with_weights @@ "+tsQuery)
+				scores = append(scores, "ts_rank(s.document_with_weights, "+tsQuery+")")
+			}
+			if substring {
+				match, score := trigramMatch(q, include)
+				matches = append(matches, match)
+				scores = append(scores, score)
+			}
+
+			q.where("(" + strings.Join(matches, " OR ") + ")")
+			q.rank = "(" + strings.Join(scores, " + ") + ") DESC"
+		}
+
+		for _, term := range exclude {
+			var matches []string
+			if fullText {
+				matches = append(matches, "s.document_with_weights @@ "+tsQueryExpression(q, []SearchTerm{term}))
+			}
+			if substring {
+				match, _ := trigramMatch(q, []SearchTerm{term})
+				matches = append(matches, match)
+			}
+			q.where("NOT (" + strings.Join(matches, " OR ") + ")")
+		}
+	}
+
+	if filter.FolderID != nil {
+		if filter.Recursive {
+			// Everything under the folder shares its path as a prefix
+			var folderPath string
+			err := pool.QueryRow(ctx, "SELECT path FROM folders WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", *filter.FolderID, userID).Scan(&folderPath)
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					return nil, nil, nil
+				}
+				return nil, nil, fmt.Errorf("%w: failed to get folder path", ErrDatabaseError)
+			}
+
+			q.where(fmt.Sprintf("s.folder_id IN (SELECT id FROM folders WHERE path LIKE %s AND deleted_at IS NULL)", q.arg(folderPath+"%")))
+		} else {
+			q.where("s.folder_id = " + q.arg(*filter.FolderID))
+		}
+	}
+
+	q.addFilters(filter)
+
+	return q, search, nil
+}
+
+// tsQueryExpression combines free text terms into one tsquery, built from the
+// parsed terms by tsQueryText and bound as a single parameter
+func tsQueryExpression(q *snippetQuery, terms []SearchTerm) string {
+	return "to_tsquery('english', " + q.arg(tsQueryText(terms)) + ")"
+}
+
+// highlightPostgresSearchHits is highlightSearchHits with the words judged
+// by ts_headline rather than stemMatches. ts_headline can't see the parts of
+// NewDecoder or report line numbers, so rather than run it over each field it
+// is given every distinct word and identifier part of the page once, and
+// whichever it marks are highlighted wherever they appear.
+func highlightPostgresSearchHits(ctx context.Context, pool *pgxpool.Pool, snippets []models.Snippet, search *SearchQuery, mode string) error {
+	include, _ := search.textTerms()
+	if len(include) == 0 || len(snippets) == 0 {
+		return nil
+	}
+
+	h := newSearchHighlighter(include, mode)
+	if len(h.words) > 0 {
+		stems, err := headlineStems(ctx, pool, h.words, pageWords(snippets))
+		if err != nil {
+			return err
+		}
+		h.stems = stems
+	}
+
+	h.highlight(snippets)
+	return nil
+}
+
+// headlineStems returns which of words ts_headline marks as matching any one
+// of needles. The needles are ORed, unlike in the search itself, so each word
+// is judged on its own.
+func headlineStems(ctx context.Context, pool *pgxpool.Pool, needles, words []string) (map[string]bool, error) {
+	args := []interface{}{strings.Join(words, " ")}
+	var queries []string
+	for _, needle := range needles {
+		args = append(args, needle)
+		queries = append(queries, fmt.Sprintf("plainto_tsquery('english', $%d)", len(args)))
+	}
+
+	// Words are only letters and digits, so < and > can't be part of one
+	query := fmt.Sprintf("SELECT ts_headline('english', $1, %s, 'HighlightAll=true, StartSel=<, StopSel=>')", strings.Join(queries, " || "))
+
+	var headline string
+	if err := pool.QueryRow(ctx, query, args...).Scan(&headline); err != nil {
+		return nil, fmt.Errorf("%w: failed to highlight search matches", ErrDatabaseError)
+	}
+
+	stems := make(map[string]bool)
+	for _, part := range strings.Split(headline, "<")[1:] {
+		if word, _, ok := strings.Cut(part, ">"); ok {
+			stems[word] = true
+		}
+	}
+	return stems, nil
+}
+
+// trigramMatch requires every term to appear verbatim, ignoring case, in the
+// title or content, ILIKE being answered by the pg_trgm indexes. The score
+// favours title matches the way ts_rank's weights do. It reuses the patterns,
+// as pg_trgm skips the % and escape characters when building trigrams, so the
+// count query can share the arguments.
+func trigramMatch(q *snippetQuery, terms []SearchTerm) (match string, score string) {
+	var conditions, scores []string
+	for _, term := range terms {
+		pattern, _ := likeSubstringPattern(term.Value)
+		p := q.arg(pattern)
+		conditions = append(conditions, fmt.Sprintf(`(s.title ILIKE %s ESCAPE '\' OR s.content ILIKE %s ESCAPE '\')`, p, p))
+		scores = append(scores, fmt.Sprintf("word_similarity(%s, s.title) * %.1f + word_similarity(%s, s.content) * %.1f", p, titleWeight, p, contentWeight))
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", "(" + strings.Join(scores, " + ") + ")"
+}
+
 func UpdateSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, snippet *models.Snippet) error {
+	return updateSnippet(ctx, pool, snippetID, snippet, false)
+}
+
+func UpdateUniqueSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, snippet *models.Snippet) error {
+	return updateSnippet(ctx, pool, snippetID, snippet, true)
+}
+
+func updateSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, snippet *models.Snippet, unique bool) error {
 	tx, err := pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
@@ -230,7 +479,8 @@ func UpdateSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, sni
 	defer tx.Rollback(ctx)
 
 	var currentUserID int64
-	err = tx.QueryRow(ctx, "SELECT user_id FROM snippets WHERE id = $1", snippetID).Scan(&currentUserID)
+	var currentHash *string
+	err = tx.QueryRow(ctx, "SELECT user_id, content_hash FROM snippets WHERE id = $1 AND deleted_at IS NULL", snippetID).Scan(&currentUserID, &currentHash)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return fmt.Errorf("snippet with ID %d does not exist: %w", snippetID, ErrNoSnippetError)
@@ -238,6 +488,14 @@ func UpdateSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, sni
 		return fmt.Errorf("failed to check snippet existence: %w", err)
 	}
 
+	// Snippets already sharing content can still be edited in other ways
+	hash := contentHash(snippet.Content)
+	if unique && (currentHash == nil || *currentHash != hash) {
+		if err = checkUniqueContent(ctx, tx, currentUserID, snippetID, hash); err != nil {
+			return err
+		}
+	}
+
 	var descriptionValue interface{}
 	if snippet.Description != nil {
 		descriptionValue = *snippet.Description
@@ -253,11 +511,12 @@ func UpdateSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, sni
 	}
 
 	now := time.Now()
+	signature := newMinHashSignature(snippet.Content)
 
 	updateQuery := `
 		UPDATE snippets 
-		SET folder_id = $1, title = $2, description = $3, content = $4, language = $5, is_favorite = $6, updated_at = $7
-		WHERE id = $8`
+		SET folder_id = $1, title = $2, description = $3, content = $4, language = $5, is_favorite = $6, search_tokens = $7, content_hash = $8, minhash = $9, updated_at = $10
+		WHERE id = $11 AND deleted_at IS NULL`
 
 	result, err := tx.Exec(ctx, updateQuery,
 		folderIDValue,
@@ -266,6 +525,9 @@ func UpdateSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, sni
 		snippet.Content,
 		snippet.Language,
 		snippet.IsFavorite,
+		snippetSearchTokens(snippet),
+		hash,
+		encodeMinHash(signature),
 		now,
 		snippetID,
 	)
@@ -278,6 +540,10 @@ func UpdateSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, sni
 		return fmt.Errorf("snippet with ID %d does not exist: %w", snippetID, ErrNoSnippetError)
 	}
 
+	if err = saveMinHashBands(ctx, tx, snippetID, currentUserID, signature); err != nil {
+		return err
+	}
+
 	if snippet.Tags != nil {
 		_, err = tx.Exec(ctx, "DELETE FROM snippet_tags WHERE snippet_id = $1", snippetID)
 		if err != nil {
@@ -292,6 +558,10 @@ func UpdateSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, sni
 		}
 	}
 
+	if err = insertSnippetRevision(ctx, tx, snippetID, now); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return fmt.Errorf("failed to commit update: %w", err)
 	}
@@ -316,16 +586,35 @@ func UpdateSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64, sni
 	return nil
 }
 
+// DeleteSnippet moves a snippet to the trash, PurgeSnippet removes it for good
 func DeleteSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64) error {
-	deleteQuery := "DELETE FROM snippets WHERE id = $1"
-	result, err := pool.Exec(ctx, deleteQuery, snippetID)
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var folderID *int64
+	err = tx.QueryRow(ctx, "SELECT folder_id FROM snippets WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", snippetID).Scan(&folderID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("snippet with ID %d does not exist: %w", snippetID, ErrNoSnippetError)
+		}
+		return fmt.Errorf("failed to check snippet existence: %w", err)
+	}
+
+	path, err := trashPath(ctx, tx, folderID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE snippets SET deleted_at = $1, trash_path = $2 WHERE id = $3", time.Now(), path, snippetID)
 	if err != nil {
 		return fmt.Errorf("failed to delete snippet: %w", err)
 	}
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("snippet with ID %d does not exist: %w", snippetID, ErrNoSnippetError)
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit deletion: %w", err)
 	}
 
 	return nil
@@ -451,3 +740,174 @@ func insertSnippetTags(ctx context.Context, tx pgx.Tx, snippetID int64, userID i
 
 	return nil
 }
+
+// BackfillSearchTokens fills in search_tokens for up to limit snippets,
+// trashed ones included, that were saved before the column existed. A
+// snippet saved in the meantime already has its tokens and is left alone.
+func BackfillSearchTokens(ctx context.Context, pool *pgxpool.Pool, limit int) (int, error) {
+	rows, err := pool.Query(ctx, "SELECT id, title, content FROM snippets WHERE search_tokens IS NULL ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to get snippets to tokenize", ErrDatabaseError)
+	}
+
+	var pending []models.Snippet
+	for rows.Next() {
+		var snippet models.Snippet
+		if err := rows.Scan(&snippet.ID, &snippet.Title, &snippet.Content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%w: failed to scan snippet", ErrDatabaseError)
+		}
+		pending = append(pending, snippet)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("%w: failed to iterate snippets", ErrDatabaseError)
+	}
+
+	for i := range pending {
+		_, err := pool.Exec(ctx, "UPDATE snippets SET search_tokens = $1 WHERE id = $2 AND search_tokens IS NULL", snippetSearchTokens(&pending[i]), pending[i].ID)
+		if err != nil {
+			return i, fmt.Errorf("%w: failed to update search tokens", ErrDatabaseError)
+		}
+	}
+
+	return len(pending), nil
+}
+
+func GetSnippetIDsByContent(ctx context.Context, pool *pgxpool.Pool, userID int64, content string) ([]int64, error) {
+	rows, err := pool.Query(ctx, "SELECT id FROM snippets WHERE user_id = $1 AND content_hash = $2 AND deleted_at IS NULL ORDER BY id", userID, contentHash(content))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to find snippets with the same content", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%w: failed to scan snippet ID", ErrDatabaseError)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate snippet IDs", ErrDatabaseError)
+	}
+
+	return ids, nil
+}
+
+// checkUniqueContent fails with a *DuplicateContentError when live snippets
+// of the user other than snippetID already hold content with hash. It takes a
+// transaction lock on the user and hash first, so two saves of the same
+// content can't both pass the check before either is committed.
+func checkUniqueContent(ctx context.Context, tx pgx.Tx, userID, snippetID int64, hash string) error {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", contentLockKey(userID, hash))
+	if err != nil {
+		return fmt.Errorf("%w: failed to lock snippet content", ErrDatabaseError)
+	}
+
+	rows, err := tx.Query(ctx, "SELECT id FROM snippets WHERE user_id = $1 AND content_hash = $2 AND id <> $3 AND deleted_at IS NULL ORDER BY id", userID, hash, snippetID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to find snippets with the same content", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("%w: failed to scan snippet ID", ErrDatabaseError)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("%w: failed to iterate snippet IDs", ErrDatabaseError)
+	}
+
+	if len(ids) > 0 {
+		return &DuplicateContentError{IDs: ids}
+	}
+	return nil
+}
+
+// contentLockKey is the advisory lock key for a user's content hash
+func contentLockKey(userID int64, hash string) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%s", userID, hash)
+	return int64(h.Sum64())
+}
+
+// BackfillContentHashes fills in content_hash for up to limit snippets,
+// trashed ones included, that were saved before the column existed
+func BackfillContentHashes(ctx context.Context, pool *pgxpool.Pool, limit int) (int, error) {
+	rows, err := pool.Query(ctx, "SELECT id, content FROM snippets WHERE content_hash IS NULL ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to get snippets to hash", ErrDatabaseError)
+	}
+
+	var pending []models.Snippet
+	for rows.Next() {
+		var snippet models.Snippet
+		if err := rows.Scan(&snippet.ID, &snippet.Content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%w: failed to scan snippet", ErrDatabaseError)
+		}
+		pending = append(pending, snippet)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("%w: failed to iterate snippets", ErrDatabaseError)
+	}
+
+	for i := range pending {
+		_, err := pool.Exec(ctx, "UPDATE snippets SET content_hash = $1 WHERE id = $2 AND content_hash IS NULL", contentHash(pending[i].Content), pending[i].ID)
+		if err != nil {
+			return i, fmt.Errorf("%w: failed to update content hash", ErrDatabaseError)
+		}
+	}
+
+	return len(pending), nil
+}
+
+func WalkSnippets(ctx context.Context, pool *pgxpool.Pool, userID int64, fn func(*models.Snippet) error) error {
+	query := `
+		SELECT id, user_id, folder_id, title, content, language
+		FROM snippets
+		WHERE user_id = $1 AND id > $2 AND deleted_at IS NULL
+		ORDER BY id
+		LIMIT $3`
+
+	var lastID int64
+	for {
+		rows, err := pool.Query(ctx, query, userID, lastID, walkBatchSize)
+		if err != nil {
+			return fmt.Errorf("%w: failed to get snippets", ErrDatabaseError)
+		}
+
+		// The batch is read in full first so no connection is held while fn runs
+		var batch []models.Snippet
+		for rows.Next() {
+			var snippet models.Snippet
+			if err := rows.Scan(&snippet.ID, &snippet.UserID, &snippet.FolderID, &snippet.Title, &snippet.Content, &snippet.Language); err != nil {
+				rows.Close()
+				return fmt.Errorf("%w: failed to scan snippet", ErrDatabaseError)
+			}
+			batch = append(batch, snippet)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("%w: failed to iterate snippets", ErrDatabaseError)
+		}
+
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < walkBatchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore implements Store on top of an embedded SQLite database
+type SQLiteStore struct {
+	DB *sql.DB
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+// ConnectSQLite opens (creating if needed) the SQLite database at dsn. The
+// schema is managed by MigrateUp. dsn may be a plain path or a file: URI.
+func ConnectSQLite(dsn string) (*SQLiteStore, error) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", sqliteDSN(dsn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	// Every connection to an in-memory database sees its own empty database
+	if strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory") {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return &SQLiteStore{DB: db}, nil
+}
+
+// sqliteQuerier is satisfied by both *sql.DB and *sql.Tx
+type sqliteQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *SQLiteStore) Close() {
+	s.DB.Close()
+}
+
+// sqliteDSN appends the connection settings the store relies on: enforced
+// foreign keys (for the cascade and SET NULL rules), WAL so readers don't
+// block the writer, and immediate transactions so read-then-write
+// transactions queue on busy_timeout instead of failing with SQLITE_BUSY.
+func sqliteDSN(dsn string) string {
+	params := []string{
+		"_pragma=foreign_keys(1)",
+		"_pragma=busy_timeout(5000)",
+		"_pragma=journal_mode(WAL)",
+		"_txlock=immediate",
+		"_time_format=sqlite",
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+
+	return dsn + separator + strings.Join(params, "&")
+}
+
+// sqliteNow returns the current time in UTC so stored timestamps sort correctly as text
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
+
+// sqliteMatchQuery turns free text terms into an FTS5 query requiring every
+// word, which is what tsQueryText asks of Postgres. A phrase term becomes an
+// FTS5 phrase and a prefix term's last word an FTS5 prefix query.
+func sqliteMatchQuery(terms []SearchTerm) string {
+	var quoted []string
+	for _, term := range terms {
+		words := searchTerms(term.Value)
+		if len(words) == 0 {
+			continue
+		}
+
+		if term.Phrase {
+			quoted = append(quoted, `"`+strings.Join(words, " ")+`"`)
+			continue
+		}
+
+		for i, word := range words {
+			if term.Prefix && i == len(words)-1 {
+				quoted = append(quoted, `"`+word+`"*`)
+			} else {
+				quoted = append(quoted, `"`+word+`"`)
+			}
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// sqlitePlaceholders returns n comma separated "?" placeholders
+func sqlitePlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func isSQLiteUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *SQLiteStore) CreateAPIToken(ctx context.Context, token *models.APIToken, tokenHash string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM api_tokens WHERE user_id = ? AND name = ?", token.UserID, token.Name).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check for duplicate API token name", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("API token name already exists")
+	}
+
+	now := sqliteNow()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scopes, folder_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		token.UserID, token.Name, tokenHash, token.Prefix, strings.Join(token.Scopes, " "), token.FolderID, token.ExpiresAt.UTC(), now,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to insert API token", ErrDatabaseError)
+	}
+
+	tokenID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%w: failed to get API token ID", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	token.ID = tokenID
+	token.LastUsedAt = nil
+	token.CreatedAt = now
+
+	return nil
+}
+
+func (s *SQLiteStore) GetAPIToken(ctx context.Context, tokenID int64) (*models.APIToken, error) {
+	token, err := sqliteScanAPIToken(s.DB.QueryRowContext(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens WHERE id = ?", tokenID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("API token with ID %d does not exist: %w", tokenID, ErrNoAPITokenError)
+		}
+		return nil, fmt.Errorf("%w: failed to get API token", ErrDatabaseError)
+	}
+
+	return token, nil
+}
+
+func (s *SQLiteStore) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	query := "SELECT " + apiTokenColumns + " FROM api_tokens WHERE token_hash = ? AND expires_at > ?"
+
+	token, err := sqliteScanAPIToken(s.DB.QueryRowContext(ctx, query, tokenHash, sqliteNow()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoAPITokenError
+		}
+		return nil, fmt.Errorf("%w: failed to get API token", ErrDatabaseError)
+	}
+
+	return token, nil
+}
+
+func (s *SQLiteStore) GetAPITokens(ctx context.Context, userID int64) ([]models.APIToken, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get API tokens", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		token, err := sqliteScanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan API token data", ErrDatabaseError)
+		}
+		tokens = append(tokens, *token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate API tokens", ErrDatabaseError)
+	}
+
+	return tokens, nil
+}
+
+func (s *SQLiteStore) TouchAPIToken(ctx context.Context, tokenID int64, usedAt time.Time) error {
+	usedAt = usedAt.UTC()
+
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE api_tokens SET last_used_at = ?
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)`,
+		usedAt, tokenID, usedAt.Add(-apiTokenTouchInterval),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update API token", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) DeleteAPIToken(ctx context.Context, tokenID int64) error {
+	result, err := s.DB.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = ?", tokenID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete API token", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete API token", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("API token with ID %d does not exist: %w", tokenID, ErrNoAPITokenError)
+	}
+
+	return nil
+}
+
+// sqliteScanAPIToken reads an apiTokenColumns row from a *sql.Row or *sql.Rows
+func sqliteScanAPIToken(row interface{ Scan(...interface{}) error }) (*models.APIToken, error) {
+	var token models.APIToken
+	var scopes string
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&scopes,
+		&token.FolderID,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = strings.Fields(scopes)
+	return &token, nil
+}
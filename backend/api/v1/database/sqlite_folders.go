@@ -0,0 +1,756 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *SQLiteStore) CreateFolder(ctx context.Context, folder *models.Folder) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if folder.ParentID != nil {
+		var parentUserID int64
+		err = tx.QueryRowContext(ctx, "SELECT user_id FROM folders WHERE id = ? AND deleted_at IS NULL", *folder.ParentID).Scan(&parentUserID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("parent folder does not exist")
+			}
+			return fmt.Errorf("failed to validate parent folder: %w", err)
+		}
+
+		if parentUserID != folder.UserID {
+			return fmt.Errorf("parent folder does not belong to user")
+		}
+
+		if err := sqliteCheckCircularReference(ctx, tx, folder.UserID, 0, *folder.ParentID); err != nil {
+			return fmt.Errorf("circular reference detected: %w", err)
+		}
+	}
+
+	taken, err := sqliteFolderNameTaken(ctx, tx, folder.UserID, folder.Name, folder.ParentID, 0)
+	if err != nil {
+		return fmt.Errorf("failed to check for duplicate folder name: %w", err)
+	}
+
+	if taken {
+		return fmt.Errorf("folder name already exists in this location")
+	}
+
+	now := sqliteNow()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO folders(user_id, name, description, parent_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		folder.UserID,
+		folder.Name,
+		folder.Description,
+		folder.ParentID,
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert folder: %w", err)
+	}
+
+	generatedID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to insert folder: %w", err)
+	}
+
+	if err = sqliteSetFolderPath(ctx, tx, generatedID, folder.ParentID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	folder.ID = generatedID
+	folder.CreatedAt = now
+	folder.UpdatedAt = now
+
+	return nil
+}
+
+func (s *SQLiteStore) GetFolder(ctx context.Context, folderID int64) (*models.Folder, error) {
+	return s.getFolder(ctx, folderID, "deleted_at IS NULL")
+}
+
+// getFolder loads a folder, trashCondition picks whether live or trashed rows
+// are visible
+func (s *SQLiteStore) getFolder(ctx context.Context, folderID int64, trashCondition string) (*models.Folder, error) {
+	query := `
+		SELECT id, user_id, name, description, parent_id, created_at, updated_at
+		FROM folders
+		WHERE id = ? AND ` + trashCondition
+
+	var folder models.Folder
+
+	err := s.DB.QueryRowContext(ctx, query, folderID).Scan(
+		&folder.ID,
+		&folder.UserID,
+		&folder.Name,
+		&folder.Description,
+		&folder.ParentID,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoFolderError
+		}
+		return nil, fmt.Errorf("failed to get folder: %w", err)
+	}
+
+	return &folder, nil
+}
+
+func (s *SQLiteStore) GetFolders(ctx context.Context, page, limit int, userID int64, parentID *int64) ([]models.Folder, int, error) {
+	offset := (page - 1) * limit
+
+	whereClause := "WHERE user_id = ? AND deleted_at IS NULL"
+	args := []interface{}{userID}
+
+	if parentID != nil {
+		whereClause += " AND parent_id = ?"
+		args = append(args, *parentID)
+	} else {
+		whereClause += " AND parent_id IS NULL"
+	}
+
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM folders %s", whereClause)
+	var total int
+	err := s.DB.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to get folder count", ErrDatabaseError)
+	}
+
+	dataQuery := fmt.Sprintf(`
+		SELECT id, user_id, name, description, parent_id, created_at, updated_at
+		FROM folders %s
+		ORDER BY name ASC
+		LIMIT ? OFFSET ?`, whereClause)
+
+	queryArgs := append(args, limit, offset)
+	rows, err := s.DB.QueryContext(ctx, dataQuery, queryArgs...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to get folders", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var folders []models.Folder
+	for rows.Next() {
+		var folder models.Folder
+
+		err := rows.Scan(
+			&folder.ID,
+			&folder.UserID,
+			&folder.Name,
+			&folder.Description,
+			&folder.ParentID,
+			&folder.CreatedAt,
+			&folder.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: failed to scan folder data", ErrDatabaseError)
+		}
+
+		folders = append(folders, folder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to iterate folders", ErrDatabaseError)
+	}
+
+	return folders, total, nil
+}
+
+func (s *SQLiteStore) GetFolderTree(ctx context.Context, userID int64) ([]*models.FolderNode, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		WITH RECURSIVE tree(id, depth) AS (
+			SELECT id, 0
+			FROM folders
+			WHERE user_id = ? AND parent_id IS NULL AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.id, t.depth + 1
+			FROM folders f
+			JOIN tree t ON f.parent_id = t.id
+			WHERE f.deleted_at IS NULL AND t.depth < 50
+		),
+		subtree(ancestor_id, folder_id) AS (
+			SELECT id, id FROM tree
+			UNION ALL
+			SELECT s.ancestor_id, f.id
+			FROM subtree s
+			JOIN folders f ON f.parent_id = s.folder_id
+			WHERE f.deleted_at IS NULL
+		),
+		counts(folder_id, snippet_count) AS (
+			SELECT folder_id, COUNT(*)
+			FROM snippets
+			WHERE user_id = ? AND folder_id IS NOT NULL AND deleted_at IS NULL
+			GROUP BY folder_id
+		)
+		SELECT f.id, f.user_id, f.name, f.description, f.parent_id, f.created_at, f.updated_at, t.depth,
+			COALESCE(c.snippet_count, 0),
+			(SELECT COALESCE(SUM(sc.snippet_count), 0)
+			 FROM subtree s
+			 JOIN counts sc ON sc.folder_id = s.folder_id
+			 WHERE s.ancestor_id = f.id)
+		FROM tree t
+		JOIN folders f ON f.id = t.id
+		LEFT JOIN counts c ON c.folder_id = f.id
+		ORDER BY t.depth, f.name`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get folder tree", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var nodes []*models.FolderNode
+	for rows.Next() {
+		node := &models.FolderNode{}
+		err := rows.Scan(
+			&node.ID,
+			&node.UserID,
+			&node.Name,
+			&node.Description,
+			&node.ParentID,
+			&node.CreatedAt,
+			&node.UpdatedAt,
+			&node.Depth,
+			&node.SnippetCount,
+			&node.TotalSnippetCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan folder tree", ErrDatabaseError)
+		}
+		nodes = append(nodes, node)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate folder tree", ErrDatabaseError)
+	}
+
+	return buildFolderTree(nodes), nil
+}
+
+func (s *SQLiteStore) GetFolderPath(ctx context.Context, folderID int64) ([]models.Folder, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		WITH RECURSIVE chain(id, parent_id, depth) AS (
+			SELECT id, parent_id, 0 FROM folders WHERE id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.id, f.parent_id, c.depth + 1
+			FROM folders f
+			JOIN chain c ON f.id = c.parent_id
+			WHERE f.deleted_at IS NULL AND c.depth < 50
+		)
+		SELECT f.id, f.user_id, f.name, f.description, f.parent_id, f.created_at, f.updated_at
+		FROM chain c
+		JOIN folders f ON f.id = c.id
+		ORDER BY c.depth DESC`, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get folder path", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var path []models.Folder
+	for rows.Next() {
+		var folder models.Folder
+		err := rows.Scan(
+			&folder.ID,
+			&folder.UserID,
+			&folder.Name,
+			&folder.Description,
+			&folder.ParentID,
+			&folder.CreatedAt,
+			&folder.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan folder path", ErrDatabaseError)
+		}
+		path = append(path, folder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate folder path", ErrDatabaseError)
+	}
+
+	if len(path) == 0 {
+		return nil, ErrNoFolderError
+	}
+
+	return path, nil
+}
+
+func (s *SQLiteStore) UpdateFolder(ctx context.Context, folderID int64, folder *models.Folder) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var currentUserID int64
+	var currentParentID *int64
+	err = tx.QueryRowContext(ctx, "SELECT user_id, parent_id FROM folders WHERE id = ? AND deleted_at IS NULL", folderID).Scan(&currentUserID, &currentParentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("folder with ID %d does not exist: %w", folderID, ErrNoFolderError)
+		}
+		return fmt.Errorf("%w: failed to check folder existence", ErrDatabaseError)
+	}
+
+	if folder.ParentID != nil {
+		var parentUserID int64
+		err = tx.QueryRowContext(ctx, "SELECT user_id FROM folders WHERE id = ? AND deleted_at IS NULL", *folder.ParentID).Scan(&parentUserID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("parent folder does not exist")
+			}
+			return fmt.Errorf("failed to validate parent folder: %w", err)
+		}
+
+		if parentUserID != folder.UserID {
+			return fmt.Errorf("parent folder does not belong to user")
+		}
+
+		if *folder.ParentID == folderID {
+			return fmt.Errorf("folder cannot be its own parent")
+		}
+
+		if !sameParent(currentParentID, folder.ParentID) {
+			if err := sqliteCheckCircularReference(ctx, tx, folder.UserID, folderID, *folder.ParentID); err != nil {
+				return fmt.Errorf("circular reference detected: %w", err)
+			}
+		}
+	}
+
+	taken, err := sqliteFolderNameTaken(ctx, tx, folder.UserID, folder.Name, folder.ParentID, folderID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check for duplicate folder name", ErrDatabaseError)
+	}
+
+	if taken {
+		return fmt.Errorf("folder name already exists in this location")
+	}
+
+	now := sqliteNow()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE folders
+		SET name = ?, description = ?, parent_id = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL`,
+		folder.Name,
+		folder.Description,
+		folder.ParentID,
+		now,
+		folderID,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update folder", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to update folder", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("folder with ID %d does not exist: %w", folderID, ErrNoFolderError)
+	}
+
+	// Moving a folder moves everything below it
+	if err = sqliteSetFolderPath(ctx, tx, folderID, folder.ParentID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit update", ErrDatabaseError)
+	}
+
+	folder.ID = folderID
+	folder.UserID = currentUserID
+	folder.UpdatedAt = now
+
+	return nil
+}
+
+// DeleteFolder moves a folder to the trash. Snippets still in it are moved to
+// the root first, snippets already in the trash keep pointing at it so they
+// can bring it back when restored.
+func (s *SQLiteStore) DeleteFolder(ctx context.Context, folderID int64, mode string) (*models.FolderDeleteResult, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	var parentID *int64
+	err = tx.QueryRowContext(ctx, "SELECT user_id, parent_id FROM folders WHERE id = ? AND deleted_at IS NULL", folderID).Scan(&userID, &parentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("folder with ID %d does not exist: %w", folderID, ErrNoFolderError)
+		}
+		return nil, fmt.Errorf("%w: failed to check folder existence", ErrDatabaseError)
+	}
+
+	path, err := sqliteTrashPath(ctx, tx, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to record folder path", ErrDatabaseError)
+	}
+
+	now := sqliteNow()
+	result := newFolderDeleteResult(mode)
+
+	// Trash the folder before dealing with its contents, so its name is free
+	// for a child that shares it
+	_, err = tx.ExecContext(ctx, "UPDATE folders SET deleted_at = ?, trash_path = ? WHERE id = ?", now, path, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to delete folder", ErrDatabaseError)
+	}
+
+	switch mode {
+	case models.FolderDeleteRestrict:
+		var childCount int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM folders WHERE parent_id = ? AND deleted_at IS NULL", folderID).Scan(&childCount)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to check for child folders", ErrDatabaseError)
+		}
+
+		if childCount > 0 {
+			return nil, fmt.Errorf("folder has %d child folders: %w", childCount, ErrFolderHasChildren)
+		}
+
+		// Move snippets to root
+		result.MovedSnippets, err = sqliteMoveFolderSnippets(ctx, tx, userID, folderID, nil, now)
+		if err != nil {
+			return nil, err
+		}
+
+	case models.FolderDeleteCascade:
+		result.RemovedFolders, result.RemovedSnippets, err = sqliteTrashFolderContents(ctx, tx, userID, folderID, path, now)
+		if err != nil {
+			return nil, err
+		}
+
+	case models.FolderDeleteReparent:
+		result.MovedFolders, err = sqliteMoveChildFolders(ctx, tx, userID, folderID, parentID, now)
+		if err != nil {
+			return nil, err
+		}
+
+		result.MovedSnippets, err = sqliteMoveFolderSnippets(ctx, tx, userID, folderID, parentID, now)
+		if err != nil {
+			return nil, err
+		}
+		result.MovedTo = parentID
+
+	default:
+		return nil, fmt.Errorf("unknown folder delete mode %q", mode)
+	}
+
+	result.RemovedFolders = append([]int64{folderID}, result.RemovedFolders...)
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%w: failed to commit deletion", ErrDatabaseError)
+	}
+
+	return result, nil
+}
+
+// sqliteMoveFolderSnippets moves userID's live snippets in folderID to
+// newFolderID and returns their IDs
+func sqliteMoveFolderSnippets(ctx context.Context, tx *sql.Tx, userID, folderID int64, newFolderID *int64, now time.Time) ([]int64, error) {
+	moved, err := sqliteQueryIDs(ctx, tx, "SELECT id FROM snippets WHERE folder_id = ? AND user_id = ? AND deleted_at IS NULL ORDER BY id", folderID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get snippets in folder", ErrDatabaseError)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE snippets SET folder_id = ?, updated_at = ? WHERE folder_id = ? AND user_id = ? AND deleted_at IS NULL", newFolderID, now, folderID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to move snippets", ErrDatabaseError)
+	}
+
+	return moved, nil
+}
+
+// sqliteMoveChildFolders moves the live subfolders of folderID to newParentID,
+// renaming any whose name is already taken there
+func sqliteMoveChildFolders(ctx context.Context, tx *sql.Tx, userID, folderID int64, newParentID *int64, now time.Time) ([]models.MovedFolder, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id, name FROM folders WHERE parent_id = ? AND deleted_at IS NULL ORDER BY id", folderID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get child folders", ErrDatabaseError)
+	}
+
+	var children []models.MovedFolder
+	for rows.Next() {
+		var child models.MovedFolder
+		if err := rows.Scan(&child.ID, &child.Name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%w: failed to scan child folder", ErrDatabaseError)
+		}
+		children = append(children, child)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate child folders", ErrDatabaseError)
+	}
+
+	moved := []models.MovedFolder{}
+	for _, child := range children {
+		name := child.Name
+		for n := 2; ; n++ {
+			existingID, err := sqliteFindLiveFolder(ctx, tx, userID, name, newParentID)
+			if err != nil {
+				return nil, err
+			}
+			if existingID == 0 {
+				break
+			}
+			name = folderCopyName(child.Name, n)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE folders SET parent_id = ?, name = ?, updated_at = ? WHERE id = ?", newParentID, name, now, child.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to move child folder", ErrDatabaseError)
+		}
+
+		if err = sqliteSetFolderPath(ctx, tx, child.ID, newParentID); err != nil {
+			return nil, err
+		}
+
+		if name != child.Name {
+			renamedFrom := child.Name
+			child.RenamedFrom = &renamedFrom
+			child.Name = name
+		}
+		moved = append(moved, child)
+	}
+
+	return moved, nil
+}
+
+// sqliteTrashFolderContents moves every live folder and snippet below folderID
+// to the trash, stamped with the same deleted_at as the folder so restoring the
+// folder brings them back with it. path is the folder's own encoded trash path.
+// Only userID's snippets are touched, whatever else claims to be in their
+// folders.
+func sqliteTrashFolderContents(ctx context.Context, tx *sql.Tx, userID, folderID int64, path string, now time.Time) ([]int64, []int64, error) {
+	rootPath, err := sqliteDecodeTrashPath(sql.NullString{String: path, Valid: true})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		WITH RECURSIVE subtree(id, parent_id, name, depth) AS (
+			SELECT id, parent_id, name, 0 FROM folders WHERE id = ?
+			UNION ALL
+			SELECT f.id, f.parent_id, f.name, s.depth + 1
+			FROM folders f
+			JOIN subtree s ON f.parent_id = s.id
+			WHERE f.deleted_at IS NULL AND s.depth < 50
+		)
+		SELECT id, parent_id, name FROM subtree ORDER BY depth, id`, folderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to get folder tree", ErrDatabaseError)
+	}
+
+	// Parents come before their children, so each folder's path can be built
+	// from its parent's
+	paths := map[int64][]string{}
+	var folderIDs []int64
+	var folderPaths [][]string
+	for rows.Next() {
+		var id int64
+		var parentID *int64
+		var name string
+		if err := rows.Scan(&id, &parentID, &name); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("%w: failed to scan folder tree", ErrDatabaseError)
+		}
+
+		if id == folderID {
+			paths[id] = append(slices.Clip(rootPath), name)
+			continue
+		}
+
+		parentPath := paths[*parentID]
+		paths[id] = append(slices.Clip(parentPath), name)
+		folderIDs = append(folderIDs, id)
+		folderPaths = append(folderPaths, parentPath)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to iterate folder tree", ErrDatabaseError)
+	}
+
+	for i, id := range folderIDs {
+		encoded, err := json.Marshal(folderPaths[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to encode trash path", ErrDatabaseError)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE folders SET deleted_at = ?, trash_path = ? WHERE id = ?", now, string(encoded), id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to delete folder", ErrDatabaseError)
+		}
+	}
+
+	snippetIDs := []int64{}
+	for _, id := range append([]int64{folderID}, folderIDs...) {
+		ids, err := sqliteQueryIDs(ctx, tx, "SELECT id FROM snippets WHERE folder_id = ? AND user_id = ? AND deleted_at IS NULL ORDER BY id", id, userID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to get snippets in folder tree", ErrDatabaseError)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		encoded, err := json.Marshal(paths[id])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to encode trash path", ErrDatabaseError)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE snippets SET deleted_at = ?, trash_path = ? WHERE folder_id = ? AND user_id = ? AND deleted_at IS NULL", now, string(encoded), id, userID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to delete snippets", ErrDatabaseError)
+		}
+		snippetIDs = append(snippetIDs, ids...)
+	}
+	slices.Sort(snippetIDs)
+
+	if folderIDs == nil {
+		folderIDs = []int64{}
+	}
+
+	return folderIDs, snippetIDs, nil
+}
+
+// sqliteQueryIDs runs a query selecting a single integer column
+func sqliteQueryIDs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// sqliteCheckCircularReference checks folderID (0 when creating) can go under
+// parentID. The parent's path lists all of its ancestors, so the folder being
+// one of them shows up without walking the tree.
+func sqliteCheckCircularReference(ctx context.Context, tx *sql.Tx, userID int64, folderID int64, parentID int64) error {
+	if folderID != 0 && parentID == folderID {
+		return fmt.Errorf("circular reference detected")
+	}
+
+	var parentPath string
+	err := tx.QueryRowContext(ctx, "SELECT path FROM folders WHERE id = ? AND user_id = ?", parentID, userID).Scan(&parentPath)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to check parent folder: %w", err)
+	}
+
+	if folderID != 0 && folderPathContains(parentPath, folderID) {
+		return fmt.Errorf("circular reference detected")
+	}
+
+	if folderPathDepth(parentPath) >= 50 {
+		return fmt.Errorf("maximum folder depth exceeded")
+	}
+
+	return nil
+}
+
+// sqliteSetFolderPath rebuilds folderID's path under parentID and carries the
+// paths of everything below it along. Call it in the same transaction whenever
+// a folder is created or its parent_id changes.
+func sqliteSetFolderPath(ctx context.Context, tx *sql.Tx, folderID int64, parentID *int64) error {
+	parentPath := "/"
+	if parentID != nil {
+		err := tx.QueryRowContext(ctx, "SELECT path FROM folders WHERE id = ?", *parentID).Scan(&parentPath)
+		if err != nil {
+			return fmt.Errorf("%w: failed to get parent folder path", ErrDatabaseError)
+		}
+	}
+
+	var oldPath string
+	err := tx.QueryRowContext(ctx, "SELECT path FROM folders WHERE id = ?", folderID).Scan(&oldPath)
+	if err != nil {
+		return fmt.Errorf("%w: failed to get folder path", ErrDatabaseError)
+	}
+
+	newPath := parentPath + strconv.FormatInt(folderID, 10) + "/"
+	if newPath == oldPath {
+		return nil
+	}
+
+	// A folder that was just inserted still has the column default and
+	// nothing below it
+	if oldPath == "/" {
+		_, err = tx.ExecContext(ctx, "UPDATE folders SET path = ? WHERE id = ?", newPath, folderID)
+	} else {
+		_, err = tx.ExecContext(ctx, "UPDATE folders SET path = ? || substr(path, ?) WHERE path GLOB ?", newPath, len(oldPath)+1, oldPath+"*")
+	}
+	if err != nil {
+		return fmt.Errorf("%w: failed to update folder paths", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+// sqliteDetachFolderPaths turns the folders directly below folderID into roots
+// before it is purged, matching what ON DELETE SET NULL does to their parent_id
+func sqliteDetachFolderPaths(ctx context.Context, tx *sql.Tx, folderID int64) error {
+	var path string
+	err := tx.QueryRowContext(ctx, "SELECT path FROM folders WHERE id = ?", folderID).Scan(&path)
+	if err != nil {
+		return fmt.Errorf("%w: failed to get folder path", ErrDatabaseError)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE folders SET path = '/' || substr(path, ?) WHERE path GLOB ? AND id <> ?", len(path)+1, path+"*", folderID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update folder paths", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func sqliteFolderNameTaken(ctx context.Context, tx *sql.Tx, userID int64, name string, parentID *int64, excludeID int64) (bool, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM folders
+		WHERE user_id = ? AND name = ? AND parent_id IS ? AND id != ? AND deleted_at IS NULL`,
+		userID, name, parentID, excludeID,
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
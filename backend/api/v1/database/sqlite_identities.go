@@ -0,0 +1,187 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *SQLiteStore) GetIdentity(ctx context.Context, identityID int64) (*models.UserIdentity, error) {
+	identity, err := sqliteScanIdentity(s.DB.QueryRowContext(ctx, "SELECT "+identityColumns+" FROM user_identities WHERE id = ?", identityID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("identity with ID %d does not exist: %w", identityID, ErrNoIdentityError)
+		}
+		return nil, fmt.Errorf("%w: failed to get identity", ErrDatabaseError)
+	}
+
+	return identity, nil
+}
+
+func (s *SQLiteStore) GetIdentityBySubject(ctx context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	query := "SELECT " + identityColumns + " FROM user_identities WHERE issuer = ? AND subject = ?"
+
+	identity, err := sqliteScanIdentity(s.DB.QueryRowContext(ctx, query, issuer, subject))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoIdentityError
+		}
+		return nil, fmt.Errorf("%w: failed to get identity", ErrDatabaseError)
+	}
+
+	return identity, nil
+}
+
+func (s *SQLiteStore) GetIdentities(ctx context.Context, userID int64) ([]models.UserIdentity, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT "+identityColumns+" FROM user_identities WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get identities", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	identities := []models.UserIdentity{}
+	for rows.Next() {
+		identity, err := sqliteScanIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan identity data", ErrDatabaseError)
+		}
+		identities = append(identities, *identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate identities", ErrDatabaseError)
+	}
+
+	return identities, nil
+}
+
+func (s *SQLiteStore) CreateIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	if err = sqliteInsertIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = ?", user.Username).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check username availability", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("%w: username '%s' is already taken", ErrUsernameExists, user.Username)
+	}
+
+	now := sqliteNow()
+
+	// password_hash stays NULL, the identity is how the user signs in
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO users (username, created_at, updated_at)
+		VALUES (?, ?, ?)`,
+		user.Username, now, now,
+	)
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return fmt.Errorf("%w: username became unavailable", ErrUsernameExists)
+		}
+		return fmt.Errorf("%w: failed to create user", ErrDatabaseError)
+	}
+
+	user.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%w: failed to create user", ErrDatabaseError)
+	}
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.TokenGeneration = 0
+
+	identity.UserID = user.ID
+	if err = sqliteInsertIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) DeleteIdentity(ctx context.Context, identityID int64) error {
+	result, err := s.DB.ExecContext(ctx, "DELETE FROM user_identities WHERE id = ?", identityID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete identity", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete identity", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("identity with ID %d does not exist: %w", identityID, ErrNoIdentityError)
+	}
+
+	return nil
+}
+
+func sqliteInsertIdentity(ctx context.Context, tx *sql.Tx, identity *models.UserIdentity) error {
+	now := sqliteNow()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO user_identities (user_id, issuer, subject, email, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		identity.UserID, identity.Issuer, identity.Subject, identity.Email, now,
+	)
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return ErrIdentityExistsError
+		}
+		return fmt.Errorf("%w: failed to insert identity", ErrDatabaseError)
+	}
+
+	identity.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%w: failed to get identity ID", ErrDatabaseError)
+	}
+	identity.CreatedAt = now
+
+	return nil
+}
+
+// sqliteScanIdentity reads an identityColumns row from a *sql.Row or *sql.Rows
+func sqliteScanIdentity(row interface{ Scan(...interface{}) error }) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Issuer,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sqliteSaveMinHashBands replaces the band keys of a snippet with those of its
+// signature, which has already been written to the minhash column
+func sqliteSaveMinHashBands(ctx context.Context, tx *sql.Tx, snippetID, userID int64, signature *minHashSignature) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM snippet_minhash_bands WHERE snippet_id = ?", snippetID); err != nil {
+		return fmt.Errorf("failed to clear minhash bands: %w", err)
+	}
+	if signature == nil {
+		return nil
+	}
+
+	keys := signature.bandKeys()
+	args := make([]interface{}, 0, 3*len(keys))
+	for _, key := range keys {
+		args = append(args, snippetID, userID, key)
+	}
+
+	query := "INSERT OR IGNORE INTO snippet_minhash_bands(snippet_id, user_id, band_key) VALUES " +
+		strings.TrimSuffix(strings.Repeat("(?, ?, ?), ", len(keys)), ", ")
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to save minhash bands: %w", err)
+	}
+	return nil
+}
+
+// BackfillMinHashes signs up to limit snippets, trashed ones included, that
+// were saved before the minhash column existed
+func (s *SQLiteStore) BackfillMinHashes(ctx context.Context, limit int) (int, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT id, user_id, content FROM snippets WHERE minhash IS NULL ORDER BY id LIMIT ?", limit)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to get snippets to sign", ErrDatabaseError)
+	}
+
+	type pendingSnippet struct {
+		id, userID int64
+		content    string
+	}
+	var pending []pendingSnippet
+	for rows.Next() {
+		var snippet pendingSnippet
+		if err := rows.Scan(&snippet.id, &snippet.userID, &snippet.content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%w: failed to scan snippet", ErrDatabaseError)
+		}
+		pending = append(pending, snippet)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("%w: failed to iterate snippets", ErrDatabaseError)
+	}
+
+	for i, snippet := range pending {
+		if err := s.backfillMinHash(ctx, snippet.id, snippet.userID, snippet.content); err != nil {
+			return i, err
+		}
+	}
+
+	return len(pending), nil
+}
+
+// backfillMinHash signs one snippet, unless an edit signed it first
+func (s *SQLiteStore) backfillMinHash(ctx context.Context, snippetID, userID int64, content string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to begin transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	signature := newMinHashSignature(content)
+	result, err := tx.ExecContext(ctx, "UPDATE snippets SET minhash = ? WHERE id = ? AND minhash IS NULL", encodeMinHash(signature), snippetID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update minhash", ErrDatabaseError)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to update minhash", ErrDatabaseError)
+	}
+	if updated == 0 {
+		return nil
+	}
+
+	if err = sqliteSaveMinHashBands(ctx, tx, snippetID, userID, signature); err != nil {
+		return fmt.Errorf("%w: failed to save minhash bands", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit minhash", ErrDatabaseError)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetSimilarityCandidates(ctx context.Context, userID, exceptID int64, bandKeys []int64) ([]SnippetSignature, error) {
+	query := `
+		SELECT ` + signatureColumns + `
+		FROM snippets s
+		WHERE s.id IN (
+			SELECT snippet_id FROM snippet_minhash_bands WHERE user_id = ? AND band_key IN (` + sqlitePlaceholders(len(bandKeys)) + `)
+			UNION
+			SELECT id FROM snippets WHERE user_id = ? AND minhash IS NULL
+		) AND s.id <> ? AND s.deleted_at IS NULL
+		ORDER BY s.id`
+
+	args := make([]interface{}, 0, len(bandKeys)+3)
+	args = append(args, userID)
+	for _, key := range bandKeys {
+		args = append(args, key)
+	}
+	args = append(args, userID, exceptID)
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get similarity candidates", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var candidates []SnippetSignature
+	for rows.Next() {
+		candidate, err := sqliteScanSnippetSignature(rows)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate similarity candidates", ErrDatabaseError)
+	}
+
+	return candidates, nil
+}
+
+func (s *SQLiteStore) WalkSnippetSignatures(ctx context.Context, userID int64, fn func(*SnippetSignature) error) error {
+	query := `
+		SELECT ` + signatureColumns + `
+		FROM snippets s
+		WHERE s.user_id = ? AND s.id > ? AND s.deleted_at IS NULL
+		ORDER BY s.id
+		LIMIT ?`
+
+	var lastID int64
+	for {
+		rows, err := s.DB.QueryContext(ctx, query, userID, lastID, walkBatchSize)
+		if err != nil {
+			return fmt.Errorf("%w: failed to get snippet signatures", ErrDatabaseError)
+		}
+
+		// The batch is read in full first, with a single connection the rest
+		// of the server waits while rows are open
+		var batch []SnippetSignature
+		for rows.Next() {
+			signature, err := sqliteScanSnippetSignature(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, signature)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("%w: failed to iterate snippet signatures", ErrDatabaseError)
+		}
+
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < walkBatchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].Snippet.ID
+	}
+}
+
+func sqliteScanSnippetSignature(rows *sql.Rows) (SnippetSignature, error) {
+	var signature SnippetSignature
+	var content sql.NullString
+	err := rows.Scan(
+		&signature.Snippet.ID,
+		&signature.Snippet.Title,
+		&signature.Snippet.FolderID,
+		&signature.Snippet.Language,
+		&signature.MinHash,
+		&content,
+	)
+	if err != nil {
+		return SnippetSignature{}, fmt.Errorf("%w: failed to scan snippet signature", ErrDatabaseError)
+	}
+	if content.Valid {
+		signature.Content = &content.String
+	}
+	return signature, nil
+}
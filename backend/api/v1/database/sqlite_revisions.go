@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *SQLiteStore) GetSnippetRevisions(ctx context.Context, snippetID int64, page, limit int) ([]models.SnippetRevision, int, error) {
+	offset := (page - 1) * limit
+
+	var total int
+	err := s.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM snippet_revisions WHERE snippet_id = ?", snippetID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to get revision count", ErrDatabaseError)
+	}
+
+	// Content is left out of listings, fetch a single revision to get it
+	query := `
+		SELECT id, snippet_id, revision, title, description, language, tags, created_at
+		FROM snippet_revisions
+		WHERE snippet_id = ?
+		ORDER BY revision DESC
+		LIMIT ? OFFSET ?`
+
+	rows, err := s.DB.QueryContext(ctx, query, snippetID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to get revisions", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var revisions []models.SnippetRevision
+	for rows.Next() {
+		var revision models.SnippetRevision
+		var tags string
+
+		err := rows.Scan(
+			&revision.ID,
+			&revision.SnippetID,
+			&revision.Revision,
+			&revision.Title,
+			&revision.Description,
+			&revision.Language,
+			&tags,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: failed to scan revision data", ErrDatabaseError)
+		}
+
+		if err := json.Unmarshal([]byte(tags), &revision.Tags); err != nil {
+			return nil, 0, fmt.Errorf("%w: failed to decode revision tags", ErrDatabaseError)
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to iterate revisions", ErrDatabaseError)
+	}
+
+	return revisions, total, nil
+}
+
+func (s *SQLiteStore) GetSnippetRevision(ctx context.Context, snippetID int64, revisionNumber int) (*models.SnippetRevision, error) {
+	query := `
+		SELECT id, snippet_id, revision, title, description, content, language, tags, created_at
+		FROM snippet_revisions
+		WHERE snippet_id = ? AND revision = ?`
+
+	var revision models.SnippetRevision
+	var tags string
+
+	err := s.DB.QueryRowContext(ctx, query, snippetID, revisionNumber).Scan(
+		&revision.ID,
+		&revision.SnippetID,
+		&revision.Revision,
+		&revision.Title,
+		&revision.Description,
+		&revision.Content,
+		&revision.Language,
+		&tags,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRevisionError
+		}
+		return nil, fmt.Errorf("%w: failed to get revision", ErrDatabaseError)
+	}
+
+	if err := json.Unmarshal([]byte(tags), &revision.Tags); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode revision tags", ErrDatabaseError)
+	}
+
+	return &revision, nil
+}
+
+// sqliteInsertSnippetRevision snapshots the snippet row and its tags as they
+// stand inside tx, numbering the revision after the latest one
+func sqliteInsertSnippetRevision(ctx context.Context, tx *sql.Tx, snippetID int64, createdAt time.Time) error {
+	query := `
+		INSERT INTO snippet_revisions (snippet_id, revision, title, description, content, language, tags, created_at)
+		SELECT s.id,
+		       COALESCE((SELECT MAX(revision) FROM snippet_revisions WHERE snippet_id = s.id), 0) + 1,
+		       s.title, s.description, s.content, s.language,
+		       (
+		           SELECT json_group_array(name) FROM (
+		               SELECT t.name FROM snippet_tags st
+		               JOIN tags t ON st.tag_id = t.id
+		               WHERE st.snippet_id = s.id
+		               ORDER BY t.name
+		           )
+		       ),
+		       ?
+		FROM snippets s
+		WHERE s.id = ?`
+
+	_, err := tx.ExecContext(ctx, query, createdAt, snippetID)
+	if err != nil {
+		return fmt.Errorf("failed to record snippet revision: %w", err)
+	}
+
+	return nil
+}
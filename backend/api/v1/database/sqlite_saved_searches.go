@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *SQLiteStore) CreateSavedSearch(ctx context.Context, search *models.SavedSearch) error {
+	filters, err := json.Marshal(search.Filters)
+	if err != nil {
+		return fmt.Errorf("failed to encode saved search filters: %w", err)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM saved_searches WHERE user_id = ? AND name = ?", search.UserID, search.Name).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check for duplicate saved search name", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("saved search name already exists")
+	}
+
+	now := sqliteNow()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO saved_searches (user_id, name, query, filters, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		search.UserID, search.Name, search.Query, string(filters), now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to insert saved search", ErrDatabaseError)
+	}
+
+	searchID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%w: failed to get saved search ID", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	search.ID = searchID
+	search.CreatedAt = now
+	search.UpdatedAt = now
+
+	return nil
+}
+
+func (s *SQLiteStore) GetSavedSearch(ctx context.Context, searchID int64) (*models.SavedSearch, error) {
+	query := `
+		SELECT id, user_id, name, query, filters, created_at, updated_at
+		FROM saved_searches
+		WHERE id = ?`
+
+	var search models.SavedSearch
+	var filters string
+	err := s.DB.QueryRowContext(ctx, query, searchID).Scan(
+		&search.ID,
+		&search.UserID,
+		&search.Name,
+		&search.Query,
+		&filters,
+		&search.CreatedAt,
+		&search.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("saved search with ID %d does not exist: %w", searchID, ErrNoSavedSearchError)
+		}
+		return nil, fmt.Errorf("%w: failed to get saved search", ErrDatabaseError)
+	}
+
+	if err = json.Unmarshal([]byte(filters), &search.Filters); err != nil {
+		return nil, fmt.Errorf("failed to decode saved search filters: %w", err)
+	}
+
+	return &search, nil
+}
+
+func (s *SQLiteStore) GetSavedSearches(ctx context.Context, userID int64) ([]models.SavedSearch, error) {
+	query := `
+		SELECT id, user_id, name, query, filters, created_at, updated_at
+		FROM saved_searches
+		WHERE user_id = ?
+		ORDER BY name ASC`
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get saved searches", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var searches []models.SavedSearch
+	for rows.Next() {
+		var search models.SavedSearch
+		var filters string
+
+		err := rows.Scan(&search.ID, &search.UserID, &search.Name, &search.Query, &filters, &search.CreatedAt, &search.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan saved search data", ErrDatabaseError)
+		}
+
+		if err = json.Unmarshal([]byte(filters), &search.Filters); err != nil {
+			return nil, fmt.Errorf("failed to decode saved search filters: %w", err)
+		}
+
+		searches = append(searches, search)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate saved searches", ErrDatabaseError)
+	}
+
+	return searches, nil
+}
+
+func (s *SQLiteStore) UpdateSavedSearch(ctx context.Context, searchID int64, search *models.SavedSearch) error {
+	filters, err := json.Marshal(search.Filters)
+	if err != nil {
+		return fmt.Errorf("failed to encode saved search filters: %w", err)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM saved_searches WHERE id = ?", searchID).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("saved search with ID %d does not exist: %w", searchID, ErrNoSavedSearchError)
+		}
+		return fmt.Errorf("%w: failed to check saved search existence", ErrDatabaseError)
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM saved_searches WHERE user_id = ? AND name = ? AND id <> ?", userID, search.Name, searchID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check for duplicate saved search name", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("saved search name already exists")
+	}
+
+	now := sqliteNow()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE saved_searches
+		SET name = ?, query = ?, filters = ?, updated_at = ?
+		WHERE id = ?`,
+		search.Name, search.Query, string(filters), now, searchID,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update saved search", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	search.ID = searchID
+	search.UserID = userID
+	search.UpdatedAt = now
+
+	return nil
+}
+
+func (s *SQLiteStore) DeleteSavedSearch(ctx context.Context, searchID int64) error {
+	result, err := s.DB.ExecContext(ctx, "DELETE FROM saved_searches WHERE id = ?", searchID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete saved search", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete saved search", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("saved search with ID %d does not exist: %w", searchID, ErrNoSavedSearchError)
+	}
+
+	return nil
+}
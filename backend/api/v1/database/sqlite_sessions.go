@@ -0,0 +1,246 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *SQLiteStore) CreateSession(ctx context.Context, session *models.Session, tokenHash string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO sessions (user_id, token_hash, device, ip_address, signed_in_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.UserID, tokenHash, session.Device, session.IPAddress, now, now, session.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to insert session", ErrDatabaseError)
+	}
+
+	sessionID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%w: failed to get session ID", ErrDatabaseError)
+	}
+
+	// The first token names the family
+	_, err = tx.ExecContext(ctx, "UPDATE sessions SET family_id = id WHERE id = ?", sessionID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update session", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	session.ID = sessionID
+	session.SignedInAt = now
+	session.LastUsedAt = now
+
+	return nil
+}
+
+func (s *SQLiteStore) GetSession(ctx context.Context, sessionID int64) (*models.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE family_id = ? AND " + liveSession + "?"
+	return s.getSession(ctx, query, sessionID, sqliteNow())
+}
+
+func (s *SQLiteStore) GetSessionByToken(ctx context.Context, tokenHash string) (*models.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE token_hash = ? AND " + liveSession + "?"
+	return s.getSession(ctx, query, tokenHash, sqliteNow())
+}
+
+func (s *SQLiteStore) getSession(ctx context.Context, query string, args ...interface{}) (*models.Session, error) {
+	var session models.Session
+	err := s.DB.QueryRowContext(ctx, query, args...).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.IPAddress,
+		&session.SignedInAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoSessionError
+		}
+		return nil, fmt.Errorf("%w: failed to get session", ErrDatabaseError)
+	}
+
+	return &session, nil
+}
+
+func (s *SQLiteStore) GetSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE user_id = ? AND " + liveSession + "? ORDER BY last_used_at DESC, family_id DESC"
+
+	rows, err := s.DB.QueryContext(ctx, query, userID, sqliteNow())
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get sessions", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	// A session refreshed twice within refreshReuseGrace has two live tokens,
+	// only the most recently used is listed
+	sessions := []models.Session{}
+	seen := make(map[int64]bool)
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.Device, &session.IPAddress, &session.SignedInAt, &session.LastUsedAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan session data", ErrDatabaseError)
+		}
+		if !seen[session.ID] {
+			seen[session.ID] = true
+			sessions = append(sessions, session)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate sessions", ErrDatabaseError)
+	}
+
+	return sessions, nil
+}
+
+func (s *SQLiteStore) RotateSession(ctx context.Context, tokenHash, newTokenHash, ipAddress string, expiresAt time.Time) (*models.Session, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var tokenID int64
+	var session models.Session
+	var replacedAt, revokedAt *time.Time
+	err = tx.QueryRowContext(ctx, "SELECT id, "+sessionColumns+", replaced_at, revoked_at FROM sessions WHERE token_hash = ?", tokenHash).Scan(
+		&tokenID,
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.IPAddress,
+		&session.SignedInAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&replacedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoSessionError
+		}
+		return nil, fmt.Errorf("%w: failed to get session", ErrDatabaseError)
+	}
+
+	now := sqliteNow()
+	if revokedAt != nil || !session.ExpiresAt.After(now) {
+		return nil, ErrNoSessionError
+	}
+
+	if replacedAt != nil && now.Sub(*replacedAt) >= refreshReuseGrace {
+		_, err = tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", now, session.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to revoke session", ErrDatabaseError)
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+		}
+		return nil, fmt.Errorf("session %d revoked: %w", session.ID, ErrSessionReuseError)
+	}
+
+	// Only a token not yet replaced is marked, so a refresh racing another
+	// with the same token, or reusing one replaced moments ago, leaves
+	// replaced_at alone and the grace isn't stretched
+	_, err = tx.ExecContext(ctx, "UPDATE sessions SET replaced_at = ? WHERE id = ? AND replaced_at IS NULL", now, tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to update session", ErrDatabaseError)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sessions (family_id, user_id, token_hash, device, ip_address, signed_in_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, newTokenHash, session.Device, ipAddress, session.SignedInAt.UTC(), now, expiresAt.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to insert session", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	session.IPAddress = ipAddress
+	session.LastUsedAt = now
+	session.ExpiresAt = expiresAt
+
+	return &session, nil
+}
+
+func (s *SQLiteStore) RevokeSession(ctx context.Context, sessionID int64) error {
+	result, err := s.DB.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", sqliteNow(), sessionID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to revoke session", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to revoke session", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("session with ID %d does not exist: %w", sessionID, ErrNoSessionError)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) RevokeUserSessions(ctx context.Context, userID, exceptID int64) (int, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+
+	var revoked int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(DISTINCT family_id) FROM sessions WHERE user_id = ? AND family_id <> ? AND "+liveSession+"?", userID, exceptID, now).Scan(&revoked)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to count sessions", ErrDatabaseError)
+	}
+
+	// Old tokens of each session are revoked along with the current one
+	_, err = tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND family_id <> ? AND revoked_at IS NULL", now, userID, exceptID)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to revoke sessions", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return revoked, nil
+}
+
+func (s *SQLiteStore) PurgeSessions(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.DB.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to purge sessions", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to purge sessions", ErrDatabaseError)
+	}
+
+	return int(rowsAffected), nil
+}
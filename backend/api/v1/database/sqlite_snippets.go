@@ -0,0 +1,833 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// bm25 column weights matching the ts_rank defaults for the A, B, C and D labels
+const sqliteRankExpression = "bm25(snippets_fts, 1.0, 0.4, 0.2, 0.1)"
+
+func (s *SQLiteStore) CreateSnippet(ctx context.Context, snippet *models.Snippet) error {
+	return s.createSnippet(ctx, snippet, false)
+}
+
+func (s *SQLiteStore) CreateUniqueSnippet(ctx context.Context, snippet *models.Snippet) error {
+	return s.createSnippet(ctx, snippet, true)
+}
+
+func (s *SQLiteStore) createSnippet(ctx context.Context, snippet *models.Snippet, unique bool) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if unique {
+		if err = sqliteCheckUniqueContent(ctx, tx, snippet.UserID, 0, contentHash(snippet.Content)); err != nil {
+			return err
+		}
+	}
+
+	query := `
+	INSERT INTO snippets(user_id, folder_id, title, description, content, language, is_favorite, search_tokens, content_hash, minhash, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	now := sqliteNow()
+	signature := newMinHashSignature(snippet.Content)
+
+	result, err := tx.ExecContext(ctx,
+		query,
+		snippet.UserID,
+		snippet.FolderID,
+		snippet.Title,
+		snippet.Description,
+		snippet.Content,
+		snippet.Language,
+		snippet.IsFavorite,
+		snippetSearchTokens(snippet),
+		contentHash(snippet.Content),
+		encodeMinHash(signature),
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert snippet: %w", err)
+	}
+
+	generatedID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to insert snippet: %w", err)
+	}
+
+	if err = sqliteSaveMinHashBands(ctx, tx, generatedID, snippet.UserID, signature); err != nil {
+		return err
+	}
+
+	// Handle tags if provided
+	if snippet.Tags != nil && len(*snippet.Tags) > 0 {
+		err = sqliteInsertSnippetTags(ctx, tx, generatedID, snippet.UserID, *snippet.Tags)
+		if err != nil {
+			return fmt.Errorf("failed to insert snippet tags: %w", err)
+		}
+	}
+
+	if err = sqliteInsertSnippetRevision(ctx, tx, generatedID, now); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	snippet.ID = generatedID
+	snippet.CreatedAt = now
+	snippet.UpdatedAt = now
+
+	return nil
+}
+
+func (s *SQLiteStore) GetSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error) {
+	return s.getSnippet(ctx, snippetID, "deleted_at IS NULL")
+}
+
+// getSnippet loads a snippet and its tags, trashCondition picks whether live
+// or trashed rows are visible
+func (s *SQLiteStore) getSnippet(ctx context.Context, snippetID int64, trashCondition string) (*models.Snippet, error) {
+	query := `
+		SELECT id, user_id, folder_id, title, description, content, language,
+		       is_favorite, created_at, updated_at
+		FROM snippets
+		WHERE id = ? AND ` + trashCondition
+
+	var snippet models.Snippet
+
+	err := s.DB.QueryRowContext(ctx, query, snippetID).Scan(
+		&snippet.ID,
+		&snippet.UserID,
+		&snippet.FolderID,
+		&snippet.Title,
+		&snippet.Description,
+		&snippet.Content,
+		&snippet.Language,
+		&snippet.IsFavorite,
+		&snippet.CreatedAt,
+		&snippet.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoSnippetError
+		}
+		return nil, fmt.Errorf("failed to get snippet: %w", err)
+	}
+
+	tags, err := sqliteGetSnippetTags(ctx, s.DB, snippetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snippet tags: %w", err)
+	}
+
+	if len(tags) > 0 {
+		snippet.Tags = &tags
+	}
+
+	return &snippet, nil
+}
+
+func (s *SQLiteStore) GetSnippets(ctx context.Context, page, limit int, userID int64, filter SnippetFilter) ([]models.Snippet, int, error) {
+	offset := (page - 1) * limit
+
+	q, search, err := s.buildSnippetQuery(ctx, userID, filter)
+	if err != nil || q == nil {
+		return nil, 0, err
+	}
+
+	whereClause := q.whereClause()
+	orderClause := q.orderClause(filter, q.rank)
+
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s %s", q.from, whereClause)
+
+	var total int
+	err = s.DB.QueryRowContext(ctx, countQuery, q.args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get snippet count: %w", err)
+	}
+
+	dataQuery := fmt.Sprintf(`
+		SELECT s.id, s.user_id, s.folder_id, s.title, s.description, s.content, s.language, s.is_favorite, s.created_at, s.updated_at
+		FROM %s
+		%s
+		%s
+		LIMIT %s OFFSET %s`, q.from, whereClause, orderClause, q.arg(limit), q.arg(offset))
+
+	snippets, err := sqliteQuerySnippets(ctx, s.DB, dataQuery, q.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if search != nil {
+		highlightSearchHits(snippets, search, filter.SearchMode)
+	}
+
+	return snippets, total, nil
+}
+
+func (s *SQLiteStore) GetSnippetFacets(ctx context.Context, userID int64, filter SnippetFilter, facets []string) (models.SnippetFacets, error) {
+	q, _, err := s.buildSnippetQuery(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newSnippetFacets(facets)
+	if q == nil {
+		return result, nil
+	}
+
+	for _, facet := range facets {
+		rows, err := s.DB.QueryContext(ctx, q.facetQuery(facet), q.args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s facet: %w", facet, err)
+		}
+
+		for rows.Next() {
+			var count models.FacetCount
+			if facet == FacetFolder {
+				err = rows.Scan(&count.FolderID, &count.Value, &count.Count)
+			} else {
+				err = rows.Scan(&count.Value, &count.Count)
+			}
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan %s facet: %w", facet, err)
+			}
+			result[facet] = append(result[facet], count)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to iterate %s facet: %w", facet, err)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *SQLiteStore) CountSnippets(ctx context.Context, userID int64, filters []SnippetFilter) ([]int, error) {
+	counts := make([]int, len(filters))
+
+	var args []interface{}
+	var subqueries []string
+	var counted []interface{}
+	for i, filter := range filters {
+		q, _, err := s.buildSnippetQuery(ctx, userID, filter, args...)
+		if err != nil {
+			return nil, err
+		}
+		if q == nil {
+			continue
+		}
+
+		args = q.args
+		subqueries = append(subqueries, fmt.Sprintf("(SELECT COUNT(*) FROM %s %s)", q.from, q.whereClause()))
+		counted = append(counted, &counts[i])
+	}
+
+	if len(subqueries) == 0 {
+		return counts, nil
+	}
+
+	err := s.DB.QueryRowContext(ctx, "SELECT "+strings.Join(subqueries, ", "), args...).Scan(counted...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count snippets: %w", err)
+	}
+
+	return counts, nil
+}
+
+// buildSnippetQuery compiles a filter into the query GetSnippets and
+// GetSnippetFacets share. A nil query means nothing can match. The query's
+// placeholders are numbered after args.
+func (s *SQLiteStore) buildSnippetQuery(ctx context.Context, userID int64, filter SnippetFilter, args ...interface{}) (*snippetQuery, *SearchQuery, error) {
+	q := newSnippetQuery(sqlitePlaceholder, userID, args...)
+
+	var search *SearchQuery
+	if filter.Search != "" {
+		var err error
+		search, err = ParseSearchQuery(filter.Search)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		q.addSearchOperators(search, userID)
+
+		fullText := filter.SearchMode != SearchModeSubstring
+		substring := filter.SearchMode != SearchModeFullText
+
+		// Hybrid search matches either way and combines the two scores. bm25
+		// is lower for better matches, so the substring score is subtracted.
+		include, exclude := search.textTerms()
+		if len(include) > 0 {
+			var matches, scores []string
+			if fullText {
+				if matchQuery := sqliteMatchQuery(include); matchQuery != "" {
+					q.from = fmt.Sprintf(`snippets s
+						LEFT JOIN (
+							SELECT rowid, %s AS rank
+							FROM snippets_fts
+							WHERE snippets_fts MATCH %s
+						) fts ON fts.rowid = s.id`, sqliteRankExpression, q.arg(matchQuery))
+					matches = append(matches, "fts.rowid IS NOT NULL")
+					scores = append(scores, "COALESCE(fts.rank, 0)")
+				}
+			}
+			if substring {
+				match, score := sqliteTrigramMatch(q, include)
+				matches = append(matches, match)
+				scores = append(scores, "- "+score)
+			}
+
+			if len(matches) == 0 {
+				// Nothing searchable left, plainto_tsquery matches no rows either
+				return nil, nil, nil
+			}
+
+			q.where("(" + strings.Join(matches, " OR ") + ")")
+			q.rank = strings.Join(scores, " ") + " ASC"
+		}
+
+		for _, term := range exclude {
+			var matches []string
+			if fullText {
+				if matchQuery := sqliteMatchQuery([]SearchTerm{term}); matchQuery != "" {
+					matches = append(matches, "s.id IN (SELECT rowid FROM snippets_fts WHERE snippets_fts MATCH "+q.arg(matchQuery)+")")
+				}
+			}
+			if substring {
+				match, _ := sqliteTrigramMatch(q, []SearchTerm{term})
+				matches = append(matches, match)
+			}
+			if len(matches) > 0 {
+				q.where("NOT (" + strings.Join(matches, " OR ") + ")")
+			}
+		}
+	}
+
+	if filter.FolderID != nil {
+		if filter.Recursive {
+			// Everything under the folder shares its path as a prefix
+			var folderPath string
+			err := s.DB.QueryRowContext(ctx, "SELECT path FROM folders WHERE id = ? AND user_id = ? AND deleted_at IS NULL", *filter.FolderID, userID).Scan(&folderPath)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil, nil, nil
+				}
+				return nil, nil, fmt.Errorf("%w: failed to get folder path", ErrDatabaseError)
+			}
+
+			q.where("s.folder_id IN (SELECT id FROM folders WHERE path GLOB " + q.arg(folderPath+"*") + " AND deleted_at IS NULL)")
+		} else {
+			q.where("s.folder_id = " + q.arg(*filter.FolderID))
+		}
+	}
+
+	q.addFilters(filter)
+
+	return q, search, nil
+}
+
+// sqliteTrigramMatch requires every term to appear verbatim, ignoring case, in
+// the title or content, answered from the snippets_trigram index. The score
+// counts title matches above content matches like the Postgres version.
+func sqliteTrigramMatch(q *snippetQuery, terms []SearchTerm) (match string, score string) {
+	var conditions, scores []string
+	for _, term := range terms {
+		pattern, escaped := likeSubstringPattern(term.Value)
+		like := "LIKE " + q.arg(pattern)
+		if escaped {
+			// FTS5 can't use the index with an ESCAPE clause, so it is only
+			// added when the term has wildcards to escape
+			like += ` ESCAPE '\'`
+		}
+
+		conditions = append(conditions, fmt.Sprintf("s.id IN (SELECT rowid FROM snippets_trigram WHERE title %s OR content %s)", like, like))
+		scores = append(scores, fmt.Sprintf("(s.title %s) * %.1f + (s.content %s) * %.1f", like, titleWeight, like, contentWeight))
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", "(" + strings.Join(scores, " + ") + ")"
+}
+
+func (s *SQLiteStore) UpdateSnippet(ctx context.Context, snippetID int64, snippet *models.Snippet) error {
+	return s.updateSnippet(ctx, snippetID, snippet, false)
+}
+
+func (s *SQLiteStore) UpdateUniqueSnippet(ctx context.Context, snippetID int64, snippet *models.Snippet) error {
+	return s.updateSnippet(ctx, snippetID, snippet, true)
+}
+
+func (s *SQLiteStore) updateSnippet(ctx context.Context, snippetID int64, snippet *models.Snippet, unique bool) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var currentUserID int64
+	var currentHash sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT user_id, content_hash FROM snippets WHERE id = ? AND deleted_at IS NULL", snippetID).Scan(&currentUserID, &currentHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("snippet with ID %d does not exist: %w", snippetID, ErrNoSnippetError)
+		}
+		return fmt.Errorf("failed to check snippet existence: %w", err)
+	}
+
+	// Snippets already sharing content can still be edited in other ways
+	hash := contentHash(snippet.Content)
+	if unique && (!currentHash.Valid || currentHash.String != hash) {
+		if err = sqliteCheckUniqueContent(ctx, tx, currentUserID, snippetID, hash); err != nil {
+			return err
+		}
+	}
+
+	now := sqliteNow()
+	signature := newMinHashSignature(snippet.Content)
+
+	updateQuery := `
+		UPDATE snippets
+		SET folder_id = ?, title = ?, description = ?, content = ?, language = ?, is_favorite = ?, search_tokens = ?, content_hash = ?, minhash = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, updateQuery,
+		snippet.FolderID,
+		snippet.Title,
+		snippet.Description,
+		snippet.Content,
+		snippet.Language,
+		snippet.IsFavorite,
+		snippetSearchTokens(snippet),
+		hash,
+		encodeMinHash(signature),
+		now,
+		snippetID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update snippet: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update snippet: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("snippet with ID %d does not exist: %w", snippetID, ErrNoSnippetError)
+	}
+
+	if err = sqliteSaveMinHashBands(ctx, tx, snippetID, currentUserID, signature); err != nil {
+		return err
+	}
+
+	if snippet.Tags != nil {
+		_, err = tx.ExecContext(ctx, "DELETE FROM snippet_tags WHERE snippet_id = ?", snippetID)
+		if err != nil {
+			return fmt.Errorf("failed to update snippet tags: %w", err)
+		}
+
+		if len(*snippet.Tags) > 0 {
+			err = sqliteInsertSnippetTags(ctx, tx, snippetID, currentUserID, *snippet.Tags)
+			if err != nil {
+				return fmt.Errorf("failed to update snippet tags: %w", err)
+			}
+		}
+	}
+
+	if err = sqliteInsertSnippetRevision(ctx, tx, snippetID, now); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit update: %w", err)
+	}
+
+	snippet.ID = snippetID
+	snippet.UserID = currentUserID
+	snippet.UpdatedAt = now
+
+	if snippet.Tags != nil {
+		tags, err := sqliteGetSnippetTags(ctx, s.DB, snippetID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve updated tags: %w", err)
+		}
+		if len(tags) > 0 {
+			snippet.Tags = &tags
+		} else {
+			emptyTags := []string{}
+			snippet.Tags = &emptyTags
+		}
+	}
+
+	return nil
+}
+
+// DeleteSnippet moves a snippet to the trash, PurgeSnippet removes it for good
+func (s *SQLiteStore) DeleteSnippet(ctx context.Context, snippetID int64) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var folderID *int64
+	err = tx.QueryRowContext(ctx, "SELECT folder_id FROM snippets WHERE id = ? AND deleted_at IS NULL", snippetID).Scan(&folderID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("snippet with ID %d does not exist: %w", snippetID, ErrNoSnippetError)
+		}
+		return fmt.Errorf("failed to check snippet existence: %w", err)
+	}
+
+	path, err := sqliteTrashPath(ctx, tx, folderID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE snippets SET deleted_at = ?, trash_path = ? WHERE id = ?", sqliteNow(), path, snippetID)
+	if err != nil {
+		return fmt.Errorf("failed to delete snippet: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit deletion: %w", err)
+	}
+
+	return nil
+}
+
+// sqliteQuerySnippets runs a query selecting the standard snippet columns and
+// attaches tags to the results. The rows are fully drained before the tag
+// query runs so it works with a single connection.
+func sqliteQuerySnippets(ctx context.Context, q sqliteQuerier, query string, args ...interface{}) ([]models.Snippet, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snippets: %w", err)
+	}
+
+	var snippets []models.Snippet
+	var snippetIDs []int64
+
+	for rows.Next() {
+		var snippet models.Snippet
+
+		err := rows.Scan(
+			&snippet.ID,
+			&snippet.UserID,
+			&snippet.FolderID,
+			&snippet.Title,
+			&snippet.Description,
+			&snippet.Content,
+			&snippet.Language,
+			&snippet.IsFavorite,
+			&snippet.CreatedAt,
+			&snippet.UpdatedAt,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan snippet data: %w", err)
+		}
+
+		snippets = append(snippets, snippet)
+		snippetIDs = append(snippetIDs, snippet.ID)
+	}
+
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("failed to iterate snippets: %w", err)
+	}
+	rows.Close()
+
+	if len(snippetIDs) > 0 {
+		err = sqliteAttachTagsToSnippets(ctx, q, snippets, snippetIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach tags: %w", err)
+		}
+	}
+
+	return snippets, nil
+}
+
+// Helper function to get tags for a single snippet
+func sqliteGetSnippetTags(ctx context.Context, q sqliteQuerier, snippetID int64) ([]string, error) {
+	tagQuery := `
+		SELECT t.name
+		FROM snippet_tags st
+		JOIN tags t ON st.tag_id = t.id
+		WHERE st.snippet_id = ?
+		ORDER BY t.name`
+
+	rows, err := q.QueryContext(ctx, tagQuery, snippetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snippet tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tagName string
+		if err := rows.Scan(&tagName); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tagName)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+func sqliteAttachTagsToSnippets(ctx context.Context, q sqliteQuerier, snippets []models.Snippet, snippetIDs []int64) error {
+	if len(snippetIDs) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(snippetIDs))
+	for i, id := range snippetIDs {
+		args[i] = id
+	}
+
+	tagQuery := fmt.Sprintf(`
+		SELECT st.snippet_id, t.name
+		FROM snippet_tags st
+		JOIN tags t ON st.tag_id = t.id
+		WHERE st.snippet_id IN (%s)
+		ORDER BY st.snippet_id, t.name`, sqlitePlaceholders(len(snippetIDs)))
+
+	rows, err := q.QueryContext(ctx, tagQuery, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get snippet tags: %w", err)
+	}
+	defer rows.Close()
+
+	// Group tags by snippet ID
+	tagMap := make(map[int64][]string)
+	for rows.Next() {
+		var snippetID int64
+		var tagName string
+		if err := rows.Scan(&snippetID, &tagName); err != nil {
+			return fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tagMap[snippetID] = append(tagMap[snippetID], tagName)
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate tags: %w", err)
+	}
+
+	// Attach tags to snippets
+	for i := range snippets {
+		if tags, exists := tagMap[snippets[i].ID]; exists {
+			snippets[i].Tags = &tags
+		}
+	}
+
+	return nil
+}
+
+func sqliteInsertSnippetTags(ctx context.Context, tx *sql.Tx, snippetID int64, userID int64, tagNames []string) error {
+	for _, tagName := range tagNames {
+		tagName = strings.TrimSpace(tagName)
+		if tagName == "" {
+			continue
+		}
+
+		var tagID int64
+
+		err := tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE user_id = ? AND name = ?", userID, tagName).Scan(&tagID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				result, err := tx.ExecContext(ctx, `
+					INSERT INTO tags (user_id, name, created_at)
+					VALUES (?, ?, ?)`,
+					userID, tagName, sqliteNow(),
+				)
+				if err == nil {
+					tagID, err = result.LastInsertId()
+				}
+				if err != nil {
+					return fmt.Errorf("failed to create tag %s: %w", tagName, err)
+				}
+			} else {
+				return fmt.Errorf("failed to get tag %s: %w", tagName, err)
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO snippet_tags (snippet_id, tag_id)
+			VALUES (?, ?)
+			ON CONFLICT DO NOTHING`,
+			snippetID, tagID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to link tag %s to snippet: %w", tagName, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) BackfillSearchTokens(ctx context.Context, limit int) (int, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT id, title, content FROM snippets WHERE search_tokens IS NULL ORDER BY id LIMIT ?", limit)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to get snippets to tokenize", ErrDatabaseError)
+	}
+
+	var pending []models.Snippet
+	for rows.Next() {
+		var snippet models.Snippet
+		if err := rows.Scan(&snippet.ID, &snippet.Title, &snippet.Content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%w: failed to scan snippet", ErrDatabaseError)
+		}
+		pending = append(pending, snippet)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("%w: failed to iterate snippets", ErrDatabaseError)
+	}
+
+	for i := range pending {
+		_, err := s.DB.ExecContext(ctx, "UPDATE snippets SET search_tokens = ? WHERE id = ? AND search_tokens IS NULL", snippetSearchTokens(&pending[i]), pending[i].ID)
+		if err != nil {
+			return i, fmt.Errorf("%w: failed to update search tokens", ErrDatabaseError)
+		}
+	}
+
+	return len(pending), nil
+}
+
+func (s *SQLiteStore) GetSnippetIDsByContent(ctx context.Context, userID int64, content string) ([]int64, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT id FROM snippets WHERE user_id = ? AND content_hash = ? AND deleted_at IS NULL ORDER BY id", userID, contentHash(content))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to find snippets with the same content", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%w: failed to scan snippet ID", ErrDatabaseError)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate snippet IDs", ErrDatabaseError)
+	}
+
+	return ids, nil
+}
+
+// sqliteCheckUniqueContent fails with a *DuplicateContentError when live
+// snippets of the user other than snippetID already hold content with hash.
+// Transactions begin immediate, so nothing else can write between the check
+// and the save that follows it.
+func sqliteCheckUniqueContent(ctx context.Context, tx *sql.Tx, userID, snippetID int64, hash string) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM snippets WHERE user_id = ? AND content_hash = ? AND id <> ? AND deleted_at IS NULL ORDER BY id", userID, hash, snippetID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to find snippets with the same content", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("%w: failed to scan snippet ID", ErrDatabaseError)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("%w: failed to iterate snippet IDs", ErrDatabaseError)
+	}
+
+	if len(ids) > 0 {
+		return &DuplicateContentError{IDs: ids}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) BackfillContentHashes(ctx context.Context, limit int) (int, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT id, content FROM snippets WHERE content_hash IS NULL ORDER BY id LIMIT ?", limit)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to get snippets to hash", ErrDatabaseError)
+	}
+
+	var pending []models.Snippet
+	for rows.Next() {
+		var snippet models.Snippet
+		if err := rows.Scan(&snippet.ID, &snippet.Content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%w: failed to scan snippet", ErrDatabaseError)
+		}
+		pending = append(pending, snippet)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("%w: failed to iterate snippets", ErrDatabaseError)
+	}
+
+	for i := range pending {
+		_, err := s.DB.ExecContext(ctx, "UPDATE snippets SET content_hash = ? WHERE id = ? AND content_hash IS NULL", contentHash(pending[i].Content), pending[i].ID)
+		if err != nil {
+			return i, fmt.Errorf("%w: failed to update content hash", ErrDatabaseError)
+		}
+	}
+
+	return len(pending), nil
+}
+
+func (s *SQLiteStore) WalkSnippets(ctx context.Context, userID int64, fn func(*models.Snippet) error) error {
+	query := `
+		SELECT id, user_id, folder_id, title, content, language
+		FROM snippets
+		WHERE user_id = ? AND id > ? AND deleted_at IS NULL
+		ORDER BY id
+		LIMIT ?`
+
+	var lastID int64
+	for {
+		rows, err := s.DB.QueryContext(ctx, query, userID, lastID, walkBatchSize)
+		if err != nil {
+			return fmt.Errorf("%w: failed to get snippets", ErrDatabaseError)
+		}
+
+		// The batch is read in full first, with a single connection the rest
+		// of the server waits while rows are open
+		var batch []models.Snippet
+		for rows.Next() {
+			var snippet models.Snippet
+			if err := rows.Scan(&snippet.ID, &snippet.UserID, &snippet.FolderID, &snippet.Title, &snippet.Content, &snippet.Language); err != nil {
+				rows.Close()
+				return fmt.Errorf("%w: failed to scan snippet", ErrDatabaseError)
+			}
+			batch = append(batch, snippet)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("%w: failed to iterate snippets", ErrDatabaseError)
+		}
+
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < walkBatchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// sqliteSuggestQuery is suggestQuery for SQLite. Its LIKE already ignores
+// ASCII case, and the NOCASE prefix indexes from 0008_suggest_indexes let it
+// answer each part with an index range scan. The %[1]s is the ESCAPE clause,
+// left out unless the prefix has wildcards to escape.
+const sqliteSuggestQuery = `
+	SELECT * FROM (
+		SELECT 'snippet' AS list,
+			ROW_NUMBER() OVER (ORDER BY is_favorite DESC, updated_at DESC, id DESC) AS position,
+			id, title AS value, 0 AS uses
+		FROM snippets
+		WHERE user_id = ?1 AND deleted_at IS NULL AND title LIKE ?2%[1]s
+		ORDER BY position
+		LIMIT ?3
+	) snippet_list
+	UNION ALL
+	SELECT * FROM (
+		SELECT 'tag', ROW_NUMBER() OVER (ORDER BY COUNT(s.id) DESC, COALESCE(MAX(s.updated_at), t.created_at) DESC, t.name),
+			t.id, t.name, COUNT(s.id)
+		FROM (
+			SELECT id, name, created_at
+			FROM tags
+			WHERE user_id = ?1 AND name LIKE ?2%[1]s
+			ORDER BY name COLLATE NOCASE, id
+			LIMIT ?4
+		) t
+		LEFT JOIN snippet_tags st ON st.tag_id = t.id
+		LEFT JOIN snippets s ON s.id = st.snippet_id AND s.deleted_at IS NULL
+		GROUP BY t.id, t.name, t.created_at
+		ORDER BY 2
+		LIMIT ?3
+	) tag_list
+	UNION ALL
+	SELECT * FROM (
+		SELECT 'folder', ROW_NUMBER() OVER (ORDER BY COUNT(s.id) DESC, COALESCE(MAX(s.updated_at), f.updated_at) DESC, f.name),
+			f.id, f.name, COUNT(s.id)
+		FROM (
+			SELECT id, name, updated_at
+			FROM folders
+			WHERE user_id = ?1 AND deleted_at IS NULL AND name LIKE ?2%[1]s
+			ORDER BY name COLLATE NOCASE, id
+			LIMIT ?4
+		) f
+		LEFT JOIN snippets s ON s.folder_id = f.id AND s.deleted_at IS NULL
+		GROUP BY f.id, f.name, f.updated_at
+		ORDER BY 2
+		LIMIT ?3
+	) folder_list
+	UNION ALL
+	SELECT * FROM (
+		SELECT 'language', ROW_NUMBER() OVER (ORDER BY COUNT(*) DESC, MAX(updated_at) DESC, language),
+			NULL, language, COUNT(*)
+		FROM snippets
+		WHERE user_id = ?1 AND deleted_at IS NULL AND language LIKE ?2%[1]s
+		GROUP BY language
+		ORDER BY 2
+		LIMIT ?3
+	) language_list
+	ORDER BY list, position`
+
+func (s *SQLiteStore) Suggest(ctx context.Context, userID int64, prefix string, limit int) (*models.Suggestions, error) {
+	pattern, escaped := likePrefixPattern(prefix)
+	escape := ""
+	if escaped {
+		escape = ` ESCAPE '\'`
+	}
+
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(sqliteSuggestQuery, escape), userID, pattern, limit, suggestCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get suggestions", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	suggestions := newSuggestions()
+	for rows.Next() {
+		var list string
+		var position int64
+		var suggestion models.Suggestion
+		if err := rows.Scan(&list, &position, &suggestion.ID, &suggestion.Value, &suggestion.Count); err != nil {
+			return nil, fmt.Errorf("%w: failed to scan suggestion", ErrDatabaseError)
+		}
+		addSuggestion(suggestions, list, suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate suggestions", ErrDatabaseError)
+	}
+
+	return suggestions, nil
+}
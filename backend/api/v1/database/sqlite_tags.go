@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *SQLiteStore) CreateTag(ctx context.Context, tag *models.Tag) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM tags WHERE user_id = ? AND name = ?", tag.UserID, tag.Name).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check for duplicate tag name", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("tag name already exists")
+	}
+
+	now := sqliteNow()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO tags (user_id, name, color, created_at)
+		VALUES (?, ?, ?, ?)`,
+		tag.UserID, tag.Name, tag.Color, now,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to insert tag", ErrDatabaseError)
+	}
+
+	tagID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%w: failed to get tag ID", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	tag.ID = tagID
+	tag.CreatedAt = now
+	tag.SnippetCount = 0
+
+	return nil
+}
+
+func (s *SQLiteStore) GetTag(ctx context.Context, tagID int64) (*models.Tag, error) {
+	query := `SELECT ` + tagColumns + `
+		FROM tags t
+		WHERE t.id = ?`
+
+	var tag models.Tag
+	err := s.DB.QueryRowContext(ctx, query, tagID).Scan(
+		&tag.ID,
+		&tag.UserID,
+		&tag.Name,
+		&tag.Color,
+		&tag.CreatedAt,
+		&tag.SnippetCount,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("tag with ID %d does not exist: %w", tagID, ErrNoTagError)
+		}
+		return nil, fmt.Errorf("%w: failed to get tag", ErrDatabaseError)
+	}
+
+	return &tag, nil
+}
+
+func (s *SQLiteStore) GetTags(ctx context.Context, userID int64) ([]models.Tag, error) {
+	query := `SELECT ` + tagColumns + `
+		FROM tags t
+		WHERE t.user_id = ?
+		ORDER BY t.name ASC`
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get tags", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var tag models.Tag
+
+		err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.SnippetCount)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan tag data", ErrDatabaseError)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate tags", ErrDatabaseError)
+	}
+
+	return tags, nil
+}
+
+func (s *SQLiteStore) UpdateTag(ctx context.Context, tagID int64, tag *models.Tag) (*models.Tag, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM tags WHERE id = ?", tagID).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("tag with ID %d does not exist: %w", tagID, ErrNoTagError)
+		}
+		return nil, fmt.Errorf("%w: failed to check tag existence", ErrDatabaseError)
+	}
+
+	resultID := tagID
+
+	var targetID int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE user_id = ? AND name = ? AND id <> ?", userID, tag.Name, tagID).Scan(&targetID)
+	switch {
+	case err == nil:
+		if err = sqliteMergeTag(ctx, tx, tagID, targetID, tag.Color); err != nil {
+			return nil, err
+		}
+		resultID = targetID
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.ExecContext(ctx, "UPDATE tags SET name = ?, color = ? WHERE id = ?", tag.Name, tag.Color, tagID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to update tag", ErrDatabaseError)
+		}
+	default:
+		return nil, fmt.Errorf("%w: failed to check for duplicate tag name", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return s.GetTag(ctx, resultID)
+}
+
+func (s *SQLiteStore) DeleteTag(ctx context.Context, tagID int64) error {
+	// snippet_tags rows go with it through ON DELETE CASCADE
+	result, err := s.DB.ExecContext(ctx, "DELETE FROM tags WHERE id = ?", tagID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete tag", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to check deleted tag", ErrDatabaseError)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("tag with ID %d does not exist: %w", tagID, ErrNoTagError)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) DeleteUnusedTags(ctx context.Context, userID int64) (int, error) {
+	result, err := s.DB.ExecContext(ctx, `
+		DELETE FROM tags
+		WHERE user_id = ?
+		  AND NOT EXISTS (SELECT 1 FROM snippet_tags st WHERE st.tag_id = tags.id)`,
+		userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to delete unused tags", ErrDatabaseError)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to count deleted tags", ErrDatabaseError)
+	}
+
+	return int(deleted), nil
+}
+
+func (s *SQLiteStore) GetSnippetTags(ctx context.Context, snippetID int64) ([]string, error) {
+	return sqliteGetSnippetTags(ctx, s.DB, snippetID)
+}
+
+// sqliteMergeTag moves every snippet from tagID onto targetID and deletes tagID
+func sqliteMergeTag(ctx context.Context, tx *sql.Tx, tagID, targetID int64, color *string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO snippet_tags (snippet_id, tag_id)
+		SELECT snippet_id, ? FROM snippet_tags WHERE tag_id = ?
+		ON CONFLICT DO NOTHING`,
+		targetID, tagID,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to move snippets to merged tag", ErrDatabaseError)
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM tags WHERE id = ?", tagID); err != nil {
+		return fmt.Errorf("%w: failed to delete merged tag", ErrDatabaseError)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE tags SET color = COALESCE(color, ?) WHERE id = ?", color, targetID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update merged tag", ErrDatabaseError)
+	}
+
+	return nil
+}
@@ -0,0 +1,503 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *SQLiteStore) GetTrash(ctx context.Context, page, limit int, userID int64, itemType string) ([]models.TrashItem, int, error) {
+	offset := (page - 1) * limit
+
+	var parts []string
+	var args []interface{}
+	if itemType == "" || itemType == models.TrashTypeSnippet {
+		parts = append(parts, `
+			SELECT 'snippet' AS item_type, id, title AS name, folder_id AS parent_id, trash_path, deleted_at
+			FROM snippets WHERE user_id = ? AND deleted_at IS NOT NULL`)
+		args = append(args, userID)
+	}
+	if itemType == "" || itemType == models.TrashTypeFolder {
+		parts = append(parts, `
+			SELECT 'folder' AS item_type, id, name, parent_id, trash_path, deleted_at
+			FROM folders WHERE user_id = ? AND deleted_at IS NOT NULL`)
+		args = append(args, userID)
+	}
+	trash := strings.Join(parts, " UNION ALL ")
+
+	var total int
+	err := s.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM (%s) trash", trash), args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to get trash count", ErrDatabaseError)
+	}
+
+	dataQuery := fmt.Sprintf(`
+		SELECT item_type, id, name, parent_id, trash_path, deleted_at
+		FROM (%s) trash
+		ORDER BY deleted_at DESC, id DESC
+		LIMIT ? OFFSET ?`, trash)
+
+	rows, err := s.DB.QueryContext(ctx, dataQuery, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to get trash", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var items []models.TrashItem
+	for rows.Next() {
+		var item models.TrashItem
+		var path sql.NullString
+		err := rows.Scan(&item.Type, &item.ID, &item.Name, &item.ParentID, &path, &item.DeletedAt)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: failed to scan trash item", ErrDatabaseError)
+		}
+
+		item.Path, err = sqliteDecodeTrashPath(path)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to iterate trash", ErrDatabaseError)
+	}
+
+	return items, total, nil
+}
+
+func (s *SQLiteStore) GetTrashedSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error) {
+	return s.getSnippet(ctx, snippetID, "deleted_at IS NOT NULL")
+}
+
+func (s *SQLiteStore) GetTrashedFolder(ctx context.Context, folderID int64) (*models.Folder, error) {
+	return s.getFolder(ctx, folderID, "deleted_at IS NOT NULL")
+}
+
+// RestoreSnippet takes a snippet out of the trash, bringing back or
+// re-creating the folders it was in
+func (s *SQLiteStore) RestoreSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	var folderID *int64
+	var encodedPath sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT user_id, folder_id, trash_path FROM snippets WHERE id = ? AND deleted_at IS NOT NULL", snippetID).Scan(&userID, &folderID, &encodedPath)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("snippet with ID %d is not in the trash: %w", snippetID, ErrNoSnippetError)
+		}
+		return nil, fmt.Errorf("%w: failed to check snippet existence", ErrDatabaseError)
+	}
+
+	path, err := sqliteDecodeTrashPath(encodedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	now := sqliteNow()
+
+	folderID, err = sqliteRestoreFolderChain(ctx, tx, userID, folderID, path, now, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE snippets
+		SET deleted_at = NULL, trash_path = NULL, folder_id = ?, updated_at = ?
+		WHERE id = ?`,
+		folderID, now, snippetID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to restore snippet", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%w: failed to commit restore", ErrDatabaseError)
+	}
+
+	return s.GetSnippet(ctx, snippetID)
+}
+
+// RestoreFolder takes a folder out of the trash, bringing back or re-creating
+// its parents. It fails if a live folder has taken its name in the meantime.
+func (s *SQLiteStore) RestoreFolder(ctx context.Context, folderID int64) (*models.Folder, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	var name string
+	var parentID *int64
+	var encodedPath sql.NullString
+	var deletedAt string
+	err = tx.QueryRowContext(ctx, "SELECT user_id, name, parent_id, trash_path, CAST(deleted_at AS TEXT) FROM folders WHERE id = ? AND deleted_at IS NOT NULL", folderID).Scan(&userID, &name, &parentID, &encodedPath, &deletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("folder with ID %d is not in the trash: %w", folderID, ErrNoFolderError)
+		}
+		return nil, fmt.Errorf("%w: failed to check folder existence", ErrDatabaseError)
+	}
+
+	path, err := sqliteDecodeTrashPath(encodedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	now := sqliteNow()
+
+	parentID, err = sqliteRestoreFolderChain(ctx, tx, userID, parentID, path, now, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	existingID, err := sqliteFindLiveFolder(ctx, tx, userID, name, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if existingID != 0 {
+		return nil, fmt.Errorf("folder name already exists in this location")
+	}
+
+	err = sqliteRestoreFolderContents(ctx, tx, userID, folderID, deletedAt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE folders
+		SET deleted_at = NULL, trash_path = NULL, parent_id = ?, updated_at = ?
+		WHERE id = ?`,
+		parentID, now, folderID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to restore folder", ErrDatabaseError)
+	}
+
+	if err = sqliteSetFolderPath(ctx, tx, folderID, parentID); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%w: failed to commit restore", ErrDatabaseError)
+	}
+
+	return s.GetFolder(ctx, folderID)
+}
+
+func (s *SQLiteStore) PurgeSnippet(ctx context.Context, snippetID int64) error {
+	result, err := s.DB.ExecContext(ctx, "DELETE FROM snippets WHERE id = ? AND deleted_at IS NOT NULL", snippetID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to purge snippet", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to purge snippet", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("snippet with ID %d is not in the trash: %w", snippetID, ErrNoSnippetError)
+	}
+
+	return nil
+}
+
+// PurgeFolder permanently deletes a trashed folder. Anything still pointing at
+// it falls back to its recorded trash_path when restored.
+func (s *SQLiteStore) PurgeFolder(ctx context.Context, folderID int64) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM folders WHERE id = ? AND deleted_at IS NOT NULL)", folderID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check folder existence", ErrDatabaseError)
+	}
+
+	if !exists {
+		return fmt.Errorf("folder with ID %d is not in the trash: %w", folderID, ErrNoFolderError)
+	}
+
+	if err = sqliteDetachFolderPaths(ctx, tx, folderID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM folders WHERE id = ?", folderID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to purge folder", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit purge", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+// EmptyTrash purges everything in a user's trash and returns how many items were removed
+func (s *SQLiteStore) EmptyTrash(ctx context.Context, userID int64) (int, error) {
+	return s.purgeTrashWhere(ctx, "user_id = ?", userID)
+}
+
+// PurgeTrash purges every item trashed before the cutoff, across all users
+func (s *SQLiteStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	return s.purgeTrashWhere(ctx, "deleted_at < ?", before.UTC())
+}
+
+func (s *SQLiteStore) purgeTrashWhere(ctx context.Context, condition string, arg interface{}) (int, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	folderIDs, err := sqliteQueryIDs(ctx, tx, "SELECT id FROM folders WHERE deleted_at IS NOT NULL AND "+condition, arg)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to get folders to purge", ErrDatabaseError)
+	}
+
+	for _, folderID := range folderIDs {
+		if err = sqliteDetachFolderPaths(ctx, tx, folderID); err != nil {
+			return 0, err
+		}
+	}
+
+	var purged int64
+	for _, table := range []string{"snippets", "folders"} {
+		result, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE deleted_at IS NOT NULL AND "+condition, arg)
+		if err != nil {
+			return 0, fmt.Errorf("%w: failed to purge %s", ErrDatabaseError, table)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("%w: failed to purge %s", ErrDatabaseError, table)
+		}
+		purged += rowsAffected
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%w: failed to commit purge", ErrDatabaseError)
+	}
+
+	return int(purged), nil
+}
+
+// sqliteTrashPath returns the names of folderID and its ancestors, root first,
+// encoded as the JSON array stored in trash_path
+func sqliteTrashPath(ctx context.Context, tx *sql.Tx, folderID *int64) (string, error) {
+	if folderID == nil {
+		return "[]", nil
+	}
+
+	var path string
+	err := tx.QueryRowContext(ctx, `
+		WITH RECURSIVE chain(id, parent_id, name, depth) AS (
+			SELECT id, parent_id, name, 0 FROM folders WHERE id = ?
+			UNION ALL
+			SELECT f.id, f.parent_id, f.name, c.depth + 1
+			FROM folders f
+			JOIN chain c ON f.id = c.parent_id
+			WHERE c.depth < 50
+		)
+		SELECT json_group_array(name) FROM (SELECT name FROM chain ORDER BY depth DESC)`, *folderID).Scan(&path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read folder path: %w", err)
+	}
+
+	return path, nil
+}
+
+func sqliteDecodeTrashPath(encoded sql.NullString) ([]string, error) {
+	path := []string{}
+	if !encoded.Valid {
+		return path, nil
+	}
+
+	if err := json.Unmarshal([]byte(encoded.String), &path); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode trash path", ErrDatabaseError)
+	}
+
+	return path, nil
+}
+
+// sqliteRestoreFolderContents restores the folders and snippets below folderID
+// that were trashed at the same time as it, i.e. by a cascading delete. Only
+// userID's snippets are restored. A subfolder whose name a live folder has
+// taken comes back as "name (2)" and so on, like a reparented one.
+func sqliteRestoreFolderContents(ctx context.Context, tx *sql.Tx, userID, folderID int64, deletedAt string, now time.Time) error {
+	folderIDs, err := sqliteQueryIDs(ctx, tx, `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT id FROM folders WHERE id = ?
+			UNION ALL
+			SELECT f.id FROM folders f
+			JOIN subtree s ON f.parent_id = s.id
+			WHERE f.deleted_at = ?
+		)
+		SELECT id FROM subtree`, folderID, deletedAt)
+	if err != nil {
+		return fmt.Errorf("%w: failed to get folder tree", ErrDatabaseError)
+	}
+
+	for _, id := range folderIDs {
+		_, err = tx.ExecContext(ctx, "UPDATE snippets SET deleted_at = NULL, trash_path = NULL, updated_at = ? WHERE folder_id = ? AND user_id = ? AND deleted_at = ?", now, id, userID, deletedAt)
+		if err != nil {
+			return fmt.Errorf("%w: failed to restore snippets in folder", ErrDatabaseError)
+		}
+
+		if id == folderID {
+			continue
+		}
+
+		var folderName string
+		var parentID *int64
+		err = tx.QueryRowContext(ctx, "SELECT name, parent_id FROM folders WHERE id = ?", id).Scan(&folderName, &parentID)
+		if err != nil {
+			return fmt.Errorf("%w: failed to get subfolder", ErrDatabaseError)
+		}
+
+		name := folderName
+		for n := 2; ; n++ {
+			existingID, err := sqliteFindLiveFolder(ctx, tx, userID, name, parentID)
+			if err != nil {
+				return err
+			}
+			if existingID == 0 {
+				break
+			}
+			name = folderCopyName(folderName, n)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE folders SET deleted_at = NULL, trash_path = NULL, name = ?, updated_at = ? WHERE id = ?", name, now, id)
+		if err != nil {
+			return fmt.Errorf("%w: failed to restore subfolders", ErrDatabaseError)
+		}
+	}
+
+	return nil
+}
+
+// sqliteRestoreFolderChain makes sure the folder a restored item goes back
+// into is live and returns its ID. A trashed parent is restored along with its
+// own parents, unless a live folder has taken its name, in which case the item
+// joins that folder instead. A purged parent is re-created from path.
+func sqliteRestoreFolderChain(ctx context.Context, tx *sql.Tx, userID int64, folderID *int64, path []string, now time.Time, depth int) (*int64, error) {
+	// Prevent infinite recursion
+	if depth > 50 {
+		return nil, fmt.Errorf("maximum folder depth exceeded")
+	}
+
+	if folderID != nil {
+		var name string
+		var parentID *int64
+		var deletedAt *time.Time
+		var encodedPath sql.NullString
+		err := tx.QueryRowContext(ctx, "SELECT name, parent_id, deleted_at, trash_path FROM folders WHERE id = ?", *folderID).Scan(&name, &parentID, &deletedAt, &encodedPath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to check parent folder", ErrDatabaseError)
+		}
+
+		if deletedAt == nil {
+			return folderID, nil
+		}
+
+		parentPath, err := sqliteDecodeTrashPath(encodedPath)
+		if err != nil {
+			return nil, err
+		}
+
+		parentID, err = sqliteRestoreFolderChain(ctx, tx, userID, parentID, parentPath, now, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		existingID, err := sqliteFindLiveFolder(ctx, tx, userID, name, parentID)
+		if err != nil {
+			return nil, err
+		}
+		if existingID != 0 {
+			return &existingID, nil
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE folders
+			SET deleted_at = NULL, trash_path = NULL, parent_id = ?, updated_at = ?
+			WHERE id = ?`,
+			parentID, now, *folderID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to restore parent folder", ErrDatabaseError)
+		}
+
+		if err = sqliteSetFolderPath(ctx, tx, *folderID, parentID); err != nil {
+			return nil, err
+		}
+
+		return folderID, nil
+	}
+
+	var parentID *int64
+	for _, name := range path {
+		id, err := sqliteFindLiveFolder(ctx, tx, userID, name, parentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if id == 0 {
+			result, err := tx.ExecContext(ctx, `
+				INSERT INTO folders (user_id, name, parent_id, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?)`,
+				userID, name, parentID, now, now,
+			)
+			if err == nil {
+				id, err = result.LastInsertId()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: failed to re-create folder", ErrDatabaseError)
+			}
+
+			if err = sqliteSetFolderPath(ctx, tx, id, parentID); err != nil {
+				return nil, err
+			}
+		}
+
+		parentID = &id
+	}
+
+	return parentID, nil
+}
+
+// sqliteFindLiveFolder returns the ID of the user's live folder with this name
+// and parent, or 0 if there is none
+func sqliteFindLiveFolder(ctx context.Context, tx *sql.Tx, userID int64, name string, parentID *int64) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM folders
+		WHERE user_id = ? AND name = ? AND parent_id IS ? AND deleted_at IS NULL`,
+		userID, name, parentID,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%w: failed to check for existing folder", ErrDatabaseError)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *SQLiteStore) GetTwoFactor(ctx context.Context, userID int64) (*models.TwoFactor, error) {
+	twoFactor := models.TwoFactor{UserID: userID}
+	err := s.DB.QueryRowContext(ctx, "SELECT secret, enabled_at, last_step, failed_attempts, locked_at FROM two_factor WHERE user_id = ?", userID).Scan(
+		&twoFactor.Secret,
+		&twoFactor.EnabledAt,
+		&twoFactor.LastStep,
+		&twoFactor.FailedAttempts,
+		&twoFactor.LockedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoTwoFactorError
+		}
+		return nil, fmt.Errorf("%w: failed to get two-factor settings", ErrDatabaseError)
+	}
+
+	return &twoFactor, nil
+}
+
+func (s *SQLiteStore) SetTwoFactorSecret(ctx context.Context, userID int64, secret string) error {
+	result, err := s.DB.ExecContext(ctx, `
+		INSERT INTO two_factor (user_id, secret, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, failed_attempts = 0, locked_at = NULL, created_at = EXCLUDED.created_at
+		WHERE two_factor.enabled_at IS NULL`,
+		userID, secret, sqliteNow(),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to save two-factor secret", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to save two-factor secret", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorEnabledError
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) EnableTwoFactor(ctx context.Context, userID, step int64, codeHashes []string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE two_factor SET enabled_at = ?, last_step = ?
+		WHERE user_id = ? AND enabled_at IS NULL`,
+		sqliteNow(), step, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to enable two-factor", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to enable two-factor", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return ErrNoTwoFactorError
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%w: failed to replace recovery codes", ErrDatabaseError)
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, codeHash)
+		if err != nil {
+			return fmt.Errorf("%w: failed to insert recovery code", ErrDatabaseError)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) UseTwoFactorStep(ctx context.Context, userID, step int64) error {
+	result, err := s.DB.ExecContext(ctx, `
+		UPDATE two_factor SET last_step = ?
+		WHERE user_id = ? AND enabled_at IS NOT NULL AND last_step < ?`,
+		step, userID, step,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to record two-factor code", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to record two-factor code", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorCodeUsedError
+	}
+
+	return nil
+}
+
+// RecordTwoFactorFailure counts a wrong code. The maxAttempts-th in a row
+// locks code entry and starts counting again, the time of the lock is
+// returned when that happens.
+func (s *SQLiteStore) RecordTwoFactorFailure(ctx context.Context, userID int64, maxAttempts int) (*time.Time, error) {
+	var failedAttempts int
+	var lockedAt *time.Time
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE two_factor SET
+			failed_attempts = CASE WHEN failed_attempts + 1 >= ? THEN 0 ELSE failed_attempts + 1 END,
+			locked_at = CASE WHEN failed_attempts + 1 >= ? THEN ? ELSE locked_at END
+		WHERE user_id = ?
+		RETURNING failed_attempts, locked_at`,
+		maxAttempts, maxAttempts, sqliteNow(), userID,
+	).Scan(&failedAttempts, &lockedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoTwoFactorError
+		}
+		return nil, fmt.Errorf("%w: failed to record two-factor failure", ErrDatabaseError)
+	}
+
+	// The count only goes back to zero when this failure set the lock
+	if failedAttempts > 0 || lockedAt == nil {
+		return nil, nil
+	}
+	utc := lockedAt.UTC()
+	return &utc, nil
+}
+
+// ResetTwoFactorFailures forgets the wrong codes before a right one
+func (s *SQLiteStore) ResetTwoFactorFailures(ctx context.Context, userID int64) error {
+	_, err := s.DB.ExecContext(ctx, "UPDATE two_factor SET failed_attempts = 0 WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to reset two-factor failures", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	result, err := s.DB.ExecContext(ctx, `
+		UPDATE recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		sqliteNow(), userID, codeHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to use recovery code", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to use recovery code", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecoveryCodeError
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := s.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to count recovery codes", ErrDatabaseError)
+	}
+
+	return count, nil
+}
+
+func (s *SQLiteStore) DisableTwoFactor(ctx context.Context, userID int64) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM two_factor WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to disable two-factor", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to disable two-factor", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return ErrNoTwoFactorError
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%w: failed to delete recovery codes", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return nil
+}
@@ -0,0 +1,320 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func (s *SQLiteStore) CreateUser(ctx context.Context, user *models.User) error {
+	created := &UserWithPassword{User: *user}
+	if err := s.CreateUserWithPassword(ctx, created); err != nil {
+		return err
+	}
+
+	*user = created.User
+	return nil
+}
+
+func (s *SQLiteStore) GetUser(ctx context.Context, userID int64, user *models.User) error {
+	selectQuery := `
+		SELECT id, username, created_at, updated_at, token_generation
+		FROM users WHERE id = ?`
+
+	err := s.DB.QueryRowContext(ctx, selectQuery, userID).Scan(
+		&user.ID,
+		&user.Username,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.TokenGeneration,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoUserError
+		}
+		fmt.Printf("Database error retrieving user ID %d: %v\n", userID, err)
+		return fmt.Errorf("%w: failed to retrieve user", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) GetUsers(ctx context.Context, page, limit int, search string) ([]models.User, int, error) {
+	offset := (page - 1) * limit
+	args := []interface{}{}
+	whereClause := ""
+
+	if search != "" {
+		// LIKE is already case-insensitive for ASCII in SQLite, like ILIKE
+		whereClause = "WHERE username LIKE ?"
+		args = append(args, "%"+search+"%")
+	}
+
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM users %s", whereClause)
+	var total int
+	err := s.DB.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+	if err != nil {
+		fmt.Printf("Database error getting user count: %v\n", err)
+		return nil, 0, fmt.Errorf("%w: failed to get user count", ErrDatabaseError)
+	}
+
+	dataQuery := fmt.Sprintf(`
+		SELECT id, username, created_at, updated_at
+		FROM users
+		%s
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?`, whereClause)
+
+	args = append(args, limit, offset)
+
+	rows, err := s.DB.QueryContext(ctx, dataQuery, args...)
+	if err != nil {
+		fmt.Printf("Database error getting users: %v\n", err)
+		return nil, 0, fmt.Errorf("%w: failed to get users", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(&user.ID, &user.Username, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			fmt.Printf("Database error scanning user row: %v\n", err)
+			return nil, 0, fmt.Errorf("%w: failed to scan user data", ErrDatabaseError)
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		fmt.Printf("Database error iterating users: %v\n", err)
+		return nil, 0, fmt.Errorf("%w: failed to iterate users", ErrDatabaseError)
+	}
+
+	return users, total, nil
+}
+
+func (s *SQLiteStore) DeleteUser(ctx context.Context, userID int64) error {
+	result, err := s.DB.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userID)
+	if err != nil {
+		fmt.Printf("Database error deleting user ID %d: %v\n", userID, err)
+		return fmt.Errorf("%w: failed to delete user", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete user", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %d does not exist: %w", userID, ErrNoUserError)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) UpdateUser(ctx context.Context, userID int64, user *models.User) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var currentUser models.User
+	err = tx.QueryRowContext(ctx, "SELECT id, username, created_at FROM users WHERE id = ?", userID).Scan(
+		&currentUser.ID,
+		&currentUser.Username,
+		&currentUser.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("user with ID %d does not exist: %w", userID, ErrNoUserError)
+		}
+		fmt.Printf("Database error retrieving user for update: %v\n", err)
+		return fmt.Errorf("%w: failed to retrieve user for update", ErrDatabaseError)
+	}
+
+	if user.Username != currentUser.Username {
+		var count int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = ? AND id != ?", user.Username, userID).Scan(&count)
+		if err != nil {
+			fmt.Printf("Database error checking username availability: %v\n", err)
+			return fmt.Errorf("%w: failed to check username availability", ErrDatabaseError)
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: username '%s' already exists", ErrUsernameExists, user.Username)
+		}
+	}
+
+	now := sqliteNow()
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET username = ?, updated_at = ? WHERE id = ?", user.Username, now, userID)
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return fmt.Errorf("%w: username became unavailable", ErrUsernameExists)
+		}
+		fmt.Printf("Database error updating user: %v\n", err)
+		return fmt.Errorf("%w: failed to update user", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return fmt.Errorf("%w: failed to commit update", ErrDatabaseError)
+	}
+
+	user.ID = userID
+	user.CreatedAt = currentUser.CreatedAt
+	user.UpdatedAt = now
+
+	return nil
+}
+
+func (s *SQLiteStore) CreateUserWithPassword(ctx context.Context, user *UserWithPassword) error {
+	// Check if username exists first
+	var count int
+	err := s.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = ?", user.Username).Scan(&count)
+	if err != nil {
+		fmt.Printf("Database error during username check: %v\n", err)
+		return fmt.Errorf("%w: failed to check username availability", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("%w: username '%s' is already taken", ErrUsernameExists, user.Username)
+	}
+
+	// Users created without a password (CreateUser) keep password_hash NULL
+	var password *string
+	if user.Password != "" {
+		password = &user.Password
+	}
+
+	now := sqliteNow()
+
+	result, err := s.DB.ExecContext(ctx, `
+		INSERT INTO users (username, password_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?)`,
+		user.Username, password, now, now,
+	)
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return fmt.Errorf("%w: username became unavailable", ErrUsernameExists)
+		}
+		fmt.Printf("Database error during user creation: %v\n", err)
+		return fmt.Errorf("%w: failed to create user", ErrDatabaseError)
+	}
+
+	user.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("%w: failed to create user", ErrDatabaseError)
+	}
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	return nil
+}
+
+func (s *SQLiteStore) GetUserByUsername(ctx context.Context, username string) (*UserWithPassword, error) {
+	selectQuery := `
+		SELECT id, username, coalesce(password_hash, ''), created_at, updated_at, token_generation
+		FROM users WHERE username = ?`
+
+	var user UserWithPassword
+	err := s.DB.QueryRowContext(ctx, selectQuery, username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Password,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.TokenGeneration,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user not found")
+		}
+		fmt.Printf("Database error retrieving user by username: %v\n", err)
+		return nil, fmt.Errorf("%w: failed to retrieve user", ErrDatabaseError)
+	}
+
+	return &user, nil
+}
+
+func (s *SQLiteStore) UpdateUserPassword(ctx context.Context, userID int64, hashedPassword string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET password_hash = ?, updated_at = ?
+		WHERE id = ?`,
+		hashedPassword, sqliteNow(), userID,
+	)
+	if err != nil {
+		fmt.Printf("Database error updating password for user ID %d: %v\n", userID, err)
+		return fmt.Errorf("%w: failed to update password", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to update password", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %d does not exist: %w", userID, ErrNoUserError)
+	}
+
+	if err = sqliteRevokeUserTokens(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) RevokeUserTokens(ctx context.Context, userID int64) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback()
+
+	if err = sqliteRevokeUserTokens(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+// sqliteRevokeUserTokens bumps the user's token generation and revokes their
+// sessions inside tx
+func sqliteRevokeUserTokens(ctx context.Context, tx *sql.Tx, userID int64) error {
+	result, err := tx.ExecContext(ctx, "UPDATE users SET token_generation = token_generation + 1 WHERE id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to revoke tokens", ErrDatabaseError)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: failed to revoke tokens", ErrDatabaseError)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %d does not exist: %w", userID, ErrNoUserError)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", sqliteNow(), userID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to revoke sessions", ErrDatabaseError)
+	}
+
+	return nil
+}
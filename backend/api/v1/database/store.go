@@ -0,0 +1,290 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// Sort fields and directions accepted by SnippetFilter
+const (
+	SnippetSortTitle     = "title"
+	SnippetSortCreatedAt = "created_at"
+	SnippetSortUpdatedAt = "updated_at"
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// Search modes accepted by SnippetFilter
+const (
+	// SearchModeFullText matches stemmed words through the full-text index
+	SearchModeFullText = "fulltext"
+	// SearchModeSubstring matches the exact text anywhere in the title or
+	// content, which suits code fragments such as ctx.Done()
+	SearchModeSubstring = "substring"
+	// SearchModeHybrid matches either way and ranks by both, the default
+	SearchModeHybrid = "hybrid"
+)
+
+// Facets GetSnippetFacets can count
+const (
+	FacetLanguage = "language"
+	FacetTag      = "tag"
+	FacetFolder   = "folder"
+)
+
+// SnippetFilter narrows the snippets returned by GetSnippets
+type SnippetFilter struct {
+	Search string
+	// SearchMode is one of the SearchMode values, empty for hybrid
+	SearchMode string
+	// FolderID limits results to one folder, Recursive widens that to every
+	// folder below it too
+	FolderID  *int64
+	Recursive bool
+	Language  string
+	// Tags keeps snippets carrying any of the tags, or all of them when
+	// MatchAllTags is set. Tag names match case-insensitively.
+	Tags         []string
+	MatchAllTags bool
+	IsFavorite   *bool
+	// Date ranges include the After bound and exclude the Before bound
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	// Sort is one of the SnippetSort fields. Left empty, search results come
+	// by relevance and everything else newest first. Order defaults to asc
+	// for title and desc for the dates.
+	Sort  string
+	Order string
+}
+
+// SnippetStore persists snippets along with their tag associations
+type SnippetStore interface {
+	CreateSnippet(ctx context.Context, snippet *models.Snippet) error
+	// CreateUniqueSnippet is CreateSnippet, but fails with a
+	// *DuplicateContentError when another of the user's live snippets holds
+	// the same content once normalized. The check and the insert are atomic.
+	CreateUniqueSnippet(ctx context.Context, snippet *models.Snippet) error
+	GetSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error)
+	GetSnippets(ctx context.Context, page, limit int, userID int64, filter SnippetFilter) ([]models.Snippet, int, error)
+	UpdateSnippet(ctx context.Context, snippetID int64, snippet *models.Snippet) error
+	// UpdateUniqueSnippet is UpdateSnippet with the check of
+	// CreateUniqueSnippet, made only when the content changes
+	UpdateUniqueSnippet(ctx context.Context, snippetID int64, snippet *models.Snippet) error
+	DeleteSnippet(ctx context.Context, snippetID int64) error
+	// GetSnippetFacets counts the snippets matching filter by each of the
+	// requested facets, over every match rather than one page
+	GetSnippetFacets(ctx context.Context, userID int64, filter SnippetFilter, facets []string) (models.SnippetFacets, error)
+	// CountSnippets counts the snippets matching each of filters, in the
+	// same order, without loading any of them
+	CountSnippets(ctx context.Context, userID int64, filters []SnippetFilter) ([]int, error)
+	// BackfillSearchTokens computes the identifier tokens of up to limit
+	// snippets saved before they existed and returns how many it updated
+	BackfillSearchTokens(ctx context.Context, limit int) (int, error)
+	// GetSnippetIDsByContent returns the user's live snippets whose content
+	// matches content once normalized, oldest first
+	GetSnippetIDsByContent(ctx context.Context, userID int64, content string) ([]int64, error)
+	// BackfillContentHashes hashes the content of up to limit snippets saved
+	// before content hashes existed and returns how many it updated
+	BackfillContentHashes(ctx context.Context, limit int) (int, error)
+	// WalkSnippets calls fn with each of the user's live snippets in ID order,
+	// loading them a batch at a time so the whole library is never in memory.
+	// Tags are not loaded. An error from fn stops the walk and is returned.
+	WalkSnippets(ctx context.Context, userID int64, fn func(*models.Snippet) error) error
+	// BackfillMinHashes stores the MinHash signature and band keys of up to
+	// limit snippets saved before signatures were stored and returns how many
+	// it updated
+	BackfillMinHashes(ctx context.Context, limit int) (int, error)
+	// GetSimilarityCandidates returns the user's live snippets other than
+	// exceptID that share any of bandKeys, along with any not yet signed, in
+	// ID order
+	GetSimilarityCandidates(ctx context.Context, userID, exceptID int64, bandKeys []int64) ([]SnippetSignature, error)
+	// WalkSnippetSignatures calls fn with the stored signature of each of the
+	// user's live snippets in ID order, a batch at a time like WalkSnippets
+	WalkSnippetSignatures(ctx context.Context, userID int64, fn func(*SnippetSignature) error) error
+}
+
+// FolderStore persists the folder hierarchy
+type FolderStore interface {
+	CreateFolder(ctx context.Context, folder *models.Folder) error
+	GetFolder(ctx context.Context, folderID int64) (*models.Folder, error)
+	GetFolders(ctx context.Context, page, limit int, userID int64, parentID *int64) ([]models.Folder, int, error)
+	GetFolderTree(ctx context.Context, userID int64) ([]*models.FolderNode, error)
+	GetFolderPath(ctx context.Context, folderID int64) ([]models.Folder, error)
+	UpdateFolder(ctx context.Context, folderID int64, folder *models.Folder) error
+	DeleteFolder(ctx context.Context, folderID int64, mode string) (*models.FolderDeleteResult, error)
+}
+
+// UserStore persists user accounts and their credentials
+type UserStore interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, userID int64, user *models.User) error
+	GetUsers(ctx context.Context, page, limit int, search string) ([]models.User, int, error)
+	UpdateUser(ctx context.Context, userID int64, user *models.User) error
+	DeleteUser(ctx context.Context, userID int64) error
+	CreateUserWithPassword(ctx context.Context, user *UserWithPassword) error
+	GetUserByUsername(ctx context.Context, username string) (*UserWithPassword, error)
+	// UpdateUserPassword sets a new password and revokes every token issued
+	// to the user, as RevokeUserTokens does
+	UpdateUserPassword(ctx context.Context, userID int64, hashedPassword string) error
+	// RevokeUserTokens bumps the user's token generation so that every access
+	// token issued so far stops working, and revokes all of their sessions
+	RevokeUserTokens(ctx context.Context, userID int64) error
+}
+
+// TagStore manages the per-user tags that snippets are labelled with
+type TagStore interface {
+	CreateTag(ctx context.Context, tag *models.Tag) error
+	GetTag(ctx context.Context, tagID int64) (*models.Tag, error)
+	GetTags(ctx context.Context, userID int64) ([]models.Tag, error)
+	// UpdateTag renames and recolors a tag. Renaming onto another tag of the
+	// same user merges the two, and the surviving tag is returned.
+	UpdateTag(ctx context.Context, tagID int64, tag *models.Tag) (*models.Tag, error)
+	DeleteTag(ctx context.Context, tagID int64) error
+	// DeleteUnusedTags removes the user's tags that no snippet carries,
+	// including snippets in the trash
+	DeleteUnusedTags(ctx context.Context, userID int64) (int, error)
+	GetSnippetTags(ctx context.Context, snippetID int64) ([]string, error)
+}
+
+// RevisionStore reads the history recorded every time a snippet is saved
+type RevisionStore interface {
+	GetSnippetRevisions(ctx context.Context, snippetID int64, page, limit int) ([]models.SnippetRevision, int, error)
+	GetSnippetRevision(ctx context.Context, snippetID int64, revision int) (*models.SnippetRevision, error)
+}
+
+// TrashStore manages soft-deleted snippets and folders. Trashed items are
+// invisible to the other stores until they are restored.
+type TrashStore interface {
+	GetTrash(ctx context.Context, page, limit int, userID int64, itemType string) ([]models.TrashItem, int, error)
+	GetTrashedSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error)
+	GetTrashedFolder(ctx context.Context, folderID int64) (*models.Folder, error)
+	RestoreSnippet(ctx context.Context, snippetID int64) (*models.Snippet, error)
+	RestoreFolder(ctx context.Context, folderID int64) (*models.Folder, error)
+	PurgeSnippet(ctx context.Context, snippetID int64) error
+	PurgeFolder(ctx context.Context, folderID int64) error
+	EmptyTrash(ctx context.Context, userID int64) (int, error)
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+}
+
+// SavedSearchStore persists the named searches listed as virtual folders
+type SavedSearchStore interface {
+	CreateSavedSearch(ctx context.Context, search *models.SavedSearch) error
+	GetSavedSearch(ctx context.Context, searchID int64) (*models.SavedSearch, error)
+	GetSavedSearches(ctx context.Context, userID int64) ([]models.SavedSearch, error)
+	UpdateSavedSearch(ctx context.Context, searchID int64, search *models.SavedSearch) error
+	DeleteSavedSearch(ctx context.Context, searchID int64) error
+}
+
+// SuggestStore answers typeahead completions
+type SuggestStore interface {
+	// Suggest returns up to limit snippet titles, tag names, folder names and
+	// languages of the user's starting with prefix, ignoring case. Snippets
+	// come favorites first and then most recently updated, the others by how
+	// many snippets use them and then how recently.
+	Suggest(ctx context.Context, userID int64, prefix string, limit int) (*models.Suggestions, error)
+}
+
+// SessionStore persists signed in sessions. Only hashes of their refresh
+// tokens are stored.
+type SessionStore interface {
+	// CreateSession starts a session for the refresh token with tokenHash
+	CreateSession(ctx context.Context, session *models.Session, tokenHash string) error
+	// GetSession returns a live session, or ErrNoSessionError once it has
+	// been revoked or has expired
+	GetSession(ctx context.Context, sessionID int64) (*models.Session, error)
+	// GetSessionByToken returns the live session whose current refresh token
+	// has tokenHash
+	GetSessionByToken(ctx context.Context, tokenHash string) (*models.Session, error)
+	// GetSessions returns the user's live sessions, most recently used first
+	GetSessions(ctx context.Context, userID int64) ([]models.Session, error)
+	// RotateSession replaces the refresh token with tokenHash by newTokenHash
+	// and extends the session to expiresAt. A token replaced less than
+	// refreshReuseGrace ago gets newTokenHash alongside its replacement;
+	// presenting one replaced before that revokes the whole session and
+	// returns ErrSessionReuseError.
+	RotateSession(ctx context.Context, tokenHash, newTokenHash, ipAddress string, expiresAt time.Time) (*models.Session, error)
+	RevokeSession(ctx context.Context, sessionID int64) error
+	// RevokeUserSessions revokes every session of the user but exceptID and
+	// returns how many it revoked
+	RevokeUserSessions(ctx context.Context, userID, exceptID int64) (int, error)
+	// PurgeSessions deletes the refresh tokens that expired before the cutoff
+	PurgeSessions(ctx context.Context, before time.Time) (int, error)
+}
+
+// APITokenStore persists personal API tokens. Only hashes of the tokens are
+// stored.
+type APITokenStore interface {
+	CreateAPIToken(ctx context.Context, token *models.APIToken, tokenHash string) error
+	GetAPIToken(ctx context.Context, tokenID int64) (*models.APIToken, error)
+	// GetAPITokenByHash returns the unexpired token with tokenHash
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error)
+	// GetAPITokens returns all of the user's tokens, expired ones included,
+	// newest first
+	GetAPITokens(ctx context.Context, userID int64) ([]models.APIToken, error)
+	// TouchAPIToken records that the token was used at usedAt. It writes at
+	// most once every apiTokenTouchInterval per token.
+	TouchAPIToken(ctx context.Context, tokenID int64, usedAt time.Time) error
+	DeleteAPIToken(ctx context.Context, tokenID int64) error
+}
+
+// TwoFactorStore persists TOTP two-factor authentication and its recovery
+// codes. Only hashes of the recovery codes are stored.
+type TwoFactorStore interface {
+	GetTwoFactor(ctx context.Context, userID int64) (*models.TwoFactor, error)
+	// SetTwoFactorSecret starts setting up two-factor with a new secret,
+	// replacing one that was never confirmed. It fails with
+	// ErrTwoFactorEnabledError once two-factor is on.
+	SetTwoFactorSecret(ctx context.Context, userID int64, secret string) error
+	// EnableTwoFactor turns two-factor on after the code for step was
+	// confirmed, and replaces the user's recovery codes
+	EnableTwoFactor(ctx context.Context, userID, step int64, codeHashes []string) error
+	// UseTwoFactorStep records that the code for step was used. It fails with
+	// ErrTwoFactorCodeUsedError for a step no later than the last one.
+	UseTwoFactorStep(ctx context.Context, userID, step int64) error
+	// RecordTwoFactorFailure counts a wrong code, returning the time of the
+	// lock when it is the maxAttempts-th in a row
+	RecordTwoFactorFailure(ctx context.Context, userID int64, maxAttempts int) (*time.Time, error)
+	ResetTwoFactorFailures(ctx context.Context, userID int64) error
+	// UseRecoveryCode spends one of the user's unused recovery codes
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+	// DisableTwoFactor removes the secret and the recovery codes
+	DisableTwoFactor(ctx context.Context, userID int64) error
+}
+
+// IdentityStore persists the OpenID Connect identities users sign in with
+type IdentityStore interface {
+	GetIdentity(ctx context.Context, identityID int64) (*models.UserIdentity, error)
+	GetIdentityBySubject(ctx context.Context, issuer, subject string) (*models.UserIdentity, error)
+	GetIdentities(ctx context.Context, userID int64) ([]models.UserIdentity, error)
+	// CreateIdentity links an identity to an existing user. It fails with
+	// ErrIdentityExistsError when the identity is linked already.
+	CreateIdentity(ctx context.Context, identity *models.UserIdentity) error
+	// CreateUserWithIdentity creates a user without a password along with
+	// the identity they sign in with
+	CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) error
+	DeleteIdentity(ctx context.Context, identityID int64) error
+}
+
+// Store bundles every storage interface so a single backend can be passed around
+type Store interface {
+	SnippetStore
+	FolderStore
+	UserStore
+	TagStore
+	RevisionStore
+	TrashStore
+	SavedSearchStore
+	SuggestStore
+	SessionStore
+	APITokenStore
+	TwoFactorStore
+	IdentityStore
+
+	Close()
+}
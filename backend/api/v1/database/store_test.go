@@ -0,0 +1,683 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// The contract tests run every store that works in-process through the same
+// checks, so the in-memory store can't drift from the SQL ones. Postgres
+// shares its behaviour with SQLite but needs a server, so it isn't run here.
+func testStores(t *testing.T) map[string]func(t *testing.T) Store {
+	return map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store {
+			return NewMemoryStore()
+		},
+		"sqlite": func(t *testing.T) Store {
+			store, err := ConnectSQLite(filepath.Join(t.TempDir(), "fragments.db"))
+			if err != nil {
+				t.Fatalf("connecting to sqlite: %v", err)
+			}
+			t.Cleanup(store.Close)
+			if _, err := store.MigrateUp(context.Background()); err != nil {
+				t.Fatalf("migrating sqlite: %v", err)
+			}
+			return store
+		},
+	}
+}
+
+func runStoreContract(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Helper()
+	for name, newStore := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			test(t, newStore(t))
+		})
+	}
+}
+
+func createTestUser(t *testing.T, store Store, username string) *models.User {
+	t.Helper()
+	user := &UserWithPassword{User: models.User{Username: username}, Password: "hash"}
+	if err := store.CreateUserWithPassword(context.Background(), user); err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	return &user.User
+}
+
+func createTestSnippet(t *testing.T, store Store, snippet *models.Snippet) *models.Snippet {
+	t.Helper()
+	if snippet.Language == "" {
+		snippet.Language = "go"
+	}
+	if err := store.CreateSnippet(context.Background(), snippet); err != nil {
+		t.Fatalf("creating snippet %q: %v", snippet.Title, err)
+	}
+	return snippet
+}
+
+func snippetIDs(snippets []models.Snippet) []int64 {
+	ids := make([]int64, len(snippets))
+	for i, snippet := range snippets {
+		ids[i] = snippet.ID
+	}
+	return ids
+}
+
+func TestStoreUsers(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		user := &models.User{Username: "alice"}
+		if err := store.CreateUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		if user.ID == 0 || user.CreatedAt.IsZero() {
+			t.Fatalf("CreateUser left ID %d and created at %v", user.ID, user.CreatedAt)
+		}
+
+		err := store.CreateUserWithPassword(ctx, &UserWithPassword{User: models.User{Username: "alice"}, Password: "hash"})
+		if !IsUsernameExistsError(err) {
+			t.Fatalf("duplicate username error = %v, want ErrUsernameExists", err)
+		}
+
+		bob := createTestUser(t, store, "bob")
+		found, err := store.GetUserByUsername(ctx, "bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.ID != bob.ID || found.Password != "hash" {
+			t.Errorf("GetUserByUsername = %d with password %q", found.ID, found.Password)
+		}
+
+		if err := store.GetUser(ctx, bob.ID+100, &models.User{}); !IsUserNotFoundError(err) {
+			t.Errorf("missing user error = %v, want ErrNoUserError", err)
+		}
+
+		snippet := createTestSnippet(t, store, &models.Snippet{UserID: bob.ID, Title: "a", Content: "a"})
+		if err := store.DeleteUser(ctx, bob.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetSnippet(ctx, snippet.ID); !errors.Is(err, ErrNoSnippetError) {
+			t.Errorf("snippet of a deleted user error = %v, want ErrNoSnippetError", err)
+		}
+	})
+}
+
+func TestStoreFolders(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+		other := createTestUser(t, store, "bob")
+
+		parent := &models.Folder{UserID: user.ID, Name: "parent"}
+		if err := store.CreateFolder(ctx, parent); err != nil {
+			t.Fatal(err)
+		}
+		child := &models.Folder{UserID: user.ID, Name: "child", ParentID: &parent.ID}
+		if err := store.CreateFolder(ctx, child); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name   string
+			folder *models.Folder
+		}{
+			{"same name in the same place", &models.Folder{UserID: user.ID, Name: "parent"}},
+			{"parent of another user", &models.Folder{UserID: other.ID, Name: "mine", ParentID: &parent.ID}},
+		}
+		for _, tt := range tests {
+			if err := store.CreateFolder(ctx, tt.folder); err == nil {
+				t.Errorf("%s: CreateFolder succeeded", tt.name)
+			}
+		}
+
+		// The same name is fine somewhere else
+		if err := store.CreateFolder(ctx, &models.Folder{UserID: user.ID, Name: "parent", ParentID: &child.ID}); err != nil {
+			t.Errorf("same name in another folder: %v", err)
+		}
+
+		err := store.UpdateFolder(ctx, parent.ID, &models.Folder{UserID: user.ID, Name: "parent", ParentID: &child.ID})
+		if err == nil {
+			t.Error("moving a folder into its own child succeeded")
+		}
+
+		path, err := store.GetFolderPath(ctx, child.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(path) != 2 || path[0].ID != parent.ID || path[1].ID != child.ID {
+			t.Errorf("GetFolderPath = %v, want parent then child", path)
+		}
+
+		if _, err := store.DeleteFolder(ctx, parent.ID, models.FolderDeleteRestrict); err == nil {
+			t.Error("restricted delete of a folder with children succeeded")
+		}
+		if _, err := store.GetFolder(ctx, parent.ID+100); !errors.Is(err, ErrNoFolderError) {
+			t.Errorf("missing folder error = %v, want ErrNoFolderError", err)
+		}
+	})
+}
+
+func TestStoreRestoreFolderNameTaken(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+
+		parent := &models.Folder{UserID: user.ID, Name: "parent"}
+		if err := store.CreateFolder(ctx, parent); err != nil {
+			t.Fatal(err)
+		}
+		child := &models.Folder{UserID: user.ID, Name: "docs", ParentID: &parent.ID}
+		if err := store.CreateFolder(ctx, child); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.DeleteFolder(ctx, parent.ID, models.FolderDeleteCascade); err != nil {
+			t.Fatal(err)
+		}
+
+		// A create that raced the cascading delete leaves a live folder of the
+		// same name under the trashed parent
+		live := insertLiveFolder(t, store, &models.Folder{UserID: user.ID, Name: "docs", ParentID: &parent.ID})
+
+		if _, err := store.RestoreFolder(ctx, parent.ID); err != nil {
+			t.Fatalf("RestoreFolder: %v", err)
+		}
+
+		tests := []struct {
+			name     string
+			folderID int64
+			want     string
+		}{
+			{"live folder keeps its name", live, "docs"},
+			{"restored folder is renamed", child.ID, "docs (2)"},
+		}
+		for _, tt := range tests {
+			folder, err := store.GetFolder(ctx, tt.folderID)
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			if folder.Name != tt.want {
+				t.Errorf("%s: name = %q, want %q", tt.name, folder.Name, tt.want)
+			}
+		}
+	})
+}
+
+// insertLiveFolder stores a live folder without the checks CreateFolder makes,
+// for states only a race can produce
+func insertLiveFolder(t *testing.T, store Store, folder *models.Folder) int64 {
+	t.Helper()
+	now := time.Now().UTC()
+
+	switch s := store.(type) {
+	case *MemoryStore:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.lastFolderID++
+		folder.ID = s.lastFolderID
+		folder.CreatedAt, folder.UpdatedAt = now, now
+		s.folders[folder.ID] = *folder
+	case *SQLiteStore:
+		result, err := s.DB.Exec(
+			"INSERT INTO folders(user_id, name, parent_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+			folder.UserID, folder.Name, folder.ParentID, now, now,
+		)
+		if err != nil {
+			t.Fatalf("inserting folder: %v", err)
+		}
+		if folder.ID, err = result.LastInsertId(); err != nil {
+			t.Fatalf("inserting folder: %v", err)
+		}
+	default:
+		t.Fatalf("can't insert folders into %T", store)
+	}
+
+	return folder.ID
+}
+
+func TestStoreSnippetPagination(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+		other := createTestUser(t, store, "bob")
+		createTestSnippet(t, store, &models.Snippet{UserID: other.ID, Title: "theirs", Content: "x"})
+
+		var created []int64
+		for _, title := range []string{"e", "d", "c", "b", "a"} {
+			created = append(created, createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: title, Content: title}).ID)
+		}
+
+		tests := []struct {
+			name   string
+			page   int
+			limit  int
+			filter SnippetFilter
+			want   []int64
+		}{
+			{"first page, newest first", 1, 2, SnippetFilter{}, []int64{created[4], created[3]}},
+			{"last page", 3, 2, SnippetFilter{}, []int64{created[0]}},
+			{"past the end", 4, 2, SnippetFilter{}, []int64{}},
+			{"by title", 1, 3, SnippetFilter{Sort: SnippetSortTitle}, []int64{created[4], created[3], created[2]}},
+			{"by title descending", 1, 1, SnippetFilter{Sort: SnippetSortTitle, Order: SortDesc}, []int64{created[0]}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				snippets, total, err := store.GetSnippets(ctx, tt.page, tt.limit, user.ID, tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if total != len(created) {
+					t.Errorf("total = %d, want %d", total, len(created))
+				}
+				if got := snippetIDs(snippets); !slices.Equal(got, tt.want) {
+					t.Errorf("snippets = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestStoreCountSnippets(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+
+		createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "Read JSON", Content: "json.NewDecoder(r)", Language: "go"})
+		createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "Write JSON", Content: "json.dumps(v)", Language: "python"})
+		createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "Wait", Content: "<-ctx.Done()", Language: "go"})
+
+		missing := int64(1000)
+		filters := []SnippetFilter{
+			{},
+			{Language: "go"},
+			{Search: "json"},
+			{Search: "json lang:go", SearchMode: SearchModeFullText},
+			{FolderID: &missing, Recursive: true},
+			{Search: "nothing"},
+		}
+
+		counts, err := store.CountSnippets(ctx, user.ID, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []int{3, 2, 2, 1, 0, 0}; !slices.Equal(counts, want) {
+			t.Errorf("CountSnippets = %v, want %v", counts, want)
+		}
+
+		// Each count agrees with the total GetSnippets reports
+		for i, filter := range filters {
+			_, total, err := store.GetSnippets(ctx, 1, 1, user.ID, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != counts[i] {
+				t.Errorf("filter %d: GetSnippets total = %d, CountSnippets = %d", i, total, counts[i])
+			}
+		}
+
+		if _, err := store.CountSnippets(ctx, user.ID, []SnippetFilter{{Search: `"open`}}); err == nil {
+			t.Error("CountSnippets with a malformed search succeeded")
+		}
+	})
+}
+
+func TestStoreSnippetTags(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+
+		first := []string{"go", "http"}
+		snippet := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "a", Content: "a", Tags: &first})
+		second := []string{"go"}
+		createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "b", Content: "b", Tags: &second})
+
+		tags, err := store.GetTags(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := make(map[string]int)
+		for _, tag := range tags {
+			counts[tag.Name] = tag.SnippetCount
+		}
+		if len(tags) != 2 || counts["go"] != 2 || counts["http"] != 1 {
+			t.Errorf("tag counts = %v, want go 2 and http 1", counts)
+		}
+
+		// Updating with new tags replaces the old ones and reuses existing tags
+		replaced := []string{"http", "json"}
+		snippet.Tags = &replaced
+		if err := store.UpdateSnippet(ctx, snippet.ID, snippet); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.GetSnippet(ctx, snippet.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Tags == nil || !slices.Equal(slices.Sorted(slices.Values(*got.Tags)), replaced) {
+			t.Errorf("tags after update = %v, want %v", got.Tags, replaced)
+		}
+
+		tags, err = store.GetTags(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 3 {
+			t.Errorf("%d tags after update, want 3", len(tags))
+		}
+	})
+}
+
+func TestStoreSnippetErrors(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+		snippet := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "a", Content: "a"})
+		if err := store.DeleteSnippet(ctx, snippet.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name string
+			call func() error
+		}{
+			{"get", func() error {
+				_, err := store.GetSnippet(ctx, snippet.ID)
+				return err
+			}},
+			{"update", func() error {
+				return store.UpdateSnippet(ctx, snippet.ID, &models.Snippet{Title: "b", Content: "b", Language: "go"})
+			}},
+			{"delete", func() error {
+				return store.DeleteSnippet(ctx, snippet.ID)
+			}},
+			{"get missing", func() error {
+				_, err := store.GetSnippet(ctx, snippet.ID+100)
+				return err
+			}},
+		}
+
+		for _, tt := range tests {
+			if err := tt.call(); !errors.Is(err, ErrNoSnippetError) {
+				t.Errorf("%s deleted snippet error = %v, want ErrNoSnippetError", tt.name, err)
+			}
+		}
+	})
+}
+
+func TestStoreSearch(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+
+		reader := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "Read JSON", Content: "json.NewDecoder(r).Decode(&v)"})
+		wait := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "Wait", Content: "<-ctx.Done()"})
+		python := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "Python JSON", Content: "json.loads(s)", Language: "python"})
+
+		tests := []struct {
+			name   string
+			filter SnippetFilter
+			want   []int64
+		}{
+			{"title word", SnippetFilter{Search: "wait"}, []int64{wait.ID}},
+			{"every word must match", SnippetFilter{Search: "python json"}, []int64{python.ID}},
+			{"any field", SnippetFilter{Search: "json"}, []int64{reader.ID, python.ID}},
+			{"identifier part", SnippetFilter{Search: "decoder", SearchMode: SearchModeFullText}, []int64{reader.ID}},
+			{"excluded word", SnippetFilter{Search: "json -python"}, []int64{reader.ID}},
+			{"phrase", SnippetFilter{Search: `"read json"`}, []int64{reader.ID}},
+			{"prefix", SnippetFilter{Search: "deco*", SearchMode: SearchModeFullText}, []int64{reader.ID}},
+			{"language operator", SnippetFilter{Search: "lang:python"}, []int64{python.ID}},
+			{"code in substring mode", SnippetFilter{Search: "ctx.Done()", SearchMode: SearchModeSubstring}, []int64{wait.ID}},
+			{"no match", SnippetFilter{Search: "nothing"}, []int64{}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				snippets, total, err := store.GetSnippets(ctx, 1, 20, user.ID, tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := snippetIDs(snippets)
+				slices.Sort(got)
+				if !slices.Equal(got, tt.want) || total != len(tt.want) {
+					t.Errorf("matches = %v (total %d), want %v", got, total, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestStoreSuggest(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+		other := createTestUser(t, store, "bob")
+
+		gopher := &models.Folder{UserID: user.ID, Name: "Gophers"}
+		if err := store.CreateFolder(ctx, gopher); err != nil {
+			t.Fatal(err)
+		}
+
+		retryTags := []string{"golang", "net"}
+		walkTags := []string{"golang"}
+		parseTags := []string{"graphs"}
+		createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "Go retry", Content: "a()", Language: "go", FolderID: &gopher.ID, Tags: &retryTags})
+		createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "Graph walk", Content: "b()", Language: "go", Tags: &walkTags})
+		createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "Parse", Content: "c()", Language: "python", Tags: &parseTags})
+		createTestSnippet(t, store, &models.Snippet{UserID: other.ID, Title: "Go other", Content: "d()", Language: "go"})
+
+		suggestions, err := store.Suggest(ctx, user.ID, "G", 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values := func(list []models.Suggestion) []string {
+			result := []string{}
+			for _, suggestion := range list {
+				result = append(result, fmt.Sprintf("%s:%d", suggestion.Value, suggestion.Count))
+			}
+			return result
+		}
+
+		tests := []struct {
+			name string
+			got  []models.Suggestion
+			want []string
+		}{
+			{"snippets", suggestions.Snippets, []string{"Graph walk:0", "Go retry:0"}},
+			{"tags by usage", suggestions.Tags, []string{"golang:2", "graphs:1"}},
+			{"folders", suggestions.Folders, []string{"Gophers:1"}},
+			{"languages", suggestions.Languages, []string{"go:2"}},
+		}
+		for _, tt := range tests {
+			if got := values(tt.got); !slices.Equal(got, tt.want) {
+				t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+			}
+		}
+
+		none, err := store.Suggest(ctx, user.ID, "zz%", 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if none.Snippets == nil || len(none.Snippets)+len(none.Tags)+len(none.Folders)+len(none.Languages) != 0 {
+			t.Errorf("no match = %+v, want empty lists", none)
+		}
+	})
+}
+
+func TestStoreUniqueContent(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+
+		const requests = 10
+		var wg sync.WaitGroup
+		errs := make(chan error, requests)
+		for range requests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- store.CreateUniqueSnippet(ctx, &models.Snippet{UserID: user.ID, Title: "t", Content: "same", Language: "go"})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		created, duplicates := 0, 0
+		for err := range errs {
+			var dupErr *DuplicateContentError
+			switch {
+			case err == nil:
+				created++
+			case errors.As(err, &dupErr):
+				duplicates++
+			default:
+				t.Fatal(err)
+			}
+		}
+		if created != 1 || duplicates != requests-1 {
+			t.Fatalf("%d created and %d duplicates, want 1 and %d", created, duplicates, requests-1)
+		}
+
+		other := createTestSnippet(t, store, &models.Snippet{UserID: user.ID, Title: "other", Content: "other"})
+		other.Content = "same  \r\n"
+		var dupErr *DuplicateContentError
+		if err := store.UpdateUniqueSnippet(ctx, other.ID, other); !errors.As(err, &dupErr) || len(dupErr.IDs) != 1 {
+			t.Fatalf("update to duplicate content error = %v, want a DuplicateContentError", err)
+		}
+
+		// Once saved anyway, a duplicate can still be edited in other ways
+		if err := store.UpdateSnippet(ctx, other.ID, other); err != nil {
+			t.Fatal(err)
+		}
+		other.Title = "renamed"
+		if err := store.UpdateUniqueSnippet(ctx, other.ID, other); err != nil {
+			t.Errorf("renaming a duplicate: %v", err)
+		}
+	})
+}
+
+func TestStoreTwoFactorFailures(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+
+		if _, err := store.RecordTwoFactorFailure(ctx, user.ID, 3); !errors.Is(err, ErrNoTwoFactorError) {
+			t.Fatalf("failure without two-factor error = %v, want ErrNoTwoFactorError", err)
+		}
+		if err := store.SetTwoFactorSecret(ctx, user.ID, "GEZDGNBV"); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 1; i <= 3; i++ {
+			lockedAt, err := store.RecordTwoFactorFailure(ctx, user.ID, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (lockedAt != nil) != (i == 3) {
+				t.Fatalf("failure %d locked at %v", i, lockedAt)
+			}
+		}
+
+		twoFactor, err := store.GetTwoFactor(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if twoFactor.FailedAttempts != 0 || twoFactor.LockedAt == nil {
+			t.Errorf("after the lock failed attempts = %d and locked at = %v", twoFactor.FailedAttempts, twoFactor.LockedAt)
+		}
+
+		// Starting over with a new secret lifts the lock
+		if err := store.SetTwoFactorSecret(ctx, user.ID, "MFRGGZDF"); err != nil {
+			t.Fatal(err)
+		}
+		if twoFactor, err = store.GetTwoFactor(ctx, user.ID); err != nil || twoFactor.LockedAt != nil {
+			t.Errorf("after a new secret locked at = %v, %v", twoFactor.LockedAt, err)
+		}
+	})
+}
+
+func TestStoreSessionRotation(t *testing.T) {
+	runStoreContract(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		user := createTestUser(t, store, "alice")
+		expiresAt := time.Now().Add(time.Hour)
+
+		session := &models.Session{UserID: user.ID, Device: "laptop", ExpiresAt: expiresAt}
+		if err := store.CreateSession(ctx, session, "first"); err != nil {
+			t.Fatal(err)
+		}
+
+		rotated, err := store.RotateSession(ctx, "first", "second", "10.0.0.1", expiresAt)
+		if err != nil || rotated.ID != session.ID {
+			t.Fatalf("RotateSession() = %+v, %v", rotated, err)
+		}
+
+		// Two tabs refreshing at once both present the first token, the late
+		// one gets a token of its own and neither is signed out
+		late, err := store.RotateSession(ctx, "first", "third", "10.0.0.1", expiresAt)
+		if err != nil || late.ID != session.ID {
+			t.Fatalf("RotateSession() with a token just replaced = %+v, %v", late, err)
+		}
+		for _, hash := range []string{"second", "third"} {
+			if _, err := store.GetSessionByToken(ctx, hash); err != nil {
+				t.Errorf("token %s after the race: %v", hash, err)
+			}
+		}
+		if _, err := store.GetSessionByToken(ctx, "first"); !errors.Is(err, ErrNoSessionError) {
+			t.Errorf("replaced token error = %v, want ErrNoSessionError", err)
+		}
+		if sessions, err := store.GetSessions(ctx, user.ID); err != nil || len(sessions) != 1 {
+			t.Errorf("GetSessions() = %+v, %v, want the one session", sessions, err)
+		}
+
+		// Past the grace a replaced token means a copy leaked
+		grace := refreshReuseGrace
+		refreshReuseGrace = 0
+		t.Cleanup(func() { refreshReuseGrace = grace })
+
+		if _, err := store.RotateSession(ctx, "first", "fourth", "10.0.0.2", expiresAt); !errors.Is(err, ErrSessionReuseError) {
+			t.Fatalf("RotateSession() with a spent token error = %v, want ErrSessionReuseError", err)
+		}
+		for _, hash := range []string{"second", "third", "fourth"} {
+			if _, err := store.GetSessionByToken(ctx, hash); !errors.Is(err, ErrNoSessionError) {
+				t.Errorf("token %s after the reuse error = %v, want ErrNoSessionError", hash, err)
+			}
+		}
+	})
+}
+
+func TestSQLiteMigrationsReversible(t *testing.T) {
+	ctx := context.Background()
+	store, err := ConnectSQLite(filepath.Join(t.TempDir(), "fragments.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	applied, err := store.MigrateUp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := store.MigrateDown(ctx, len(applied))
+	if err != nil {
+		t.Fatalf("migrating down: %v", err)
+	}
+	if len(reverted) != len(applied) {
+		t.Fatalf("reverted %d of %d migrations", len(reverted), len(applied))
+	}
+	if _, err := store.MigrateUp(ctx); err != nil {
+		t.Fatalf("migrating up again: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// suggestCandidates caps how many tags or folders matching the prefix are
+// ranked by usage. Counting uses is the costly part, so a one letter prefix
+// counts for the first suggestCandidates names in order rather than every
+// name starting with that letter.
+const suggestCandidates = 100
+
+// suggestQuery answers every list in one round trip. It takes the user ID,
+// the LIKE pattern, the limit and suggestCandidates, and returns the list, the
+// position in it, the ID (NULL for languages), value and usage count (0 for
+// snippets). The prefix indexes from 0008_suggest_indexes and
+// 0015_suggest_language_index keep each part to a short index range scan, so
+// it stays quick on every keystroke.
+const suggestQuery = `
+	SELECT * FROM (
+		SELECT 'snippet' AS list,
+			ROW_NUMBER() OVER (ORDER BY is_favorite DESC, updated_at DESC, id DESC) AS position,
+			id, title AS value, 0::BIGINT AS uses
+		FROM snippets
+		WHERE user_id = $1 AND deleted_at IS NULL AND LOWER(title) LIKE $2 ESCAPE '\'
+		ORDER BY position
+		LIMIT $3
+	) snippet_list
+	UNION ALL
+	SELECT * FROM (
+		SELECT 'tag', ROW_NUMBER() OVER (ORDER BY COUNT(s.id) DESC, COALESCE(MAX(s.updated_at), t.created_at) DESC, t.name),
+			t.id, t.name, COUNT(s.id)
+		FROM (
+			SELECT id, name, created_at
+			FROM tags
+			WHERE user_id = $1 AND LOWER(name) LIKE $2 ESCAPE '\'
+			ORDER BY LOWER(name), id
+			LIMIT $4
+		) t
+		LEFT JOIN snippet_tags st ON st.tag_id = t.id
+		LEFT JOIN snippets s ON s.id = st.snippet_id AND s.deleted_at IS NULL
+		GROUP BY t.id, t.name, t.created_at
+		ORDER BY 2
+		LIMIT $3
+	) tag_list
+	UNION ALL
+	SELECT * FROM (
+		SELECT 'folder', ROW_NUMBER() OVER (ORDER BY COUNT(s.id) DESC, COALESCE(MAX(s.updated_at), f.updated_at) DESC, f.name),
+			f.id, f.name, COUNT(s.id)
+		FROM (
+			SELECT id, name, updated_at
+			FROM folders
+			WHERE user_id = $1 AND deleted_at IS NULL AND LOWER(name) LIKE $2 ESCAPE '\'
+			ORDER BY LOWER(name), id
+			LIMIT $4
+		) f
+		LEFT JOIN snippets s ON s.folder_id = f.id AND s.deleted_at IS NULL
+		GROUP BY f.id, f.name, f.updated_at
+		ORDER BY 2
+		LIMIT $3
+	) folder_list
+	UNION ALL
+	SELECT * FROM (
+		SELECT 'language', ROW_NUMBER() OVER (ORDER BY COUNT(*) DESC, MAX(updated_at) DESC, language),
+			NULL::INTEGER, language, COUNT(*)
+		FROM snippets
+		WHERE user_id = $1 AND deleted_at IS NULL AND LOWER(language) LIKE $2 ESCAPE '\'
+		GROUP BY language
+		ORDER BY 2
+		LIMIT $3
+	) language_list
+	ORDER BY list, position`
+
+func Suggest(ctx context.Context, pool *pgxpool.Pool, userID int64, prefix string, limit int) (*models.Suggestions, error) {
+	pattern, _ := likePrefixPattern(strings.ToLower(prefix))
+
+	rows, err := pool.Query(ctx, suggestQuery, userID, pattern, limit, suggestCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get suggestions", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	suggestions := newSuggestions()
+	for rows.Next() {
+		var list string
+		var position int64
+		var suggestion models.Suggestion
+		if err := rows.Scan(&list, &position, &suggestion.ID, &suggestion.Value, &suggestion.Count); err != nil {
+			return nil, fmt.Errorf("%w: failed to scan suggestion", ErrDatabaseError)
+		}
+		addSuggestion(suggestions, list, suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate suggestions", ErrDatabaseError)
+	}
+
+	return suggestions, nil
+}
+
+// newSuggestions returns suggestions with every list empty rather than nil,
+// so each encodes as []
+func newSuggestions() *models.Suggestions {
+	return &models.Suggestions{
+		Snippets:  []models.Suggestion{},
+		Tags:      []models.Suggestion{},
+		Folders:   []models.Suggestion{},
+		Languages: []models.Suggestion{},
+	}
+}
+
+// addSuggestion appends a row of a suggest query to the list it names
+func addSuggestion(suggestions *models.Suggestions, list string, suggestion models.Suggestion) {
+	switch list {
+	case "snippet":
+		suggestions.Snippets = append(suggestions.Snippets, suggestion)
+	case "tag":
+		suggestions.Tags = append(suggestions.Tags, suggestion)
+	case "folder":
+		suggestions.Folders = append(suggestions.Folders, suggestion)
+	case "language":
+		suggestions.Languages = append(suggestions.Languages, suggestion)
+	}
+}
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNoTagError = errors.New("tag does not exist")
+
+// tagColumns selects a tag along with the number of live snippets carrying it
+const tagColumns = `
+		t.id, t.user_id, t.name, t.color, t.created_at,
+		(SELECT COUNT(*)
+		 FROM snippet_tags st
+		 JOIN snippets s ON s.id = st.snippet_id
+		 WHERE st.tag_id = t.id AND s.deleted_at IS NULL) AS snippet_count`
+
+func CreateTag(ctx context.Context, pool *pgxpool.Pool, tag *models.Tag) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	var count int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM tags WHERE user_id = $1 AND name = $2", tag.UserID, tag.Name).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check for duplicate tag name", ErrDatabaseError)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("tag name already exists")
+	}
+
+	now := time.Now()
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO tags (user_id, name, color, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		tag.UserID, tag.Name, tag.Color, now,
+	).Scan(&tag.ID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to insert tag", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	tag.CreatedAt = now
+	tag.SnippetCount = 0
+
+	return nil
+}
+
+func GetTag(ctx context.Context, pool *pgxpool.Pool, tagID int64) (*models.Tag, error) {
+	query := `SELECT ` + tagColumns + `
+		FROM tags t
+		WHERE t.id = $1`
+
+	var tag models.Tag
+	err := pool.QueryRow(ctx, query, tagID).Scan(
+		&tag.ID,
+		&tag.UserID,
+		&tag.Name,
+		&tag.Color,
+		&tag.CreatedAt,
+		&tag.SnippetCount,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("tag with ID %d does not exist: %w", tagID, ErrNoTagError)
+		}
+		return nil, fmt.Errorf("%w: failed to get tag", ErrDatabaseError)
+	}
+
+	return &tag, nil
+}
+
+func GetTags(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.Tag, error) {
+	query := `SELECT ` + tagColumns + `
+		FROM tags t
+		WHERE t.user_id = $1
+		ORDER BY t.name ASC`
+
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get tags", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var tag models.Tag
+		var color *string
+
+		err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &color, &tag.CreatedAt, &tag.SnippetCount)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to scan tag data", ErrDatabaseError)
+		}
+
+		tag.Color = color
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to iterate tags", ErrDatabaseError)
+	}
+
+	return tags, nil
+}
+
+// UpdateTag renames and recolors a tag. When the new name is taken by another
+// of the user's tags the two are merged: snippets move over to the existing
+// tag, which keeps its color unless it has none, and this one is deleted.
+func UpdateTag(ctx context.Context, pool *pgxpool.Pool, tagID int64, tag *models.Tag) (*models.Tag, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, "SELECT user_id FROM tags WHERE id = $1 FOR UPDATE", tagID).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("tag with ID %d does not exist: %w", tagID, ErrNoTagError)
+		}
+		return nil, fmt.Errorf("%w: failed to check tag existence", ErrDatabaseError)
+	}
+
+	resultID := tagID
+
+	var targetID int64
+	err = tx.QueryRow(ctx, "SELECT id FROM tags WHERE user_id = $1 AND name = $2 AND id <> $3", userID, tag.Name, tagID).Scan(&targetID)
+	switch {
+	case err == nil:
+		if err = mergeTag(ctx, tx, tagID, targetID, tag.Color); err != nil {
+			return nil, err
+		}
+		resultID = targetID
+	case errors.Is(err, pgx.ErrNoRows):
+		_, err = tx.Exec(ctx, "UPDATE tags SET name = $1, color = $2 WHERE id = $3", tag.Name, tag.Color, tagID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to update tag", ErrDatabaseError)
+		}
+	default:
+		return nil, fmt.Errorf("%w: failed to check for duplicate tag name", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return GetTag(ctx, pool, resultID)
+}
+
+func DeleteTag(ctx context.Context, pool *pgxpool.Pool, tagID int64) error {
+	// snippet_tags rows go with it through ON DELETE CASCADE
+	result, err := pool.Exec(ctx, "DELETE FROM tags WHERE id = $1", tagID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete tag", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("tag with ID %d does not exist: %w", tagID, ErrNoTagError)
+	}
+
+	return nil
+}
+
+func DeleteUnusedTags(ctx context.Context, pool *pgxpool.Pool, userID int64) (int, error) {
+	result, err := pool.Exec(ctx, `
+		DELETE FROM tags t
+		WHERE t.user_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM snippet_tags st WHERE st.tag_id = t.id)`,
+		userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to delete unused tags", ErrDatabaseError)
+	}
+
+	return int(result.RowsAffected()), nil
+}
+
+// mergeTag moves every snippet from tagID onto targetID and deletes tagID
+func mergeTag(ctx context.Context, tx pgx.Tx, tagID, targetID int64, color *string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO snippet_tags (snippet_id, tag_id)
+		SELECT snippet_id, $1 FROM snippet_tags WHERE tag_id = $2
+		ON CONFLICT DO NOTHING`,
+		targetID, tagID,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to move snippets to merged tag", ErrDatabaseError)
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM tags WHERE id = $1", tagID); err != nil {
+		return fmt.Errorf("%w: failed to delete merged tag", ErrDatabaseError)
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE tags SET color = COALESCE(color, $1) WHERE id = $2", color, targetID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to update merged tag", ErrDatabaseError)
+	}
+
+	return nil
+}
@@ -0,0 +1,497 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func GetTrash(ctx context.Context, pool *pgxpool.Pool, page, limit int, userID int64, itemType string) ([]models.TrashItem, int, error) {
+	offset := (page - 1) * limit
+
+	var parts []string
+	if itemType == "" || itemType == models.TrashTypeSnippet {
+		parts = append(parts, `
+			SELECT 'snippet' AS item_type, id, title AS name, folder_id AS parent_id, trash_path, deleted_at
+			FROM snippets WHERE user_id = $1 AND deleted_at IS NOT NULL`)
+	}
+	if itemType == "" || itemType == models.TrashTypeFolder {
+		parts = append(parts, `
+			SELECT 'folder' AS item_type, id, name, parent_id, trash_path, deleted_at
+			FROM folders WHERE user_id = $1 AND deleted_at IS NOT NULL`)
+	}
+	trash := strings.Join(parts, " UNION ALL ")
+
+	var total int
+	err := pool.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM (%s) trash", trash), userID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to get trash count", ErrDatabaseError)
+	}
+
+	dataQuery := fmt.Sprintf(`
+		SELECT item_type, id, name, parent_id, trash_path, deleted_at
+		FROM (%s) trash
+		ORDER BY deleted_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, trash)
+
+	rows, err := pool.Query(ctx, dataQuery, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to get trash", ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	var items []models.TrashItem
+	for rows.Next() {
+		var item models.TrashItem
+		err := rows.Scan(&item.Type, &item.ID, &item.Name, &item.ParentID, &item.Path, &item.DeletedAt)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: failed to scan trash item", ErrDatabaseError)
+		}
+		if item.Path == nil {
+			item.Path = []string{}
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to iterate trash", ErrDatabaseError)
+	}
+
+	return items, total, nil
+}
+
+func GetTrashedSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64) (*models.Snippet, error) {
+	return getSnippet(ctx, pool, snippetID, "deleted_at IS NOT NULL")
+}
+
+func GetTrashedFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64) (*models.Folder, error) {
+	return getFolder(ctx, pool, folderID, "deleted_at IS NOT NULL")
+}
+
+// RestoreSnippet takes a snippet out of the trash, bringing back or
+// re-creating the folders it was in
+func RestoreSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64) (*models.Snippet, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	var folderID *int64
+	var path []string
+	err = tx.QueryRow(ctx, "SELECT user_id, folder_id, trash_path FROM snippets WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE", snippetID).Scan(&userID, &folderID, &path)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("snippet with ID %d is not in the trash: %w", snippetID, ErrNoSnippetError)
+		}
+		return nil, fmt.Errorf("%w: failed to check snippet existence", ErrDatabaseError)
+	}
+
+	now := time.Now()
+
+	folderID, err = restoreFolderChain(ctx, tx, userID, folderID, path, now, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE snippets
+		SET deleted_at = NULL, trash_path = NULL, folder_id = $1, updated_at = $2
+		WHERE id = $3`,
+		folderID, now, snippetID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to restore snippet", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%w: failed to commit restore", ErrDatabaseError)
+	}
+
+	return GetSnippet(ctx, pool, snippetID)
+}
+
+// RestoreFolder takes a folder out of the trash, bringing back or re-creating
+// its parents. It fails if a live folder has taken its name in the meantime.
+func RestoreFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64) (*models.Folder, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	var name string
+	var parentID *int64
+	var path []string
+	var deletedAt time.Time
+	err = tx.QueryRow(ctx, "SELECT user_id, name, parent_id, trash_path, deleted_at FROM folders WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE", folderID).Scan(&userID, &name, &parentID, &path, &deletedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("folder with ID %d is not in the trash: %w", folderID, ErrNoFolderError)
+		}
+		return nil, fmt.Errorf("%w: failed to check folder existence", ErrDatabaseError)
+	}
+
+	now := time.Now()
+
+	parentID, err = restoreFolderChain(ctx, tx, userID, parentID, path, now, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	existingID, err := findLiveFolder(ctx, tx, userID, name, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if existingID != 0 {
+		return nil, fmt.Errorf("folder name already exists in this location")
+	}
+
+	err = restoreFolderContents(ctx, tx, userID, folderID, deletedAt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE folders
+		SET deleted_at = NULL, trash_path = NULL, parent_id = $1, updated_at = $2
+		WHERE id = $3`,
+		parentID, now, folderID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to restore folder", ErrDatabaseError)
+	}
+
+	if err = setFolderPath(ctx, tx, folderID, parentID); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%w: failed to commit restore", ErrDatabaseError)
+	}
+
+	return GetFolder(ctx, pool, folderID)
+}
+
+func PurgeSnippet(ctx context.Context, pool *pgxpool.Pool, snippetID int64) error {
+	result, err := pool.Exec(ctx, "DELETE FROM snippets WHERE id = $1 AND deleted_at IS NOT NULL", snippetID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to purge snippet", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("snippet with ID %d is not in the trash: %w", snippetID, ErrNoSnippetError)
+	}
+
+	return nil
+}
+
+// PurgeFolder permanently deletes a trashed folder. Anything still pointing at
+// it falls back to its recorded trash_path when restored.
+func PurgeFolder(ctx context.Context, pool *pgxpool.Pool, folderID int64) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM folders WHERE id = $1 AND deleted_at IS NOT NULL)", folderID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check folder existence", ErrDatabaseError)
+	}
+
+	if !exists {
+		return fmt.Errorf("folder with ID %d is not in the trash: %w", folderID, ErrNoFolderError)
+	}
+
+	if err = detachFolderPaths(ctx, tx, folderID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM folders WHERE id = $1", folderID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to purge folder", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit purge", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+// EmptyTrash purges everything in a user's trash and returns how many items were removed
+func EmptyTrash(ctx context.Context, pool *pgxpool.Pool, userID int64) (int, error) {
+	return purgeTrashWhere(ctx, pool, "user_id = $1", userID)
+}
+
+// PurgeTrash purges every item trashed before the cutoff, across all users
+func PurgeTrash(ctx context.Context, pool *pgxpool.Pool, before time.Time) (int, error) {
+	return purgeTrashWhere(ctx, pool, "deleted_at < $1", before)
+}
+
+func purgeTrashWhere(ctx context.Context, pool *pgxpool.Pool, condition string, arg interface{}) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	snippets, err := tx.Exec(ctx, "DELETE FROM snippets WHERE deleted_at IS NOT NULL AND "+condition, arg)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to purge snippets", ErrDatabaseError)
+	}
+
+	rows, err := tx.Query(ctx, "SELECT id FROM folders WHERE deleted_at IS NOT NULL AND "+condition, arg)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to get folders to purge", ErrDatabaseError)
+	}
+
+	folderIDs, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to get folders to purge", ErrDatabaseError)
+	}
+
+	for _, folderID := range folderIDs {
+		if err = detachFolderPaths(ctx, tx, folderID); err != nil {
+			return 0, err
+		}
+	}
+
+	folders, err := tx.Exec(ctx, "DELETE FROM folders WHERE deleted_at IS NOT NULL AND "+condition, arg)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to purge folders", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%w: failed to commit purge", ErrDatabaseError)
+	}
+
+	return int(snippets.RowsAffected() + folders.RowsAffected()), nil
+}
+
+// trashPath returns the names of folderID and its ancestors, root first, so a
+// trashed item remembers where it lived
+func trashPath(ctx context.Context, tx pgx.Tx, folderID *int64) ([]string, error) {
+	path := []string{}
+	if folderID == nil {
+		return path, nil
+	}
+
+	rows, err := tx.Query(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, name, 0 AS depth FROM folders WHERE id = $1
+			UNION ALL
+			SELECT f.id, f.parent_id, f.name, c.depth + 1
+			FROM folders f
+			JOIN chain c ON f.id = c.parent_id
+			WHERE c.depth < 50
+		)
+		SELECT name FROM chain ORDER BY depth DESC`, *folderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read folder path: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan folder path: %w", err)
+		}
+		path = append(path, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate folder path: %w", err)
+	}
+
+	return path, nil
+}
+
+// restoreFolderContents restores the folders and snippets below folderID that
+// were trashed at deletedAt, i.e. along with it by a cascading delete. Only
+// userID's snippets are restored. A subfolder whose name a live folder has
+// taken comes back as "name (2)" and so on, like a reparented one.
+func restoreFolderContents(ctx context.Context, tx pgx.Tx, userID, folderID int64, deletedAt, now time.Time) error {
+	subtree := `
+		WITH RECURSIVE subtree AS (
+			SELECT id, 0 AS depth FROM folders WHERE id = $1
+			UNION ALL
+			SELECT f.id, s.depth + 1 FROM folders f
+			JOIN subtree s ON f.parent_id = s.id
+			WHERE f.deleted_at = $2
+		)`
+
+	_, err := tx.Exec(ctx, subtree+`
+		UPDATE snippets SET deleted_at = NULL, trash_path = NULL, updated_at = $3
+		WHERE deleted_at = $2 AND user_id = $4 AND folder_id IN (SELECT id FROM subtree)`,
+		folderID, deletedAt, now, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to restore snippets in folder", ErrDatabaseError)
+	}
+
+	rows, err := tx.Query(ctx, subtree+`
+		SELECT f.id, f.name, f.parent_id
+		FROM subtree s
+		JOIN folders f ON f.id = s.id
+		WHERE f.id <> $1
+		ORDER BY s.depth, f.id`,
+		folderID, deletedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to get subfolders", ErrDatabaseError)
+	}
+
+	type subfolder struct {
+		id       int64
+		name     string
+		parentID *int64
+	}
+	var subfolders []subfolder
+	for rows.Next() {
+		var folder subfolder
+		if err := rows.Scan(&folder.id, &folder.name, &folder.parentID); err != nil {
+			rows.Close()
+			return fmt.Errorf("%w: failed to scan subfolder", ErrDatabaseError)
+		}
+		subfolders = append(subfolders, folder)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("%w: failed to iterate subfolders", ErrDatabaseError)
+	}
+
+	for _, folder := range subfolders {
+		name := folder.name
+		for n := 2; ; n++ {
+			existingID, err := findLiveFolder(ctx, tx, userID, name, folder.parentID)
+			if err != nil {
+				return err
+			}
+			if existingID == 0 {
+				break
+			}
+			name = folderCopyName(folder.name, n)
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE folders SET deleted_at = NULL, trash_path = NULL, name = $1, updated_at = $2 WHERE id = $3", name, now, folder.id)
+		if err != nil {
+			return fmt.Errorf("%w: failed to restore subfolders", ErrDatabaseError)
+		}
+	}
+
+	return nil
+}
+
+// restoreFolderChain makes sure the folder a restored item goes back into is
+// live and returns its ID. A trashed parent is restored along with its own
+// parents, unless a live folder has taken its name, in which case the item
+// joins that folder instead. A purged parent is re-created from path.
+func restoreFolderChain(ctx context.Context, tx pgx.Tx, userID int64, folderID *int64, path []string, now time.Time, depth int) (*int64, error) {
+	// Prevent infinite recursion
+	if depth > 50 {
+		return nil, fmt.Errorf("maximum folder depth exceeded")
+	}
+
+	if folderID != nil {
+		var name string
+		var parentID *int64
+		var deletedAt *time.Time
+		var parentPath []string
+		err := tx.QueryRow(ctx, "SELECT name, parent_id, deleted_at, trash_path FROM folders WHERE id = $1", *folderID).Scan(&name, &parentID, &deletedAt, &parentPath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to check parent folder", ErrDatabaseError)
+		}
+
+		if deletedAt == nil {
+			return folderID, nil
+		}
+
+		parentID, err = restoreFolderChain(ctx, tx, userID, parentID, parentPath, now, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		existingID, err := findLiveFolder(ctx, tx, userID, name, parentID)
+		if err != nil {
+			return nil, err
+		}
+		if existingID != 0 {
+			return &existingID, nil
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE folders
+			SET deleted_at = NULL, trash_path = NULL, parent_id = $1, updated_at = $2
+			WHERE id = $3`,
+			parentID, now, *folderID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to restore parent folder", ErrDatabaseError)
+		}
+
+		if err = setFolderPath(ctx, tx, *folderID, parentID); err != nil {
+			return nil, err
+		}
+
+		return folderID, nil
+	}
+
+	var parentID *int64
+	for _, name := range path {
+		id, err := findLiveFolder(ctx, tx, userID, name, parentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if id == 0 {
+			err = tx.QueryRow(ctx, `
+				INSERT INTO folders (user_id, name, parent_id, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5)
+				RETURNING id`,
+				userID, name, parentID, now, now,
+			).Scan(&id)
+			if err != nil {
+				return nil, fmt.Errorf("%w: failed to re-create folder", ErrDatabaseError)
+			}
+
+			if err = setFolderPath(ctx, tx, id, parentID); err != nil {
+				return nil, err
+			}
+		}
+
+		parentID = &id
+	}
+
+	return parentID, nil
+}
+
+// findLiveFolder returns the ID of the user's live folder with this name and
+// parent, or 0 if there is none
+func findLiveFolder(ctx context.Context, tx pgx.Tx, userID int64, name string, parentID *int64) (int64, error) {
+	var id int64
+	err := tx.QueryRow(ctx, `
+		SELECT id FROM folders
+		WHERE user_id = $1 AND name = $2 AND parent_id IS NOT DISTINCT FROM $3 AND deleted_at IS NULL`,
+		userID, name, parentID,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%w: failed to check for existing folder", ErrDatabaseError)
+	}
+
+	return id, nil
+}
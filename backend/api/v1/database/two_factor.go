@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNoTwoFactorError       = errors.New("two-factor authentication is not set up")
+	ErrTwoFactorEnabledError  = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorCodeUsedError = errors.New("two-factor code has already been used")
+	ErrNoRecoveryCodeError    = errors.New("recovery code does not exist")
+)
+
+func GetTwoFactor(ctx context.Context, pool *pgxpool.Pool, userID int64) (*models.TwoFactor, error) {
+	twoFactor := models.TwoFactor{UserID: userID}
+	err := pool.QueryRow(ctx, "SELECT secret, enabled_at, last_step, failed_attempts, locked_at FROM two_factor WHERE user_id = $1", userID).Scan(
+		&twoFactor.Secret,
+		&twoFactor.EnabledAt,
+		&twoFactor.LastStep,
+		&twoFactor.FailedAttempts,
+		&twoFactor.LockedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoTwoFactorError
+		}
+		return nil, fmt.Errorf("%w: failed to get two-factor settings", ErrDatabaseError)
+	}
+
+	return &twoFactor, nil
+}
+
+func SetTwoFactorSecret(ctx context.Context, pool *pgxpool.Pool, userID int64, secret string) error {
+	result, err := pool.Exec(ctx, `
+		INSERT INTO two_factor (user_id, secret, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, failed_attempts = 0, locked_at = NULL, created_at = EXCLUDED.created_at
+		WHERE two_factor.enabled_at IS NULL`,
+		userID, secret, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to save two-factor secret", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrTwoFactorEnabledError
+	}
+
+	return nil
+}
+
+func EnableTwoFactor(ctx context.Context, pool *pgxpool.Pool, userID, step int64, codeHashes []string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		UPDATE two_factor SET enabled_at = $1, last_step = $2
+		WHERE user_id = $3 AND enabled_at IS NULL`,
+		time.Now(), step, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to enable two-factor", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoTwoFactorError
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("%w: failed to replace recovery codes", ErrDatabaseError)
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, codeHash)
+		if err != nil {
+			return fmt.Errorf("%w: failed to insert recovery code", ErrDatabaseError)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func UseTwoFactorStep(ctx context.Context, pool *pgxpool.Pool, userID, step int64) error {
+	result, err := pool.Exec(ctx, `
+		UPDATE two_factor SET last_step = $1
+		WHERE user_id = $2 AND enabled_at IS NOT NULL AND last_step < $1`,
+		step, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to record two-factor code", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrTwoFactorCodeUsedError
+	}
+
+	return nil
+}
+
+// RecordTwoFactorFailure counts a wrong code. The maxAttempts-th in a row
+// locks code entry and starts counting again, the time of the lock is
+// returned when that happens.
+func RecordTwoFactorFailure(ctx context.Context, pool *pgxpool.Pool, userID int64, maxAttempts int) (*time.Time, error) {
+	var failedAttempts int
+	var lockedAt *time.Time
+	err := pool.QueryRow(ctx, `
+		UPDATE two_factor SET
+			failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+			locked_at = CASE WHEN failed_attempts + 1 >= $2 THEN $3 ELSE locked_at END
+		WHERE user_id = $1
+		RETURNING failed_attempts, locked_at`,
+		userID, maxAttempts, time.Now(),
+	).Scan(&failedAttempts, &lockedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoTwoFactorError
+		}
+		return nil, fmt.Errorf("%w: failed to record two-factor failure", ErrDatabaseError)
+	}
+
+	// The count only goes back to zero when this failure set the lock
+	if failedAttempts > 0 {
+		return nil, nil
+	}
+	return lockedAt, nil
+}
+
+// ResetTwoFactorFailures forgets the wrong codes before a right one
+func ResetTwoFactorFailures(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
+	_, err := pool.Exec(ctx, "UPDATE two_factor SET failed_attempts = 0 WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to reset two-factor failures", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func UseRecoveryCode(ctx context.Context, pool *pgxpool.Pool, userID int64, codeHash string) error {
+	result, err := pool.Exec(ctx, `
+		UPDATE recovery_codes SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`,
+		time.Now(), userID, codeHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: failed to use recovery code", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRecoveryCodeError
+	}
+
+	return nil
+}
+
+func CountRecoveryCodes(ctx context.Context, pool *pgxpool.Pool, userID int64) (int, error) {
+	var count int
+	err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to count recovery codes", ErrDatabaseError)
+	}
+
+	return count, nil
+}
+
+func DisableTwoFactor(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, "DELETE FROM two_factor WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to disable two-factor", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoTwoFactorError
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("%w: failed to delete recovery codes", ErrDatabaseError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/GHutch55/fragments/backend/api/v1/models"
 	"github.com/jackc/pgx/v5"
@@ -47,7 +48,7 @@ func CreateUser(ctx context.Context, pool *pgxpool.Pool, user *models.User) erro
 
 func GetUser(ctx context.Context, pool *pgxpool.Pool, userID int64, user *models.User) error {
 	selectQuery := `
-		SELECT id, username, created_at, updated_at
+		SELECT id, username, created_at, updated_at, token_generation
 		FROM users WHERE id = $1`
 
 	err := pool.QueryRow(ctx, selectQuery, userID).Scan(
@@ -55,6 +56,7 @@ func GetUser(ctx context.Context, pool *pgxpool.Pool, userID int64, user *models
 		&user.Username,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.TokenGeneration,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -256,7 +258,7 @@ func CreateUserWithPassword(ctx context.Context, pool *pgxpool.Pool, user *UserW
 
 func GetUserByUsername(ctx context.Context, pool *pgxpool.Pool, username string) (*UserWithPassword, error) {
 	selectQuery := `
-        SELECT id, username, password_hash, created_at, updated_at
+        SELECT id, username, coalesce(password_hash, ''), created_at, updated_at, token_generation
         FROM users WHERE username = $1`
 
 	var user UserWithPassword
@@ -266,6 +268,7 @@ func GetUserByUsername(ctx context.Context, pool *pgxpool.Pool, username string)
 		&user.Password,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.TokenGeneration,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -279,12 +282,18 @@ func GetUserByUsername(ctx context.Context, pool *pgxpool.Pool, username string)
 }
 
 func UpdateUserPassword(ctx context.Context, pool *pgxpool.Pool, userID int64, hashedPassword string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
 	updateQuery := `
         UPDATE users
         SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
         WHERE id = $2`
 
-	result, err := pool.Exec(ctx, updateQuery, hashedPassword, userID)
+	result, err := tx.Exec(ctx, updateQuery, hashedPassword, userID)
 	if err != nil {
 		fmt.Printf("Database error updating password for user ID %d: %v\n", userID, err)
 		return fmt.Errorf("%w: failed to update password", ErrDatabaseError)
@@ -295,5 +304,51 @@ func UpdateUserPassword(ctx context.Context, pool *pgxpool.Pool, userID int64, h
 		return fmt.Errorf("user with ID %d does not exist: %w", userID, ErrNoUserError)
 	}
 
+	if err = revokeUserTokens(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+func RevokeUserTokens(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start transaction", ErrDatabaseError)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = revokeUserTokens(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: failed to commit transaction", ErrDatabaseError)
+	}
+
+	return nil
+}
+
+// revokeUserTokens bumps the user's token generation and revokes their
+// sessions inside tx
+func revokeUserTokens(ctx context.Context, tx pgx.Tx, userID int64) error {
+	result, err := tx.Exec(ctx, "UPDATE users SET token_generation = token_generation + 1 WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to revoke tokens", ErrDatabaseError)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user with ID %d does not exist: %w", userID, ErrNoUserError)
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL", time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to revoke sessions", ErrDatabaseError)
+	}
+
 	return nil
 }
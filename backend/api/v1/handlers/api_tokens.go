@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	MaxAPITokenNameLength = 100
+	// DefaultAPITokenDays and MaxAPITokenDays bound how long a token lives,
+	// a leaked token should not work forever
+	DefaultAPITokenDays = 30
+	MaxAPITokenDays     = 365
+)
+
+type APITokenHandler struct {
+	DB      database.APITokenStore
+	Folders database.FolderStore
+}
+
+// CreateAPIToken issues a personal API token. The response is the only time
+// the token itself is shown.
+func (h *APITokenHandler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	newToken, err := h.validateAPIToken(&req)
+	if err != nil {
+		SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	newToken.UserID = user.ID
+
+	// A token can only be limited to a folder the user owns
+	if newToken.FolderID != nil {
+		folder, err := h.Folders.GetFolder(r.Context(), *newToken.FolderID)
+		if err == nil && folder.UserID != user.ID {
+			err = database.ErrNoFolderError // Don't reveal existence
+		}
+		if err != nil {
+			if errors.Is(err, database.ErrNoFolderError) {
+				SendError(w, "Folder not found", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, database.ErrDatabaseError) {
+				SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+				return
+			}
+			SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	token, tokenHash, prefix, err := middleware.GenerateAPIToken()
+	if err != nil {
+		SendError(w, "Failed to generate API token", http.StatusInternalServerError)
+		return
+	}
+	newToken.Prefix = prefix
+
+	err = h.DB.CreateAPIToken(r.Context(), newToken, tokenHash)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			SendError(w, "API token name already exists", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.CreatedAPIToken{
+		APIToken: *newToken,
+		Token:    token,
+	})
+}
+
+// GetAPITokens lists the user's tokens, without the tokens themselves
+func (h *APITokenHandler) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := h.DB.GetAPITokens(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": tokens,
+	})
+}
+
+// DeleteAPIToken revokes a token, it stops working straight away
+func (h *APITokenHandler) DeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || tokenID <= 0 {
+		SendError(w, "Invalid API token ID", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.DB.GetAPIToken(r.Context(), tokenID)
+	if err == nil && token.UserID != user.ID {
+		err = database.ErrNoAPITokenError // Don't reveal existence
+	}
+	if err == nil {
+		err = h.DB.DeleteAPIToken(r.Context(), tokenID)
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrNoAPITokenError) {
+			SendError(w, "API token not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateAPIToken checks a create request and turns it into the token to
+// store
+func (h *APITokenHandler) validateAPIToken(req *models.CreateAPITokenRequest) (*models.APIToken, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	if utf8.RuneCountInString(name) > MaxAPITokenNameLength {
+		return nil, fmt.Errorf("name must be less than %d characters", MaxAPITokenNameLength)
+	}
+
+	// Scopes are stored in a fixed order, whatever order they were asked for in
+	var scopes []string
+	for _, scope := range models.APITokenScopes {
+		if slices.Contains(req.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.APITokenScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q, scopes must be %s", scope, strings.Join(models.APITokenScopes, ", "))
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	if req.FolderID != nil {
+		if *req.FolderID <= 0 {
+			return nil, errors.New("Invalid folder ID")
+		}
+		// folders:write reaches every folder, so it can't be kept to one
+		if slices.Contains(scopes, models.ScopeFoldersWrite) {
+			return nil, fmt.Errorf("a token limited to a folder can't have the %s scope", models.ScopeFoldersWrite)
+		}
+	}
+
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = DefaultAPITokenDays
+	}
+	if days < 1 || days > MaxAPITokenDays {
+		return nil, fmt.Errorf("expires_in_days must be between 1 and %d", MaxAPITokenDays)
+	}
+
+	return &models.APIToken{
+		Name:      name,
+		Scopes:    scopes,
+		FolderID:  req.FolderID,
+		ExpiresAt: time.Now().AddDate(0, 0, days),
+	}, nil
+}
+
+// inTokenFolder reports whether a snippet in folderID is within reach of the
+// request's API token. Tokens that aren't limited to a folder reach them all.
+func inTokenFolder(r *http.Request, folderID *int64) bool {
+	tokenFolderID, limited := middleware.GetTokenFolderID(r.Context())
+	return !limited || (folderID != nil && *folderID == tokenFolderID)
+}
+
+// keepInTokenFolder puts a snippet saved with an API token limited to a folder
+// in that folder, and writes an error response when it was meant for another
+func keepInTokenFolder(w http.ResponseWriter, r *http.Request, snippet *models.Snippet) bool {
+	tokenFolderID, limited := middleware.GetTokenFolderID(r.Context())
+	if !limited {
+		return true
+	}
+
+	if snippet.FolderID == nil {
+		snippet.FolderID = &tokenFolderID
+		return true
+	}
+	if *snippet.FolderID != tokenFolderID {
+		SendError(w, "API token is limited to another folder", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -11,19 +11,29 @@ import (
 	"github.com/GHutch55/fragments/backend/api/v1/database"
 	"github.com/GHutch55/fragments/backend/api/v1/middleware"
 	"github.com/GHutch55/fragments/backend/api/v1/models"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// freshSignInWindow is how recently a user without a password must have
+// signed in to set their first one
+const freshSignInWindow = 5 * time.Minute
+
 type AuthHandler struct {
-	DB             *pgxpool.Pool
+	DB             database.UserStore
+	Sessions       database.SessionStore
+	TwoFactor      database.TwoFactorStore
 	AuthMiddleware *middleware.AuthMiddleware
+	// RefreshTokenTTL is how long a session lasts without being refreshed
+	RefreshTokenTTL time.Duration
 }
 
-func NewAuthHandler(pool *pgxpool.Pool, authMiddleware *middleware.AuthMiddleware) *AuthHandler {
+func NewAuthHandler(users database.UserStore, sessions database.SessionStore, twoFactor database.TwoFactorStore, authMiddleware *middleware.AuthMiddleware, refreshTokenTTL time.Duration) *AuthHandler {
 	return &AuthHandler{
-		DB:             pool,
-		AuthMiddleware: authMiddleware,
+		DB:              users,
+		Sessions:        sessions,
+		TwoFactor:       twoFactor,
+		AuthMiddleware:  authMiddleware,
+		RefreshTokenTTL: refreshTokenTTL,
 	}
 }
 
@@ -31,8 +41,9 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+		Username   string `json:"username"`
+		Password   string `json:"password"`
+		DeviceName string `json:"device_name"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -61,7 +72,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Password: string(hashedPassword),
 	}
 
-	err = database.CreateUserWithPassword(r.Context(), h.DB, userWithPassword)
+	err = h.DB.CreateUserWithPassword(r.Context(), userWithPassword)
 	if err != nil {
 		if database.IsUsernameExistsError(err) {
 			SendError(w, "Username already exists", http.StatusConflict)
@@ -75,8 +86,8 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := h.AuthMiddleware.GenerateToken(&userWithPassword.User)
+	// Sign the new user in
+	tokens, err := h.startSession(r, &userWithPassword.User, req.DeviceName)
 	if err != nil {
 		SendError(w, "Failed to generate authentication token", http.StatusInternalServerError)
 		return
@@ -91,8 +102,8 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := models.AuthResponse{
-		Token: token,
-		User:  userResponse,
+		TokenResponse: *tokens,
+		User:          userResponse,
 	}
 
 	w.WriteHeader(http.StatusCreated)
@@ -115,7 +126,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get user by username
-	user, err := database.GetUserByUsername(r.Context(), h.DB, loginReq.Username)
+	user, err := h.DB.GetUserByUsername(r.Context(), loginReq.Username)
 	if err != nil {
 		// Use generic message to prevent username enumeration
 		time.Sleep(100 * time.Millisecond) // delay to prevent timing attacks
@@ -132,8 +143,14 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := h.AuthMiddleware.GenerateToken(&user.User)
+	// With two-factor on the password only earns a challenge, which is
+	// exchanged for tokens at /auth/2fa/verify
+	if h.sendTwoFactorChallenge(w, r, &user.User, loginReq.DeviceName) {
+		return
+	}
+
+	// Start a session and issue its tokens
+	tokens, err := h.startSession(r, &user.User, loginReq.DeviceName)
 	if err != nil {
 		SendError(w, "Failed to generate authentication token", http.StatusInternalServerError)
 		return
@@ -148,8 +165,8 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := models.AuthResponse{
-		Token: token,
-		User:  userResponse,
+		TokenResponse: *tokens,
+		User:          userResponse,
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -198,17 +215,30 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current user with password from database
-	currentUser, err := database.GetUserByUsername(r.Context(), h.DB, user.Username)
+	currentUser, err := h.DB.GetUserByUsername(r.Context(), user.Username)
 	if err != nil {
 		SendError(w, "Unable to verify current password", http.StatusInternalServerError)
 		return
 	}
 
-	// Verify current password
-	err = bcrypt.CompareHashAndPassword([]byte(currentUser.Password), []byte(changePasswordReq.CurrentPassword))
-	if err != nil {
-		SendError(w, "Current password is incorrect", http.StatusUnauthorized)
-		return
+	// Verify current password. Users who only sign in with an identity
+	// provider have none yet, and prove it is them some other way before
+	// setting their first one here.
+	if currentUser.Password == "" {
+		if !h.checkFirstPasswordProof(w, r, user.ID, changePasswordReq.Code) {
+			return
+		}
+	} else {
+		if strings.TrimSpace(changePasswordReq.CurrentPassword) == "" {
+			SendError(w, "current password is required", http.StatusBadRequest)
+			return
+		}
+
+		err = bcrypt.CompareHashAndPassword([]byte(currentUser.Password), []byte(changePasswordReq.CurrentPassword))
+		if err != nil {
+			SendError(w, "Current password is incorrect", http.StatusUnauthorized)
+			return
+		}
 	}
 
 	// Hash new password
@@ -218,17 +248,90 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update password in database
-	err = database.UpdateUserPassword(r.Context(), h.DB, user.ID, string(hashedPassword))
+	// The current session is revoked along with every other, so remember
+	// its device to sign this one back in
+	var device string
+	if sessionID, ok := middleware.GetSessionIDFromContext(r.Context()); ok {
+		if session, err := h.Sessions.GetSession(r.Context(), sessionID); err == nil {
+			device = session.Device
+		}
+	}
+
+	// Update password in database, revoking all existing tokens
+	err = h.DB.UpdateUserPassword(r.Context(), user.ID, string(hashedPassword))
 	if err != nil {
 		SendError(w, "Failed to update password", http.StatusInternalServerError)
 		return
 	}
 
+	// Reload the user for the new token generation
+	var updatedUser models.User
+	if err := h.DB.GetUser(r.Context(), user.ID, &updatedUser); err != nil {
+		SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.startSession(r, &updatedUser, device)
+	if err != nil {
+		SendError(w, "Failed to generate authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.ChangePasswordResponse{
+		Message:       "Password updated successfully",
+		TokenResponse: *tokens,
+	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Password updated successfully",
-	})
+	json.NewEncoder(w).Encode(response)
+}
+
+// checkFirstPasswordProof stands in for the current password of a user who
+// has none. An access token alone isn't enough, or anyone who got hold of one
+// could keep the account with a password of their own: users with two-factor
+// on give a code, others must have just signed in with their identity
+// provider on this session.
+func (h *AuthHandler) checkFirstPasswordProof(w http.ResponseWriter, r *http.Request, userID int64, code string) bool {
+	twoFactor, err := h.TwoFactor.GetTwoFactor(r.Context(), userID)
+	if err != nil && !errors.Is(err, database.ErrNoTwoFactorError) {
+		SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+		return false
+	}
+
+	if err == nil && twoFactor.Enabled() {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			SendError(w, "code is required", http.StatusBadRequest)
+			return false
+		}
+
+		valid, err := h.checkTwoFactorCode(r.Context(), userID, code)
+		if errors.Is(err, errTwoFactorLocked) {
+			SendError(w, "Too many wrong two-factor codes, try again later", http.StatusTooManyRequests)
+			return false
+		}
+		if err != nil {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return false
+		}
+		if !valid {
+			SendError(w, "Invalid two-factor code", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+
+	var session *models.Session
+	sessionID, ok := middleware.GetSessionIDFromContext(r.Context())
+	if ok {
+		session, err = h.Sessions.GetSession(r.Context(), sessionID)
+	}
+	if !ok || err != nil || time.Since(session.SignedInAt) > freshSignInWindow {
+		SendError(w, "Sign in again with your identity provider to set a password", http.StatusForbidden)
+		return false
+	}
+
+	return true
 }
 
 // validateRegistration validates registration input
@@ -271,10 +374,6 @@ func (h *AuthHandler) validateLogin(req *models.LoginRequest) error {
 
 // validateChangePassword validates change password input
 func (h *AuthHandler) validateChangePassword(req *models.ChangePasswordRequest) error {
-	if strings.TrimSpace(req.CurrentPassword) == "" {
-		return errors.New("current password is required")
-	}
-
 	if strings.TrimSpace(req.NewPassword) == "" {
 		return errors.New("new password is required")
 	}
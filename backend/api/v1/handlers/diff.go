@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines matches the default context of diff -u
+const diffContextLines = 3
+
+// unifiedDiff returns a line-based unified diff between a and b, or an empty
+// string when they are identical
+func unifiedDiff(fromName, toName, a, b string) string {
+	d := &lineDiff{a: splitLines(a), b: splitLines(b)}
+	d.deleted = make([]bool, len(d.a))
+	d.inserted = make([]bool, len(d.b))
+	d.compare(0, len(d.a), 0, len(d.b))
+
+	ops := d.script()
+
+	var out strings.Builder
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Grow the hunk while the unchanged gap to the next change is small
+		// enough that the two context blocks would touch
+		end := i + 1
+		for j := end; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+				continue
+			}
+			if j-end+1 > 2*diffContextLines {
+				break
+			}
+		}
+
+		first := max(i-diffContextLines, 0)
+		last := min(end+diffContextLines, len(ops))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&out, ops[first:last])
+
+		i = last
+	}
+
+	return out.String()
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+	aPos int // lines of a consumed before this op
+	bPos int // lines of b consumed before this op
+}
+
+func writeHunk(out *strings.Builder, ops []diffOp) {
+	aCount, bCount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			aCount++
+		}
+		if op.kind != '-' {
+			bCount++
+		}
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n",
+		hunkRange(ops[0].aPos, aCount), hunkRange(ops[0].bPos, bCount))
+	for _, op := range ops {
+		out.WriteByte(op.kind)
+		out.WriteString(op.line)
+		out.WriteByte('\n')
+	}
+}
+
+// hunkRange formats a hunk range the way GNU diff does: an empty range points
+// at the line before it, and a count of one is left out
+func hunkRange(pos, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", pos)
+	case 1:
+		return fmt.Sprintf("%d", pos+1)
+	default:
+		return fmt.Sprintf("%d,%d", pos+1, count)
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// lineDiff finds a shortest edit script between two sets of lines using
+// Myers' linear space refinement
+type lineDiff struct {
+	a, b     []string
+	deleted  []bool
+	inserted []bool
+}
+
+// script walks both sides and turns the marked lines into diff operations
+func (d *lineDiff) script() []diffOp {
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(d.a) || j < len(d.b) {
+		switch {
+		case i < len(d.a) && d.deleted[i]:
+			ops = append(ops, diffOp{kind: '-', line: d.a[i], aPos: i, bPos: j})
+			i++
+		case j < len(d.b) && d.inserted[j]:
+			ops = append(ops, diffOp{kind: '+', line: d.b[j], aPos: i, bPos: j})
+			j++
+		default:
+			ops = append(ops, diffOp{kind: ' ', line: d.a[i], aPos: i, bPos: j})
+			i++
+			j++
+		}
+	}
+	return ops
+}
+
+func (d *lineDiff) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	if aLo == aHi || bLo == bHi {
+		d.markAll(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	x, y := d.middleSnake(aLo, aHi, bLo, bHi)
+	if (x == aLo && y == bLo) || (x == aHi && y == bHi) {
+		// No progress possible, fall back to replacing the whole range
+		d.markAll(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	d.compare(aLo, x, bLo, y)
+	d.compare(x, aHi, y, bHi)
+}
+
+func (d *lineDiff) markAll(aLo, aHi, bLo, bHi int) {
+	for i := aLo; i < aHi; i++ {
+		d.deleted[i] = true
+	}
+	for j := bLo; j < bHi; j++ {
+		d.inserted[j] = true
+	}
+}
+
+// middleSnake runs the search forwards from the start and backwards from the
+// end at the same time and returns a point where the two paths overlap, which
+// always lies on a shortest edit script
+func (d *lineDiff) middleSnake(aLo, aHi, bLo, bHi int) (int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	limit := (n + m + 1) / 2
+	offset := limit + 1
+
+	// forward[k] is the furthest x reached on diagonal k = x - y, backward[c]
+	// the same measured from the end of both ranges
+	forward := make([]int, 2*limit+3)
+	backward := make([]int, 2*limit+3)
+
+	for step := 0; step <= limit; step++ {
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			c := delta - k
+			if odd && c >= -(step-1) && c <= step-1 && x+backward[offset+c] >= n {
+				return aLo + x, bLo + y
+			}
+		}
+
+		for c := -step; c <= step; c += 2 {
+			var u int
+			if c == -step || (c != step && backward[offset+c-1] < backward[offset+c+1]) {
+				u = backward[offset+c+1]
+			} else {
+				u = backward[offset+c-1] + 1
+			}
+			v := u - c
+			for u < n && v < m && d.a[aHi-1-u] == d.b[bHi-1-v] {
+				u++
+				v++
+			}
+			backward[offset+c] = u
+
+			k := delta - c
+			if !odd && k >= -step && k <= step && forward[offset+k]+u >= n {
+				return aHi - u, bHi - v
+			}
+		}
+	}
+
+	return aLo, bLo
+}
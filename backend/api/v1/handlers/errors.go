@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
 )
 
 // ErrorResponse represents a JSON error response
@@ -10,6 +12,10 @@ type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
 	Code    string `json:"code,omitempty"`
+	// Position points at the offending character of a malformed search query
+	Position *int `json:"position,omitempty"`
+	// DuplicateIDs lists the snippets that already hold the same content
+	DuplicateIDs []int64 `json:"duplicate_ids,omitempty"`
 }
 
 // APIResponse represents a standardized API response
@@ -54,6 +60,36 @@ func SendErrorWithCode(w http.ResponseWriter, message, code string, statusCode i
 	json.NewEncoder(w).Encode(response)
 }
 
+// SendSearchQueryError sends a 400 for a malformed search query, including the
+// position of the problem so the client can point at it
+func SendSearchQueryError(w http.ResponseWriter, err *database.SearchQueryError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+
+	response := ErrorResponse{
+		Error:    http.StatusText(http.StatusBadRequest),
+		Message:  "Invalid search query: " + err.Error(),
+		Code:     "invalid_search_query",
+		Position: &err.Position,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// SendDuplicateContentError sends a 409 naming the snippets that already hold
+// the content being saved
+func SendDuplicateContentError(w http.ResponseWriter, ids []int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+
+	response := ErrorResponse{
+		Error:        http.StatusText(http.StatusConflict),
+		Message:      "A snippet with the same content already exists, pass allow_duplicate=true to save it anyway",
+		Code:         "duplicate_content",
+		DuplicateIDs: ids,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
 // SendData sends a successful response with data
 func SendData(w http.ResponseWriter, data interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
@@ -12,7 +12,6 @@ import (
 	"github.com/GHutch55/fragments/backend/api/v1/middleware"
 	"github.com/GHutch55/fragments/backend/api/v1/models"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const (
@@ -21,7 +20,11 @@ const (
 )
 
 type FolderHandler struct {
-	DB *pgxpool.Pool
+	DB database.FolderStore
+	// SavedSearches and Snippets list saved searches as virtual folders in
+	// the tree
+	SavedSearches database.SavedSearchStore
+	Snippets      database.SnippetStore
 }
 
 func (h *FolderHandler) CreateFolder(w http.ResponseWriter, r *http.Request) {
@@ -49,7 +52,7 @@ func (h *FolderHandler) CreateFolder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.CreateFolder(r.Context(), h.DB, &newFolder)
+	err = h.DB.CreateFolder(r.Context(), &newFolder)
 	if err != nil {
 		if strings.Contains(err.Error(), "already exists") {
 			SendError(w, "Folder name already exists in this location", http.StatusConflict)
@@ -97,7 +100,7 @@ func (h *FolderHandler) GetFolder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	gotFolder, err := database.GetFolder(r.Context(), h.DB, folderID)
+	gotFolder, err := h.DB.GetFolder(r.Context(), folderID)
 	if err != nil {
 		if errors.Is(err, database.ErrNoFolderError) {
 			SendError(w, "Folder not found", http.StatusNotFound)
@@ -159,7 +162,7 @@ func (h *FolderHandler) GetFolders(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Only get folders for the authenticated user
-	folders, total, err := database.GetFolders(r.Context(), h.DB, page, limit, user.ID, parentID)
+	folders, total, err := h.DB.GetFolders(r.Context(), page, limit, user.ID, parentID)
 	if err != nil {
 		if errors.Is(err, database.ErrDatabaseError) {
 			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
@@ -189,6 +192,106 @@ func (h *FolderHandler) GetFolders(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+func (h *FolderHandler) GetFolderTree(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	tree, err := h.DB.GetFolderTree(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data": tree,
+	}
+
+	// saved_searches=true adds the user's saved searches as virtual folders
+	if includeStr := r.URL.Query().Get("saved_searches"); includeStr != "" {
+		include, err := strconv.ParseBool(includeStr)
+		if err != nil {
+			SendError(w, "saved_searches must be true or false", http.StatusBadRequest)
+			return
+		}
+
+		if include {
+			nodes, err := savedSearchNodes(r.Context(), h.SavedSearches, h.Snippets, user.ID)
+			if err != nil {
+				if errors.Is(err, database.ErrDatabaseError) {
+					SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+					return
+				}
+				SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+				return
+			}
+			response["saved_searches"] = nodes
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *FolderHandler) GetFolderPath(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	folderIDStr := chi.URLParam(r, "id")
+	if folderIDStr == "" {
+		SendError(w, "Folder ID is required", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.ParseInt(folderIDStr, 10, 64)
+	if err != nil || folderID <= 0 {
+		SendError(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	path, err := h.DB.GetFolderPath(r.Context(), folderID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoFolderError) {
+			SendError(w, "Folder not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	// Verify user owns this folder, the last entry is the folder itself
+	if path[len(path)-1].UserID != user.ID {
+		SendError(w, "Folder not found", http.StatusNotFound) // Don't reveal existence
+		return
+	}
+
+	response := map[string]interface{}{
+		"data": path,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
 func (h *FolderHandler) UpdateFolder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -212,7 +315,7 @@ func (h *FolderHandler) UpdateFolder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if folder exists and user owns it
-	existingFolder, err := database.GetFolder(r.Context(), h.DB, folderID)
+	existingFolder, err := h.DB.GetFolder(r.Context(), folderID)
 	if err != nil {
 		if errors.Is(err, database.ErrNoFolderError) {
 			SendError(w, "Folder not found", http.StatusNotFound)
@@ -247,7 +350,7 @@ func (h *FolderHandler) UpdateFolder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.UpdateFolder(r.Context(), h.DB, folderID, &updateFolder)
+	err = h.DB.UpdateFolder(r.Context(), folderID, &updateFolder)
 	if err != nil {
 		if errors.Is(err, database.ErrNoFolderError) {
 			SendError(w, "Folder not found", http.StatusNotFound)
@@ -299,8 +402,19 @@ func (h *FolderHandler) DeleteFolder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// restrict (the default) refuses folders with subfolders, cascade trashes
+	// the whole subtree and reparent moves the contents up a level
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = models.FolderDeleteRestrict
+	}
+	if mode != models.FolderDeleteRestrict && mode != models.FolderDeleteCascade && mode != models.FolderDeleteReparent {
+		SendError(w, "mode must be restrict, cascade or reparent", http.StatusBadRequest)
+		return
+	}
+
 	// Check if folder exists and user owns it
-	existingFolder, err := database.GetFolder(r.Context(), h.DB, folderID)
+	existingFolder, err := h.DB.GetFolder(r.Context(), folderID)
 	if err != nil {
 		if errors.Is(err, database.ErrNoFolderError) {
 			SendError(w, "Folder not found", http.StatusNotFound)
@@ -320,14 +434,14 @@ func (h *FolderHandler) DeleteFolder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.DeleteFolder(r.Context(), h.DB, folderID)
+	result, err := h.DB.DeleteFolder(r.Context(), folderID, mode)
 	if err != nil {
 		if errors.Is(err, database.ErrNoFolderError) {
 			SendError(w, "Folder not found", http.StatusNotFound)
 			return
 		}
 		if errors.Is(err, database.ErrFolderHasChildren) {
-			SendError(w, "Cannot delete folder: folder contains subfolders", http.StatusConflict)
+			SendError(w, "Cannot delete folder: folder contains subfolders, use mode=cascade or mode=reparent", http.StatusConflict)
 			return
 		}
 		if errors.Is(err, database.ErrDatabaseError) {
@@ -338,7 +452,8 @@ func (h *FolderHandler) DeleteFolder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
 }
 
 func (h *FolderHandler) validateFolder(folder *models.Folder) error {
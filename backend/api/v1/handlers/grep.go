@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+const (
+	MaxGrepPatternLength = 1000
+	// MaxGrepLineLength is how much of a matching line is sent back, in characters
+	MaxGrepLineLength = 500
+)
+
+// errGrepMatchLimit stops the walk once the match budget is spent
+var errGrepMatchLimit = errors.New("grep match limit reached")
+
+type GrepHandler struct {
+	DB database.SnippetStore
+	// Timeout and MaxMatches bound the work a single grep may do
+	Timeout    time.Duration
+	MaxMatches int
+}
+
+// GrepSnippets runs an RE2 pattern over every line of the user's snippets and
+// streams the matches as newline-delimited JSON, ending with a summary line
+func (h *GrepHandler) GrepSnippets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	pattern := r.URL.Query().Get("pattern")
+	if pattern == "" {
+		SendError(w, "pattern is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(pattern) > MaxGrepPatternLength {
+		SendError(w, "pattern is too long", http.StatusBadRequest)
+		return
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		SendErrorWithCode(w, "Invalid pattern: "+err.Error(), "invalid_pattern", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	summary := models.GrepSummary{Type: models.GrepLineSummary}
+	err = h.DB.WalkSnippets(ctx, user.ID, func(snippet *models.Snippet) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		summary.SnippetsSearched++
+
+		found := false
+		content := snippet.Content
+		for line := 1; ; line++ {
+			text, rest, more := strings.Cut(content, "\n")
+			text = strings.TrimSuffix(text, "\r")
+
+			if re.MatchString(text) {
+				if summary.Matches >= h.MaxMatches {
+					return errGrepMatchLimit
+				}
+
+				match := models.GrepMatch{
+					Type:      models.GrepLineMatch,
+					SnippetID: snippet.ID,
+					Title:     snippet.Title,
+					Line:      line,
+					Text:      text,
+				}
+				if utf8.RuneCountInString(text) > MaxGrepLineLength {
+					match.Text = string([]rune(text)[:MaxGrepLineLength])
+					match.Truncated = true
+				}
+
+				encoder.Encode(match)
+				summary.Matches++
+				found = true
+			}
+
+			if !more {
+				break
+			}
+			content = rest
+		}
+
+		// Send each snippet's matches as soon as they are found
+		if found && flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errGrepMatchLimit):
+		summary.Truncated = true
+		summary.Reason = models.GrepReasonMatchLimit
+	case r.Context().Err() != nil:
+		// The client went away, there is no one to tell
+		return
+	case ctx.Err() != nil:
+		summary.Truncated = true
+		summary.Reason = models.GrepReasonTimeLimit
+	case err != nil:
+		// The status is already sent, so the failure goes in the stream
+		encoder.Encode(models.GrepError{Type: models.GrepLineError, Message: "Unable to process request at this time"})
+		return
+	}
+
+	encoder.Encode(summary)
+}
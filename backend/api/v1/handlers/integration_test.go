@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const testPassword = "Correct-Horse-9-Battery"
+
+// testAPI serves the auth, API token, snippet, folder and suggest routes as main.go mounts them,
+// backed by a fresh in-memory store
+type testAPI struct {
+	t      *testing.T
+	server *httptest.Server
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	store := database.NewMemoryStore()
+	authMiddleware := middleware.NewAuthMiddleware(store, store, store, "integration-test-secret-of-32-chars", 15*time.Minute)
+	authHandler := NewAuthHandler(store, store, store, authMiddleware, 24*time.Hour)
+	snippetHandler := &SnippetHandler{DB: store, Folders: store}
+	folderHandler := &FolderHandler{DB: store, SavedSearches: store, Snippets: store}
+	suggestHandler := &SuggestHandler{DB: store}
+	apiTokenHandler := &APITokenHandler{DB: store, Folders: store}
+
+	r := chi.NewRouter()
+	r.Post("/auth/register", authHandler.Register)
+	r.Post("/auth/login", authHandler.Login)
+	r.Post("/auth/refresh", authHandler.Refresh)
+	r.Group(func(r chi.Router) {
+		r.Use(authMiddleware.RequireAuth)
+		r.Post("/auth/change-password", authHandler.ChangePassword)
+		r.Get("/auth/sessions", authHandler.GetSessions)
+
+		r.Post("/snippets", snippetHandler.CreateSnippet)
+		r.Get("/snippets", snippetHandler.GetSnippets)
+		r.Get("/snippets/{id}", snippetHandler.GetSnippet)
+		r.Put("/snippets/{id}", snippetHandler.UpdateSnippet)
+		r.Delete("/snippets/{id}", snippetHandler.DeleteSnippet)
+
+		r.Post("/folders", folderHandler.CreateFolder)
+		r.Get("/folders/{id}", folderHandler.GetFolder)
+
+		r.Post("/auth/tokens", apiTokenHandler.CreateAPIToken)
+	})
+	r.With(
+		middleware.TokenScopes(models.ScopeSnippetsRead, models.ScopeSnippetsWrite),
+		authMiddleware.RequireAuth,
+	).Get("/suggest", suggestHandler.Suggest)
+
+	api := &testAPI{t: t, server: httptest.NewServer(r)}
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+// do sends body as JSON with token as the bearer token, if given, and decodes
+// the response into out, if given. It returns the status code.
+func (api *testAPI) do(method, path, token string, body, out interface{}) int {
+	api.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			api.t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, api.server.URL+path, reader)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := api.server.Client().Do(req)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			api.t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// register signs a new user up, failing the test if that doesn't work
+func (api *testAPI) register(username string) models.AuthResponse {
+	api.t.Helper()
+	var auth models.AuthResponse
+	status := api.do(http.MethodPost, "/auth/register", "", map[string]string{
+		"username": username,
+		"password": testPassword,
+	}, &auth)
+	if status != http.StatusCreated {
+		api.t.Fatalf("registering %s: status %d", username, status)
+	}
+	return auth
+}
+
+func TestIntegrationSnippetLifecycle(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.register("alice").Token
+
+	var folder models.Folder
+	if status := api.do(http.MethodPost, "/folders", alice, map[string]string{"name": "http"}, &folder); status != http.StatusCreated {
+		t.Fatalf("creating folder: status %d", status)
+	}
+
+	var snippet models.Snippet
+	status := api.do(http.MethodPost, "/snippets", alice, map[string]interface{}{
+		"title":     "Decode a request",
+		"content":   "json.NewDecoder(r.Body).Decode(&req)",
+		"language":  "Go",
+		"tags":      []string{"json", "http"},
+		"folder_id": folder.ID,
+	}, &snippet)
+	if status != http.StatusCreated {
+		t.Fatalf("creating snippet: status %d", status)
+	}
+	if snippet.ID == 0 || snippet.Language != "go" {
+		t.Fatalf("created snippet %d with language %q", snippet.ID, snippet.Language)
+	}
+
+	var list struct {
+		Data       []models.Snippet `json:"data"`
+		Pagination struct {
+			Total int `json:"total"`
+		} `json:"pagination"`
+	}
+	if status := api.do(http.MethodGet, "/snippets?search=decoder", alice, nil, &list); status != http.StatusOK {
+		t.Fatalf("searching: status %d", status)
+	}
+	if list.Pagination.Total != 1 || list.Data[0].SearchHit == nil || list.Data[0].SearchHit.Lines[0] != 1 {
+		t.Fatalf("search found %d snippets, hit %+v", list.Pagination.Total, list.Data[0].SearchHit)
+	}
+
+	snippet.Title = "Decode a JSON request"
+	var updated models.Snippet
+	if status := api.do(http.MethodPut, fmt.Sprintf("/snippets/%d", snippet.ID), alice, snippet, &updated); status != http.StatusOK {
+		t.Fatalf("updating snippet: status %d", status)
+	}
+	if updated.Title != snippet.Title {
+		t.Errorf("updated title = %q", updated.Title)
+	}
+
+	// The same content again is refused unless the client insists
+	duplicate := map[string]interface{}{"title": "again", "content": snippet.Content, "language": "go"}
+	if status := api.do(http.MethodPost, "/snippets", alice, duplicate, nil); status != http.StatusConflict {
+		t.Errorf("duplicate content: status %d, want %d", status, http.StatusConflict)
+	}
+	if status := api.do(http.MethodPost, "/snippets?allow_duplicate=true", alice, duplicate, nil); status != http.StatusCreated {
+		t.Errorf("duplicate content allowed: status %d, want %d", status, http.StatusCreated)
+	}
+
+	path := fmt.Sprintf("/snippets/%d", snippet.ID)
+	if status := api.do(http.MethodDelete, path, alice, nil, nil); status != http.StatusOK && status != http.StatusNoContent {
+		t.Fatalf("deleting snippet: status %d", status)
+	}
+	if status := api.do(http.MethodGet, path, alice, nil, nil); status != http.StatusNotFound {
+		t.Errorf("deleted snippet: status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestIntegrationOwnership(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.register("alice").Token
+	bob := api.register("bob").Token
+
+	var folder models.Folder
+	api.do(http.MethodPost, "/folders", alice, map[string]string{"name": "private"}, &folder)
+	var snippet models.Snippet
+	api.do(http.MethodPost, "/snippets", alice, map[string]interface{}{
+		"title": "secret", "content": "secret", "language": "go",
+	}, &snippet)
+
+	snippetPath := fmt.Sprintf("/snippets/%d", snippet.ID)
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       interface{}
+		wantStatus int
+	}{
+		{"no token", http.MethodGet, "/snippets", "", nil, http.StatusUnauthorized},
+		{"bad token", http.MethodGet, "/snippets", "not-a-token", nil, http.StatusUnauthorized},
+		{"another user's snippet", http.MethodGet, snippetPath, bob, nil, http.StatusNotFound},
+		{"updating another user's snippet", http.MethodPut, snippetPath, bob, map[string]string{
+			"title": "mine", "content": "mine", "language": "go",
+		}, http.StatusNotFound},
+		{"deleting another user's snippet", http.MethodDelete, snippetPath, bob, nil, http.StatusNotFound},
+		{"another user's folder", http.MethodGet, fmt.Sprintf("/folders/%d", folder.ID), bob, nil, http.StatusNotFound},
+		{"saving into another user's folder", http.MethodPost, "/snippets", bob, map[string]interface{}{
+			"title": "mine", "content": "mine", "language": "go", "folder_id": folder.ID,
+		}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := api.do(tt.method, tt.path, tt.token, tt.body, nil); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+
+	var list struct {
+		Data []models.Snippet `json:"data"`
+	}
+	api.do(http.MethodGet, "/snippets", bob, nil, &list)
+	if len(list.Data) != 0 {
+		t.Errorf("bob sees %d snippets, want 0", len(list.Data))
+	}
+}
+
+func TestIntegrationSessions(t *testing.T) {
+	api := newTestAPI(t)
+	auth := api.register("alice")
+
+	var refreshed models.TokenResponse
+	status := api.do(http.MethodPost, "/auth/refresh", "", models.RefreshRequest{RefreshToken: auth.RefreshToken}, &refreshed)
+	if status != http.StatusOK || refreshed.RefreshToken == auth.RefreshToken {
+		t.Fatalf("refreshing: status %d", status)
+	}
+	if status := api.do(http.MethodGet, "/snippets", refreshed.Token, nil, nil); status != http.StatusOK {
+		t.Errorf("refreshed token: status %d, want %d", status, http.StatusOK)
+	}
+
+}
+
+func TestIntegrationConcurrentRefresh(t *testing.T) {
+	api := newTestAPI(t)
+	auth := api.register("alice")
+
+	// Two tabs refreshing with the same token at once both stay signed in
+	body, err := json.Marshal(models.RefreshRequest{RefreshToken: auth.RefreshToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	responses := make([]models.TokenResponse, 2)
+	statuses := make([]int, 2)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := api.server.Client().Post(api.server.URL+"/auth/refresh", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Errorf("refresh %d: %v", i, err)
+				return
+			}
+			defer resp.Body.Close()
+			statuses[i] = resp.StatusCode
+			json.NewDecoder(resp.Body).Decode(&responses[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, response := range responses {
+		if statuses[i] != http.StatusOK {
+			t.Fatalf("refresh %d: status %d, want %d", i, statuses[i], http.StatusOK)
+		}
+		if status := api.do(http.MethodGet, "/snippets", response.Token, nil, nil); status != http.StatusOK {
+			t.Errorf("access token of refresh %d: status %d, want %d", i, status, http.StatusOK)
+		}
+		if status := api.do(http.MethodPost, "/auth/refresh", "", models.RefreshRequest{RefreshToken: response.RefreshToken}, nil); status != http.StatusOK {
+			t.Errorf("refresh token of refresh %d: status %d, want %d", i, status, http.StatusOK)
+		}
+	}
+	if responses[0].RefreshToken == responses[1].RefreshToken {
+		t.Error("both refreshes got the same refresh token")
+	}
+
+	// Both tokens belong to the one session
+	var sessions struct {
+		Data []models.Session `json:"data"`
+	}
+	if status := api.do(http.MethodGet, "/auth/sessions", responses[0].Token, nil, &sessions); status != http.StatusOK || len(sessions.Data) != 1 {
+		t.Errorf("sessions after the race: status %d, %d sessions, want 1", status, len(sessions.Data))
+	}
+}
+
+func TestIntegrationPasswords(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.register("alice").Token
+
+	var login models.AuthResponse
+	if status := api.do(http.MethodPost, "/auth/login", "", models.LoginRequest{Username: "alice", Password: testPassword}, &login); status != http.StatusOK {
+		t.Fatalf("logging in: status %d", status)
+	}
+	if status := api.do(http.MethodPost, "/auth/login", "", models.LoginRequest{Username: "alice", Password: "wrong"}, nil); status != http.StatusUnauthorized {
+		t.Errorf("wrong password: status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	const newPassword = "Another-Horse-8-Battery"
+	status := api.do(http.MethodPost, "/auth/change-password", alice, models.ChangePasswordRequest{
+		CurrentPassword: "wrong",
+		NewPassword:     newPassword,
+	}, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("changing password with the wrong one: status %d, want %d", status, http.StatusUnauthorized)
+	}
+	var changed models.ChangePasswordResponse
+	status = api.do(http.MethodPost, "/auth/change-password", alice, models.ChangePasswordRequest{
+		CurrentPassword: testPassword,
+		NewPassword:     newPassword,
+	}, &changed)
+	if status != http.StatusOK {
+		t.Fatalf("changing password: status %d", status)
+	}
+
+	// Changing the password signs every other session out
+	for _, token := range []string{alice, login.Token} {
+		if status := api.do(http.MethodGet, "/snippets", token, nil, nil); status != http.StatusUnauthorized {
+			t.Errorf("token from before the change: status %d, want %d", status, http.StatusUnauthorized)
+		}
+	}
+	if status := api.do(http.MethodPost, "/auth/refresh", "", models.RefreshRequest{RefreshToken: login.RefreshToken}, nil); status != http.StatusUnauthorized {
+		t.Errorf("refresh token from before the change: status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := api.do(http.MethodGet, "/snippets", changed.Token, nil, nil); status != http.StatusOK {
+		t.Errorf("token from the change: status %d, want %d", status, http.StatusOK)
+	}
+
+	if status := api.do(http.MethodPost, "/auth/login", "", models.LoginRequest{Username: "alice", Password: testPassword}, nil); status != http.StatusUnauthorized {
+		t.Errorf("old password: status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := api.do(http.MethodPost, "/auth/login", "", models.LoginRequest{Username: "alice", Password: newPassword}, nil); status != http.StatusOK {
+		t.Errorf("new password: status %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestIntegrationSuggest(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.register("alice")
+
+	if status := api.do(http.MethodPost, "/snippets", alice.Token, models.Snippet{Title: "Retry with backoff", Content: "retry()", Language: "go"}, nil); status != http.StatusCreated {
+		t.Fatalf("creating snippet: status %d", status)
+	}
+
+	var suggestions struct {
+		Data models.Suggestions `json:"data"`
+	}
+	if status := api.do(http.MethodGet, "/suggest?q=re", alice.Token, nil, &suggestions); status != http.StatusOK {
+		t.Fatalf("suggest: status %d", status)
+	}
+	if len(suggestions.Data.Snippets) != 1 || suggestions.Data.Snippets[0].Value != "Retry with backoff" {
+		t.Errorf("snippet suggestions = %+v", suggestions.Data.Snippets)
+	}
+
+	for _, path := range []string{"/suggest", "/suggest?q=", "/suggest?q=%20%20"} {
+		if status := api.do(http.MethodGet, path, alice.Token, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want %d", path, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestIntegrationSuggestAPITokens(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.register("alice")
+
+	if status := api.do(http.MethodPost, "/snippets", alice.Token, models.Snippet{Title: "Retry with backoff", Content: "retry()", Language: "go"}, nil); status != http.StatusCreated {
+		t.Fatalf("creating snippet: status %d", status)
+	}
+	var folder models.Folder
+	if status := api.do(http.MethodPost, "/folders", alice.Token, models.Folder{Name: "Work"}, &folder); status != http.StatusCreated {
+		t.Fatalf("creating folder: status %d", status)
+	}
+
+	tests := []struct {
+		name   string
+		token  models.CreateAPITokenRequest
+		status int
+	}{
+		{"read", models.CreateAPITokenRequest{Name: "read", Scopes: []string{models.ScopeSnippetsRead}}, http.StatusOK},
+		{"write only", models.CreateAPITokenRequest{Name: "write", Scopes: []string{models.ScopeSnippetsWrite}}, http.StatusForbidden},
+		{"folders only", models.CreateAPITokenRequest{Name: "folders", Scopes: []string{models.ScopeFoldersWrite}}, http.StatusForbidden},
+		// Suggestions span every folder, so a token kept to one can't see them
+		{"limited to a folder", models.CreateAPITokenRequest{Name: "folder", Scopes: []string{models.ScopeSnippetsRead}, FolderID: &folder.ID}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created models.CreatedAPIToken
+			if status := api.do(http.MethodPost, "/auth/tokens", alice.Token, tt.token, &created); status != http.StatusCreated {
+				t.Fatalf("creating token: status %d", status)
+			}
+
+			var suggestions struct {
+				Data models.Suggestions `json:"data"`
+			}
+			status := api.do(http.MethodGet, "/suggest?q=re", created.Token, nil, &suggestions)
+			if status != tt.status {
+				t.Fatalf("suggest: status %d, want %d", status, tt.status)
+			}
+			if status == http.StatusOK && len(suggestions.Data.Snippets) != 1 {
+				t.Errorf("snippet suggestions = %+v", suggestions.Data.Snippets)
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/GHutch55/fragments/backend/api/v1/oidc"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// maxUsernameAttempts bounds the numbered usernames tried for a new user
+	// whose name from the provider is already taken
+	maxUsernameAttempts = 20
+	// maxUsernameLength matches the limit validateUser enforces
+	maxUsernameLength = 49
+)
+
+// OIDCHandler signs users in with an OpenID Connect provider. Identities are
+// matched by the provider's subject, a user signing in for the first time
+// gets a new account without a password.
+type OIDCHandler struct {
+	Auth       *AuthHandler
+	Identities database.IdentityStore
+	// Provider is nil when OpenID Connect isn't configured, leaving only the
+	// identities already linked to be listed and removed
+	Provider *oidc.Provider
+}
+
+// StartLogin begins signing in with the provider
+func (h *OIDCHandler) StartLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.OIDCStartRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			SendError(w, "Invalid JSON format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.startFlow(w, r, &middleware.OIDCFlowClaims{Device: req.DeviceName})
+}
+
+// StartLink begins linking a provider identity to the signed in user, so
+// they can sign in with it from then on
+func (h *OIDCHandler) StartLink(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	h.startFlow(w, r, &middleware.OIDCFlowClaims{
+		LinkUserID: user.ID,
+		Generation: user.TokenGeneration,
+	})
+}
+
+// Callback finishes a login or link with the code the provider redirected
+// back with. Signing in answers like Login, linking with the new identity.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Code == "" {
+		SendError(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.FlowToken) == "" {
+		SendError(w, "flow_token is required", http.StatusBadRequest)
+		return
+	}
+
+	flow, err := h.Auth.AuthMiddleware.ValidateOIDCFlowToken(strings.TrimSpace(req.FlowToken))
+	if err != nil {
+		SendError(w, "Invalid or expired sign in attempt", http.StatusUnauthorized)
+		return
+	}
+
+	// The state ties the redirect to the browser that started the flow
+	if subtle.ConstantTimeCompare([]byte(req.State), []byte(flow.State)) != 1 {
+		SendError(w, "Invalid or expired sign in attempt", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := h.Provider.Exchange(r.Context(), req.Code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		log.Printf("OpenID Connect sign in failed: %v", err)
+		if errors.Is(err, oidc.ErrProvider) {
+			SendError(w, "Identity provider is unavailable", http.StatusBadGateway)
+			return
+		}
+		SendError(w, "Sign in with the identity provider failed", http.StatusUnauthorized)
+		return
+	}
+
+	if flow.LinkUserID > 0 {
+		h.link(w, r, flow, claims)
+		return
+	}
+	h.signIn(w, r, flow, claims)
+}
+
+// GetIdentities lists the provider identities linked to the user
+func (h *OIDCHandler) GetIdentities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	identities, err := h.Identities.GetIdentities(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": identities,
+	})
+}
+
+// DeleteIdentity unlinks a provider identity. An account without a password
+// keeps its last identity, or there would be no way left to sign in.
+func (h *OIDCHandler) DeleteIdentity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	identityID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || identityID <= 0 {
+		SendError(w, "Invalid identity ID", http.StatusBadRequest)
+		return
+	}
+
+	identity, err := h.Identities.GetIdentity(r.Context(), identityID)
+	if err == nil && identity.UserID != user.ID {
+		err = database.ErrNoIdentityError // Don't reveal existence
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrNoIdentityError) {
+			SendError(w, "Identity not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	currentUser, err := h.Auth.DB.GetUserByUsername(r.Context(), user.Username)
+	if err != nil {
+		SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+		return
+	}
+	if currentUser.Password == "" {
+		identities, err := h.Identities.GetIdentities(r.Context(), user.ID)
+		if err != nil {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		if len(identities) <= 1 {
+			SendError(w, "Set a password before unlinking your last sign in method", http.StatusConflict)
+			return
+		}
+	}
+
+	err = h.Identities.DeleteIdentity(r.Context(), identityID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoIdentityError) {
+			SendError(w, "Identity not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startFlow answers with where to send the browser and the flow token to
+// come back with
+func (h *OIDCHandler) startFlow(w http.ResponseWriter, r *http.Request, flow *middleware.OIDCFlowClaims) {
+	var err error
+	if flow.State, err = oidc.RandomString(); err == nil {
+		if flow.Nonce, err = oidc.RandomString(); err == nil {
+			flow.CodeVerifier, err = oidc.RandomString()
+		}
+	}
+	if err != nil {
+		SendError(w, "Failed to start sign in", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := h.Provider.AuthCodeURL(r.Context(), flow.State, flow.Nonce, oidc.CodeChallenge(flow.CodeVerifier))
+	if err != nil {
+		log.Printf("OpenID Connect discovery failed: %v", err)
+		SendError(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	flowToken, err := h.Auth.AuthMiddleware.GenerateOIDCFlowToken(flow)
+	if err != nil {
+		SendError(w, "Failed to start sign in", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.OIDCStartResponse{
+		AuthorizationURL: authURL,
+		FlowToken:        flowToken,
+		ExpiresIn:        int(middleware.OIDCFlowTokenTTL.Seconds()),
+	})
+}
+
+// signIn signs in the user the identity is linked to, creating both when
+// the identity is new
+func (h *OIDCHandler) signIn(w http.ResponseWriter, r *http.Request, flow *middleware.OIDCFlowClaims, claims *oidc.Claims) {
+	var user models.User
+	identity, err := h.Identities.GetIdentityBySubject(r.Context(), claims.Issuer, claims.Subject)
+	if err == nil {
+		err = h.Auth.DB.GetUser(r.Context(), identity.UserID, &user)
+	} else if errors.Is(err, database.ErrNoIdentityError) {
+		err = h.createUser(r, claims, &user)
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	// The provider stands in for the password, two-factor is still asked for
+	if h.Auth.sendTwoFactorChallenge(w, r, &user, flow.Device) {
+		return
+	}
+
+	tokens, err := h.Auth.startSession(r, &user, flow.Device)
+	if err != nil {
+		SendError(w, "Failed to generate authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.AuthResponse{
+		TokenResponse: *tokens,
+		User: models.UserResponse{
+			ID:        user.ID,
+			Username:  user.Username,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+	})
+}
+
+// link adds the identity to the user who started the flow
+func (h *OIDCHandler) link(w http.ResponseWriter, r *http.Request, flow *middleware.OIDCFlowClaims, claims *oidc.Claims) {
+	// A password change since the link started signs the user out of it too
+	var user models.User
+	err := h.Auth.DB.GetUser(r.Context(), flow.LinkUserID, &user)
+	if err != nil || user.TokenGeneration != flow.Generation {
+		SendError(w, "Invalid or expired sign in attempt", http.StatusUnauthorized)
+		return
+	}
+
+	identity := &models.UserIdentity{
+		UserID:  user.ID,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+
+	err = h.Identities.CreateIdentity(r.Context(), identity)
+	if err != nil {
+		if errors.Is(err, database.ErrIdentityExistsError) {
+			SendError(w, "This identity is already linked to an account", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(identity)
+}
+
+// createUser makes a passwordless account for a new identity, named after
+// what the provider calls the user. Taken names get a number on the end.
+func (h *OIDCHandler) createUser(r *http.Request, claims *oidc.Claims, user *models.User) error {
+	base := identityUsername(claims)
+	identity := &models.UserIdentity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+
+	for attempt := 1; attempt <= maxUsernameAttempts; attempt++ {
+		*user = models.User{Username: base}
+		if attempt > 1 {
+			suffix := strconv.Itoa(attempt)
+			user.Username = truncateRunes(base, maxUsernameLength-len(suffix)-1) + "-" + suffix
+		}
+
+		err := h.Identities.CreateUserWithIdentity(r.Context(), user, identity)
+		if !database.IsUsernameExistsError(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%w: no free username for %q", database.ErrUsernameExists, base)
+}
+
+// identityUsername picks a username from the ID token, keeping only the
+// characters usernames allow
+func identityUsername(claims *oidc.Claims) string {
+	for _, candidate := range []string{claims.PreferredUsername, strings.Split(claims.Email, "@")[0], claims.Name} {
+		var b strings.Builder
+		for _, r := range strings.TrimSpace(candidate) {
+			switch {
+			case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-':
+				b.WriteRune(r)
+			case r == '.' || r == ' ':
+				b.WriteRune('_')
+			}
+		}
+
+		username := truncateRunes(b.String(), maxUsernameLength)
+		if len(username) >= 3 {
+			return username
+		}
+	}
+	return "user"
+}
+
+func truncateRunes(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type RevisionHandler struct {
+	DB       database.RevisionStore
+	Snippets database.SnippetStore
+}
+
+func (h *RevisionHandler) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	snippet, ok := h.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	page := 1
+	if pageStr := query.Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	limit := 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	revisions, total, err := h.DB.GetSnippetRevisions(r.Context(), snippet.ID, page, limit)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	totalPages := (total + limit - 1) / limit
+	hasNext := page < totalPages
+	hasPrev := page > 1
+
+	response := map[string]interface{}{
+		"data": revisions,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+			"has_next":    hasNext,
+			"has_prev":    hasPrev,
+		},
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *RevisionHandler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	snippet, ok := h.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revisionNumber, err := strconv.Atoi(chi.URLParam(r, "rev"))
+	if err != nil || revisionNumber <= 0 {
+		SendError(w, "Invalid revision number", http.StatusBadRequest)
+		return
+	}
+
+	revision, ok := h.getRevision(w, r, snippet.ID, revisionNumber)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(revision)
+}
+
+func (h *RevisionHandler) DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	snippet, ok := h.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil || from <= 0 {
+		SendError(w, "from must be a valid revision number", http.StatusBadRequest)
+		return
+	}
+
+	to, err := strconv.Atoi(query.Get("to"))
+	if err != nil || to <= 0 {
+		SendError(w, "to must be a valid revision number", http.StatusBadRequest)
+		return
+	}
+
+	fromRevision, ok := h.getRevision(w, r, snippet.ID, from)
+	if !ok {
+		return
+	}
+
+	toRevision, ok := h.getRevision(w, r, snippet.ID, to)
+	if !ok {
+		return
+	}
+
+	changedFields := []string{}
+	if fromRevision.Title != toRevision.Title {
+		changedFields = append(changedFields, "title")
+	}
+	if !sameDescription(fromRevision.Description, toRevision.Description) {
+		changedFields = append(changedFields, "description")
+	}
+	if fromRevision.Content != toRevision.Content {
+		changedFields = append(changedFields, "content")
+	}
+	if fromRevision.Language != toRevision.Language {
+		changedFields = append(changedFields, "language")
+	}
+	if !slices.Equal(fromRevision.Tags, toRevision.Tags) {
+		changedFields = append(changedFields, "tags")
+	}
+
+	diff := models.SnippetRevisionDiff{
+		SnippetID:     snippet.ID,
+		From:          from,
+		To:            to,
+		ChangedFields: changedFields,
+		Diff: unifiedDiff(
+			fmt.Sprintf("revision %d", from),
+			fmt.Sprintf("revision %d", to),
+			fromRevision.Content,
+			toRevision.Content,
+		),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(diff)
+}
+
+// RestoreRevision copies a revision back onto the snippet. The restore is an
+// ordinary update, so it is recorded as a new revision and nothing is lost.
+func (h *RevisionHandler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	snippet, ok := h.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revisionNumber, err := strconv.Atoi(chi.URLParam(r, "rev"))
+	if err != nil || revisionNumber <= 0 {
+		SendError(w, "Invalid revision number", http.StatusBadRequest)
+		return
+	}
+
+	revision, ok := h.getRevision(w, r, snippet.ID, revisionNumber)
+	if !ok {
+		return
+	}
+
+	// Folder and favorite are not versioned, keep their current values
+	tags := revision.Tags
+	restored := models.Snippet{
+		UserID:      snippet.UserID,
+		FolderID:    snippet.FolderID,
+		Title:       revision.Title,
+		Description: revision.Description,
+		Content:     revision.Content,
+		Language:    revision.Language,
+		IsFavorite:  snippet.IsFavorite,
+		Tags:        &tags,
+		CreatedAt:   snippet.CreatedAt,
+	}
+
+	err = h.Snippets.UpdateSnippet(r.Context(), snippet.ID, &restored)
+	if err != nil {
+		if errors.Is(err, database.ErrNoSnippetError) {
+			SendError(w, "Snippet not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(restored)
+}
+
+// ownedSnippet loads the snippet named in the URL and writes an error response
+// unless it belongs to the authenticated user
+func (h *RevisionHandler) ownedSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	return getOwnedSnippet(w, r, h.Snippets)
+}
+
+func (h *RevisionHandler) getRevision(w http.ResponseWriter, r *http.Request, snippetID int64, revisionNumber int) (*models.SnippetRevision, bool) {
+	revision, err := h.DB.GetSnippetRevision(r.Context(), snippetID, revisionNumber)
+	if err != nil {
+		if errors.Is(err, database.ErrNoRevisionError) {
+			SendError(w, "Revision not found", http.StatusNotFound)
+			return nil, false
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return nil, false
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return revision, true
+}
+
+func sameDescription(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	MaxSavedSearchNameLength  = 100
+	MaxSavedSearchQueryLength = 500
+)
+
+type SavedSearchHandler struct {
+	DB       database.SavedSearchStore
+	Snippets database.SnippetStore
+}
+
+// updateSavedSearchRequest leaves out fields that should not change
+type updateSavedSearchRequest struct {
+	Name    *string                    `json:"name"`
+	Query   *string                    `json:"query"`
+	Filters *models.SavedSearchFilters `json:"filters"`
+}
+
+func (h *SavedSearchHandler) CreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var newSearch models.SavedSearch
+	err := json.NewDecoder(r.Body).Decode(&newSearch)
+	if err != nil {
+		SendError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	// Set user ID from authenticated user (prevent user ID spoofing)
+	newSearch.UserID = user.ID
+
+	if !h.validateSavedSearch(w, &newSearch) {
+		return
+	}
+
+	err = h.DB.CreateSavedSearch(r.Context(), &newSearch)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			SendError(w, "Saved search name already exists", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newSearch)
+}
+
+func (h *SavedSearchHandler) GetSavedSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	search, ok := h.ownedSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(search)
+}
+
+func (h *SavedSearchHandler) GetSavedSearches(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	searches, err := h.DB.GetSavedSearches(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	if searches == nil {
+		searches = []models.SavedSearch{}
+	}
+
+	response := map[string]interface{}{
+		"data": searches,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateSavedSearch renames a saved search or changes what it searches for.
+// Filters, when given, replace the stored ones as a whole.
+func (h *SavedSearchHandler) UpdateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	existingSearch, ok := h.ownedSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	var req updateSavedSearchRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		SendError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	updateSearch := *existingSearch
+	if req.Name != nil {
+		updateSearch.Name = *req.Name
+	}
+	if req.Query != nil {
+		updateSearch.Query = *req.Query
+	}
+	if req.Filters != nil {
+		updateSearch.Filters = *req.Filters
+	}
+
+	if !h.validateSavedSearch(w, &updateSearch) {
+		return
+	}
+
+	err = h.DB.UpdateSavedSearch(r.Context(), existingSearch.ID, &updateSearch)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			SendError(w, "Saved search name already exists", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, database.ErrNoSavedSearchError) {
+			SendError(w, "Saved search not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updateSearch)
+}
+
+func (h *SavedSearchHandler) DeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	existingSearch, ok := h.ownedSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.DB.DeleteSavedSearch(r.Context(), existingSearch.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoSavedSearchError) {
+			SendError(w, "Saved search not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunSavedSearch returns the snippets a saved search matches right now, paged
+// the same way as GET /snippets
+func (h *SavedSearchHandler) RunSavedSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	search, ok := h.ownedSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	page := 1
+	if pageStr := query.Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	limit := 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	filter, err := savedSearchFilter(search)
+	if err != nil {
+		var queryErr *database.SearchQueryError
+		if errors.As(err, &queryErr) {
+			SendSearchQueryError(w, queryErr)
+			return
+		}
+		SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	facets, err := parseSnippetFacets(query)
+	if err != nil {
+		SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snippets, total, err := h.Snippets.GetSnippets(r.Context(), page, limit, search.UserID, filter)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	var snippetFacets models.SnippetFacets
+	if len(facets) > 0 {
+		// Facets count the whole result set, not just this page
+		snippetFacets, err = h.Snippets.GetSnippetFacets(r.Context(), search.UserID, filter, facets)
+		if err != nil {
+			if errors.Is(err, database.ErrDatabaseError) {
+				SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+				return
+			}
+			SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	totalPages := (total + limit - 1) / limit
+	hasNext := page < totalPages
+	hasPrev := page > 1
+
+	response := map[string]interface{}{
+		"data": snippets,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+			"has_next":    hasNext,
+			"has_prev":    hasPrev,
+		},
+	}
+
+	if snippetFacets != nil {
+		response["meta"] = map[string]interface{}{
+			"facets": snippetFacets,
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ownedSavedSearch parses the saved search ID from the URL and loads it,
+// provided it belongs to the authenticated user
+func (h *SavedSearchHandler) ownedSavedSearch(w http.ResponseWriter, r *http.Request) (*models.SavedSearch, bool) {
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	searchID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || searchID <= 0 {
+		SendError(w, "Invalid saved search ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	search, err := h.DB.GetSavedSearch(r.Context(), searchID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoSavedSearchError) {
+			SendError(w, "Saved search not found", http.StatusNotFound)
+			return nil, false
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return nil, false
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if search.UserID != user.ID {
+		SendError(w, "Saved search not found", http.StatusNotFound) // Don't reveal existence
+		return nil, false
+	}
+
+	return search, true
+}
+
+// validateSavedSearch normalizes a saved search and checks its query and
+// filters the way GET /snippets would, sending a 400 when they are invalid
+func (h *SavedSearchHandler) validateSavedSearch(w http.ResponseWriter, search *models.SavedSearch) bool {
+	search.Name = strings.TrimSpace(search.Name)
+	if search.Name == "" {
+		SendError(w, "saved search name is required", http.StatusBadRequest)
+		return false
+	}
+
+	if utf8.RuneCountInString(search.Name) > MaxSavedSearchNameLength {
+		SendError(w, "saved search name must be less than 100 characters", http.StatusBadRequest)
+		return false
+	}
+
+	search.Query = strings.TrimSpace(search.Query)
+	if utf8.RuneCountInString(search.Query) > MaxSavedSearchQueryLength {
+		SendError(w, "query must be less than 500 characters", http.StatusBadRequest)
+		return false
+	}
+
+	filters := &search.Filters
+	filters.Mode = strings.ToLower(strings.TrimSpace(filters.Mode))
+	filters.Language = strings.ToLower(strings.TrimSpace(filters.Language))
+
+	var tags []string
+	for _, tag := range filters.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	filters.Tags = tags
+
+	if _, err := savedSearchFilter(search); err != nil {
+		var queryErr *database.SearchQueryError
+		if errors.As(err, &queryErr) {
+			SendSearchQueryError(w, queryErr)
+			return false
+		}
+		SendError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// savedSearchFilter turns a saved search back into GET /snippets parameters
+// and parses them, so saved and ad hoc searches behave the same
+func savedSearchFilter(search *models.SavedSearch) (database.SnippetFilter, error) {
+	filters := search.Filters
+	values := url.Values{}
+
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+
+	set("search", search.Query)
+	set("mode", filters.Mode)
+	set("language", filters.Language)
+	if filters.FolderID != nil {
+		set("folder_id", strconv.FormatInt(*filters.FolderID, 10))
+	}
+	if filters.Recursive {
+		set("recursive", "true")
+	}
+	for _, tag := range filters.Tags {
+		values.Add("tag", tag)
+	}
+	set("tag_mode", filters.TagMode)
+	if filters.IsFavorite != nil {
+		set("is_favorite", strconv.FormatBool(*filters.IsFavorite))
+	}
+	set("created_after", filters.CreatedAfter)
+	set("created_before", filters.CreatedBefore)
+	set("updated_after", filters.UpdatedAfter)
+	set("updated_before", filters.UpdatedBefore)
+	set("sort", filters.Sort)
+	set("order", filters.Order)
+
+	return parseSnippetFilter(values)
+}
+
+// savedSearchNodes lists the user's saved searches as virtual folders, each
+// counting the snippets it matches at the moment. The counts come from one
+// CountSnippets call rather than a query per search.
+func savedSearchNodes(ctx context.Context, searches database.SavedSearchStore, snippets database.SnippetStore, userID int64) ([]models.SavedSearchNode, error) {
+	saved, err := searches.GetSavedSearches(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]models.SavedSearchNode, len(saved))
+	var filters []database.SnippetFilter
+	var counted []int
+	for i := range saved {
+		nodes[i] = models.SavedSearchNode{SavedSearch: saved[i], Virtual: true}
+
+		// A search saved before a filter was tightened counts as empty
+		// rather than failing the whole tree
+		if filter, err := savedSearchFilter(&saved[i]); err == nil {
+			filters = append(filters, filter)
+			counted = append(counted, i)
+		}
+	}
+
+	if len(filters) > 0 {
+		counts, err := snippets.CountSnippets(ctx, userID, filters)
+		if err != nil {
+			return nil, err
+		}
+		for i, node := range counted {
+			nodes[node].SnippetCount = counts[i]
+		}
+	}
+
+	return nodes, nil
+}
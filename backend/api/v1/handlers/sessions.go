@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxDeviceLength caps the device label stored with a session
+const maxDeviceLength = 200
+
+// Refresh swaps a refresh token for a new access token and a new refresh
+// token. Each refresh token works once; a used one coming back signs the
+// whole session out, since either the client or whoever copied it is no
+// longer the only holder. Coming back within seconds of its use, as when two
+// tabs refresh together, it gets a fresh token in the same session instead.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	refreshToken, ok := decodeRefreshToken(w, r)
+	if !ok {
+		return
+	}
+
+	newRefreshToken, newTokenHash, err := generateRefreshToken()
+	if err != nil {
+		SendError(w, "Failed to generate authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(h.RefreshTokenTTL)
+	session, err := h.Sessions.RotateSession(r.Context(), hashRefreshToken(refreshToken), newTokenHash, clientIP(r), expiresAt)
+	if err != nil {
+		if errors.Is(err, database.ErrSessionReuseError) {
+			log.Printf("Refresh token reuse detected: %v", err)
+			SendError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, database.ErrNoSessionError) {
+			SendError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	var user models.User
+	if err := h.DB.GetUser(r.Context(), session.UserID, &user); err != nil {
+		if errors.Is(err, database.ErrNoUserError) {
+			SendError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+		SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.issueTokens(&user, session.ID, newRefreshToken)
+	if err != nil {
+		SendError(w, "Failed to generate authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// Logout signs out the session of a refresh token. It works without an
+// access token, which may well have expired, and succeeds for a session
+// that is already gone.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	refreshToken, ok := decodeRefreshToken(w, r)
+	if !ok {
+		return
+	}
+
+	session, err := h.Sessions.GetSessionByToken(r.Context(), hashRefreshToken(refreshToken))
+	if err == nil {
+		err = h.Sessions.RevokeSession(r.Context(), session.ID)
+	}
+	if err != nil && !errors.Is(err, database.ErrNoSessionError) {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSessions lists the devices the user is signed in on, flagging the one
+// making the request
+func (h *AuthHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	currentID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+	sessions, err := h.Sessions.GetSessions(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": sessions,
+	})
+}
+
+// RevokeSession signs out one of the user's devices. Its access tokens stop
+// working straight away.
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || sessionID <= 0 {
+		SendError(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.Sessions.GetSession(r.Context(), sessionID)
+	if err == nil && session.UserID != user.ID {
+		err = database.ErrNoSessionError // Don't reveal existence
+	}
+	if err == nil {
+		err = h.Sessions.RevokeSession(r.Context(), sessionID)
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrNoSessionError) {
+			SendError(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeSessions signs out every device but the one making the request
+func (h *AuthHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	currentID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+	revoked, err := h.Sessions.RevokeUserSessions(r.Context(), user.ID, currentID)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"revoked": revoked,
+	})
+}
+
+// startSession signs user in on a new session and issues its first tokens
+func (h *AuthHandler) startSession(r *http.Request, user *models.User, deviceName string) (*models.TokenResponse, error) {
+	refreshToken, tokenHash, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		UserID:    user.ID,
+		Device:    sessionDevice(r, deviceName),
+		IPAddress: clientIP(r),
+		ExpiresAt: time.Now().Add(h.RefreshTokenTTL),
+	}
+	if err := h.Sessions.CreateSession(r.Context(), session, tokenHash); err != nil {
+		return nil, err
+	}
+
+	return h.issueTokens(user, session.ID, refreshToken)
+}
+
+func (h *AuthHandler) issueTokens(user *models.User, sessionID int64, refreshToken string) (*models.TokenResponse, error) {
+	token, err := h.AuthMiddleware.GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.AuthMiddleware.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// decodeRefreshToken reads the refresh token from the request body
+func decodeRefreshToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, "Invalid JSON format", http.StatusBadRequest)
+		return "", false
+	}
+
+	req.RefreshToken = strings.TrimSpace(req.RefreshToken)
+	if req.RefreshToken == "" {
+		SendError(w, "refresh_token is required", http.StatusBadRequest)
+		return "", false
+	}
+
+	return req.RefreshToken, true
+}
+
+// generateRefreshToken returns a random refresh token along with the hash
+// that is stored in its place
+func generateRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashRefreshToken(token), nil
+}
+
+// hashRefreshToken is SHA-256 rather than bcrypt, the token is random enough
+// that a fast hash can't be brute forced and it has to be looked up by value
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionDevice labels a session with the name the client gave it, or with
+// its User-Agent
+func sessionDevice(r *http.Request, deviceName string) string {
+	device := strings.TrimSpace(deviceName)
+	if device == "" {
+		device = strings.TrimSpace(r.UserAgent())
+	}
+
+	if runes := []rune(device); len(runes) > maxDeviceLength {
+		device = string(runes[:maxDeviceLength])
+	}
+	return device
+}
+
+// clientIP is the address the request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+)
+
+const (
+	DefaultSimilarLimit = 10
+	MaxSimilarLimit     = 50
+	// DefaultSimilarity is the least similarity a more-like-this result needs
+	DefaultSimilarity = 0.2
+	// DefaultDuplicateSimilarity is how alike two snippets must be to count
+	// as near duplicates. Below MinDuplicateSimilarity the candidate search
+	// starts missing pairs.
+	DefaultDuplicateSimilarity = 0.8
+	MinDuplicateSimilarity     = 0.5
+)
+
+// SimilarSnippets ranks the user's other snippets by how much content they
+// share with the one in the URL
+func (h *SnippetHandler) SimilarSnippets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	snippet, ok := getOwnedSnippet(w, r, h.DB)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit := DefaultSimilarLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= MaxSimilarLimit {
+			limit = l
+		}
+	}
+
+	minSimilarity, err := parseSimilarityParam(query, DefaultSimilarity, 0)
+	if err != nil {
+		SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	similar, err := database.FindSimilarSnippets(r.Context(), h.DB, snippet, limit, minSimilarity)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data": similar,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// DuplicateSnippets clusters the user's near-duplicate snippets so they can
+// be merged
+func (h *SnippetHandler) DuplicateSnippets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	minSimilarity, err := parseSimilarityParam(r.URL.Query(), DefaultDuplicateSimilarity, MinDuplicateSimilarity)
+	if err != nil {
+		SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clusters, err := database.FindDuplicateSnippets(r.Context(), h.DB, user.ID, minSimilarity)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data": clusters,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseSimilarityParam reads min_similarity, which must lie between least
+// and 1
+func parseSimilarityParam(query url.Values, fallback, least float64) (float64, error) {
+	value := query.Get("min_similarity")
+	if value == "" {
+		return fallback, nil
+	}
+
+	similarity, err := strconv.ParseFloat(value, 64)
+	if err != nil || similarity < least || similarity > 1 {
+		return 0, fmt.Errorf("min_similarity must be between %g and 1", least)
+	}
+	return similarity, nil
+}
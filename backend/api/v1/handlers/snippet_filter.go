@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+)
+
+// parseSnippetFilter reads the GET /snippets filter and sort parameters. The
+// error message is meant for the client, search syntax errors come back as a
+// *database.SearchQueryError.
+func parseSnippetFilter(query url.Values) (database.SnippetFilter, error) {
+	filter := database.SnippetFilter{
+		Search:   query.Get("search"),
+		Language: strings.ToLower(strings.TrimSpace(query.Get("language"))),
+	}
+
+	// Catch a malformed search here so it comes back as a 400, the returned
+	// error is a *database.SearchQueryError
+	if filter.Search != "" {
+		if _, err := database.ParseSearchQuery(filter.Search); err != nil {
+			return filter, err
+		}
+	}
+
+	// mode picks how search text matches, hybrid (the default) accepts
+	// either a full-text or a substring match
+	filter.SearchMode = strings.ToLower(query.Get("mode"))
+	switch filter.SearchMode {
+	case "", database.SearchModeHybrid, database.SearchModeFullText, database.SearchModeSubstring:
+	default:
+		return filter, errors.New("mode must be hybrid, fulltext or substring")
+	}
+
+	if folderIDStr := query.Get("folder_id"); folderIDStr != "" {
+		folderID, err := strconv.ParseInt(folderIDStr, 10, 64)
+		if err != nil || folderID <= 0 {
+			return filter, errors.New("Invalid folder ID")
+		}
+		filter.FolderID = &folderID
+	}
+
+	// recursive=true includes snippets in every folder below folder_id
+	if recursiveStr := query.Get("recursive"); recursiveStr != "" {
+		recursive, err := strconv.ParseBool(recursiveStr)
+		if err != nil {
+			return filter, errors.New("recursive must be true or false")
+		}
+		if recursive && filter.FolderID == nil {
+			return filter, errors.New("recursive requires folder_id")
+		}
+		filter.Recursive = recursive
+	}
+
+	// tag can be repeated or comma separated, tag_mode picks whether a
+	// snippet needs any or all of them
+	for _, value := range query["tag"] {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				filter.Tags = append(filter.Tags, tag)
+			}
+		}
+	}
+
+	switch query.Get("tag_mode") {
+	case "", "any":
+	case "all":
+		filter.MatchAllTags = true
+	default:
+		return filter, errors.New("tag_mode must be any or all")
+	}
+
+	if favoriteStr := query.Get("is_favorite"); favoriteStr != "" {
+		favorite, err := strconv.ParseBool(favoriteStr)
+		if err != nil {
+			return filter, errors.New("is_favorite must be true or false")
+		}
+		filter.IsFavorite = &favorite
+	}
+
+	dates := []struct {
+		param  string
+		target **time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_after", &filter.UpdatedAfter},
+		{"updated_before", &filter.UpdatedBefore},
+	}
+	for _, date := range dates {
+		value := query.Get(date.param)
+		if value == "" {
+			continue
+		}
+		t, err := parseDateParam(value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be a date (YYYY-MM-DD) or RFC 3339 timestamp", date.param)
+		}
+		*date.target = &t
+	}
+
+	filter.Sort = query.Get("sort")
+	switch filter.Sort {
+	case "", database.SnippetSortTitle, database.SnippetSortCreatedAt, database.SnippetSortUpdatedAt:
+	default:
+		return filter, errors.New("sort must be title, created_at or updated_at")
+	}
+
+	filter.Order = strings.ToLower(query.Get("order"))
+	switch filter.Order {
+	case "", database.SortAsc, database.SortDesc:
+	default:
+		return filter, errors.New("order must be asc or desc")
+	}
+	if filter.Order != "" && filter.Sort == "" {
+		return filter, errors.New("order requires sort")
+	}
+
+	return filter, nil
+}
+
+// parseSnippetFacets reads the comma separated facets parameter, naming the
+// counts to return alongside a listing
+func parseSnippetFacets(query url.Values) ([]string, error) {
+	var facets []string
+	for _, value := range query["facets"] {
+		for _, facet := range strings.Split(value, ",") {
+			facet = strings.ToLower(strings.TrimSpace(facet))
+			switch facet {
+			case "":
+				continue
+			case database.FacetLanguage, database.FacetTag, database.FacetFolder:
+			default:
+				return nil, errors.New("facets must be language, tag or folder")
+			}
+			if !slices.Contains(facets, facet) {
+				facets = append(facets, facet)
+			}
+		}
+	}
+	return facets, nil
+}
+
+// parseDateParam accepts a full RFC 3339 timestamp or a bare date, which is
+// taken as midnight UTC
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -13,7 +13,6 @@ import (
 	"github.com/GHutch55/fragments/backend/api/v1/middleware"
 	"github.com/GHutch55/fragments/backend/api/v1/models"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const (
@@ -26,7 +25,8 @@ const (
 )
 
 type SnippetHandler struct {
-	DB *pgxpool.Pool
+	DB      database.SnippetStore
+	Folders database.FolderStore
 }
 
 func (h *SnippetHandler) CreateSnippet(w http.ResponseWriter, r *http.Request) {
@@ -54,8 +54,30 @@ func (h *SnippetHandler) CreateSnippet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.CreateSnippet(r.Context(), h.DB, &newSnippet)
+	if !keepInTokenFolder(w, r, &newSnippet) {
+		return
+	}
+
+	if !h.checkSnippetFolder(w, r, user.ID, newSnippet.FolderID) {
+		return
+	}
+
+	allowDuplicate, ok := parseAllowDuplicate(w, r)
+	if !ok {
+		return
+	}
+
+	if allowDuplicate {
+		err = h.DB.CreateSnippet(r.Context(), &newSnippet)
+	} else {
+		err = h.DB.CreateUniqueSnippet(r.Context(), &newSnippet)
+	}
 	if err != nil {
+		var dupErr *database.DuplicateContentError
+		if errors.As(err, &dupErr) {
+			SendDuplicateContentError(w, dupErr.IDs)
+			return
+		}
 		log.Printf("Error creating snippet in database: %v", err)
 		if errors.Is(err, database.ErrDatabaseError) {
 			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
@@ -91,7 +113,7 @@ func (h *SnippetHandler) GetSnippet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	gotSnippet, err := database.GetSnippet(r.Context(), h.DB, snippetID)
+	gotSnippet, err := h.DB.GetSnippet(r.Context(), snippetID)
 	if err != nil {
 		if errors.Is(err, database.ErrNoSnippetError) {
 			SendError(w, "Snippet not found", http.StatusNotFound)
@@ -106,7 +128,7 @@ func (h *SnippetHandler) GetSnippet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify user owns this snippet
-	if gotSnippet.UserID != user.ID {
+	if gotSnippet.UserID != user.ID || !inTokenFolder(r, gotSnippet.FolderID) {
 		SendError(w, "Snippet not found", http.StatusNotFound) // Don't reveal existence
 		return
 	}
@@ -141,10 +163,46 @@ func (h *SnippetHandler) GetSnippets(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	search := query.Get("search")
+	filter, err := parseSnippetFilter(query)
+	if err != nil {
+		var queryErr *database.SearchQueryError
+		if errors.As(err, &queryErr) {
+			SendSearchQueryError(w, queryErr)
+			return
+		}
+		SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	facets, err := parseSnippetFacets(query)
+	if err != nil {
+		SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// excerpts_only=true leaves the content out of search results, the
+	// excerpts of their search hit standing in for it
+	excerptsOnly := false
+	if excerptsStr := query.Get("excerpts_only"); excerptsStr != "" {
+		excerptsOnly, err = strconv.ParseBool(excerptsStr)
+		if err != nil {
+			SendError(w, "excerpts_only must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// An API token limited to a folder only lists that folder
+	if tokenFolderID, limited := middleware.GetTokenFolderID(r.Context()); limited {
+		if filter.FolderID != nil && *filter.FolderID != tokenFolderID {
+			SendError(w, "API token is limited to another folder", http.StatusForbidden)
+			return
+		}
+		filter.FolderID = &tokenFolderID
+		filter.Recursive = false
+	}
 
 	// Only get snippets for the authenticated user
-	snippets, total, err := database.GetSnippets(r.Context(), h.DB, page, limit, user.ID, search)
+	snippets, total, err := h.DB.GetSnippets(r.Context(), page, limit, user.ID, filter)
 	if err != nil {
 		if errors.Is(err, database.ErrDatabaseError) {
 			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
@@ -154,6 +212,28 @@ func (h *SnippetHandler) GetSnippets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if excerptsOnly {
+		for i := range snippets {
+			if snippets[i].SearchHit != nil {
+				snippets[i].Content = ""
+			}
+		}
+	}
+
+	var snippetFacets models.SnippetFacets
+	if len(facets) > 0 {
+		// Facets count the whole result set, not just this page
+		snippetFacets, err = h.DB.GetSnippetFacets(r.Context(), user.ID, filter, facets)
+		if err != nil {
+			if errors.Is(err, database.ErrDatabaseError) {
+				SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+				return
+			}
+			SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	totalPages := (total + limit - 1) / limit
 	hasNext := page < totalPages
 	hasPrev := page > 1
@@ -170,6 +250,12 @@ func (h *SnippetHandler) GetSnippets(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	if snippetFacets != nil {
+		response["meta"] = map[string]interface{}{
+			"facets": snippetFacets,
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
@@ -197,7 +283,7 @@ func (h *SnippetHandler) UpdateSnippet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if snippet exists and user owns it
-	existingSnippet, err := database.GetSnippet(r.Context(), h.DB, snippetID)
+	existingSnippet, err := h.DB.GetSnippet(r.Context(), snippetID)
 	if err != nil {
 		if errors.Is(err, database.ErrNoSnippetError) {
 			SendError(w, "Snippet not found", http.StatusNotFound)
@@ -212,7 +298,7 @@ func (h *SnippetHandler) UpdateSnippet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify user owns this snippet
-	if existingSnippet.UserID != user.ID {
+	if existingSnippet.UserID != user.ID || !inTokenFolder(r, existingSnippet.FolderID) {
 		SendError(w, "Snippet not found", http.StatusNotFound) // Don't reveal existence
 		return
 	}
@@ -232,8 +318,30 @@ func (h *SnippetHandler) UpdateSnippet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.UpdateSnippet(r.Context(), h.DB, snippetID, &updateSnippet)
+	if !keepInTokenFolder(w, r, &updateSnippet) {
+		return
+	}
+
+	if !h.checkSnippetFolder(w, r, user.ID, updateSnippet.FolderID) {
+		return
+	}
+
+	allowDuplicate, ok := parseAllowDuplicate(w, r)
+	if !ok {
+		return
+	}
+
+	if allowDuplicate {
+		err = h.DB.UpdateSnippet(r.Context(), snippetID, &updateSnippet)
+	} else {
+		err = h.DB.UpdateUniqueSnippet(r.Context(), snippetID, &updateSnippet)
+	}
 	if err != nil {
+		var dupErr *database.DuplicateContentError
+		if errors.As(err, &dupErr) {
+			SendDuplicateContentError(w, dupErr.IDs)
+			return
+		}
 		if errors.Is(err, database.ErrNoSnippetError) {
 			SendError(w, "Snippet not found", http.StatusNotFound)
 			return
@@ -273,7 +381,7 @@ func (h *SnippetHandler) DeleteSnippet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if snippet exists and user owns it
-	existingSnippet, err := database.GetSnippet(r.Context(), h.DB, snippetID)
+	existingSnippet, err := h.DB.GetSnippet(r.Context(), snippetID)
 	if err != nil {
 		if errors.Is(err, database.ErrNoSnippetError) {
 			SendError(w, "Snippet not found", http.StatusNotFound)
@@ -288,12 +396,12 @@ func (h *SnippetHandler) DeleteSnippet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify user owns this snippet
-	if existingSnippet.UserID != user.ID {
+	if existingSnippet.UserID != user.ID || !inTokenFolder(r, existingSnippet.FolderID) {
 		SendError(w, "Snippet not found", http.StatusNotFound) // Don't reveal existence
 		return
 	}
 
-	err = database.DeleteSnippet(r.Context(), h.DB, snippetID)
+	err = h.DB.DeleteSnippet(r.Context(), snippetID)
 	if err != nil {
 		if errors.Is(err, database.ErrNoSnippetError) {
 			SendError(w, "Snippet not found", http.StatusNotFound)
@@ -423,3 +531,92 @@ func (h *SnippetHandler) validateSnippet(snippet *models.Snippet) error {
 
 	return nil
 }
+
+// parseAllowDuplicate reads allow_duplicate, which lets the client save
+// content another of the user's snippets already holds. The check itself is
+// made by the store along with the save, so two requests can't race past it.
+func parseAllowDuplicate(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	allowStr := r.URL.Query().Get("allow_duplicate")
+	if allowStr == "" {
+		return false, true
+	}
+
+	allow, err := strconv.ParseBool(allowStr)
+	if err != nil {
+		SendError(w, "allow_duplicate must be true or false", http.StatusBadRequest)
+		return false, false
+	}
+	return allow, true
+}
+
+// getOwnedSnippet loads the snippet named in the URL from snippets and writes
+// an error response unless it belongs to the authenticated user
+func getOwnedSnippet(w http.ResponseWriter, r *http.Request, snippets database.SnippetStore) (*models.Snippet, bool) {
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	snippetIDStr := chi.URLParam(r, "id")
+	if snippetIDStr == "" {
+		SendError(w, "Snippet ID is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	snippetID, err := strconv.ParseInt(snippetIDStr, 10, 64)
+	if err != nil || snippetID <= 0 {
+		SendError(w, "Invalid snippet ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	snippet, err := snippets.GetSnippet(r.Context(), snippetID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoSnippetError) {
+			SendError(w, "Snippet not found", http.StatusNotFound)
+			return nil, false
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return nil, false
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Verify user owns this snippet
+	if snippet.UserID != user.ID || !inTokenFolder(r, snippet.FolderID) {
+		SendError(w, "Snippet not found", http.StatusNotFound) // Don't reveal existence
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// checkSnippetFolder makes sure a snippet is only filed in a folder of its
+// owner, otherwise the other user's folder deletes would move or trash it
+func (h *SnippetHandler) checkSnippetFolder(w http.ResponseWriter, r *http.Request, userID int64, folderID *int64) bool {
+	if folderID == nil {
+		return true
+	}
+
+	folder, err := h.Folders.GetFolder(r.Context(), *folderID)
+	if err == nil && folder.UserID != userID {
+		err = database.ErrNoFolderError // Don't reveal existence
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrNoFolderError) {
+			SendError(w, "Invalid folder", http.StatusBadRequest)
+			return false
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return false
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+func TestCreateSnippetDuplicateContentRace(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	user := &database.UserWithPassword{User: models.User{Username: "alice"}}
+	if err := store.CreateUserWithPassword(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	h := &SnippetHandler{DB: store, Folders: store}
+
+	const requests = 20
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := `{"title":"hello","content":"fmt.Println(\"hello\")","language":"go"}`
+			req := httptest.NewRequest(http.MethodPost, "/snippets", strings.NewReader(body))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, &user.User))
+			rec := httptest.NewRecorder()
+			h.CreateSnippet(rec, req)
+			if rec.Code == http.StatusBadRequest {
+				t.Errorf("bad request: %s", rec.Body)
+			}
+			statuses <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != requests-1 {
+		t.Fatalf("statuses = %v, want one %d and the rest %d", counts, http.StatusCreated, http.StatusConflict)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+)
+
+const (
+	MaxSuggestPrefixLength = 100
+	// DefaultSuggestLimit and MaxSuggestLimit bound each kind of suggestion
+	DefaultSuggestLimit = 5
+	MaxSuggestLimit     = 20
+)
+
+type SuggestHandler struct {
+	DB database.SuggestStore
+}
+
+// Suggest completes the prefix in q from the user's snippet titles, tag
+// names, folder names and languages, for the command palette. q is required,
+// an empty one would rank everything the user has on every keystroke.
+func (h *SuggestHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+
+	prefix := strings.TrimSpace(query.Get("q"))
+	if prefix == "" {
+		SendError(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(prefix) > MaxSuggestPrefixLength {
+		SendError(w, "q is too long", http.StatusBadRequest)
+		return
+	}
+
+	limit := DefaultSuggestLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= MaxSuggestLimit {
+			limit = l
+		}
+	}
+
+	suggestions, err := h.DB.Suggest(r.Context(), user.ID, prefix, limit)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data": suggestions,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
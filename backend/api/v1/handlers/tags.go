@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type TagHandler struct {
+	DB database.TagStore
+}
+
+// updateTagRequest leaves out fields that should not change. Color is kept
+// raw so an explicit null, which clears the color, can be told apart from a
+// missing field.
+type updateTagRequest struct {
+	Name  *string         `json:"name"`
+	Color json.RawMessage `json:"color"`
+}
+
+func (h *TagHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var newTag models.Tag
+	err := json.NewDecoder(r.Body).Decode(&newTag)
+	if err != nil {
+		SendError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	// Set user ID from authenticated user (prevent user ID spoofing)
+	newTag.UserID = user.ID
+
+	if err := h.validateTag(&newTag); err != nil {
+		SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.DB.CreateTag(r.Context(), &newTag)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			SendError(w, "Tag name already exists", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newTag)
+}
+
+func (h *TagHandler) GetTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	tag, ok := h.ownedTag(w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	tags, err := h.DB.GetTags(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+
+	response := map[string]interface{}{
+		"data": tags,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateTag renames or recolors a tag. Renaming onto a name the user already
+// has merges the two tags and returns the one that was kept.
+func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	existingTag, ok := h.ownedTag(w, r)
+	if !ok {
+		return
+	}
+
+	var req updateTagRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		SendError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	updateTag := *existingTag
+	if req.Name != nil {
+		updateTag.Name = *req.Name
+	}
+	if len(req.Color) > 0 {
+		updateTag.Color = nil
+		if err := json.Unmarshal(req.Color, &updateTag.Color); err != nil {
+			SendError(w, "Invalid JSON format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.validateTag(&updateTag); err != nil {
+		SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.DB.UpdateTag(r.Context(), existingTag.ID, &updateTag)
+	if err != nil {
+		if errors.Is(err, database.ErrNoTagError) {
+			SendError(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// DeleteTag removes a tag from every snippet carrying it
+func (h *TagHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	existingTag, ok := h.ownedTag(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.DB.DeleteTag(r.Context(), existingTag.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoTagError) {
+			SendError(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUnusedTags cleans up the tags no snippet carries anymore
+func (h *TagHandler) DeleteUnusedTags(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	deleted, err := h.DB.DeleteUnusedTags(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted": deleted,
+	})
+}
+
+// ownedTag parses the tag ID from the URL and loads the tag, provided it
+// belongs to the authenticated user
+func (h *TagHandler) ownedTag(w http.ResponseWriter, r *http.Request) (*models.Tag, bool) {
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	tagID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || tagID <= 0 {
+		SendError(w, "Invalid tag ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	tag, err := h.DB.GetTag(r.Context(), tagID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoTagError) {
+			SendError(w, "Tag not found", http.StatusNotFound)
+			return nil, false
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return nil, false
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if tag.UserID != user.ID {
+		SendError(w, "Tag not found", http.StatusNotFound) // Don't reveal existence
+		return nil, false
+	}
+
+	return tag, true
+}
+
+func (h *TagHandler) validateTag(tag *models.Tag) error {
+	// Validate name, using the same rules as tags set on a snippet
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return errors.New("tag name is required")
+	}
+
+	if utf8.RuneCountInString(tag.Name) > MaxTagLength {
+		return errors.New("tag name must be less than 50 characters")
+	}
+
+	for _, r := range tag.Name {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') || r == '_' || r == '-' || r == ' ') {
+			return errors.New("tags can only contain letters, numbers, underscores, hyphens, and spaces")
+		}
+	}
+
+	// Validate color (optional), #rgb or #rrggbb
+	if tag.Color != nil {
+		*tag.Color = strings.TrimSpace(*tag.Color)
+		// If color is empty after trimming, set it to nil
+		if *tag.Color == "" {
+			tag.Color = nil
+		} else if !isHexColor(*tag.Color) {
+			return errors.New("color must be a hex color like #1e90ff")
+		}
+	}
+
+	return nil
+}
+
+func isHexColor(color string) bool {
+	if (len(color) != 4 && len(color) != 7) || color[0] != '#' {
+		return false
+	}
+	for _, r := range color[1:] {
+		if !((r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')) {
+			return false
+		}
+	}
+	return true
+}
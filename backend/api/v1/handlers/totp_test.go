@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatalf("decoding secret: %v", err)
+	}
+
+	// The RFC lists 8 digit codes, 6 digit codes are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTPWindow(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		step   int64
+		wantOK bool
+	}{
+		{"current step", current, true},
+		{"one step behind", current - 1, true},
+		{"one step ahead", current + 1, true},
+		{"two steps behind", current - 2, false},
+		{"two steps ahead", current + 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(rfc6238Secret, totpCode(key, tt.step), now)
+			if ok != tt.wantOK {
+				t.Fatalf("matchTOTP ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step != tt.step {
+				t.Errorf("matchTOTP step = %d, want %d", step, tt.step)
+			}
+		})
+	}
+}
+
+func TestMatchTOTPRejectsMalformed(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	for _, code := range []string{"", "05047", "0504711", "abcdef"} {
+		if _, ok := matchTOTP(rfc6238Secret, code, now); ok {
+			t.Errorf("matchTOTP accepted %q", code)
+		}
+	}
+	if _, ok := matchTOTP("not base32!", "050471", now); ok {
+		t.Error("matchTOTP accepted a code for an invalid secret")
+	}
+	// Secrets are matched whatever their case
+	if _, ok := matchTOTP(strings.ToLower(rfc6238Secret), "050471", now); !ok {
+		t.Error("matchTOTP rejected a lowercase secret")
+	}
+}
+
+func TestIsTOTPCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"123456", true},
+		{"000000", true},
+		{"12345", false},
+		{"1234567", false},
+		{"12345a", false},
+		{"abcd-efgh-ijkl-mnop", false},
+	}
+
+	for _, tt := range tests {
+		if got := isTOTPCode(tt.code); got != tt.want {
+			t.Errorf("isTOTPCode(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("generateRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 19 || strings.Count(code, "-") != 3 {
+			t.Errorf("code %q is not formatted like abcd-efgh-ijkl-mnop", code)
+		}
+		if isTOTPCode(code) {
+			t.Errorf("code %q would be taken for a TOTP code", code)
+		}
+		if hashes[i] != hashRecoveryCode(code) {
+			t.Errorf("hash of code %d does not match", i)
+		}
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCodeNormalizes(t *testing.T) {
+	want := hashRecoveryCode("abcd-efgh-ijkl-mnop")
+	for _, code := range []string{"ABCD-EFGH-IJKL-MNOP", "abcdefghijklmnop", "abcd efgh ijkl mnop"} {
+		if got := hashRecoveryCode(code); got != want {
+			t.Errorf("hashRecoveryCode(%q) differs from the canonical form", code)
+		}
+	}
+	if hashRecoveryCode("abcd-efgh-ijkl-mnoq") == want {
+		t.Error("different codes hash the same")
+	}
+}
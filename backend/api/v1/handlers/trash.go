@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type TrashHandler struct {
+	DB database.TrashStore
+	// Retention is how long items stay in the trash before they are purged
+	// automatically, 0 when they are kept until purged by hand
+	Retention time.Duration
+}
+
+func (h *TrashHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+
+	page := 1
+	if pageStr := query.Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	limit := 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	itemType := query.Get("type")
+	if itemType != "" && itemType != models.TrashTypeSnippet && itemType != models.TrashTypeFolder {
+		SendError(w, "type must be snippet or folder", http.StatusBadRequest)
+		return
+	}
+
+	items, total, err := h.DB.GetTrash(r.Context(), page, limit, user.ID, itemType)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	if items == nil {
+		items = []models.TrashItem{}
+	}
+
+	if h.Retention > 0 {
+		for i := range items {
+			purgeAt := items[i].DeletedAt.Add(h.Retention)
+			items[i].PurgeAt = &purgeAt
+		}
+	}
+
+	totalPages := (total + limit - 1) / limit
+	hasNext := page < totalPages
+	hasPrev := page > 1
+
+	response := map[string]interface{}{
+		"data": items,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+			"has_next":    hasNext,
+			"has_prev":    hasPrev,
+		},
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *TrashHandler) RestoreSnippet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	snippetID, ok := h.trashedSnippetID(w, r)
+	if !ok {
+		return
+	}
+
+	snippet, err := h.DB.RestoreSnippet(r.Context(), snippetID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoSnippetError) {
+			SendError(w, "Snippet not found in trash", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(snippet)
+}
+
+func (h *TrashHandler) RestoreFolder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	folderID, ok := h.trashedFolderID(w, r)
+	if !ok {
+		return
+	}
+
+	folder, err := h.DB.RestoreFolder(r.Context(), folderID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoFolderError) {
+			SendError(w, "Folder not found in trash", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		if strings.Contains(err.Error(), "already exists") {
+			SendError(w, "A folder with this name already exists in this location", http.StatusConflict)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(folder)
+}
+
+func (h *TrashHandler) PurgeSnippet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	snippetID, ok := h.trashedSnippetID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.DB.PurgeSnippet(r.Context(), snippetID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoSnippetError) {
+			SendError(w, "Snippet not found in trash", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TrashHandler) PurgeFolder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	folderID, ok := h.trashedFolderID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.DB.PurgeFolder(r.Context(), folderID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoFolderError) {
+			SendError(w, "Folder not found in trash", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TrashHandler) EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	purged, err := h.DB.EmptyTrash(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"purged": purged,
+	})
+}
+
+// trashedSnippetID parses the snippet ID from the URL and checks the trashed
+// snippet belongs to the authenticated user
+func (h *TrashHandler) trashedSnippetID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	snippetID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || snippetID <= 0 {
+		SendError(w, "Invalid snippet ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	snippet, err := h.DB.GetTrashedSnippet(r.Context(), snippetID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoSnippetError) {
+			SendError(w, "Snippet not found in trash", http.StatusNotFound)
+			return 0, false
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return 0, false
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if snippet.UserID != user.ID {
+		SendError(w, "Snippet not found in trash", http.StatusNotFound) // Don't reveal existence
+		return 0, false
+	}
+
+	return snippetID, true
+}
+
+// trashedFolderID parses the folder ID from the URL and checks the trashed
+// folder belongs to the authenticated user
+func (h *TrashHandler) trashedFolderID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	// Get authenticated user
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	folderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || folderID <= 0 {
+		SendError(w, "Invalid folder ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	folder, err := h.DB.GetTrashedFolder(r.Context(), folderID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoFolderError) {
+			SendError(w, "Folder not found in trash", http.StatusNotFound)
+			return 0, false
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return 0, false
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if folder.UserID != user.ID {
+		SendError(w, "Folder not found in trash", http.StatusNotFound) // Don't reveal existence
+		return 0, false
+	}
+
+	return folderID, true
+}
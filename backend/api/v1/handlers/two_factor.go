@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxTwoFactorAttempts wrong codes in a row lock code entry
+	maxTwoFactorAttempts = 5
+	// twoFactorLockout is how long code entry stays locked. It is longer than
+	// middleware.ChallengeTokenTTL, so the challenges that ran into the lock
+	// have expired by the time it lifts and the password is needed again.
+	twoFactorLockout = 15 * time.Minute
+)
+
+// errTwoFactorLocked is returned by checkTwoFactorCode while code entry is
+// locked
+var errTwoFactorLocked = errors.New("too many wrong two-factor codes")
+
+// GetTwoFactor reports whether the user has two-factor on and how many
+// recovery codes they have left
+func (h *AuthHandler) GetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var status models.TwoFactorStatus
+	twoFactor, err := h.TwoFactor.GetTwoFactor(r.Context(), user.ID)
+	if err == nil && twoFactor.Enabled() {
+		status.Enabled = true
+		status.EnabledAt = twoFactor.EnabledAt
+		status.RecoveryCodesRemaining, err = h.TwoFactor.CountRecoveryCodes(r.Context(), user.ID)
+	}
+	if err != nil && !errors.Is(err, database.ErrNoTwoFactorError) {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+// SetupTwoFactor starts turning two-factor on with a new secret. Nothing
+// changes at sign in until a code from it is confirmed.
+func (h *AuthHandler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		SendError(w, "Failed to generate two-factor secret", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.TwoFactor.SetTwoFactorSecret(r.Context(), user.ID, secret)
+	if err != nil {
+		if errors.Is(err, database.ErrTwoFactorEnabledError) {
+			SendError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: totpURI(secret, user.Username),
+	})
+}
+
+// ConfirmTwoFactor turns two-factor on once the user proves their
+// authenticator works, and hands out their recovery codes
+func (h *AuthHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	code := strings.TrimSpace(req.Code)
+	if code == "" {
+		SendError(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	twoFactor, err := h.TwoFactor.GetTwoFactor(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoTwoFactorError) {
+			SendError(w, "Two-factor setup has not been started", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	if twoFactor.Enabled() {
+		SendError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	step, ok := matchTOTP(twoFactor.Secret, code, time.Now())
+	if !ok {
+		SendError(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		SendError(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.TwoFactor.EnableTwoFactor(r.Context(), user.ID, step, hashes)
+	if err != nil {
+		if errors.Is(err, database.ErrNoTwoFactorError) {
+			// Enabled or restarted by another request in the meantime
+			SendError(w, "Two-factor setup has changed, please start again", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor off, or abandons a setup that was never
+// confirmed. Turning it off takes the password so a stolen session can't do
+// it, a pending setup protects nothing yet and is cancelled without one.
+func (h *AuthHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		SendError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DisableTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	twoFactor, err := h.TwoFactor.GetTwoFactor(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoTwoFactorError) {
+			SendError(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+			return
+		}
+		SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+		return
+	}
+
+	if twoFactor.Enabled() && !h.checkDisableTwoFactorProof(w, r, user, req) {
+		return
+	}
+
+	err = h.TwoFactor.DisableTwoFactor(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoTwoFactorError) {
+			SendError(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkDisableTwoFactorProof checks the password, or a current code for users
+// without a password, who sign in with an identity provider
+func (h *AuthHandler) checkDisableTwoFactorProof(w http.ResponseWriter, r *http.Request, user *models.User, req models.DisableTwoFactorRequest) bool {
+	// Get current user with password from database
+	currentUser, err := h.DB.GetUserByUsername(r.Context(), user.Username)
+	if err != nil {
+		SendError(w, "Unable to verify password", http.StatusInternalServerError)
+		return false
+	}
+
+	if currentUser.Password == "" {
+		code := strings.TrimSpace(req.Code)
+		if code == "" {
+			SendError(w, "code is required", http.StatusBadRequest)
+			return false
+		}
+
+		valid, err := h.checkTwoFactorCode(r.Context(), user.ID, code)
+		if errors.Is(err, errTwoFactorLocked) {
+			SendError(w, "Too many wrong two-factor codes, try again later", http.StatusTooManyRequests)
+			return false
+		}
+		if err != nil {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return false
+		}
+		if !valid {
+			SendError(w, "Invalid two-factor code", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+
+	if strings.TrimSpace(req.Password) == "" {
+		SendError(w, "password is required", http.StatusBadRequest)
+		return false
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(currentUser.Password), []byte(req.Password))
+	if err != nil {
+		SendError(w, "Password is incorrect", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// VerifyTwoFactor finishes a login for a user with two-factor on, swapping
+// the challenge token from Login and a code for the tokens of a new session
+func (h *AuthHandler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.TwoFactorVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	code := strings.TrimSpace(req.Code)
+	if strings.TrimSpace(req.ChallengeToken) == "" {
+		SendError(w, "challenge_token is required", http.StatusBadRequest)
+		return
+	}
+	if code == "" {
+		SendError(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := h.AuthMiddleware.ValidateChallengeToken(strings.TrimSpace(req.ChallengeToken))
+	if err != nil {
+		SendError(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := h.DB.GetUser(r.Context(), claims.UserID, &user); err != nil {
+		if errors.Is(err, database.ErrNoUserError) {
+			SendError(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+			return
+		}
+		SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+		return
+	}
+
+	// A password change since the login revokes its challenge too
+	if user.TokenGeneration != claims.Generation {
+		SendError(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+
+	ok, err := h.checkTwoFactorCode(r.Context(), user.ID, code)
+	if errors.Is(err, errTwoFactorLocked) {
+		SendError(w, "Too many wrong two-factor codes, try again later", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+			return
+		}
+		SendError(w, "An unexpected error occurred", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		SendError(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := h.startSession(r, &user, claims.Device)
+	if err != nil {
+		SendError(w, "Failed to generate authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.AuthResponse{
+		TokenResponse: *tokens,
+		User: models.UserResponse{
+			ID:        user.ID,
+			Username:  user.Username,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendTwoFactorChallenge answers a login with the right password but no code
+// yet. It reports false without writing anything when the user doesn't have
+// two-factor on.
+func (h *AuthHandler) sendTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user *models.User, deviceName string) bool {
+	twoFactor, err := h.TwoFactor.GetTwoFactor(r.Context(), user.ID)
+	if errors.Is(err, database.ErrNoTwoFactorError) || (err == nil && !twoFactor.Enabled()) {
+		return false
+	}
+	if err != nil {
+		SendError(w, "Unable to process request at this time", http.StatusInternalServerError)
+		return true
+	}
+
+	challengeToken, err := h.AuthMiddleware.GenerateChallengeToken(user, deviceName)
+	if err != nil {
+		SendError(w, "Failed to generate authentication token", http.StatusInternalServerError)
+		return true
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    challengeToken,
+		ExpiresIn:         int(middleware.ChallengeTokenTTL.Seconds()),
+	})
+	return true
+}
+
+// checkTwoFactorCode checks a code from the user's authenticator, or spends
+// one of their recovery codes. Each code only works once. Wrong codes count
+// against the user whichever request they come from, enough in a row lock
+// code entry and the check fails with errTwoFactorLocked until it lifts.
+func (h *AuthHandler) checkTwoFactorCode(ctx context.Context, userID int64, code string) (bool, error) {
+	twoFactor, err := h.TwoFactor.GetTwoFactor(ctx, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoTwoFactorError) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !twoFactor.Enabled() {
+		return false, nil
+	}
+
+	if twoFactor.LockedAt != nil && time.Since(*twoFactor.LockedAt) < twoFactorLockout {
+		return false, errTwoFactorLocked
+	}
+
+	valid, err := h.matchTwoFactorCode(ctx, twoFactor, code)
+	if err != nil {
+		return false, err
+	}
+
+	if valid {
+		if twoFactor.FailedAttempts > 0 {
+			if err := h.TwoFactor.ResetTwoFactorFailures(ctx, userID); err != nil {
+				log.Printf("Failed to reset two-factor failures: %v", err)
+			}
+		}
+		return true, nil
+	}
+
+	lockedAt, err := h.TwoFactor.RecordTwoFactorFailure(ctx, userID, maxTwoFactorAttempts)
+	if err != nil {
+		return false, err
+	}
+	if lockedAt != nil {
+		return false, errTwoFactorLocked
+	}
+	return false, nil
+}
+
+// matchTwoFactorCode checks code against the authenticator or the unused
+// recovery codes, spending it when it matches
+func (h *AuthHandler) matchTwoFactorCode(ctx context.Context, twoFactor *models.TwoFactor, code string) (bool, error) {
+	userID := twoFactor.UserID
+	if isTOTPCode(code) {
+		step, ok := matchTOTP(twoFactor.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		err := h.TwoFactor.UseTwoFactorStep(ctx, userID, step)
+		if errors.Is(err, database.ErrTwoFactorCodeUsedError) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	err := h.TwoFactor.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if errors.Is(err, database.ErrNoRecoveryCodeError) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+// newTwoFactorUser creates a user with two-factor on and returns the handler,
+// the user's ID, their secret and their recovery codes
+func newTwoFactorUser(t *testing.T) (*AuthHandler, int64, string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+
+	user := &models.User{Username: "alice"}
+	if err := store.CreateUser(ctx, user); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetTwoFactorSecret(ctx, user.ID, secret); err != nil {
+		t.Fatalf("setting secret: %v", err)
+	}
+	// Step 0 leaves every current code unused
+	if err := store.EnableTwoFactor(ctx, user.ID, 0, hashes); err != nil {
+		t.Fatalf("enabling two-factor: %v", err)
+	}
+
+	return &AuthHandler{DB: store, TwoFactor: store}, user.ID, secret, codes
+}
+
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, time.Now().Unix()/totpPeriod)
+}
+
+func TestCheckTwoFactorCodeTOTPOnce(t *testing.T) {
+	h, userID, secret, _ := newTwoFactorUser(t)
+	ctx := context.Background()
+	code := currentTOTP(t, secret)
+
+	if ok, err := h.checkTwoFactorCode(ctx, userID, code); err != nil || !ok {
+		t.Fatalf("first use = %v, %v, want true", ok, err)
+	}
+	if ok, err := h.checkTwoFactorCode(ctx, userID, code); err != nil || ok {
+		t.Fatalf("replayed code = %v, %v, want false", ok, err)
+	}
+}
+
+func TestCheckTwoFactorCodeRecoveryOnce(t *testing.T) {
+	h, userID, _, codes := newTwoFactorUser(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"unused code", codes[0], true},
+		{"same code again", codes[0], false},
+		{"typed in uppercase without dashes", strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), true},
+		{"spent code typed differently", strings.ToUpper(codes[1]), false},
+	}
+
+	for _, tt := range tests {
+		ok, err := h.checkTwoFactorCode(ctx, userID, tt.code)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if ok != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+
+	remaining, err := h.TwoFactor.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != recoveryCodeCount-2 {
+		t.Errorf("%d recovery codes left, want %d", remaining, recoveryCodeCount-2)
+	}
+}
+
+func TestCheckTwoFactorCodeLockout(t *testing.T) {
+	h, userID, secret, codes := newTwoFactorUser(t)
+	ctx := context.Background()
+
+	for i := 1; i < maxTwoFactorAttempts; i++ {
+		if ok, err := h.checkTwoFactorCode(ctx, userID, "000000"); err != nil || ok {
+			t.Fatalf("wrong code %d = %v, %v, want false", i, ok, err)
+		}
+	}
+	if _, err := h.checkTwoFactorCode(ctx, userID, "aaaa-bbbb-cccc-dddd"); !errors.Is(err, errTwoFactorLocked) {
+		t.Fatalf("wrong code %d error = %v, want errTwoFactorLocked", maxTwoFactorAttempts, err)
+	}
+
+	// Right codes don't get through the lock, and don't get spent
+	if _, err := h.checkTwoFactorCode(ctx, userID, currentTOTP(t, secret)); !errors.Is(err, errTwoFactorLocked) {
+		t.Fatalf("TOTP while locked error = %v, want errTwoFactorLocked", err)
+	}
+	if _, err := h.checkTwoFactorCode(ctx, userID, codes[0]); !errors.Is(err, errTwoFactorLocked) {
+		t.Fatalf("recovery code while locked error = %v, want errTwoFactorLocked", err)
+	}
+	remaining, err := h.TwoFactor.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != recoveryCodeCount {
+		t.Errorf("%d recovery codes left, want %d", remaining, recoveryCodeCount)
+	}
+}
+
+func TestCheckTwoFactorCodeSuccessResetsFailures(t *testing.T) {
+	h, userID, _, codes := newTwoFactorUser(t)
+	ctx := context.Background()
+
+	for i := 1; i < maxTwoFactorAttempts; i++ {
+		h.checkTwoFactorCode(ctx, userID, "000000")
+	}
+	if ok, err := h.checkTwoFactorCode(ctx, userID, codes[0]); err != nil || !ok {
+		t.Fatalf("right code = %v, %v, want true", ok, err)
+	}
+
+	twoFactor, err := h.TwoFactor.GetTwoFactor(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if twoFactor.FailedAttempts != 0 || twoFactor.LockedAt != nil {
+		t.Errorf("after a right code failed attempts = %d, locked at = %v", twoFactor.FailedAttempts, twoFactor.LockedAt)
+	}
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		password   string
+		confirmed  bool
+		body       string
+		wantStatus int
+	}{
+		{"pending setup without a password", "", false, `{}`, http.StatusNoContent},
+		{"pending setup with a password", "secret", false, `{}`, http.StatusNoContent},
+		{"enabled without a password needs a code", "", true, `{}`, http.StatusBadRequest},
+		{"enabled with a wrong code", "", true, `{"code":"aaaa-bbbb-cccc-dddd"}`, http.StatusUnauthorized},
+		{"enabled needs the password", "secret", true, `{}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := database.NewMemoryStore()
+			user := &database.UserWithPassword{User: models.User{Username: "alice"}, Password: tt.password}
+			if err := store.CreateUserWithPassword(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SetTwoFactorSecret(ctx, user.ID, "GEZDGNBVGY3TQOJQ"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.confirmed {
+				if err := store.EnableTwoFactor(ctx, user.ID, 0, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			h := &AuthHandler{DB: store, TwoFactor: store}
+			req := httptest.NewRequest(http.MethodPost, "/auth/2fa/disable", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, &user.User))
+			rec := httptest.NewRecorder()
+			h.DisableTwoFactor(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			_, err := store.GetTwoFactor(ctx, user.ID)
+			if removed := errors.Is(err, database.ErrNoTwoFactorError); removed != (tt.wantStatus == http.StatusNoContent) {
+				t.Errorf("two-factor removed = %v", removed)
+			}
+		})
+	}
+}
@@ -13,13 +13,12 @@ import (
 	"github.com/GHutch55/fragments/backend/api/v1/middleware"
 	"github.com/GHutch55/fragments/backend/api/v1/models"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // UserHandler holds the database connection
 type UserHandler struct {
-	DB *pgxpool.Pool
+	DB database.UserStore
 }
 
 // GetCurrentUser gets the authenticated user's information
@@ -57,7 +56,7 @@ func (h *UserHandler) UpdateCurrentUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := database.UpdateUser(r.Context(), h.DB, user.ID, &updateUser)
+	err := h.DB.UpdateUser(r.Context(), user.ID, &updateUser)
 	if err != nil {
 		switch {
 		case database.IsUserNotFoundError(err):
@@ -86,7 +85,7 @@ func (h *UserHandler) DeleteCurrentUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := database.DeleteUser(r.Context(), h.DB, user.ID)
+	err := h.DB.DeleteUser(r.Context(), user.ID)
 	if err != nil {
 		switch {
 		case database.IsUserNotFoundError(err):
@@ -144,7 +143,7 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		Password: string(hashedPassword),
 	}
 
-	err = database.CreateUserWithPassword(r.Context(), h.DB, userWithPassword)
+	err = h.DB.CreateUserWithPassword(r.Context(), userWithPassword)
 	if err != nil {
 		switch {
 		case database.IsUsernameExistsError(err):
@@ -173,7 +172,7 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var user models.User
-	err = database.GetUser(r.Context(), h.DB, userID, &user)
+	err = h.DB.GetUser(r.Context(), userID, &user)
 	if err != nil {
 		switch {
 		case database.IsUserNotFoundError(err):
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+)
+
+const (
+	APITokenContextKey    contextKey = "api_token"
+	tokenScopesContextKey contextKey = "token_scopes"
+)
+
+// apiTokenPrefixLength is how much of a token is kept to tell it apart, the
+// "frg_" prefix and four random characters
+const apiTokenPrefixLength = len(models.APITokenPrefix) + 4
+
+// tokenScopes are the scopes a route accepts API tokens with
+type tokenScopes struct {
+	read, write string
+	// folders allows tokens limited to a folder, whose handlers keep them
+	// inside it
+	folders bool
+}
+
+// TokenScopes lets RequireAuth accept API tokens on the routes below it.
+// Reading, GET and HEAD, needs the read scope and anything else the write
+// scope. It has to come before RequireAuth, routes without it only take
+// access tokens. Tokens limited to a folder are turned away.
+func TokenScopes(read, write string) func(http.Handler) http.Handler {
+	return withTokenScopes(tokenScopes{read: read, write: write})
+}
+
+// FolderTokenScopes is TokenScopes for routes that also take tokens limited
+// to a folder. Their handlers must check GetTokenFolderID.
+func FolderTokenScopes(read, write string) func(http.Handler) http.Handler {
+	return withTokenScopes(tokenScopes{read: read, write: write, folders: true})
+}
+
+func withTokenScopes(scopes tokenScopes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), tokenScopesContextKey, scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GenerateAPIToken returns a new personal API token along with the hash that
+// is stored in its place and the prefix that is shown for it
+func GenerateAPIToken() (token, tokenHash, prefix string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+
+	token = models.APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashAPIToken(token), token[:apiTokenPrefixLength], nil
+}
+
+// hashAPIToken is SHA-256 for the same reason as refresh tokens, a random
+// token can't be brute forced and has to be looked up by its hash
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetAPITokenFromContext returns the API token a request was made with, it
+// is missing for requests made with an access token
+func GetAPITokenFromContext(ctx context.Context) (*models.APIToken, bool) {
+	token, ok := ctx.Value(APITokenContextKey).(*models.APIToken)
+	return token, ok
+}
+
+// GetTokenFolderID returns the folder the request's API token is limited to
+func GetTokenFolderID(ctx context.Context) (int64, bool) {
+	if token, ok := GetAPITokenFromContext(ctx); ok && token.FolderID != nil {
+		return *token.FolderID, true
+	}
+	return 0, false
+}
+
+// requireAPIToken is RequireAuth for a personal API token
+func (am *AuthMiddleware) requireAPIToken(w http.ResponseWriter, r *http.Request, next http.Handler, tokenString string) {
+	scopes, ok := r.Context().Value(tokenScopesContextKey).(tokenScopes)
+	if !ok {
+		am.sendError(w, "API tokens can't be used for this endpoint", http.StatusForbidden)
+		return
+	}
+
+	token, err := am.APITokens.GetAPITokenByHash(r.Context(), hashAPIToken(tokenString))
+	if err != nil {
+		if errors.Is(err, database.ErrNoAPITokenError) {
+			am.sendError(w, "Invalid or expired API token", http.StatusUnauthorized)
+			return
+		}
+		am.sendError(w, "Unable to verify API token", http.StatusInternalServerError)
+		return
+	}
+
+	var user models.User
+	if err := am.DB.GetUser(r.Context(), token.UserID, &user); err != nil {
+		if errors.Is(err, database.ErrNoUserError) {
+			am.sendError(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+		am.sendError(w, "Unable to verify user", http.StatusInternalServerError)
+		return
+	}
+
+	scope := scopes.write
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		scope = scopes.read
+	}
+	if !slices.Contains(token.Scopes, scope) {
+		am.sendError(w, fmt.Sprintf("API token is missing the %s scope", scope), http.StatusForbidden)
+		return
+	}
+
+	if token.FolderID != nil && !scopes.folders {
+		am.sendError(w, "API tokens limited to a folder can't be used for this endpoint", http.StatusForbidden)
+		return
+	}
+
+	// A failed write only leaves the last used time behind, so the request
+	// still goes ahead
+	if err := am.APITokens.TouchAPIToken(r.Context(), token.ID, time.Now()); err != nil {
+		log.Printf("Error updating last use of API token %d: %v", token.ID, err)
+	}
+
+	ctx := context.WithValue(r.Context(), UserContextKey, &user)
+	ctx = context.WithValue(ctx, APITokenContextKey, token)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
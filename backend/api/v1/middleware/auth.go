@@ -12,23 +12,33 @@ import (
 	"github.com/GHutch55/fragments/backend/api/v1/database"
 	"github.com/GHutch55/fragments/backend/api/v1/models"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type contextKey string
 
-const UserContextKey contextKey = "user"
+const (
+	UserContextKey    contextKey = "user"
+	SessionContextKey contextKey = "session"
+)
 
-// AuthMiddleware handles JWT authentication
+// AuthMiddleware handles JWT and personal API token authentication
 type AuthMiddleware struct {
-	DB        *pgxpool.Pool
-	JWTSecret string
+	DB        database.UserStore
+	Sessions  database.SessionStore
+	APITokens database.APITokenStore
+	// JWTSecret signs access tokens, which live for AccessTokenTTL and are
+	// renewed with the refresh token of their session
+	JWTSecret      string
+	AccessTokenTTL time.Duration
 }
 
 // Claims represents JWT token claims
 type Claims struct {
-	UserID   int64  `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID int64  `json:"sid"`
+	// Generation is the user's token generation when the token was issued
+	Generation int64 `json:"gen"`
 	jwt.RegisteredClaims
 }
 
@@ -39,23 +49,28 @@ type ErrorResponse struct {
 }
 
 // NewAuthMiddleware creates a new AuthMiddleware instance
-func NewAuthMiddleware(pool *pgxpool.Pool, jwtSecret string) *AuthMiddleware {
+func NewAuthMiddleware(users database.UserStore, sessions database.SessionStore, apiTokens database.APITokenStore, jwtSecret string, accessTokenTTL time.Duration) *AuthMiddleware {
 	return &AuthMiddleware{
-		DB:        pool,
-		JWTSecret: jwtSecret,
+		DB:             users,
+		Sessions:       sessions,
+		APITokens:      apiTokens,
+		JWTSecret:      jwtSecret,
+		AccessTokenTTL: accessTokenTTL,
 	}
 }
 
-// GenerateToken creates a new JWT token for the given user
-func (am *AuthMiddleware) GenerateToken(user *models.User) (string, error) {
+// GenerateToken creates a new access token for the given user's session
+func (am *AuthMiddleware) GenerateToken(user *models.User, sessionID int64) (string, error) {
 	if user == nil {
 		return "", errors.New("user cannot be nil")
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
+	expirationTime := time.Now().Add(am.AccessTokenTTL)
 	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
+		UserID:     user.ID,
+		Username:   user.Username,
+		SessionID:  sessionID,
+		Generation: user.TokenGeneration,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -102,10 +117,19 @@ func (am *AuthMiddleware) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid user ID in token")
 	}
 
+	// Tokens from before sessions existed can't be revoked, so they are
+	// turned away and their users sign in again. Two-factor challenge tokens
+	// have no session either.
+	if claims.SessionID <= 0 {
+		return nil, errors.New("token has no session")
+	}
+
 	return claims, nil
 }
 
-// RequireAuth middleware that validates JWT tokens and loads user context
+// RequireAuth middleware that validates JWT tokens and loads user context.
+// Personal API tokens are accepted too on routes that declare the scopes they
+// need with TokenScopes.
 func (am *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -124,6 +148,11 @@ func (am *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 			return
 		}
 
+		if strings.HasPrefix(bearerToken[1], models.APITokenPrefix) {
+			am.requireAPIToken(w, r, next, bearerToken[1])
+			return
+		}
+
 		// Validate token
 		claims, err := am.ValidateToken(bearerToken[1])
 		if err != nil {
@@ -133,7 +162,7 @@ func (am *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 
 		// Load user from database with context
 		var user models.User
-		err = database.GetUser(r.Context(), am.DB, claims.UserID, &user)
+		err = am.DB.GetUser(r.Context(), claims.UserID, &user)
 		if err != nil {
 			// Check for specific database errors
 			if errors.Is(err, database.ErrNoUserError) || strings.Contains(err.Error(), "not found") {
@@ -154,8 +183,26 @@ func (am *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		// Add user to request context
+		// Changing the password or a forced logout bumps the generation,
+		// which revokes every token issued before
+		if user.TokenGeneration != claims.Generation {
+			am.sendError(w, "Token has been revoked", http.StatusUnauthorized)
+			return
+		}
+
+		// A signed out or revoked session takes its access tokens with it
+		if err := am.checkSession(r.Context(), claims); err != nil {
+			if errors.Is(err, database.ErrDatabaseError) {
+				am.sendError(w, "Unable to verify session", http.StatusInternalServerError)
+				return
+			}
+			am.sendError(w, "Session has expired or been revoked", http.StatusUnauthorized)
+			return
+		}
+
+		// Add user and session to request context
 		ctx := context.WithValue(r.Context(), UserContextKey, &user)
+		ctx = context.WithValue(ctx, SessionContextKey, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -177,9 +224,10 @@ func (am *AuthMiddleware) OptionalAuth(next http.Handler) http.Handler {
 		if len(bearerToken) == 2 && strings.EqualFold(bearerToken[0], "Bearer") {
 			if claims, err := am.ValidateToken(bearerToken[1]); err == nil {
 				var user models.User
-				if err := database.GetUser(r.Context(), am.DB, claims.UserID, &user); err == nil {
-					if user.Username == claims.Username {
+				if err := am.DB.GetUser(r.Context(), claims.UserID, &user); err == nil {
+					if user.Username == claims.Username && user.TokenGeneration == claims.Generation && am.checkSession(r.Context(), claims) == nil {
 						ctx := context.WithValue(r.Context(), UserContextKey, &user)
+						ctx = context.WithValue(ctx, SessionContextKey, claims.SessionID)
 						next.ServeHTTP(w, r.WithContext(ctx))
 						return
 					}
@@ -206,6 +254,26 @@ func GetUserIDFromContext(ctx context.Context) (int64, bool) {
 	return 0, false
 }
 
+// GetSessionIDFromContext returns the session the request's access token
+// belongs to
+func GetSessionIDFromContext(ctx context.Context) (int64, bool) {
+	sessionID, ok := ctx.Value(SessionContextKey).(int64)
+	return sessionID, ok
+}
+
+// checkSession makes sure the token's session is still live and belongs to
+// the token's user
+func (am *AuthMiddleware) checkSession(ctx context.Context, claims *Claims) error {
+	session, err := am.Sessions.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != claims.UserID {
+		return database.ErrNoSessionError
+	}
+	return nil
+}
+
 // sendError sends a JSON error response
 func (am *AuthMiddleware) sendError(w http.ResponseWriter, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
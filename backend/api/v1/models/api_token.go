@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Scopes a personal API token can be granted
+const (
+	ScopeSnippetsRead  = "snippets:read"
+	ScopeSnippetsWrite = "snippets:write"
+	ScopeFoldersWrite  = "folders:write"
+)
+
+// APITokenScopes lists every scope, in the order they are shown
+var APITokenScopes = []string{ScopeSnippetsRead, ScopeSnippetsWrite, ScopeFoldersWrite}
+
+// APITokenPrefix starts every personal API token, which tells them apart from
+// access tokens and makes leaked ones easy to search for
+const APITokenPrefix = "frg_"
+
+// APIToken is a personal access token for scripts. The token itself is only
+// shown once, when it is created.
+type APIToken struct {
+	ID     int64    `json:"id"`
+	UserID int64    `json:"user_id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"` // first characters of the token
+	Scopes []string `json:"scopes"`
+	// FolderID limits the token to the snippets of one folder
+	FolderID   *int64     `json:"folder_id,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPITokenRequest is the body of POST /tokens
+type CreateAPITokenRequest struct {
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	FolderID *int64   `json:"folder_id"`
+	// ExpiresInDays defaults to 30, tokens can't outlive a year
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// CreatedAPIToken is a new token along with its only copy of the secret
+type CreatedAPIToken struct {
+	APIToken
+	Token string `json:"token"`
+}
@@ -4,14 +4,31 @@ import "time"
 
 // LoginRequest represents a user login request
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name,omitempty"` // labels the session, defaults to the User-Agent
 }
 
-// ChangePasswordRequest represents a password change request
+// RefreshRequest carries the refresh token of a session, for refreshing it
+// or signing it out
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ChangePasswordRequest represents a password change request. Users without
+// a password leave CurrentPassword empty, and give a two-factor code instead
+// if they have it on.
 type ChangePasswordRequest struct {
 	CurrentPassword string `json:"current_password"`
 	NewPassword     string `json:"new_password"`
+	Code            string `json:"code,omitempty"`
+}
+
+// ChangePasswordResponse carries the tokens of a new session, since changing
+// the password revokes every existing one
+type ChangePasswordResponse struct {
+	Message string `json:"message"`
+	TokenResponse
 }
 
 // UserResponse represents a user in API responses (without sensitive data)
@@ -22,8 +39,16 @@ type UserResponse struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// TokenResponse holds a new access token and the refresh token that replaces
+// the session's previous one
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // seconds until Token expires
+}
+
 // AuthResponse represents the response after successful authentication
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  UserResponse `json:"user"`
+	TokenResponse
+	User UserResponse `json:"user"`
 }
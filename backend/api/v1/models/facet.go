@@ -0,0 +1,14 @@
+package models
+
+// SnippetFacets maps each requested facet, language, tag or folder, onto its
+// most common values, most snippets first
+type SnippetFacets map[string][]FacetCount
+
+// FacetCount is how many snippets share one facet value. Folder counts carry
+// the folder ID as well as its name, snippets outside any folder are counted
+// with an empty name and no ID.
+type FacetCount struct {
+	Value    string `json:"value"`
+	FolderID *int64 `json:"folder_id,omitempty"`
+	Count    int    `json:"count"`
+}
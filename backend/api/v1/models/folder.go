@@ -11,3 +11,43 @@ type Folder struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+// Modes for deleting a folder that still has contents
+const (
+	// FolderDeleteRestrict refuses folders with subfolders and moves the
+	// folder's snippets to the root
+	FolderDeleteRestrict = "restrict"
+	// FolderDeleteCascade moves the folder, its subfolders and every snippet
+	// in them to the trash
+	FolderDeleteCascade = "cascade"
+	// FolderDeleteReparent moves the folder's subfolders and snippets up to
+	// its parent before trashing it
+	FolderDeleteReparent = "reparent"
+)
+
+// FolderDeleteResult reports what deleting a folder did with its contents
+type FolderDeleteResult struct {
+	Mode            string        `json:"mode"`
+	RemovedFolders  []int64       `json:"removed_folders"`
+	RemovedSnippets []int64       `json:"removed_snippets"`
+	MovedFolders    []MovedFolder `json:"moved_folders"`
+	MovedSnippets   []int64       `json:"moved_snippets"`
+	MovedTo         *int64        `json:"moved_to"` // null when moved items went to the root
+}
+
+// MovedFolder is a subfolder lifted out of a deleted folder. RenamedFrom is set
+// when its name was already taken in the new location.
+type MovedFolder struct {
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	RenamedFrom *string `json:"renamed_from,omitempty"`
+}
+
+// FolderNode is a folder in the nested tree returned by GET /folders/tree
+type FolderNode struct {
+	Folder
+	Depth             int           `json:"depth"`
+	SnippetCount      int           `json:"snippet_count"`       // snippets directly in this folder
+	TotalSnippetCount int           `json:"total_snippet_count"` // snippets in this folder and all below it
+	Children          []*FolderNode `json:"children"`
+}
@@ -0,0 +1,39 @@
+package models
+
+// Values for the type of each line in a grep stream
+const (
+	GrepLineMatch   = "match"
+	GrepLineSummary = "summary"
+	GrepLineError   = "error"
+)
+
+// Reasons a grep stopped before searching every snippet
+const (
+	GrepReasonMatchLimit = "match_limit"
+	GrepReasonTimeLimit  = "time_limit"
+)
+
+// GrepMatch is one line of snippet content matching a grep pattern
+type GrepMatch struct {
+	Type      string `json:"type"`
+	SnippetID int64  `json:"snippet_id"`
+	Title     string `json:"title"`
+	Line      int    `json:"line"` // 1-based
+	Text      string `json:"text"`
+	Truncated bool   `json:"truncated,omitempty"` // Text was cut short
+}
+
+// GrepSummary ends a grep stream
+type GrepSummary struct {
+	Type             string `json:"type"`
+	Matches          int    `json:"matches"`
+	SnippetsSearched int    `json:"snippets_searched"`
+	Truncated        bool   `json:"truncated"`
+	Reason           string `json:"reason,omitempty"` // one of the GrepReason values when truncated
+}
+
+// GrepError ends a grep stream that failed after it started
+type GrepError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// UserIdentity is an account at an OpenID Connect provider linked to a user
+type UserIdentity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCStartResponse sends the browser to the provider. FlowToken is handed
+// back to /auth/oidc/callback along with what the provider redirects with.
+type OIDCStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	FlowToken        string `json:"flow_token"`
+	ExpiresIn        int    `json:"expires_in"` // seconds until FlowToken expires
+}
+
+// OIDCStartRequest optionally names the device the login will sign in
+type OIDCStartRequest struct {
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+// OIDCCallbackRequest carries the code and state the provider redirected
+// back with
+type OIDCCallbackRequest struct {
+	Code      string `json:"code"`
+	State     string `json:"state"`
+	FlowToken string `json:"flow_token"`
+}
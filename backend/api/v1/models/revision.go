@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// SnippetRevision is an immutable snapshot of a snippet taken on every write
+type SnippetRevision struct {
+	ID          int64     `json:"id"`
+	SnippetID   int64     `json:"snippet_id"`
+	Revision    int       `json:"revision"`
+	Title       string    `json:"title"`
+	Description *string   `json:"description,omitempty"`
+	Content     string    `json:"content,omitempty"` // left out of revision listings
+	Language    string    `json:"language"`
+	Tags        []string  `json:"tags"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// SnippetRevisionDiff compares two revisions of the same snippet
+type SnippetRevisionDiff struct {
+	SnippetID     int64    `json:"snippet_id"`
+	From          int      `json:"from"`
+	To            int      `json:"to"`
+	ChangedFields []string `json:"changed_fields"`
+	Diff          string   `json:"diff"` // unified diff of the content
+}
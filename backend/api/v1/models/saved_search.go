@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// SavedSearch is a named GET /snippets query that can be run again later and
+// shows up in the folder tree as a virtual folder
+type SavedSearch struct {
+	ID        int64              `json:"id"`
+	UserID    int64              `json:"user_id"`
+	Name      string             `json:"name"`
+	Query     string             `json:"query"` // search box text, may be empty
+	Filters   SavedSearchFilters `json:"filters"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// SavedSearchFilters are the GET /snippets filter and sort parameters of a
+// saved search, with the same names and formats
+type SavedSearchFilters struct {
+	Mode          string   `json:"mode,omitempty"`
+	Language      string   `json:"language,omitempty"`
+	FolderID      *int64   `json:"folder_id,omitempty"`
+	Recursive     bool     `json:"recursive,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	TagMode       string   `json:"tag_mode,omitempty"`
+	IsFavorite    *bool    `json:"is_favorite,omitempty"`
+	CreatedAfter  string   `json:"created_after,omitempty"`
+	CreatedBefore string   `json:"created_before,omitempty"`
+	UpdatedAfter  string   `json:"updated_after,omitempty"`
+	UpdatedBefore string   `json:"updated_before,omitempty"`
+	Sort          string   `json:"sort,omitempty"`
+	Order         string   `json:"order,omitempty"`
+}
+
+// SavedSearchNode is a saved search listed in the folder tree. It holds no
+// snippets of its own, its contents are whatever the search matches now.
+type SavedSearchNode struct {
+	SavedSearch
+	Virtual      bool `json:"virtual"` // always true, tells it apart from a FolderNode
+	SnippetCount int  `json:"snippet_count"`
+}
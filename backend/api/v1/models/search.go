@@ -0,0 +1,30 @@
+package models
+
+// Values for SearchExcerpt.Field and SearchHit.Fields
+const (
+	SearchFieldTitle       = "title"
+	SearchFieldDescription = "description"
+	SearchFieldContent     = "content"
+)
+
+// SearchHit explains why a snippet matched a search
+type SearchHit struct {
+	Fields   []string        `json:"fields"`   // fields with a match, title first
+	Lines    []int           `json:"lines"`    // 1-based content lines with a match
+	Excerpts []SearchExcerpt `json:"excerpts"` // the title, description and first content lines that matched
+}
+
+// SearchExcerpt is a piece of one field with the matched text marked. Text is
+// plain rather than HTML, the client escapes it and wraps the highlights.
+type SearchExcerpt struct {
+	Field      string      `json:"field"`
+	Line       int         `json:"line,omitempty"` // 1-based, content excerpts only
+	Text       string      `json:"text"`
+	Highlights []TextRange `json:"highlights"`
+}
+
+// TextRange marks Text[Start:End], counted in characters
+type TextRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
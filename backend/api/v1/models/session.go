@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Session is one signed in device. Its ID stays the same while the refresh
+// token behind it is rotated.
+type Session struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Device     string    `json:"device"` // client supplied name, or its User-Agent
+	IPAddress  string    `json:"ip_address"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"` // when the refresh token runs out
+	Current    bool      `json:"current"`    // the session making the request
+}
@@ -0,0 +1,18 @@
+package models
+
+// SimilarSnippet is a snippet whose content resembles another's
+type SimilarSnippet struct {
+	ID       int64  `json:"id"`
+	Title    string `json:"title"`
+	FolderID *int64 `json:"folder_id"`
+	Language string `json:"language"`
+	// Similarity estimates the share of content the two snippets have in
+	// common, from 0 to 1
+	Similarity float64 `json:"similarity"`
+}
+
+// DuplicateCluster is a group of near-duplicate snippets that could be merged.
+// The first snippet is the oldest, the similarity of the rest is to it.
+type DuplicateCluster struct {
+	Snippets []SimilarSnippet `json:"snippets"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// Suggestions are the typeahead completions for a prefix, one list per kind,
+// each ordered by usage and then recency
+type Suggestions struct {
+	Snippets  []Suggestion `json:"snippets"`
+	Tags      []Suggestion `json:"tags"`
+	Folders   []Suggestion `json:"folders"`
+	Languages []Suggestion `json:"languages"`
+}
+
+// Suggestion is one completion: a snippet title, tag name, folder name or
+// language
+type Suggestion struct {
+	ID    *int64 `json:"id,omitempty"` // the snippet, tag or folder, languages have none
+	Value string `json:"value"`
+	// Count is how many live snippets use the tag, folder or language
+	Count int `json:"count,omitempty"`
+}
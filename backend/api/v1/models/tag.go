@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type Tag struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Color     *string   `json:"color,omitempty"` // hex color for UI, could be empty
+	CreatedAt time.Time `json:"created_at"`
+	// SnippetCount is how many live snippets carry the tag, trashed ones are
+	// not counted
+	SnippetCount int `json:"snippet_count"`
+}
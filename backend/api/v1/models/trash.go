@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Values for TrashItem.Type
+const (
+	TrashTypeSnippet = "snippet"
+	TrashTypeFolder  = "folder"
+)
+
+// TrashItem is a soft-deleted snippet or folder waiting to be restored or purged
+type TrashItem struct {
+	Type      string     `json:"type"`
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`                // snippet title or folder name
+	ParentID  *int64     `json:"parent_id,omitempty"` // folder the item was in, if it still exists
+	Path      []string   `json:"path"`                // folder names leading to the item when it was trashed
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"` // when retention removes it, if enabled
+}
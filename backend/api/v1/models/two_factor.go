@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// TwoFactor is a user's TOTP authenticator. It only guards sign in once
+// EnabledAt is set, when the user has confirmed a code from it.
+type TwoFactor struct {
+	UserID    int64
+	Secret    string // base32, as shown to authenticator apps
+	EnabledAt *time.Time
+	// LastStep is the time step of the last code accepted
+	LastStep int64
+	// FailedAttempts counts wrong codes since the last right one or lockout
+	FailedAttempts int
+	// LockedAt is when too many wrong codes last locked code entry
+	LockedAt *time.Time
+}
+
+// Enabled reports whether sign in asks for a code
+func (t *TwoFactor) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+// TwoFactorStatus is the response of GET /auth/2fa
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorSetupResponse holds a new secret for the user to add to their
+// authenticator, by scanning OTPAuthURI as a QR code or typing in Secret
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TwoFactorCodeRequest carries a code from the authenticator
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodesResponse is the only time recovery codes are shown
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// DisableTwoFactorRequest represents a request to turn two-factor off.
+// Accounts without a password give a current code instead.
+type DisableTwoFactorRequest struct {
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// TwoFactorChallengeResponse is what a login gets in place of tokens when the
+// user has two-factor on. ChallengeToken is exchanged for tokens at
+// /auth/2fa/verify along with a code.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"` // seconds until ChallengeToken expires
+}
+
+// TwoFactorVerifyRequest answers a login challenge with a code from the
+// authenticator or a recovery code
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
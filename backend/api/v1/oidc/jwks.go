@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// keyRefreshInterval stops tokens with made up key IDs from making every
+// request fetch the key set again
+const keyRefreshInterval = time.Minute
+
+// jsonWebKey is one key of a JWKS document. Only signing keys of the types
+// ID tokens use are kept.
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// key finds the public key an ID token was signed with. Providers rotate
+// keys, so an unknown key ID fetches the set again.
+func (p *Provider) key(ctx context.Context, md *metadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	key, ok := p.lookupKey(kid)
+	recent := p.keys != nil && time.Since(p.keysLoaded) < keyRefreshInterval
+	p.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+	if recent {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	_, err, _ := p.fetches.Do("jwks "+md.JWKSURI, func() (interface{}, error) {
+		keys, err := p.fetchKeys(context.WithoutCancel(ctx), md.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.keys = keys
+		p.keysLoaded = time.Now()
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// fetchKeys gets the provider's signing keys by key ID, skipping any that
+// aren't for signatures or can't be used
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid jwks_uri", ErrProvider)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: key set request failed with status %d", ErrProvider, status)
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	return keys, nil
+}
+
+// lookupKey assumes p.mu is held. A token without a key ID only matches a
+// provider that publishes a single key.
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,328 @@
+// Package oidc is a minimal OpenID Connect relying party: discovery, the
+// authorization code flow with PKCE, and ID token verification against the
+// provider's published keys
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// maxResponseSize caps what is read from the provider
+const maxResponseSize = 1 << 20
+
+// discoveryTTL is how long provider metadata is trusted before it is
+// fetched again
+const discoveryTTL = time.Hour
+
+// ErrProvider is returned when the provider can't be reached or answers with
+// something other than what the flow expects
+var ErrProvider = errors.New("identity provider error")
+
+type Config struct {
+	// IssuerURL is the provider's issuer identifier, its discovery document
+	// lives under /.well-known/openid-configuration
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string // empty for public clients
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims are what a verified ID token says about the user
+type Claims struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+type Provider struct {
+	config Config
+	client *http.Client
+
+	// fetches makes concurrent logins share one request to the provider.
+	// mu only guards the cached results, never a request.
+	fetches    singleflight.Group
+	mu         sync.Mutex
+	metadata   *metadata
+	fetchedAt  time.Time
+	keys       map[string]interface{} // kid -> public key
+	keysLoaded time.Time
+}
+
+// metadata is the part of the discovery document the flow needs
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// idTokenClaims are the ID token claims beyond the registered ones
+type idTokenClaims struct {
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// NewProvider sets up a provider. Nothing is fetched until the first login,
+// so the API starts even while the provider is down.
+func NewProvider(config Config) *Provider {
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Issuer is the configured issuer identifier
+func (p *Provider) Issuer() string {
+	return p.config.IssuerURL
+}
+
+// AuthCodeURL is where the browser is sent to sign in at the provider
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid authorization endpoint", ErrProvider)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the ID
+// token that came with it, once its signature, issuer, audience, expiry and
+// nonce all check out
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid token endpoint", ErrProvider)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &token)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		// An OAuth error is the code or verifier being refused, not the
+		// provider failing
+		if token.Error != "" {
+			return nil, fmt.Errorf("token request refused: %s %s", token.Error, token.ErrorDescription)
+		}
+		return nil, fmt.Errorf("%w: token request failed with status %d", ErrProvider, status)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrProvider)
+	}
+
+	return p.verifyIDToken(ctx, md, token.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, md *metadata, rawToken, nonce string) (*Claims, error) {
+	claims := &idTokenClaims{}
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(md.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+
+	_, err := parser.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, md, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id_token: no subject")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, errors.New("invalid id_token: issued to another party")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("invalid id_token: nonce does not match")
+	}
+
+	return &Claims{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+// discover returns the provider metadata, fetching it when it is missing or
+// stale
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	md, fetchedAt := p.metadata, p.fetchedAt
+	p.mu.Unlock()
+
+	if md != nil && time.Since(fetchedAt) < discoveryTTL {
+		return md, nil
+	}
+
+	// The request is shared, so one caller giving up mustn't fail the rest.
+	// The client's timeout still bounds it.
+	v, err, _ := p.fetches.Do("discovery", func() (interface{}, error) {
+		md, err := p.fetchMetadata(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.metadata == nil || p.metadata.JWKSURI != md.JWKSURI {
+			p.keys = nil
+		}
+		p.metadata = md
+		p.fetchedAt = time.Now()
+		return md, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*metadata), nil
+}
+
+// fetchMetadata gets and checks the discovery document
+func (p *Provider) fetchMetadata(ctx context.Context) (*metadata, error) {
+	discoveryURL := strings.TrimSuffix(p.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid issuer URL", ErrProvider)
+	}
+
+	var md metadata
+	status, err := p.doJSON(req, &md)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: discovery failed with status %d", ErrProvider, status)
+	}
+
+	// The issuer in the document has to be the one configured, or ID tokens
+	// from some other issuer could pass as this one's
+	if strings.TrimSuffix(md.Issuer, "/") != strings.TrimSuffix(p.config.IssuerURL, "/") {
+		return nil, fmt.Errorf("%w: discovery issuer %q does not match %q", ErrProvider, md.Issuer, p.config.IssuerURL)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document is missing endpoints", ErrProvider)
+	}
+	if len(md.CodeChallengeMethods) > 0 && !contains(md.CodeChallengeMethods, "S256") {
+		return nil, fmt.Errorf("%w: provider does not support S256 PKCE", ErrProvider)
+	}
+
+	return &md, nil
+}
+
+// doJSON sends req and decodes the JSON response into v, whatever its status
+func (p *Provider) doJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to read response: %v", ErrProvider, err)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("%w: invalid JSON from %s", ErrProvider, req.URL.Host)
+	}
+	return resp.StatusCode, nil
+}
+
+// RandomString returns a URL safe random value for state, nonce and PKCE
+// verifiers
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge is the S256 PKCE challenge of verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowProvider serves discovery and an empty key set, holding every key set
+// request until release is closed
+type slowProvider struct {
+	server     *httptest.Server
+	discovery  atomic.Int32
+	keySets    atomic.Int32
+	release    chan struct{}
+	keyRequest chan struct{}
+}
+
+func newSlowProvider(t *testing.T) *slowProvider {
+	t.Helper()
+	sp := &slowProvider{
+		release:    make(chan struct{}),
+		keyRequest: make(chan struct{}, 1),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		sp.discovery.Add(1)
+		// Give concurrent callers time to pile up behind this request
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 sp.server.URL,
+			"authorization_endpoint": sp.server.URL + "/authorize",
+			"token_endpoint":         sp.server.URL + "/token",
+			"jwks_uri":               sp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		sp.keySets.Add(1)
+		select {
+		case sp.keyRequest <- struct{}{}:
+		default:
+		}
+		<-sp.release
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []interface{}{}})
+	})
+
+	sp.server = httptest.NewServer(mux)
+	t.Cleanup(sp.server.Close)
+	return sp
+}
+
+func (sp *slowProvider) provider() *Provider {
+	return NewProvider(Config{
+		IssuerURL:   sp.server.URL,
+		ClientID:    "fragments",
+		RedirectURL: "http://localhost/callback",
+		Scopes:      []string{"openid"},
+	})
+}
+
+func TestDiscoverSharesOneRequest(t *testing.T) {
+	sp := newSlowProvider(t)
+	p := sp.provider()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := sp.discovery.Load(); n != 1 {
+		t.Errorf("discovery fetched %d times, want 1", n)
+	}
+}
+
+func TestKeyFetchDoesNotBlockCachedMetadata(t *testing.T) {
+	sp := newSlowProvider(t)
+	p := sp.provider()
+	ctx := context.Background()
+
+	md, err := p.discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyErr := make(chan error, 1)
+	go func() {
+		_, err := p.key(ctx, md, "some-key")
+		keyErr <- err
+	}()
+	<-sp.keyRequest
+
+	// The key set request is still waiting on the provider
+	done := make(chan struct{})
+	go func() {
+		p.AuthCodeURL(ctx, "state", "nonce", "challenge")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("AuthCodeURL waited on the key set request")
+	}
+
+	close(sp.release)
+	if err := <-keyErr; err == nil {
+		t.Error("key found in an empty key set")
+	}
+
+	// The empty set was just loaded, so it isn't fetched again straight away
+	if _, err := p.key(ctx, md, "some-key"); err == nil {
+		t.Error("key found in an empty key set")
+	}
+	if n := sp.keySets.Load(); n != 1 {
+		t.Errorf("key set fetched %d times, want 1", n)
+	}
+}
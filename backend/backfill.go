@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// backfillBatchSize is how many snippets a backfill works through at a time
+const backfillBatchSize = 500
+
+// runBackfill fills in a column added after snippets were already saved,
+// calling batch until it comes back short or ctx is cancelled. what names the
+// column in the log.
+func runBackfill(ctx context.Context, what string, batch func(ctx context.Context, limit int) (int, error)) {
+	total := 0
+	for ctx.Err() == nil {
+		updated, err := batch(ctx, backfillBatchSize)
+		total += updated
+		if err != nil {
+			log.Printf("failed to backfill %s: %v", what, err)
+			return
+		}
+		if updated < backfillBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Backfilled %s for %d snippet(s)", what, total)
+	}
+}
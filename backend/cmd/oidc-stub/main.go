@@ -0,0 +1,262 @@
+// Command oidc-stub is a stand-in OpenID Connect provider for trying out and
+// testing sign in locally. It approves every authorization request straight
+// away, as the user named by login_hint or -subject, so it must never be
+// exposed anywhere real.
+//
+//	go run ./cmd/oidc-stub -addr :9000
+//
+// and run the API with
+//
+//	OIDC_ISSUER_URL=http://localhost:9000
+//	OIDC_CLIENT_ID=fragments
+//	OIDC_REDIRECT_URL=http://localhost:5173/auth/oidc/callback
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "stub-key"
+
+// codeTTL is how long an authorization code can be redeemed
+const codeTTL = time.Minute
+
+// grant is what an authorization code was issued for
+type grant struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	subject       string
+	expiresAt     time.Time
+}
+
+type stub struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	subject      string
+	domain       string
+	key          *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL the API is configured with")
+	clientID := flag.String("client-id", "fragments", "client ID to accept")
+	clientSecret := flag.String("client-secret", "", "client secret to require, empty for a public client")
+	subject := flag.String("subject", "alice", "user to sign in as when the request has no login_hint")
+	domain := flag.String("email-domain", "example.com", "domain of the email address in ID tokens")
+	flag.Parse()
+
+	s, err := newStub(*issuer, *clientID, *clientSecret, *subject, *domain)
+	if err != nil {
+		log.Fatalf("failed to generate signing key: %v", err)
+	}
+
+	log.Printf("OpenID Connect stub provider for %s listening on %s", s.issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, s.handler()))
+}
+
+func newStub(issuer, clientID, clientSecret, subject, domain string) (*stub, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stub{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		subject:      subject,
+		domain:       domain,
+		key:          key,
+		grants:       make(map[string]grant),
+	}, nil
+}
+
+func (s *stub) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("GET /authorize", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+	return mux
+}
+
+func (s *stub) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *stub) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize approves the request without asking anything and redirects back
+// with a code
+func (s *stub) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != s.clientID {
+		http.Error(w, "unsupported response_type or unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "S256 code_challenge is required", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	subject := query.Get("login_hint")
+	if subject == "" {
+		subject = s.subject
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.grants[code] = grant{
+		clientID:      s.clientID,
+		redirectURI:   redirectURI.String(),
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+		subject:       subject,
+		expiresAt:     time.Now().Add(codeTTL),
+	}
+	s.mu.Unlock()
+
+	values := redirectURI.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirectURI.RawQuery = values.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token redeems a code once, checking the client, redirect URI and PKCE
+// verifier, and issues a signed ID token
+func (s *stub) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientID != s.clientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.clientSecret)) != 1 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(g.expiresAt) || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant", "unknown, expired or already used code")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		tokenError(w, "invalid_grant", "code_verifier does not match code_challenge")
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                s.issuer,
+		"sub":                g.subject,
+		"aud":                s.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              g.nonce,
+		"email":              g.subject + "@" + s.domain,
+		"email_verified":     true,
+		"preferred_username": g.subject,
+	})
+	token.Header["kid"] = keyID
+
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("failed to generate random value: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+	"github.com/GHutch55/fragments/backend/api/v1/handlers"
+	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/GHutch55/fragments/backend/api/v1/oidc"
+	"github.com/go-chi/chi/v5"
+)
+
+const redirectURL = "http://localhost:5173/auth/oidc/callback"
+
+// flowTest runs the API's OpenID Connect routes, as main.go mounts them,
+// against a stub provider
+type flowTest struct {
+	t        *testing.T
+	store    *database.MemoryStore
+	api      http.Handler
+	provider *http.Client
+}
+
+func newFlowTest(t *testing.T) *flowTest {
+	t.Helper()
+
+	provider := httptest.NewUnstartedServer(nil)
+	s, err := newStub("http://"+provider.Listener.Addr().String(), "fragments", "shh", "alice", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.Config.Handler = s.handler()
+	provider.Start()
+	t.Cleanup(provider.Close)
+
+	store := database.NewMemoryStore()
+	authMiddleware := middleware.NewAuthMiddleware(store, store, store, "oidc-flow-test-secret-of-32-chars", 15*time.Minute)
+	authHandler := handlers.NewAuthHandler(store, store, store, authMiddleware, 24*time.Hour)
+	oidcHandler := &handlers.OIDCHandler{
+		Auth:       authHandler,
+		Identities: store,
+		Provider: oidc.NewProvider(oidc.Config{
+			IssuerURL:    s.issuer,
+			ClientID:     "fragments",
+			ClientSecret: "shh",
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"openid", "profile", "email"},
+		}),
+	}
+
+	r := chi.NewRouter()
+	r.Post("/auth/register", authHandler.Register)
+	r.Post("/auth/oidc/start", oidcHandler.StartLogin)
+	r.Post("/auth/oidc/callback", oidcHandler.Callback)
+	r.Group(func(r chi.Router) {
+		r.Use(authMiddleware.RequireAuth)
+		r.Post("/auth/oidc/link", oidcHandler.StartLink)
+	})
+
+	// The browser's side of the redirect is read off the Location header
+	client := provider.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &flowTest{t: t, store: store, api: r, provider: client}
+}
+
+// post sends body to the API and decodes a successful response into out
+func (f *flowTest) post(path, token string, body, out interface{}) int {
+	f.t.Helper()
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	f.api.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			f.t.Fatalf("%s: decoding response: %v", path, err)
+		}
+	}
+	return rec.Code
+}
+
+// start begins a login, or a link when token is set
+func (f *flowTest) start(token string) models.OIDCStartResponse {
+	f.t.Helper()
+
+	path := "/auth/oidc/start"
+	if token != "" {
+		path = "/auth/oidc/link"
+	}
+	var started models.OIDCStartResponse
+	if status := f.post(path, token, struct{}{}, &started); status != http.StatusOK {
+		f.t.Fatalf("%s: status %d", path, status)
+	}
+	return started
+}
+
+// authorize signs in at the stub as subject, with edit given a chance to
+// change the authorization request first, and returns the callback request
+// it redirects back with
+func (f *flowTest) authorize(started models.OIDCStartResponse, subject string, edit func(url.Values)) models.OIDCCallbackRequest {
+	f.t.Helper()
+
+	authURL, err := url.Parse(started.AuthorizationURL)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	query := authURL.Query()
+	query.Set("login_hint", subject)
+	if edit != nil {
+		edit(query)
+	}
+	authURL.RawQuery = query.Encode()
+
+	resp, err := f.provider.Get(authURL.String())
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		f.t.Fatalf("authorizing: status %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != redirectURL {
+		f.t.Fatalf("redirected to %s, want %s", got, redirectURL)
+	}
+	return models.OIDCCallbackRequest{
+		Code:      location.Query().Get("code"),
+		State:     location.Query().Get("state"),
+		FlowToken: started.FlowToken,
+	}
+}
+
+// login runs a whole login as subject
+func (f *flowTest) login(subject string) models.AuthResponse {
+	f.t.Helper()
+
+	var auth models.AuthResponse
+	callback := f.authorize(f.start(""), subject, nil)
+	if status := f.post("/auth/oidc/callback", "", callback, &auth); status != http.StatusOK {
+		f.t.Fatalf("logging in as %s: status %d", subject, status)
+	}
+	return auth
+}
+
+func TestLogin(t *testing.T) {
+	f := newFlowTest(t)
+
+	first := f.login("carol")
+	if first.User.ID == 0 || first.User.Username != "carol" || first.Token == "" {
+		t.Fatalf("first login signed in %+v", first.User)
+	}
+	identities, err := f.store.GetIdentities(t.Context(), first.User.ID)
+	if err != nil || len(identities) != 1 || identities[0].Subject != "carol" {
+		t.Fatalf("identities after first login = %+v, %v", identities, err)
+	}
+
+	// The same subject comes back to the same account
+	second := f.login("carol")
+	if second.User.ID != first.User.ID {
+		t.Errorf("second login signed in user %d, want %d", second.User.ID, first.User.ID)
+	}
+
+	// Another subject gets another account
+	other := f.login("dave")
+	if other.User.ID == first.User.ID {
+		t.Errorf("another subject signed in user %d too", other.User.ID)
+	}
+}
+
+func TestLoginNameTaken(t *testing.T) {
+	f := newFlowTest(t)
+
+	status := f.post("/auth/register", "", map[string]string{
+		"username": "carol",
+		"password": "Correct-Horse-9-Battery",
+	}, nil)
+	if status != http.StatusCreated {
+		t.Fatalf("registering: status %d", status)
+	}
+
+	// A password account with the same name is not signed into
+	auth := f.login("carol")
+	if auth.User.Username != "carol-2" {
+		t.Errorf("signed in as %q, want carol-2", auth.User.Username)
+	}
+}
+
+func TestCallbackRefused(t *testing.T) {
+	tests := []struct {
+		name string
+		// edit changes the authorization request sent to the stub
+		edit func(url.Values)
+		// tamper changes the callback request sent to the API
+		tamper     func(*models.OIDCCallbackRequest)
+		wantStatus int
+	}{
+		{
+			name:       "state mismatch",
+			tamper:     func(req *models.OIDCCallbackRequest) { req.State = "someone-elses-state" },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "nonce mismatch",
+			edit:       func(query url.Values) { query.Set("nonce", "someone-elses-nonce") },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "PKCE challenge mismatch",
+			edit: func(query url.Values) {
+				query.Set("code_challenge", oidc.CodeChallenge("someone-elses-verifier"))
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown code",
+			tamper:     func(req *models.OIDCCallbackRequest) { req.Code = "made-up" },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid flow token",
+			tamper:     func(req *models.OIDCCallbackRequest) { req.FlowToken = "not-a-token" },
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFlowTest(t)
+
+			callback := f.authorize(f.start(""), "carol", tt.edit)
+			if tt.tamper != nil {
+				tt.tamper(&callback)
+			}
+			if status := f.post("/auth/oidc/callback", "", callback, nil); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+
+			if _, err := f.store.GetUserByUsername(t.Context(), "carol"); err == nil {
+				t.Error("a refused login created a user")
+			}
+		})
+	}
+}
+
+func TestCodeSingleUse(t *testing.T) {
+	f := newFlowTest(t)
+
+	callback := f.authorize(f.start(""), "carol", nil)
+	if status := f.post("/auth/oidc/callback", "", callback, nil); status != http.StatusOK {
+		t.Fatalf("first use: status %d", status)
+	}
+	if status := f.post("/auth/oidc/callback", "", callback, nil); status != http.StatusUnauthorized {
+		t.Errorf("second use: status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestLink(t *testing.T) {
+	f := newFlowTest(t)
+	carol := f.login("carol")
+
+	var bob models.AuthResponse
+	status := f.post("/auth/register", "", map[string]string{
+		"username": "bob",
+		"password": "Correct-Horse-9-Battery",
+	}, &bob)
+	if status != http.StatusCreated {
+		t.Fatalf("registering: status %d", status)
+	}
+
+	// An identity already bound to carol's account can't be taken over
+	callback := f.authorize(f.start(bob.Token), "carol", nil)
+	if status := f.post("/auth/oidc/callback", "", callback, nil); status != http.StatusConflict {
+		t.Errorf("linking carol's identity: status %d, want %d", status, http.StatusConflict)
+	}
+	if again := f.login("carol"); again.User.ID != carol.User.ID {
+		t.Errorf("carol's identity signs in user %d, want %d", again.User.ID, carol.User.ID)
+	}
+
+	// A new one is linked, and signs bob in from then on
+	var identity models.UserIdentity
+	callback = f.authorize(f.start(bob.Token), "bobby", nil)
+	if status := f.post("/auth/oidc/callback", "", callback, &identity); status != http.StatusCreated {
+		t.Fatalf("linking: status %d", status)
+	}
+	if identity.UserID != bob.User.ID || identity.Subject != "bobby" {
+		t.Errorf("linked %+v", identity)
+	}
+	if auth := f.login("bobby"); auth.User.ID != bob.User.ID {
+		t.Errorf("linked identity signs in user %d, want %d", auth.User.ID, bob.User.ID)
+	}
+}
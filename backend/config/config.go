@@ -4,14 +4,42 @@ import (
 	"errors"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// Supported values for Config.DatabaseDriver
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 type Config struct {
-	Port        string
-	DatabaseURL string
-	JWTSecret   string
+	Port            string
+	DatabaseDriver  string
+	DatabaseURL     string
+	AutoMigrate     bool
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	TrashRetention  time.Duration
+	GrepTimeout     time.Duration
+	GrepMaxMatches  int
+	// OIDC is nil unless sign in with an OpenID Connect provider is set up
+	OIDC *OIDCConfig
+}
+
+// OIDCConfig describes the OpenID Connect provider users can sign in with
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
 }
 
 func LoadConfig() (*Config, error) {
@@ -31,14 +59,119 @@ func LoadConfig() (*Config, error) {
 		return nil, errors.New("DATABASE_URL environment variable is required")
 	}
 
+	// sqlite:// and file: URLs select the embedded SQLite backend, anything
+	// else is handed to pgx as a Postgres connection string
+	dbDriver := DriverPostgres
+	switch {
+	case strings.HasPrefix(dbURL, "sqlite://"):
+		dbDriver = DriverSQLite
+		dbURL = strings.TrimPrefix(dbURL, "sqlite://")
+	case strings.HasPrefix(dbURL, "file:"):
+		dbDriver = DriverSQLite
+	}
+
+	// Apply pending migrations on start. Defaults to on for SQLite so a
+	// laptop install works without running "migrate up" first.
+	autoMigrate := dbDriver == DriverSQLite
+	if autoMigrateStr := os.Getenv("AUTO_MIGRATE"); autoMigrateStr != "" {
+		autoMigrate, err = strconv.ParseBool(autoMigrateStr)
+		if err != nil {
+			return nil, errors.New("AUTO_MIGRATE must be true or false")
+		}
+	}
+
 	JWTsecret := os.Getenv("JWT_SECRET")
 	if JWTsecret == "" {
 		return nil, errors.New("JWT_SECRET environment variable is required")
 	}
 
+	// Access tokens are short lived and can't be revoked on their own, the
+	// refresh token of their session renews them until it goes unused for
+	// REFRESH_TOKEN_TTL_DAYS
+	accessTokenTTL := 15 * time.Minute
+	if ttlStr := os.Getenv("ACCESS_TOKEN_TTL_MINUTES"); ttlStr != "" {
+		minutes, err := strconv.Atoi(ttlStr)
+		if err != nil || minutes <= 0 {
+			return nil, errors.New("ACCESS_TOKEN_TTL_MINUTES must be a positive number of minutes")
+		}
+		accessTokenTTL = time.Duration(minutes) * time.Minute
+	}
+
+	refreshTokenTTL := 30 * 24 * time.Hour
+	if ttlStr := os.Getenv("REFRESH_TOKEN_TTL_DAYS"); ttlStr != "" {
+		days, err := strconv.Atoi(ttlStr)
+		if err != nil || days <= 0 {
+			return nil, errors.New("REFRESH_TOKEN_TTL_DAYS must be a positive number of days")
+		}
+		refreshTokenTTL = time.Duration(days) * 24 * time.Hour
+	}
+
+	// Trashed items are purged for good after this many days, 0 keeps them
+	// until they are purged by hand
+	trashRetention := 30 * 24 * time.Hour
+	if retentionStr := os.Getenv("TRASH_RETENTION_DAYS"); retentionStr != "" {
+		days, err := strconv.Atoi(retentionStr)
+		if err != nil || days < 0 {
+			return nil, errors.New("TRASH_RETENTION_DAYS must be a non-negative number of days")
+		}
+		trashRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	// Budget for one grep request, it stops and reports truncated results
+	// once either runs out
+	grepTimeout := 5 * time.Second
+	if timeoutStr := os.Getenv("GREP_TIMEOUT_SECONDS"); timeoutStr != "" {
+		seconds, err := strconv.Atoi(timeoutStr)
+		if err != nil || seconds <= 0 {
+			return nil, errors.New("GREP_TIMEOUT_SECONDS must be a positive number of seconds")
+		}
+		grepTimeout = time.Duration(seconds) * time.Second
+	}
+
+	grepMaxMatches := 1000
+	if maxStr := os.Getenv("GREP_MAX_MATCHES"); maxStr != "" {
+		grepMaxMatches, err = strconv.Atoi(maxStr)
+		if err != nil || grepMaxMatches <= 0 {
+			return nil, errors.New("GREP_MAX_MATCHES must be a positive number")
+		}
+	}
+
+	// Setting OIDC_ISSUER_URL turns on sign in with that provider. The
+	// redirect URL is the frontend page that hands the code to the API.
+	var oidcConfig *OIDCConfig
+	if issuerURL := os.Getenv("OIDC_ISSUER_URL"); issuerURL != "" {
+		oidcConfig = &OIDCConfig{
+			IssuerURL:    issuerURL,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+		}
+		if oidcConfig.ClientID == "" {
+			return nil, errors.New("OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set")
+		}
+		if oidcConfig.RedirectURL == "" {
+			return nil, errors.New("OIDC_REDIRECT_URL is required when OIDC_ISSUER_URL is set")
+		}
+		if len(oidcConfig.Scopes) == 0 {
+			oidcConfig.Scopes = []string{"openid", "profile", "email"}
+		}
+		if !slices.Contains(oidcConfig.Scopes, "openid") {
+			return nil, errors.New("OIDC_SCOPES must include openid")
+		}
+	}
+
 	return &Config{
-		Port:         port,
-		DatabaseURL: dbURL,
-		JWTSecret:    JWTsecret,
+		Port:            port,
+		DatabaseDriver:  dbDriver,
+		DatabaseURL:     dbURL,
+		AutoMigrate:     autoMigrate,
+		JWTSecret:       JWTsecret,
+		AccessTokenTTL:  accessTokenTTL,
+		RefreshTokenTTL: refreshTokenTTL,
+		TrashRetention:  trashRetention,
+		GrepTimeout:     grepTimeout,
+		GrepMaxMatches:  grepMaxMatches,
+		OIDC:            oidcConfig,
 	}, nil
 }
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/GHutch55/fragments/backend/api/v1/database"
 	"github.com/GHutch55/fragments/backend/api/v1/handlers"
 	"github.com/GHutch55/fragments/backend/api/v1/middleware"
+	"github.com/GHutch55/fragments/backend/api/v1/models"
+	"github.com/GHutch55/fragments/backend/api/v1/oidc"
 	"github.com/GHutch55/fragments/backend/config"
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
@@ -24,6 +28,55 @@ func main() {
 	}
 	log.Println("2. Config loaded successfully")
 
+	var store database.MigratingStore
+	if cfg.DatabaseDriver == config.DriverSQLite {
+		store, err = database.ConnectSQLite(cfg.DatabaseURL)
+	} else {
+		store, err = database.ConnectPostgres(cfg.DatabaseURL)
+	}
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer store.Close()
+	log.Printf("3. Database connected successfully (%s)", cfg.DatabaseDriver)
+
+	// "migrate up|down N|status" manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), store, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		applied, err := store.MigrateUp(context.Background())
+		if err != nil {
+			log.Fatalf("failed to apply migrations: %v", err)
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+	}
+
+	// Refuse to run against a schema written by a newer binary, or one
+	// that still has migrations to apply
+	pending, err := database.CheckSchemaVersion(context.Background(), store)
+	if err != nil {
+		log.Fatalf("schema check failed: %v", err)
+	}
+	if pending > 0 {
+		log.Fatalf("%d pending migration(s), run \"migrate up\" or set AUTO_MIGRATE=true", pending)
+	}
+	log.Println("4. Schema version verified")
+
+	// "logout USERNAME" revokes every token of a user and exits
+	if len(os.Args) > 1 && os.Args[1] == "logout" {
+		if err := runLogout(context.Background(), store, os.Args[2:]); err != nil {
+			log.Fatalf("logout: %v", err)
+		}
+		return
+	}
+
 	// JWT secret is required - fail fast if not provided
 	jwtSecret := cfg.JWTSecret
 	if jwtSecret == "" {
@@ -33,19 +86,30 @@ func main() {
 		log.Fatal("JWT_SECRET must be at least 32 characters long")
 	}
 
-	pool, err := database.Connect(cfg.DatabaseURL)
-	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
-	}
-	defer pool.Close()
-	log.Println("5. Database connected successfully")
-
 	// Create middleware and handlers
-	authMiddleware := middleware.NewAuthMiddleware(pool, jwtSecret)
-	userHandler := &handlers.UserHandler{DB: pool}
-	snippetHandler := &handlers.SnippetHandler{DB: pool}
-	folderHandler := &handlers.FolderHandler{DB: pool}
-	authHandler := handlers.NewAuthHandler(pool, authMiddleware)
+	authMiddleware := middleware.NewAuthMiddleware(store, store, store, jwtSecret, cfg.AccessTokenTTL)
+	userHandler := &handlers.UserHandler{DB: store}
+	snippetHandler := &handlers.SnippetHandler{DB: store, Folders: store}
+	folderHandler := &handlers.FolderHandler{DB: store, SavedSearches: store, Snippets: store}
+	revisionHandler := &handlers.RevisionHandler{DB: store, Snippets: store}
+	trashHandler := &handlers.TrashHandler{DB: store, Retention: cfg.TrashRetention}
+	tagHandler := &handlers.TagHandler{DB: store}
+	savedSearchHandler := &handlers.SavedSearchHandler{DB: store, Snippets: store}
+	grepHandler := &handlers.GrepHandler{DB: store, Timeout: cfg.GrepTimeout, MaxMatches: cfg.GrepMaxMatches}
+	suggestHandler := &handlers.SuggestHandler{DB: store}
+	apiTokenHandler := &handlers.APITokenHandler{DB: store, Folders: store}
+	authHandler := handlers.NewAuthHandler(store, store, store, authMiddleware, cfg.RefreshTokenTTL)
+	oidcHandler := &handlers.OIDCHandler{Auth: authHandler, Identities: store}
+	if cfg.OIDC != nil {
+		oidcHandler.Provider = oidc.NewProvider(oidc.Config{
+			IssuerURL:    cfg.OIDC.IssuerURL,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+		})
+		log.Printf("OpenID Connect sign in enabled (%s)", cfg.OIDC.IssuerURL)
+	}
 
 	r := chi.NewRouter()
 	r.Use(chimiddleware.Logger)
@@ -70,21 +134,49 @@ func main() {
 
 		// Auth routes with rate limiting
 		r.Route("/auth", func(r chi.Router) {
-			// Rate limit auth endpoints: 5 requests per minute per IP
-			r.Use(httprate.LimitByIP(5, 1*time.Minute))
-
-			r.Post("/register", authHandler.Register)
-			r.Post("/login", authHandler.Login)
+			// Refreshing takes a refresh token rather than a password, and
+			// every open tab does it when the access token expires, so it
+			// gets a looser limit than the rest
+			r.Group(func(r chi.Router) {
+				r.Use(httprate.LimitByIP(60, 1*time.Minute))
+				r.Post("/refresh", authHandler.Refresh)
+			})
 
-			// Protected auth routes (no rate limiting needed - already authenticated)
 			r.Group(func(r chi.Router) {
-				r.Use(authMiddleware.RequireAuth)
-				r.Get("/me", authHandler.Me)
-				r.Post("/change-password", authHandler.ChangePassword)
+				// Rate limit auth endpoints: 5 requests per minute per IP
+				r.Use(httprate.LimitByIP(5, 1*time.Minute))
+
+				r.Post("/register", authHandler.Register)
+				r.Post("/login", authHandler.Login)
+				r.Post("/logout", authHandler.Logout)
+				r.Post("/2fa/verify", authHandler.VerifyTwoFactor)
+				if oidcHandler.Provider != nil {
+					r.Post("/oidc/start", oidcHandler.StartLogin)
+					r.Post("/oidc/callback", oidcHandler.Callback)
+				}
+
+				// Protected auth routes (no rate limiting needed - already authenticated)
+				r.Group(func(r chi.Router) {
+					r.Use(authMiddleware.RequireAuth)
+					r.Get("/me", authHandler.Me)
+					r.Post("/change-password", authHandler.ChangePassword)
+					r.Get("/sessions", authHandler.GetSessions)
+					r.Delete("/sessions", authHandler.RevokeSessions)
+					r.Delete("/sessions/{id}", authHandler.RevokeSession)
+					r.Get("/2fa", authHandler.GetTwoFactor)
+					r.Post("/2fa/setup", authHandler.SetupTwoFactor)
+					r.Post("/2fa/confirm", authHandler.ConfirmTwoFactor)
+					r.Post("/2fa/disable", authHandler.DisableTwoFactor)
+					r.Get("/identities", oidcHandler.GetIdentities)
+					r.Delete("/identities/{id}", oidcHandler.DeleteIdentity)
+					if oidcHandler.Provider != nil {
+						r.Post("/oidc/link", oidcHandler.StartLink)
+					}
+				})
 			})
 		})
 
-		// Protected routes
+		// Protected routes, which only take access tokens
 		r.Group(func(r chi.Router) {
 			r.Use(authMiddleware.RequireAuth)
 
@@ -95,25 +187,115 @@ func main() {
 				r.Delete("/me", userHandler.DeleteCurrentUser)
 			})
 
-			// Snippet routes
-			r.Route("/snippets", func(r chi.Router) {
+			r.Route("/trash", func(r chi.Router) {
+				r.Get("/", trashHandler.GetTrash)
+				r.Delete("/", trashHandler.EmptyTrash)
+				r.Post("/snippets/{id}/restore", trashHandler.RestoreSnippet)
+				r.Delete("/snippets/{id}", trashHandler.PurgeSnippet)
+				r.Post("/folders/{id}/restore", trashHandler.RestoreFolder)
+				r.Delete("/folders/{id}", trashHandler.PurgeFolder)
+			})
+
+			// Personal API tokens can't be used to make more of themselves
+			r.Route("/tokens", func(r chi.Router) {
+				r.Post("/", apiTokenHandler.CreateAPIToken)
+				r.Get("/", apiTokenHandler.GetAPITokens)
+				r.Delete("/{id}", apiTokenHandler.DeleteAPIToken)
+			})
+		})
+
+		// Protected routes that personal API tokens with the right scopes can
+		// use too. Scopes are read for GET and write for anything else.
+		r.Route("/snippets", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.FolderTokenScopes(models.ScopeSnippetsRead, models.ScopeSnippetsWrite))
+				r.Use(authMiddleware.RequireAuth)
+
 				r.Post("/", snippetHandler.CreateSnippet)
 				r.Get("/{id}", snippetHandler.GetSnippet)
 				r.Get("/", snippetHandler.GetSnippets)
 				r.Delete("/{id}", snippetHandler.DeleteSnippet)
 				r.Put("/{id}", snippetHandler.UpdateSnippet)
+
+				r.Get("/{id}/revisions", revisionHandler.GetRevisions)
+				r.Get("/{id}/revisions/diff", revisionHandler.DiffRevisions)
+				r.Get("/{id}/revisions/{rev}", revisionHandler.GetRevision)
+				r.Post("/{id}/revisions/{rev}/restore", revisionHandler.RestoreRevision)
 			})
 
-			r.Route("/folders", func(r chi.Router) {
-				r.Post("/", folderHandler.CreateFolder)
-				r.Get("/{id}", folderHandler.GetFolder)
-				r.Get("/", folderHandler.GetFolders)
-				r.Delete("/{id}", folderHandler.DeleteFolder)
-				r.Put("/{id}", folderHandler.UpdateFolder)
+			// These look across every folder
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.TokenScopes(models.ScopeSnippetsRead, models.ScopeSnippetsWrite))
+				r.Use(authMiddleware.RequireAuth)
+
+				r.Get("/grep", grepHandler.GrepSnippets)
+				r.Get("/duplicates", snippetHandler.DuplicateSnippets)
+				r.Get("/{id}/similar", snippetHandler.SimilarSnippets)
 			})
 		})
+
+		r.Route("/folders", func(r chi.Router) {
+			r.Use(middleware.TokenScopes(models.ScopeSnippetsRead, models.ScopeFoldersWrite))
+			r.Use(authMiddleware.RequireAuth)
+
+			r.Post("/", folderHandler.CreateFolder)
+			r.Get("/tree", folderHandler.GetFolderTree)
+			r.Get("/{id}", folderHandler.GetFolder)
+			r.Get("/{id}/path", folderHandler.GetFolderPath)
+			r.Get("/", folderHandler.GetFolders)
+			r.Delete("/{id}", folderHandler.DeleteFolder)
+			r.Put("/{id}", folderHandler.UpdateFolder)
+		})
+
+		r.Route("/tags", func(r chi.Router) {
+			r.Use(middleware.TokenScopes(models.ScopeSnippetsRead, models.ScopeSnippetsWrite))
+			r.Use(authMiddleware.RequireAuth)
+
+			r.Post("/", tagHandler.CreateTag)
+			r.Get("/", tagHandler.GetTags)
+			r.Delete("/unused", tagHandler.DeleteUnusedTags)
+			r.Get("/{id}", tagHandler.GetTag)
+			r.Put("/{id}", tagHandler.UpdateTag)
+			r.Delete("/{id}", tagHandler.DeleteTag)
+		})
+
+		r.Route("/saved-searches", func(r chi.Router) {
+			r.Use(middleware.TokenScopes(models.ScopeSnippetsRead, models.ScopeSnippetsWrite))
+			r.Use(authMiddleware.RequireAuth)
+
+			r.Post("/", savedSearchHandler.CreateSavedSearch)
+			r.Get("/", savedSearchHandler.GetSavedSearches)
+			r.Get("/{id}", savedSearchHandler.GetSavedSearch)
+			r.Put("/{id}", savedSearchHandler.UpdateSavedSearch)
+			r.Delete("/{id}", savedSearchHandler.DeleteSavedSearch)
+			r.Get("/{id}/snippets", savedSearchHandler.RunSavedSearch)
+		})
+
+		r.With(
+			middleware.TokenScopes(models.ScopeSnippetsRead, models.ScopeSnippetsWrite),
+			authMiddleware.RequireAuth,
+		).Get("/suggest", suggestHandler.Suggest)
 	})
 
+	// Tokenize identifiers, hash and sign content of snippets saved before
+	// search_tokens, content_hash and minhash existed. Until a snippet is
+	// reached it is still found by its whole words but not caught as a
+	// duplicate, and similarity lookups sign it on every request.
+	go func() {
+		ctx := context.Background()
+		runBackfill(ctx, "search tokens", store.BackfillSearchTokens)
+		runBackfill(ctx, "content hashes", store.BackfillContentHashes)
+		runBackfill(ctx, "minhash signatures", store.BackfillMinHashes)
+	}()
+
+	// Purge expired trash in the background, TRASH_RETENTION_DAYS=0 turns it off
+	if cfg.TrashRetention > 0 {
+		go runTrashPurger(context.Background(), store, cfg.TrashRetention)
+	}
+
+	// Drop refresh tokens once they have expired
+	go runSessionPurger(context.Background(), store)
+
 	log.Printf("Starting server on port %s", cfg.Port)
 	err = http.ListenAndServe(":"+cfg.Port, r)
 	if err != nil {
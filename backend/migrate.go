@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+)
+
+const migrateUsage = `usage:
+  migrate up        apply all pending migrations
+  migrate down N    roll back the N most recent migrations
+  migrate status    list migrations and whether they are applied`
+
+// runMigrate implements the migrate subcommand
+func runMigrate(ctx context.Context, m database.Migrator, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+
+		applied, err := m.MigrateUp(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied  %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+
+	case "down":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+
+		steps, err := strconv.Atoi(args[1])
+		if err != nil || steps <= 0 {
+			return fmt.Errorf("invalid number of migrations %q", args[1])
+		}
+
+		reverted, err := m.MigrateDown(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to roll back")
+		}
+
+	case "status":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+
+		statuses, err := m.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", ""
+			if status.Applied {
+				state = "applied"
+				appliedAt = status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			if status.Unknown {
+				state = "unknown (newer binary)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
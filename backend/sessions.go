@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+)
+
+const logoutUsage = `usage:
+  logout USERNAME   revoke every token and session of the user`
+
+// sessionPurgeInterval is how often runSessionPurger looks for expired tokens
+const sessionPurgeInterval = time.Hour
+
+// runSessionPurger deletes expired refresh tokens, once on start and then
+// every sessionPurgeInterval until ctx is cancelled
+func runSessionPurger(ctx context.Context, store database.SessionStore) {
+	ticker := time.NewTicker(sessionPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := store.PurgeSessions(ctx, time.Now())
+		if err != nil {
+			log.Printf("failed to purge sessions: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d expired refresh token(s)", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runLogout implements the logout subcommand, signing a user out of every
+// device at once
+func runLogout(ctx context.Context, users database.UserStore, args []string) error {
+	if len(args) != 1 {
+		return errors.New(logoutUsage)
+	}
+
+	user, err := users.GetUserByUsername(ctx, args[0])
+	if err != nil {
+		if errors.Is(err, database.ErrDatabaseError) {
+			return err
+		}
+		return fmt.Errorf("no user %q", args[0])
+	}
+
+	if err := users.RevokeUserTokens(ctx, user.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked all tokens of %s\n", user.Username)
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/GHutch55/fragments/backend/api/v1/database"
+)
+
+// trashPurgeInterval is how often runTrashPurger looks for expired items
+const trashPurgeInterval = time.Hour
+
+// runTrashPurger permanently deletes items that have been in the trash for
+// longer than retention, once on start and then every trashPurgeInterval
+// until ctx is cancelled
+func runTrashPurger(ctx context.Context, store database.TrashStore, retention time.Duration) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := store.PurgeTrash(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("failed to purge trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d expired trash item(s)", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
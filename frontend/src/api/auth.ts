@@ -1,11 +1,17 @@
-import { apiRequest } from "./client";
+import { apiRequest, tokenStorage } from "./client";
 import type {
   AuthResponse,
   ApiSuccess,
   PublicUser,
   RegisterInput,
   LoginInput,
+  LoginResponse,
   ChangePasswordInput,
+  ChangePasswordResponse,
+  Session,
+  TokenResponse,
+  TwoFactorSetup,
+  TwoFactorStatus,
 } from "./types";
 
 export const authAPI = {
@@ -16,40 +22,128 @@ export const authAPI = {
     });
   },
 
-  login: async (data: LoginInput): Promise<AuthResponse> => {
-    return apiRequest<AuthResponse>("/auth/login", {
+  login: async (data: LoginInput): Promise<LoginResponse> => {
+    return apiRequest<LoginResponse>("/auth/login", {
       method: "POST",
       body: JSON.stringify(data),
     });
   },
 
+  // Finishes a login that answered with a two-factor challenge, code is from
+  // the authenticator app or a recovery code
+  verifyTwoFactor: async (
+    challengeToken: string,
+    code: string,
+  ): Promise<AuthResponse> => {
+    return apiRequest<AuthResponse>("/auth/2fa/verify", {
+      method: "POST",
+      body: JSON.stringify({ challenge_token: challengeToken, code }),
+    });
+  },
+
+  getTwoFactor: async (): Promise<TwoFactorStatus> => {
+    return apiRequest<TwoFactorStatus>("/auth/2fa");
+  },
+
+  setupTwoFactor: async (): Promise<TwoFactorSetup> => {
+    return apiRequest<TwoFactorSetup>("/auth/2fa/setup", {
+      method: "POST",
+    });
+  },
+
+  // Recovery codes are only ever returned here
+  confirmTwoFactor: async (
+    code: string,
+  ): Promise<{ recovery_codes: string[] }> => {
+    return apiRequest<{ recovery_codes: string[] }>("/auth/2fa/confirm", {
+      method: "POST",
+      body: JSON.stringify({ code }),
+    });
+  },
+
+  // Users without a password confirm with a current code instead, a setup
+  // that was never confirmed is cancelled with neither
+  disableTwoFactor: async (
+    password: string,
+    code?: string,
+  ): Promise<ApiSuccess> => {
+    return apiRequest<ApiSuccess>("/auth/2fa/disable", {
+      method: "POST",
+      body: JSON.stringify(password ? { password } : { code }),
+    });
+  },
+
+  refresh: async (refreshToken: string): Promise<TokenResponse> => {
+    return apiRequest<TokenResponse>("/auth/refresh", {
+      method: "POST",
+      body: JSON.stringify({ refresh_token: refreshToken }),
+    });
+  },
+
+  logout: async (refreshToken: string): Promise<ApiSuccess> => {
+    return apiRequest<ApiSuccess>("/auth/logout", {
+      method: "POST",
+      body: JSON.stringify({ refresh_token: refreshToken }),
+    });
+  },
+
+  getSessions: async (): Promise<Session[]> => {
+    const response = await apiRequest<{ data: Session[] }>("/auth/sessions");
+    return response.data;
+  },
+
+  revokeSession: async (id: number): Promise<ApiSuccess> => {
+    return apiRequest<ApiSuccess>(`/auth/sessions/${id}`, {
+      method: "DELETE",
+    });
+  },
+
+  revokeOtherSessions: async (): Promise<{ revoked: number }> => {
+    return apiRequest<{ revoked: number }>("/auth/sessions", {
+      method: "DELETE",
+    });
+  },
+
   getMe: async (): Promise<PublicUser> => {
     return apiRequest<PublicUser>("/auth/me");
   },
 
-  changePassword: async (data: ChangePasswordInput): Promise<ApiSuccess> => {
-    return apiRequest<ApiSuccess>("/auth/change-password", {
-      method: "PUT",
-      body: JSON.stringify(data),
-    });
+  // Every other session is signed out, this one carries on with new tokens
+  changePassword: async (
+    data: ChangePasswordInput,
+  ): Promise<ChangePasswordResponse> => {
+    const response = await apiRequest<ChangePasswordResponse>(
+      "/auth/change-password",
+      {
+        method: "POST",
+        body: JSON.stringify(data),
+      },
+    );
+    tokenStorage.set(response);
+    return response;
   },
 };
 
 export const authHelpers = {
-  setToken: (token: string): void => {
-    localStorage.setItem("authToken", token);
+  setTokens: (tokens: TokenResponse): void => {
+    tokenStorage.set(tokens);
   },
 
   removeToken: (): void => {
-    localStorage.removeItem("authToken");
+    tokenStorage.clear();
   },
 
   isAuthenticated: (): boolean => {
-    return !!localStorage.getItem("authToken");
+    return !!tokenStorage.getAccessToken();
   },
 
-  logout: (): void => {
-    localStorage.removeItem("authToken");
+  logout: async (): Promise<void> => {
+    const refreshToken = tokenStorage.getRefreshToken();
+    if (refreshToken) {
+      // Signing out on the server is best effort, the tokens go either way
+      await authAPI.logout(refreshToken).catch(() => undefined);
+    }
+    tokenStorage.clear();
     window.location.href = "/login";
   },
 };
@@ -1,15 +1,73 @@
+import type { TokenResponse } from "./types";
+
 const API_BASE_URL = import.meta.env.VITE_API_URL || "http://localhost:8080/api/v1";
 
-const getAuthToken = (): string | null => {
-  return localStorage.getItem("authToken");
+export const tokenStorage = {
+  getAccessToken: (): string | null => localStorage.getItem("authToken"),
+
+  getRefreshToken: (): string | null => localStorage.getItem("refreshToken"),
+
+  set: (tokens: TokenResponse): void => {
+    localStorage.setItem("authToken", tokens.token);
+    localStorage.setItem("refreshToken", tokens.refresh_token);
+  },
+
+  clear: (): void => {
+    localStorage.removeItem("authToken");
+    localStorage.removeItem("refreshToken");
+  },
+};
+
+// Endpoints that answer 401 for bad credentials rather than an expired token
+const NO_REFRESH_ENDPOINTS = [
+  "/auth/login",
+  "/auth/register",
+  "/auth/refresh",
+  "/auth/logout",
+  "/auth/change-password",
+  "/auth/2fa/verify",
+  "/auth/2fa/disable",
+  "/auth/oidc/callback",
+];
+
+// Refresh tokens only work once, so concurrent requests that all hit an
+// expired access token share one refresh rather than racing each other
+let refreshing: Promise<boolean> | null = null;
+
+const refreshTokens = (): Promise<boolean> => {
+  const refreshToken = tokenStorage.getRefreshToken();
+  if (!refreshToken) {
+    return Promise.resolve(false);
+  }
+
+  refreshing ??= fetch(`${API_BASE_URL}/auth/refresh`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ refresh_token: refreshToken }),
+  })
+    .then(async (response) => {
+      if (!response.ok) {
+        tokenStorage.clear();
+        return false;
+      }
+      tokenStorage.set((await response.json()) as TokenResponse);
+      return true;
+    })
+    .catch(() => false)
+    .finally(() => {
+      refreshing = null;
+    });
+
+  return refreshing;
 };
 
 export async function apiRequest<T>(
   endpoint: string,
   options: RequestInit = {},
+  retry = true,
 ): Promise<T> {
   const url = `${API_BASE_URL}${endpoint}`;
-  const token = getAuthToken();
+  const token = tokenStorage.getAccessToken();
 
   const config: RequestInit = {
     headers: {
@@ -26,6 +84,17 @@ export async function apiRequest<T>(
 
   const response = await fetch(url, config);
 
+  // An expired access token is renewed once and the request sent again
+  if (
+    response.status === 401 &&
+    token &&
+    retry &&
+    !NO_REFRESH_ENDPOINTS.includes(endpoint) &&
+    (await refreshTokens())
+  ) {
+    return apiRequest<T>(endpoint, options, false);
+  }
+
   if (response.status === 204) {
     return { success: true } as T;
   }
@@ -3,5 +3,9 @@ export * from "./users";
 export * from "./snippets";
 export * from "./folders";
 export * from "./tags";
+export * from "./savedSearches";
+export * from "./suggest";
+export * from "./tokens";
+export * from "./oidc";
 
 export type * from "./types";
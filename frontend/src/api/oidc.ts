@@ -0,0 +1,74 @@
+import { apiRequest } from "./client";
+import type {
+  ApiSuccess,
+  LoginResponse,
+  OIDCStart,
+  UserIdentity,
+} from "./types";
+
+// The flow token has to survive the round trip through the provider
+const FLOW_TOKEN_KEY = "oidcFlowToken";
+
+const redirectToProvider = (start: OIDCStart): void => {
+  sessionStorage.setItem(FLOW_TOKEN_KEY, start.flow_token);
+  window.location.assign(start.authorization_url);
+};
+
+export const oidcAPI = {
+  // Sends the browser to the identity provider to sign in
+  start: async (deviceName?: string): Promise<void> => {
+    const start = await apiRequest<OIDCStart>("/auth/oidc/start", {
+      method: "POST",
+      body: JSON.stringify({ device_name: deviceName }),
+    });
+    redirectToProvider(start);
+  },
+
+  // Sends the browser to the identity provider to link it to this account
+  link: async (): Promise<void> => {
+    const start = await apiRequest<OIDCStart>("/auth/oidc/link", {
+      method: "POST",
+    });
+    redirectToProvider(start);
+  },
+
+  // Finishes a sign in or link with the query the provider redirected back
+  // with. A sign in answers like login, a link with the new identity.
+  callback: async (
+    search: string,
+  ): Promise<LoginResponse | UserIdentity> => {
+    const params = new URLSearchParams(search);
+    const flowToken = sessionStorage.getItem(FLOW_TOKEN_KEY);
+    sessionStorage.removeItem(FLOW_TOKEN_KEY);
+
+    const providerError = params.get("error");
+    if (providerError) {
+      throw new Error(params.get("error_description") || providerError);
+    }
+    if (!flowToken) {
+      throw new Error("Sign in was not started from this browser");
+    }
+
+    return apiRequest<LoginResponse | UserIdentity>("/auth/oidc/callback", {
+      method: "POST",
+      body: JSON.stringify({
+        code: params.get("code") ?? "",
+        state: params.get("state") ?? "",
+        flow_token: flowToken,
+      }),
+    });
+  },
+
+  getIdentities: async (): Promise<UserIdentity[]> => {
+    const response = await apiRequest<{ data: UserIdentity[] }>(
+      "/auth/identities",
+    );
+    return response.data;
+  },
+
+  unlink: async (id: number): Promise<ApiSuccess> => {
+    return apiRequest<ApiSuccess>(`/auth/identities/${id}`, {
+      method: "DELETE",
+    });
+  },
+};
@@ -0,0 +1,62 @@
+import { apiRequest } from "./client";
+import type {
+  SavedSearch,
+  Snippet,
+  Paginated,
+  ApiSuccess,
+  CreateSavedSearchInput,
+  UpdateSavedSearchInput,
+} from "./types";
+
+export const savedSearchesAPI = {
+  create: async (data: CreateSavedSearchInput): Promise<SavedSearch> => {
+    return apiRequest<SavedSearch>("/saved-searches", {
+      method: "POST",
+      body: JSON.stringify(data),
+    });
+  },
+
+  getAll: async (): Promise<SavedSearch[]> => {
+    const response = await apiRequest<{ data: SavedSearch[] }>(
+      "/saved-searches",
+    );
+    return response.data;
+  },
+
+  getById: async (id: number): Promise<SavedSearch> => {
+    return apiRequest<SavedSearch>(`/saved-searches/${id}`);
+  },
+
+  update: async (
+    id: number,
+    data: UpdateSavedSearchInput,
+  ): Promise<SavedSearch> => {
+    return apiRequest<SavedSearch>(`/saved-searches/${id}`, {
+      method: "PUT",
+      body: JSON.stringify(data),
+    });
+  },
+
+  delete: async (id: number): Promise<ApiSuccess> => {
+    return apiRequest<ApiSuccess>(`/saved-searches/${id}`, {
+      method: "DELETE",
+    });
+  },
+
+  run: async (
+    id: number,
+    params: { page?: string; limit?: string } = {},
+  ): Promise<Paginated<Snippet>> => {
+    const searchParams = new URLSearchParams();
+
+    if (params.page) searchParams.append("page", params.page);
+    if (params.limit) searchParams.append("limit", params.limit);
+
+    const queryString = searchParams.toString();
+    const endpoint = queryString
+      ? `/saved-searches/${id}/snippets?${queryString}`
+      : `/saved-searches/${id}/snippets`;
+
+    return apiRequest<Paginated<Snippet>>(endpoint);
+  },
+};
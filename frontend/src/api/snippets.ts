@@ -5,24 +5,38 @@ import type {
   ApiSuccess,
   CreateSnippetInput,
   UpdateSnippetInput,
+  SnippetFacet,
+  SimilarSnippet,
+  DuplicateCluster,
 } from "./types";
 
 export const snippetsAPI = {
-  create: async (data: CreateSnippetInput): Promise<Snippet> => {
-    return apiRequest<Snippet>("/snippets", {
+  create: async (
+    data: CreateSnippetInput,
+    allowDuplicate = false,
+  ): Promise<Snippet> => {
+    const query = allowDuplicate ? "?allow_duplicate=true" : "";
+    return apiRequest<Snippet>(`/snippets${query}`, {
       method: "POST",
       body: JSON.stringify(data),
     });
   },
 
   getAll: async (
-    params: { page?: string; limit?: string; search?: string } = {},
+    params: {
+      page?: string;
+      limit?: string;
+      search?: string;
+      facets?: SnippetFacet[];
+    } = {},
   ): Promise<Paginated<Snippet>> => {
     const searchParams = new URLSearchParams();
 
     if (params.page) searchParams.append("page", params.page);
     if (params.limit) searchParams.append("limit", params.limit);
     if (params.search) searchParams.append("search", params.search);
+    if (params.facets?.length)
+      searchParams.append("facets", params.facets.join(","));
 
     const queryString = searchParams.toString();
     const endpoint = queryString ? `/snippets?${queryString}` : "/snippets";
@@ -34,8 +48,13 @@ export const snippetsAPI = {
     return apiRequest<Snippet>(`/snippets/${id}`);
   },
 
-  update: async (id: number, data: UpdateSnippetInput): Promise<Snippet> => {
-    return apiRequest<Snippet>(`/snippets/${id}`, {
+  update: async (
+    id: number,
+    data: UpdateSnippetInput,
+    allowDuplicate = false,
+  ): Promise<Snippet> => {
+    const query = allowDuplicate ? "?allow_duplicate=true" : "";
+    return apiRequest<Snippet>(`/snippets/${id}${query}`, {
       method: "PUT",
       body: JSON.stringify(data),
     });
@@ -46,4 +65,20 @@ export const snippetsAPI = {
       method: "DELETE",
     });
   },
+
+  getSimilar: async (id: number, limit?: number): Promise<SimilarSnippet[]> => {
+    const query = limit ? `?limit=${limit}` : "";
+    const response = await apiRequest<{ data: SimilarSnippet[] }>(
+      `/snippets/${id}/similar${query}`,
+    );
+    return response.data;
+  },
+
+  getDuplicates: async (minSimilarity?: number): Promise<DuplicateCluster[]> => {
+    const query = minSimilarity ? `?min_similarity=${minSimilarity}` : "";
+    const response = await apiRequest<{ data: DuplicateCluster[] }>(
+      `/snippets/duplicates${query}`,
+    );
+    return response.data;
+  },
 };
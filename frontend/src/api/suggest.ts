@@ -0,0 +1,14 @@
+import { apiRequest } from "./client";
+import type { Suggestions } from "./types";
+
+export const suggestAPI = {
+  get: async (q: string, limit?: number): Promise<Suggestions> => {
+    const searchParams = new URLSearchParams({ q });
+    if (limit) searchParams.append("limit", String(limit));
+
+    const response = await apiRequest<{ data: Suggestions }>(
+      `/suggest?${searchParams.toString()}`,
+    );
+    return response.data;
+  },
+};
@@ -10,7 +10,8 @@ export const tagsAPI = {
   },
 
   getAll: async (): Promise<Tag[]> => {
-    return apiRequest<Tag[]>("/tags");
+    const response = await apiRequest<{ data: Tag[] }>("/tags");
+    return response.data;
   },
 
   getById: async (id: number): Promise<Tag> => {
@@ -29,4 +30,10 @@ export const tagsAPI = {
       method: "DELETE",
     });
   },
+
+  deleteUnused: async (): Promise<{ deleted: number }> => {
+    return apiRequest<{ deleted: number }>("/tags/unused", {
+      method: "DELETE",
+    });
+  },
 };
@@ -0,0 +1,27 @@
+import { apiRequest } from "./client";
+import type {
+  APIToken,
+  ApiSuccess,
+  CreateAPITokenInput,
+  CreatedAPIToken,
+} from "./types";
+
+export const tokensAPI = {
+  create: async (data: CreateAPITokenInput): Promise<CreatedAPIToken> => {
+    return apiRequest<CreatedAPIToken>("/tokens", {
+      method: "POST",
+      body: JSON.stringify(data),
+    });
+  },
+
+  getAll: async (): Promise<APIToken[]> => {
+    const response = await apiRequest<{ data: APIToken[] }>("/tokens");
+    return response.data;
+  },
+
+  revoke: async (id: number): Promise<ApiSuccess> => {
+    return apiRequest<ApiSuccess>(`/tokens/${id}`, {
+      method: "DELETE",
+    });
+  },
+};
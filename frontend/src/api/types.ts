@@ -7,11 +7,94 @@ export interface User {
 
 export type PublicUser = Omit<User, "password_hash">;
 
-export interface AuthResponse {
+export interface TokenResponse {
   token: string;
+  refresh_token: string;
+  expires_in: number;
+}
+
+export interface ChangePasswordResponse extends TokenResponse {
+  message: string;
+}
+
+export interface AuthResponse extends TokenResponse {
   user: PublicUser;
 }
 
+// A login for a user with two-factor on gets a challenge instead of tokens,
+// answered with a code at /auth/2fa/verify
+export interface TwoFactorChallenge {
+  two_factor_required: true;
+  challenge_token: string;
+  expires_in: number;
+}
+
+export type LoginResponse = AuthResponse | TwoFactorChallenge;
+
+export interface TwoFactorStatus {
+  enabled: boolean;
+  enabled_at?: string;
+  recovery_codes_remaining: number;
+}
+
+export interface TwoFactorSetup {
+  secret: string;
+  otpauth_uri: string;
+}
+
+export interface Session {
+  id: number;
+  user_id: number;
+  device: string;
+  ip_address: string;
+  signed_in_at: string;
+  last_used_at: string;
+  expires_at: string;
+  current: boolean;
+}
+
+// An account at the OpenID Connect provider linked to the user
+export interface UserIdentity {
+  id: number;
+  user_id: number;
+  issuer: string;
+  subject: string;
+  email?: string;
+  created_at: string;
+}
+
+export interface OIDCStart {
+  authorization_url: string;
+  flow_token: string;
+  expires_in: number;
+}
+
+export type APITokenScope = "snippets:read" | "snippets:write" | "folders:write";
+
+export interface APIToken {
+  id: number;
+  user_id: number;
+  name: string;
+  prefix: string;
+  scopes: APITokenScope[];
+  folder_id?: number;
+  expires_at: string;
+  last_used_at: string | null;
+  created_at: string;
+}
+
+// The token itself is only returned when it is created
+export interface CreatedAPIToken extends APIToken {
+  token: string;
+}
+
+export interface CreateAPITokenInput {
+  name: string;
+  scopes: APITokenScope[];
+  folder_id?: number;
+  expires_in_days?: number;
+}
+
 export interface Folder {
   id: number;
   user_id: number;
@@ -33,6 +116,22 @@ export interface Snippet {
   tags?: string[];
   created_at: string;
   updated_at: string;
+  search_hit?: SearchHit;
+}
+
+export type SearchField = "title" | "description" | "content";
+
+export interface SearchHit {
+  fields: SearchField[];
+  lines: number[];
+  excerpts: SearchExcerpt[];
+}
+
+export interface SearchExcerpt {
+  field: SearchField;
+  line?: number;
+  text: string;
+  highlights: { start: number; end: number }[];
 }
 
 export interface Tag {
@@ -41,6 +140,58 @@ export interface Tag {
   name: string;
   color?: string | null;
   created_at: string;
+  snippet_count: number;
+}
+
+export interface SavedSearchFilters {
+  mode?: "hybrid" | "fulltext" | "substring";
+  language?: string;
+  folder_id?: number;
+  recursive?: boolean;
+  tags?: string[];
+  tag_mode?: "any" | "all";
+  is_favorite?: boolean;
+  created_after?: string;
+  created_before?: string;
+  updated_after?: string;
+  updated_before?: string;
+  sort?: "title" | "created_at" | "updated_at";
+  order?: "asc" | "desc";
+}
+
+export interface SavedSearch {
+  id: number;
+  user_id: number;
+  name: string;
+  query: string;
+  filters: SavedSearchFilters;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface SimilarSnippet {
+  id: number;
+  title: string;
+  folder_id: number | null;
+  language: string;
+  similarity: number;
+}
+
+export interface DuplicateCluster {
+  snippets: SimilarSnippet[];
+}
+
+export interface Suggestion {
+  id?: number;
+  value: string;
+  count?: number;
+}
+
+export interface Suggestions {
+  snippets: Suggestion[];
+  tags: Suggestion[];
+  folders: Suggestion[];
+  languages: Suggestion[];
 }
 
 export interface SnippetTag {
@@ -53,8 +204,21 @@ export interface Paginated<T> {
   total: number;
   page: number;
   limit: number;
+  meta?: {
+    facets?: SnippetFacets;
+  };
+}
+
+export interface FacetCount {
+  value: string;
+  folder_id?: number;
+  count: number;
 }
 
+export type SnippetFacet = "language" | "tag" | "folder";
+
+export type SnippetFacets = Partial<Record<SnippetFacet, FacetCount[]>>;
+
 export interface ApiSuccess {
   success: true;
 }
@@ -64,16 +228,22 @@ export interface RegisterInput {
   username: string;
   password: string;
   display_name?: string | null;
+  device_name?: string;
 }
 
 export interface LoginInput {
   username: string;
   password: string;
+  device_name?: string;
 }
 
 export interface ChangePasswordInput {
+  // Left empty by users who only sign in with an identity provider, who give
+  // a two-factor code instead if they have it on, or else must have just
+  // signed in
   current_password: string;
   new_password: string;
+  code?: string;
 }
 
 // Users
@@ -124,3 +294,16 @@ export interface UpdateTagInput {
   name?: string;
   color?: string | null;
 }
+
+// Saved searches
+export interface CreateSavedSearchInput {
+  name: string;
+  query?: string;
+  filters?: SavedSearchFilters;
+}
+
+export interface UpdateSavedSearchInput {
+  name?: string;
+  query?: string;
+  filters?: SavedSearchFilters;
+}
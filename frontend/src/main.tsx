@@ -7,6 +7,7 @@ import { LoginForm } from "./pages/login.tsx";
 import { FileTreeProvider } from "./hooks/fileTreeProvider.tsx";
 import { Dashboard } from "./pages/dashboard.tsx";
 import { EditorPage } from "./pages/editor.tsx";
+import { OIDCCallback } from "./pages/oidcCallback.tsx";
 
 ReactDOM.createRoot(document.getElementById("root")!).render(
   <React.StrictMode>
@@ -16,6 +17,7 @@ ReactDOM.createRoot(document.getElementById("root")!).render(
           <Route path="/" element={<Navigate to="/login" replace />} />
           <Route path="/register" element={<RegisterForm />} />
           <Route path="/login" element={<LoginForm />} />
+          <Route path="/auth/oidc/callback" element={<OIDCCallback />} />
           <Route path="/editor" element={<EditorPage />} />
           <Route path="/editor/:id" element={<EditorPage />} />
           <Route path="/dashboard" element={<Dashboard />} />
@@ -1,6 +1,6 @@
 import { useState, useContext } from "react";
-import { authAPI } from "@/api";
-import { useNavigate } from "react-router-dom";
+import { authAPI, authHelpers, oidcAPI } from "@/api";
+import { useLocation, useNavigate } from "react-router-dom";
 import type { LoginInput } from "@/api";
 import { FileTreeContext } from "@/hooks/fileTreeContext";
 
@@ -17,12 +17,24 @@ import {
 } from "@/components/ui/card";
 import LogoFull from "@/assets/logoFull.svg";
 
+// Sign in with an identity provider, set when the API has OIDC configured
+const OIDC_ENABLED = import.meta.env.VITE_OIDC_ENABLED === "true";
+
 export function LoginForm() {
   const [form, setForm] = useState<LoginInput>({
     username: "",
     password: "",
   });
 
+  const location = useLocation();
+
+  // Set once the password is accepted for a user with two-factor on, or by
+  // an identity provider sign in that still needs the code
+  const [challengeToken, setChallengeToken] = useState<string | null>(
+    (location.state as { challengeToken?: string } | null)?.challengeToken ??
+      null,
+  );
+  const [code, setCode] = useState("");
   const [error, setError] = useState<string | null>(null);
   const [loading, setLoading] = useState(false);
   const navigate = useNavigate();
@@ -35,12 +47,21 @@ export function LoginForm() {
 
     try {
       setLoading(true);
-      const response = await authAPI.login({
-        username: form.username,
-        password: form.password,
-      });
+      let response;
+      if (challengeToken) {
+        response = await authAPI.verifyTwoFactor(challengeToken, code.trim());
+      } else {
+        response = await authAPI.login({
+          username: form.username,
+          password: form.password,
+        });
+        if ("two_factor_required" in response) {
+          setChallengeToken(response.challenge_token);
+          return;
+        }
+      }
 
-      localStorage.setItem("authToken", response.token);
+      authHelpers.setTokens(response);
 
       fileTree?.loadAll();
       navigate("/dashboard");
@@ -55,6 +76,17 @@ export function LoginForm() {
     }
   }
 
+  async function handleOIDC() {
+    setError(null);
+    try {
+      setLoading(true);
+      await oidcAPI.start();
+    } catch (err: unknown) {
+      setError(err instanceof Error ? err.message : "Sign in failed");
+      setLoading(false);
+    }
+  }
+
   return (
     <div className="flex flex-col justify-center items-center h-screen bg-background">
       <img src={LogoFull} alt="Logo" className="w-80 h-20 mb-8" />
@@ -73,32 +105,69 @@ export function LoginForm() {
 
         <CardContent>
           <form className="space-y-6" onSubmit={handleSubmit}>
-            <div className="space-y-2">
-              <Label htmlFor="username">Username *</Label>
-              <Input
-                id="username"
-                value={form.username}
-                onChange={(e) => setForm({ ...form, username: e.target.value })}
-                required
-              />
-            </div>
-
-            <div className="space-y-2">
-              <Label htmlFor="password">Password *</Label>
-              <Input
-                id="password"
-                type="password"
-                value={form.password}
-                onChange={(e) => setForm({ ...form, password: e.target.value })}
-                required
-              />
-            </div>
+            {challengeToken ? (
+              <div className="space-y-2">
+                <Label htmlFor="code">Two-factor code *</Label>
+                <Input
+                  id="code"
+                  autoComplete="one-time-code"
+                  placeholder="123456 or a recovery code"
+                  value={code}
+                  onChange={(e) => setCode(e.target.value)}
+                  autoFocus
+                  required
+                />
+              </div>
+            ) : (
+              <>
+                <div className="space-y-2">
+                  <Label htmlFor="username">Username *</Label>
+                  <Input
+                    id="username"
+                    value={form.username}
+                    onChange={(e) =>
+                      setForm({ ...form, username: e.target.value })
+                    }
+                    required
+                  />
+                </div>
+
+                <div className="space-y-2">
+                  <Label htmlFor="password">Password *</Label>
+                  <Input
+                    id="password"
+                    type="password"
+                    value={form.password}
+                    onChange={(e) =>
+                      setForm({ ...form, password: e.target.value })
+                    }
+                    required
+                  />
+                </div>
+              </>
+            )}
 
             {error && <p className="text-red-500 text-sm">{error}</p>}
 
             <Button type="submit" className="w-full" disabled={loading}>
-              {loading ? "Logging In..." : "Log In"}
+              {loading
+                ? "Logging In..."
+                : challengeToken
+                  ? "Verify"
+                  : "Log In"}
             </Button>
+
+            {OIDC_ENABLED && !challengeToken && (
+              <Button
+                type="button"
+                variant="outline"
+                className="w-full"
+                disabled={loading}
+                onClick={handleOIDC}
+              >
+                Sign in with single sign-on
+              </Button>
+            )}
           </form>
         </CardContent>
       </Card>
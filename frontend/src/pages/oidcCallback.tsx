@@ -0,0 +1,73 @@
+import { useContext, useEffect, useRef, useState } from "react";
+import { useLocation, useNavigate } from "react-router-dom";
+import { authHelpers, oidcAPI } from "@/api";
+import { FileTreeContext } from "@/hooks/fileTreeContext";
+
+import { Button } from "@/components/ui/button";
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardHeader,
+  CardTitle,
+} from "@/components/ui/card";
+import LogoFull from "@/assets/logoFull.svg";
+
+// Where the identity provider sends the browser back to, configured on the
+// API as OIDC_REDIRECT_URL
+export function OIDCCallback() {
+  const [error, setError] = useState<string | null>(null);
+  const location = useLocation();
+  const navigate = useNavigate();
+  const fileTree = useContext(FileTreeContext);
+
+  // The code only works once, StrictMode running the effect twice mustn't
+  // send it twice
+  const sent = useRef(false);
+
+  useEffect(() => {
+    if (sent.current) {
+      return;
+    }
+    sent.current = true;
+
+    oidcAPI
+      .callback(location.search)
+      .then((response) => {
+        if ("two_factor_required" in response) {
+          navigate("/login", {
+            replace: true,
+            state: { challengeToken: response.challenge_token },
+          });
+          return;
+        }
+        if ("token" in response) {
+          authHelpers.setTokens(response);
+          fileTree?.loadAll();
+        }
+        navigate("/dashboard", { replace: true });
+      })
+      .catch((err: unknown) => {
+        setError(err instanceof Error ? err.message : "Sign in failed");
+      });
+  }, [location.search, navigate, fileTree]);
+
+  return (
+    <div className="flex flex-col justify-center items-center h-screen bg-background">
+      <img src={LogoFull} alt="Logo" className="w-80 h-20 mb-8" />
+      <Card className="w-full max-w-md">
+        <CardHeader>
+          <CardTitle>{error ? "Sign in failed" : "Signing in..."}</CardTitle>
+          {error && <CardDescription>{error}</CardDescription>}
+        </CardHeader>
+        {error && (
+          <CardContent>
+            <Button className="w-full" onClick={() => navigate("/login")}>
+              Back to log in
+            </Button>
+          </CardContent>
+        )}
+      </Card>
+    </div>
+  );
+}
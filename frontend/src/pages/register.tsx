@@ -1,6 +1,6 @@
 import { useState } from "react";
 import { useNavigate } from "react-router-dom";
-import { authAPI } from "@/api";
+import { authAPI, authHelpers } from "@/api";
 import type { RegisterInput } from "@/api";
 
 import { Label } from "@/components/ui/label";
@@ -61,7 +61,7 @@ export function RegisterForm() {
         password: form.password,
       });
 
-      localStorage.setItem("authToken", response.token);
+      authHelpers.setTokens(response);
 
       navigate("/login");
     } catch (err: unknown) {